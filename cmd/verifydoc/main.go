@@ -0,0 +1,69 @@
+// main.go - Katzenpost voting authority document verification tool.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/katzenpost/authority/voting/pki"
+	"github.com/katzenpost/authority/voting/server/config"
+)
+
+type peersFile struct {
+	Authorities []*config.AuthorityPeer
+}
+
+func main() {
+	peersPath := flag.String("p", "peers.toml", "Path to the file containing the [[Authorities]] peer list.")
+	docPath := flag.String("d", "", "Path to the serialized consensus document.")
+	threshold := flag.Int("t", 0, "Number of peer signatures required, defaults to all of the peers.")
+	flag.Parse()
+
+	peers := new(peersFile)
+	if _, err := toml.DecodeFile(*peersPath, peers); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load peers file '%v': %v\n", *peersPath, err)
+		os.Exit(-1)
+	}
+	for _, v := range peers.Authorities {
+		if err := v.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid peer in '%v': %v\n", *peersPath, err)
+			os.Exit(-1)
+		}
+	}
+
+	doc, err := ioutil.ReadFile(*docPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read document '%v': %v\n", *docPath, err)
+		os.Exit(-1)
+	}
+
+	report := pki.VerifyDocumentSignatures(doc, peers.Authorities)
+	fmt.Print(report)
+	if *threshold == 0 {
+		*threshold = len(peers.Authorities)
+	}
+	d, err := pki.VerifyDocument(doc, peers.Authorities, *threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Document failed verification: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Document for epoch %v is signed by %d/%d peers.\n", d.Epoch, report.NumValid(), len(peers.Authorities))
+}
@@ -30,8 +30,24 @@ import (
 func main() {
 	cfgFile := flag.String("f", "katzenpost-authority.toml", "Path to the authority config file.")
 	genOnly := flag.Bool("g", false, "Generate the keys and exit immediately.")
+	keygen := flag.Bool("k", false, "Generate the identity key, print the public key and exit.")
+	nextKeygen := flag.Bool("n", false, "Generate the next identity key for a key rotation, print the public key and exit.")
+	validate := flag.Bool("validate", false, "Validate the config file, given as the argument or with -f, and exit.")
 	flag.Parse()
 
+	if *validate {
+		f := *cfgFile
+		if flag.NArg() > 0 {
+			f = flag.Arg(0)
+		}
+		if err := server.ValidateConfigFile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Config file '%v' is invalid: %v\n", f, err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Config file '%v' is valid.\n", f)
+		os.Exit(0)
+	}
+
 	// Set the umask to something "paranoid".
 	syscall.Umask(0077)
 
@@ -41,6 +57,25 @@ func main() {
 		os.Exit(-1)
 	}
 
+	if *keygen {
+		pk, err := server.GenerateKeys(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate the identity key: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println(pk)
+		os.Exit(0)
+	}
+	if *nextKeygen {
+		pk, err := server.GenerateNextKeys(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate the next identity key: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println(pk)
+		os.Exit(0)
+	}
+
 	// Setup the signal handling.
 	ch := make(chan os.Signal)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
@@ -52,6 +87,10 @@ func main() {
 	svr, err := server.New(cfg)
 	if err != nil {
 		if err == server.ErrGenerateOnly {
+			if err = server.WriteTopologyPlan(os.Stdout, cfg); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to plan the topology: %v\n", err)
+				os.Exit(-1)
+			}
 			os.Exit(0)
 		}
 		fmt.Fprintf(os.Stderr, "Failed to spawn authority instance: %v\n", err)
@@ -65,10 +104,17 @@ func main() {
 		svr.Shutdown()
 	}()
 
-	// Rotate server logs upon SIGHUP.
+	// Rotate server logs and reload the whitelist upon SIGHUP.
 	go func() {
-		<-rotateCh
-		svr.RotateLog()
+		for range rotateCh {
+			svr.RotateLog()
+			newCfg, err := config.LoadFile(*cfgFile, false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to reload config file '%v': %v\n", *cfgFile, err)
+				continue
+			}
+			svr.ReloadWhitelist(newCfg)
+		}
 	}()
 
 	// Wait for the authority to explode or be terminated.
@@ -1,6 +1,6 @@
 module github.com/katzenpost/authority
 
-go 1.12
+go 1.13
 
 require (
 	git.schwanenlied.me/yawning/chacha20 v0.0.0-20170904085104-e3b1f968fc63
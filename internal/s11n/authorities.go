@@ -0,0 +1,93 @@
+// authorities.go - Katzenpost consensus authority set.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package s11n
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/ugorji/go/codec"
+)
+
+// AuthorityEntry is a directory authority, as clients need to know it to
+// fetch and verify the consensus.
+//
+// In a vote, the entries are the authority itself and its configured
+// peers.  In a consensus, the entries are the ones a threshold of
+// authorities voted for with the same LinkKey and Addresses.
+type AuthorityEntry struct {
+	// IdentityKey is the authority's identity key.
+	IdentityKey []byte
+
+	// LinkKey is the authority's link layer key.
+	LinkKey []byte
+
+	// Addresses are the addresses the authority is reachable at.
+	Addresses []string
+}
+
+// SortAuthorities sorts the authority entries by identity key, as is
+// required for them to be serialized deterministically.
+func SortAuthorities(entries []*AuthorityEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].IdentityKey, entries[j].IdentityKey) < 0
+	})
+}
+
+// VerifyAndParseAuthorities verifies the signature of the document, and
+// returns the authority set it carries, which is empty for documents from
+// authorities that predate the field.
+func VerifyAndParseAuthorities(b []byte, verifier cert.Verifier) ([]*AuthorityEntry, error) {
+	payload, err := cert.Verify(verifier, b)
+	if err != nil {
+		return nil, err
+	}
+	d := new(Document)
+	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	if err = dec.Decode(d); err != nil {
+		return nil, err
+	}
+	if d.Version != DocumentVersion {
+		return nil, fmt.Errorf("Invalid Document Version: '%v'", d.Version)
+	}
+	if err = validateAuthorities(d.Authorities); err != nil {
+		return nil, fmt.Errorf("Document has invalid Authorities: %v", err)
+	}
+	return d.Authorities, nil
+}
+
+func validateAuthorities(entries []*AuthorityEntry) error {
+	for i, e := range entries {
+		if len(e.IdentityKey) != eddsa.PublicKeySize {
+			return fmt.Errorf("Authorities entry %d has invalid IdentityKey", i)
+		}
+		if len(e.LinkKey) != ecdh.PublicKeySize {
+			return fmt.Errorf("Authorities entry %d has invalid LinkKey", i)
+		}
+		if len(e.Addresses) == 0 {
+			return fmt.Errorf("Authorities entry %d has no Addresses", i)
+		}
+		if i > 0 && bytes.Compare(entries[i-1].IdentityKey, e.IdentityKey) >= 0 {
+			return fmt.Errorf("Authorities entry %d is out of order or duplicated", i)
+		}
+	}
+	return nil
+}
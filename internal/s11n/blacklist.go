@@ -0,0 +1,81 @@
+// blacklist.go - Katzenpost consensus node blacklist.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package s11n
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// BlacklistEntry is a node identity that clients must never route through,
+// regardless of where else it appears.
+//
+// In a vote, the entries are the ones the authority wants published.  In a
+// consensus, the entries are the ones a threshold of authorities voted for
+// with the same Until.  An entry ages out of the consensus once the epoch
+// reaches Until, or as soon as fewer than a threshold of authorities still
+// vote for it.
+type BlacklistEntry struct {
+	// IdentityKey is the node's identity key.
+	IdentityKey []byte
+
+	// Until is the first epoch the entry is no longer published for, or 0
+	// if the entry does not expire.
+	Until uint64 `codec:",omitempty"`
+}
+
+// IsExpired returns true iff the entry is not to be published for epoch.
+func (e *BlacklistEntry) IsExpired(epoch uint64) bool {
+	return e.Until != 0 && e.Until <= epoch
+}
+
+// IsBlacklisted returns true iff the identity key is listed in the
+// Document's blacklist.
+func (d *Document) IsBlacklisted(id *eddsa.PublicKey) bool {
+	for _, e := range d.Blacklist {
+		if bytes.Equal(e.IdentityKey, id.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// SortBlacklist sorts the blacklist entries by identity key, as is required
+// for them to be serialized deterministically.
+func SortBlacklist(entries []*BlacklistEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].IdentityKey, entries[j].IdentityKey) < 0
+	})
+}
+
+func validateBlacklist(entries []*BlacklistEntry, epoch uint64) error {
+	for i, e := range entries {
+		if len(e.IdentityKey) != eddsa.PublicKeySize {
+			return fmt.Errorf("Blacklist entry %d has invalid IdentityKey", i)
+		}
+		if e.IsExpired(epoch) {
+			return fmt.Errorf("Blacklist entry %d expired at epoch %v", i, e.Until)
+		}
+		if i > 0 && bytes.Compare(entries[i-1].IdentityKey, e.IdentityKey) >= 0 {
+			return fmt.Errorf("Blacklist entry %d is out of order or duplicated", i)
+		}
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/katzenpost/core/crypto/cert"
@@ -34,27 +35,87 @@ import (
 
 const (
 	nodeDescriptorVersion = "v0"
+
+	// SignatureAlgorithmEd25519 is the descriptor signature algorithm
+	// identifier for Ed25519, the algorithm assumed for descriptors that do
+	// not specify one.
+	SignatureAlgorithmEd25519 = "ed25519"
 )
 
 var (
 	// CertificateExpiration is the time a descriptor certificate will be valid for.
 	CertificateExpiration = (epochtime.Period * 3) + (time.Minute * 10)
+
+	signatureAlgorithmsLock sync.RWMutex
+	signatureAlgorithms     = map[string]DescriptorVerifierFunc{
+		SignatureAlgorithmEd25519: func(d *pki.MixDescriptor) (cert.Verifier, error) {
+			if d.IdentityKey == nil {
+				return nil, fmt.Errorf("Descriptor missing IdentityKey")
+			}
+			return d.IdentityKey, nil
+		},
+	}
 )
 
+// DescriptorVerifierFunc returns the verifier for a descriptor signed with a
+// given signature algorithm.
+type DescriptorVerifierFunc func(*pki.MixDescriptor) (cert.Verifier, error)
+
+// RegisterSignatureAlgorithm registers the verifier constructor for a
+// descriptor signature algorithm, so that descriptors signed with a newer
+// scheme can be verified during a migration.
+func RegisterSignatureAlgorithm(algorithm string, fn DescriptorVerifierFunc) {
+	signatureAlgorithmsLock.Lock()
+	defer signatureAlgorithmsLock.Unlock()
+	signatureAlgorithms[algorithm] = fn
+}
+
+// IsSignatureAlgorithmKnown returns true iff descriptors signed with the
+// given signature algorithm can be verified.
+func IsSignatureAlgorithmKnown(algorithm string) bool {
+	signatureAlgorithmsLock.RLock()
+	defer signatureAlgorithmsLock.RUnlock()
+	_, ok := signatureAlgorithms[algorithm]
+	return ok
+}
+
 type nodeDescriptor struct {
 	// Version uniquely identifies the descriptor format as being for the
 	// specified version so that it can be rejected if the format changes.
 	Version string
 
+	// ProofOfWork is the descriptor submission proof-of-work nonce, see
+	// VerifyProofOfWork.
+	ProofOfWork uint64 `codec:",omitempty"`
+
+	// Timestamp is the time the descriptor was signed at, in seconds since
+	// the Unix epoch, see GetTimestampFromDescriptor.
+	Timestamp int64 `codec:",omitempty"`
+
+	// SignatureAlgorithm identifies the algorithm the descriptor is signed
+	// with, and is omitted for Ed25519.
+	SignatureAlgorithm string `codec:",omitempty"`
+
 	pki.MixDescriptor
 }
 
 // SignDescriptor signs and serializes the descriptor with the provided signing
 // key.
 func SignDescriptor(signer cert.Signer, base *pki.MixDescriptor) ([]byte, error) {
+	return SignDescriptorWithProofOfWork(signer, base, 0)
+}
+
+// SignDescriptorWithProofOfWork signs and serializes the descriptor along
+// with the submission proof-of-work nonce, with the provided signing key.
+func SignDescriptorWithProofOfWork(signer cert.Signer, base *pki.MixDescriptor, nonce uint64) ([]byte, error) {
 	d := new(nodeDescriptor)
 	d.MixDescriptor = *base
 	d.Version = nodeDescriptorVersion
+	d.ProofOfWork = nonce
+	d.Timestamp = time.Now().Unix()
+	if alg := signer.KeyType(); alg != SignatureAlgorithmEd25519 {
+		d.SignatureAlgorithm = alg
+	}
 
 	// Serialize the descriptor.
 	var payload []byte
@@ -73,7 +134,8 @@ func SignDescriptor(signer cert.Signer, base *pki.MixDescriptor) ([]byte, error)
 }
 
 // GetVerifierFromDescriptor returns a verifier for the given
-// mix descriptor certificate.
+// mix descriptor certificate.  Descriptors signed with an unknown signature
+// algorithm are rejected.
 func GetVerifierFromDescriptor(rawDesc []byte) (cert.Verifier, error) {
 	payload, err := cert.GetCertified(rawDesc)
 	if err != nil {
@@ -85,14 +147,88 @@ func GetVerifierFromDescriptor(rawDesc []byte) (cert.Verifier, error) {
 	if err = dec.Decode(d); err != nil {
 		return nil, err
 	}
-	return d.IdentityKey, nil
+
+	alg := signatureAlgorithm(d)
+	signatureAlgorithmsLock.RLock()
+	fn, ok := signatureAlgorithms[alg]
+	signatureAlgorithmsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown descriptor signature algorithm: '%v'", alg)
+	}
+	return fn(&d.MixDescriptor)
+}
+
+// GetSignatureAlgorithmFromDescriptor returns the signature algorithm
+// identifier of the given mix descriptor certificate, without verifying the
+// signature.
+func GetSignatureAlgorithmFromDescriptor(rawDesc []byte) (string, error) {
+	payload, err := cert.GetCertified(rawDesc)
+	if err != nil {
+		return "", err
+	}
+	d := new(nodeDescriptor)
+	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	if err = dec.Decode(d); err != nil {
+		return "", err
+	}
+	return signatureAlgorithm(d), nil
+}
+
+func signatureAlgorithm(d *nodeDescriptor) string {
+	if d.SignatureAlgorithm == "" {
+		return SignatureAlgorithmEd25519
+	}
+	return d.SignatureAlgorithm
+}
+
+// GetProofOfWorkFromDescriptor returns the submission proof-of-work nonce of
+// the given mix descriptor certificate, without verifying the signature.
+func GetProofOfWorkFromDescriptor(rawDesc []byte) (uint64, error) {
+	payload, err := cert.GetCertified(rawDesc)
+	if err != nil {
+		return 0, err
+	}
+	d := new(nodeDescriptor)
+	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	if err = dec.Decode(d); err != nil {
+		return 0, err
+	}
+	return d.ProofOfWork, nil
+}
+
+// GetTimestampFromDescriptor returns the time the descriptor claims to have
+// been signed at, in seconds since the Unix epoch, or 0 for descriptors that
+// predate the timestamp.  It does not verify the descriptor.
+func GetTimestampFromDescriptor(rawDesc []byte) (int64, error) {
+	payload, err := cert.GetCertified(rawDesc)
+	if err != nil {
+		return 0, err
+	}
+	d := new(nodeDescriptor)
+	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	if err = dec.Decode(d); err != nil {
+		return 0, err
+	}
+	return d.Timestamp, nil
 }
 
 // VerifyAndParseDescriptor verifies the signature and deserializes the
 // descriptor.  MixDescriptors returned from this routine are guaranteed
 // to have been correctly self signed by the IdentityKey listed in the
-// MixDescriptor.
+// MixDescriptor.  Fields that are not known to this implementation are
+// ignored.
 func VerifyAndParseDescriptor(verifier cert.Verifier, b []byte, epoch uint64) (*pki.MixDescriptor, error) {
+	return verifyAndParseDescriptor(verifier, b, epoch, jsonHandle)
+}
+
+// VerifyAndParseDescriptorStrict is like VerifyAndParseDescriptor, except
+// that descriptors with fields that are not known to this implementation
+// are rejected.
+func VerifyAndParseDescriptorStrict(verifier cert.Verifier, b []byte, epoch uint64) (*pki.MixDescriptor, error) {
+	return verifyAndParseDescriptor(verifier, b, epoch, strictJSONHandle)
+}
+
+func verifyAndParseDescriptor(verifier cert.Verifier, b []byte, epoch uint64, h *codec.JsonHandle) (*pki.MixDescriptor, error) {
 	signatures, err := cert.GetSignatures(b)
 	if len(signatures) != 1 {
 		return nil, fmt.Errorf("Expected 1 signature, got: %v", len(signatures))
@@ -106,7 +242,7 @@ func VerifyAndParseDescriptor(verifier cert.Verifier, b []byte, epoch uint64) (*
 
 	// Parse the payload.
 	d := new(nodeDescriptor)
-	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	dec := codec.NewDecoderBytes(payload, h)
 	if err = dec.Decode(d); err != nil {
 		return nil, err
 	}
@@ -230,6 +366,7 @@ func validateKaetzchen(m map[string]map[string]interface{}) error {
 		return nil
 	}
 
+	endpoints := make(map[string]string)
 	for capa, params := range m {
 		if len(capa) == 0 {
 			return fmt.Errorf("capability lenght out of bounds")
@@ -245,14 +382,23 @@ func validateKaetzchen(m map[string]map[string]interface{}) error {
 		} else if ep, ok = v.(string); !ok {
 			return fmt.Errorf("capability '%v' invalid endpoint type: %T", capa, v)
 		}
-		// XXX: Should this enforce formating?
 		if len(ep) == 0 || len(ep) > constants.RecipientIDLength {
 			return fmt.Errorf("capability '%v' invalid endpoint, length out of bounds", capa)
 		}
 
-		// Note: This explicitly does not enforce endpoint uniqueness, because
-		// it is conceivable that a single endpoint can service multiple
-		// request types.
+		// Kaetzchen endpoints live in a recipient namespace reserved by the
+		// leading '+', so anything else would collide with user mailboxes.
+		if ep[0] != '+' || len(ep) == 1 {
+			return fmt.Errorf("capability '%v' invalid endpoint: '%v'", capa, ep)
+		}
+
+		// Each capability must map to a distinct endpoint, otherwise clients
+		// resolving a service via the consensus can't tell which one they
+		// are talking to.
+		if other, ok := endpoints[ep]; ok {
+			return fmt.Errorf("capability '%v' duplicates endpoint '%v' of capability '%v'", capa, ep, other)
+		}
+		endpoints[ep] = capa
 	}
 
 	return nil
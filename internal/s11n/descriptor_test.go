@@ -19,12 +19,15 @@ package s11n
 import (
 	"crypto/rand"
 	"testing"
+	"time"
 
+	"github.com/katzenpost/core/crypto/cert"
 	"github.com/katzenpost/core/crypto/ecdh"
 	"github.com/katzenpost/core/crypto/eddsa"
 	"github.com/katzenpost/core/pki"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
 )
 
 const debugTestEpoch = 0x23
@@ -95,3 +98,247 @@ func TestDescriptor(t *testing.T) {
 		require.Equal(v.Bytes(), vv.Bytes(), "MixKeys[%v]", k)
 	}
 }
+
+func TestProofOfWork(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const nBits = 16
+
+	identityPriv, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	otherPriv, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	id := identityPriv.PublicKey()
+
+	nonce := SolveProofOfWork(debugTestEpoch, id, nBits)
+	assert.True(VerifyProofOfWork(debugTestEpoch, id, nonce, nBits), "valid proof")
+	assert.True(VerifyProofOfWork(debugTestEpoch, id, nonce, 0), "difficulty 0")
+
+	// The proof is bound to the epoch and identity key.
+	assert.False(VerifyProofOfWork(debugTestEpoch+1, id, nonce, nBits), "other epoch")
+	assert.False(VerifyProofOfWork(debugTestEpoch, otherPriv.PublicKey(), nonce, nBits), "other identity key")
+
+	// SolveProofOfWork returns the smallest valid nonce.
+	for n := uint64(0); n < nonce; n++ {
+		assert.False(VerifyProofOfWork(debugTestEpoch, id, n, nBits), "invalid proof %d", n)
+	}
+	assert.False(VerifyProofOfWork(debugTestEpoch, id, nonce, 256+1), "impossible difficulty")
+
+	// The nonce is carried in the signed descriptor.
+	d := &pki.MixDescriptor{Name: "hydra-dominatus.example.net", IdentityKey: id}
+	signed, err := SignDescriptorWithProofOfWork(identityPriv, d, nonce)
+	require.NoError(err, "SignDescriptorWithProofOfWork()")
+	n, err := GetProofOfWorkFromDescriptor(signed)
+	require.NoError(err, "GetProofOfWorkFromDescriptor()")
+	assert.Equal(nonce, n)
+
+	signed, err = SignDescriptor(identityPriv, d)
+	require.NoError(err, "SignDescriptor()")
+	n, err = GetProofOfWorkFromDescriptor(signed)
+	require.NoError(err, "GetProofOfWorkFromDescriptor()")
+	assert.Equal(uint64(0), n)
+}
+
+func TestDescriptorUnknownFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	identityPriv, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	linkPriv, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err, "ecdh.NewKeypair()")
+	mixPriv, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err, "ecdh.NewKeypair()")
+
+	// Serialize a descriptor from the future, with a field this version
+	// knows nothing about.
+	d := &struct {
+		nodeDescriptor
+		FutureField string
+	}{FutureField: "from the future"}
+	d.Version = nodeDescriptorVersion
+	d.Name = "hydra-dominatus.example.net"
+	d.Addresses = map[pki.Transport][]string{
+		pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+	}
+	d.Layer = 0
+	d.IdentityKey = identityPriv.PublicKey()
+	d.LinkKey = linkPriv.PublicKey()
+	d.MixKeys = map[uint64]*ecdh.PublicKey{
+		debugTestEpoch: mixPriv.PublicKey(),
+	}
+	var payload []byte
+	enc := codec.NewEncoderBytes(&payload, jsonHandle)
+	require.NoError(enc.Encode(d), "Encode()")
+	signed, err := cert.Sign(identityPriv, payload, time.Now().Add(CertificateExpiration).Unix())
+	require.NoError(err, "cert.Sign()")
+
+	// Lenient parsing ignores the unknown field.
+	dd, err := VerifyAndParseDescriptor(identityPriv.PublicKey(), signed, debugTestEpoch)
+	require.NoError(err, "VerifyAndParseDescriptor()")
+	assert.Equal(d.Name, dd.Name, "Name")
+
+	// Strict parsing rejects the descriptor.
+	_, err = VerifyAndParseDescriptorStrict(identityPriv.PublicKey(), signed, debugTestEpoch)
+	assert.Error(err, "VerifyAndParseDescriptorStrict()")
+
+	// Both accept a descriptor without unknown fields.
+	signed, err = SignDescriptor(identityPriv, &d.MixDescriptor)
+	require.NoError(err, "SignDescriptor()")
+	_, err = VerifyAndParseDescriptorStrict(identityPriv.PublicKey(), signed, debugTestEpoch)
+	assert.NoError(err, "VerifyAndParseDescriptorStrict()")
+}
+
+type algorithmSigner struct {
+	*eddsa.PrivateKey
+	algorithm string
+}
+
+func (s *algorithmSigner) KeyType() string {
+	return s.algorithm
+}
+
+func TestDescriptorSignatureAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	identityPriv, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	linkPriv, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err, "ecdh.NewKeypair()")
+	mixPriv, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err, "ecdh.NewKeypair()")
+
+	d := &pki.MixDescriptor{
+		Name:        "hydra-dominatus.example.net",
+		IdentityKey: identityPriv.PublicKey(),
+		LinkKey:     linkPriv.PublicKey(),
+		MixKeys: map[uint64]*ecdh.PublicKey{
+			debugTestEpoch: mixPriv.PublicKey(),
+		},
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+	}
+
+	// Ed25519 descriptors do not carry an algorithm identifier.
+	signed, err := SignDescriptor(identityPriv, d)
+	require.NoError(err, "SignDescriptor()")
+	alg, err := GetSignatureAlgorithmFromDescriptor(signed)
+	require.NoError(err, "GetSignatureAlgorithmFromDescriptor()")
+	assert.Equal(SignatureAlgorithmEd25519, alg)
+	verifier, err := GetVerifierFromDescriptor(signed)
+	require.NoError(err, "GetVerifierFromDescriptor()")
+	_, err = VerifyAndParseDescriptorStrict(verifier, signed, debugTestEpoch)
+	assert.NoError(err, "VerifyAndParseDescriptorStrict()")
+
+	// Descriptors signed with an unknown algorithm are rejected.
+	const testAlgorithm = "test-algorithm"
+	signer := &algorithmSigner{identityPriv, testAlgorithm}
+	signed, err = SignDescriptor(signer, d)
+	require.NoError(err, "SignDescriptor()")
+	alg, err = GetSignatureAlgorithmFromDescriptor(signed)
+	require.NoError(err, "GetSignatureAlgorithmFromDescriptor()")
+	assert.Equal(testAlgorithm, alg)
+	assert.False(IsSignatureAlgorithmKnown(testAlgorithm))
+	_, err = GetVerifierFromDescriptor(signed)
+	assert.Error(err, "GetVerifierFromDescriptor()")
+
+	// They are accepted once the algorithm is registered.
+	RegisterSignatureAlgorithm(testAlgorithm, func(d *pki.MixDescriptor) (cert.Verifier, error) {
+		return d.IdentityKey, nil
+	})
+	assert.True(IsSignatureAlgorithmKnown(testAlgorithm))
+	verifier, err = GetVerifierFromDescriptor(signed)
+	require.NoError(err, "GetVerifierFromDescriptor()")
+	_, err = VerifyAndParseDescriptorStrict(verifier, signed, debugTestEpoch)
+	assert.NoError(err, "VerifyAndParseDescriptorStrict()")
+}
+
+func TestValidateTransports(t *testing.T) {
+	assert := assert.New(t)
+
+	allowed := []pki.Transport{pki.TransportTCP, pki.TransportTCPv4, pki.TransportTCPv6, TransportTorV2, TransportTorV3}
+	addrs := map[pki.Transport][]string{
+		pki.TransportTCPv4:      []string{"192.0.2.1:4242"},
+		pki.TransportTCP:        []string{"example.com:4242"},
+		TransportTorV2:          []string{"thisisanoldonion.onion:2323"},
+		TransportTorV3:          []string{"thisisnotanonion.example.com:2323"},
+		pki.TransportTCPv6:      []string{},
+		pki.Transport("quic"):   []string{"192.0.2.1:4242"},
+		pki.Transport("unused"): nil,
+	}
+
+	valid, err := ValidateTransports(addrs, allowed)
+	assert.Error(err)
+	assert.Equal(map[pki.Transport][]string{
+		pki.TransportTCPv4: addrs[pki.TransportTCPv4],
+		pki.TransportTCP:   addrs[pki.TransportTCP],
+		TransportTorV2:     addrs[TransportTorV2],
+	}, valid)
+
+	// The error lists the excluded transports in a stable order.
+	for i := 0; i < 10; i++ {
+		_, err2 := ValidateTransports(addrs, allowed)
+		assert.Equal(err.Error(), err2.Error())
+	}
+
+	// Nothing is excluded from a valid map.
+	valid, err = ValidateTransports(map[pki.Transport][]string{
+		pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		TransportTorV3:     []string{"vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion:443"},
+	}, allowed)
+	assert.NoError(err)
+	assert.Len(valid, 2)
+
+	// Transports that are not allowed are excluded.
+	valid, err = ValidateTransports(map[pki.Transport][]string{
+		TransportTorV2: []string{"thisisanoldonion.onion:2323"},
+	}, []pki.Transport{pki.TransportTCPv4})
+	assert.Error(err)
+	assert.Empty(valid)
+}
+
+func TestValidateAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateAddresses(map[pki.Transport][]string{
+		pki.TransportTCPv4:    []string{"192.0.2.1:4242"},
+		TransportTorV2:        []string{"thisisanoldonion.onion:2323"},
+		pki.Transport("quic"): []string{"whatever"},
+	}))
+	assert.Error(ValidateAddresses(map[pki.Transport][]string{
+		pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		TransportTorV3:     []string{"thisisnotanonion.example.com:2323"},
+	}))
+	assert.Error(ValidateAddresses(map[pki.Transport][]string{
+		pki.TransportTCP: []string{"example.com"},
+	}))
+}
+
+func TestValidateKaetzchen(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateKaetzchen(nil), "nil")
+	assert.NoError(validateKaetzchen(map[string]map[string]interface{}{
+		"loop":      {"endpoint": "+loop"},
+		"keyserver": {"endpoint": "+keyserver", "version": 1},
+	}), "good")
+
+	for n, m := range map[string]map[string]map[string]interface{}{
+		"empty capability": {"": {"endpoint": "+loop"}},
+		"no parameters":    {"loop": nil},
+		"no endpoint":      {"loop": {"foo": "bar"}},
+		"endpoint type":    {"loop": {"endpoint": 23}},
+		"empty endpoint":   {"loop": {"endpoint": ""}},
+		"no prefix":        {"loop": {"endpoint": "loop"}},
+		"bare prefix":      {"loop": {"endpoint": "+"}},
+		"duplicate endpoint": {
+			"loop": {"endpoint": "+loop"},
+			"echo": {"endpoint": "+loop"},
+		},
+	} {
+		assert.Error(validateKaetzchen(m), n)
+	}
+}
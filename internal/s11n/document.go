@@ -26,6 +26,7 @@ import (
 	"github.com/katzenpost/core/epochtime"
 	"github.com/katzenpost/core/pki"
 	"github.com/ugorji/go/codec"
+	"golang.org/x/crypto/sha3"
 )
 
 const (
@@ -35,6 +36,8 @@ const (
 	SharedRandomLength = 40
 	// SharedRandomValueLength is the length in bytes of a SharedRandomValue.
 	SharedRandomValueLength = 32
+	// DocumentHashLength is the length in bytes of a DocumentHash.
+	DocumentHashLength = 32
 )
 
 var (
@@ -42,7 +45,8 @@ var (
 	// invalid.
 	ErrInvalidEpoch = errors.New("invalid document epoch")
 
-	jsonHandle *codec.JsonHandle
+	jsonHandle       *codec.JsonHandle
+	strictJSONHandle *codec.JsonHandle
 )
 
 // Document is the on-the-wire representation of a PKI Document.
@@ -69,6 +73,56 @@ type Document struct {
 
 	SharedRandomCommit []byte
 	SharedRandomValue  []byte
+
+	// PriorDocumentHash is the DocumentHash of the previous epoch's
+	// Document, if documents are chained and there is one.
+	PriorDocumentHash []byte `codec:",omitempty"`
+
+	// Blacklist is the list of node identities that clients must never
+	// route through, sorted by identity key.
+	Blacklist []*BlacklistEntry `codec:",omitempty"`
+
+	// SphinxGeometryVersion identifies the packet geometry and parameter
+	// semantics of the network.  Clients should refuse documents with a
+	// version they do not support.  Documents from authorities that
+	// predate the field carry 0.
+	SphinxGeometryVersion uint64 `codec:",omitempty"`
+
+	// Authorities is the directory authority set, sorted by identity key,
+	// so that clients can learn it from a few seed authorities.
+	Authorities []*AuthorityEntry `codec:",omitempty"`
+
+	// SphinxGeometry is the Sphinx packet geometry of the network, if the
+	// authorities publish it.
+	SphinxGeometry *SphinxGeometry `codec:",omitempty"`
+}
+
+// SphinxGeometry is the Sphinx packet geometry that the mix nodes and
+// clients must agree on.
+type SphinxGeometry struct {
+	// Hops is the number of hops in a path, including both Providers,
+	// which is always the number of Topology layers plus 2.
+	Hops uint64
+
+	// PerHopRoutingInfoLength is the length in bytes of the routing
+	// information for each hop.
+	PerHopRoutingInfoLength uint64
+
+	// PayloadLength is the length in bytes of the packet payload.
+	PayloadLength uint64
+}
+
+func validateSphinxGeometry(g *SphinxGeometry, nrLayers int) error {
+	if g == nil {
+		return nil
+	}
+	if g.Hops != uint64(nrLayers)+2 {
+		return fmt.Errorf("%v Hops for %v layers", g.Hops, nrLayers)
+	}
+	if g.PerHopRoutingInfoLength == 0 || g.PayloadLength == 0 {
+		return errors.New("zero length")
+	}
+	return nil
 }
 
 // FromPayload deserializes, then verifies a Document, and returns the Document or error.
@@ -85,6 +139,19 @@ func FromPayload(verifier cert.Verifier, payload []byte) (*Document, error) {
 	return d, nil
 }
 
+// DocumentHash returns the SHA3-256 digest of the certified payload of the
+// signed document.  As the signatures are excluded, every copy of a
+// consensus document has the same DocumentHash regardless of which
+// authorities' signatures are attached.
+func DocumentHash(b []byte) ([]byte, error) {
+	payload, err := cert.GetCertified(b)
+	if err != nil {
+		return nil, err
+	}
+	h := sha3.Sum256(payload)
+	return h[:], nil
+}
+
 // SignDocument signs and serializes the document with the provided signing key.
 func SignDocument(signer cert.Signer, d *Document) ([]byte, error) {
 	d.Version = DocumentVersion
@@ -133,18 +200,99 @@ func MultiSignDocument(signer cert.Signer, peerSignatures []*cert.Signature, ver
 }
 
 // VerifyAndParseDocument verifies the signautre and deserializes the document.
+// Nodes listed in the document's Blacklist are omitted from the result.
 func VerifyAndParseDocument(b []byte, verifier cert.Verifier) (*pki.Document, error) {
 	payload, err := cert.Verify(verifier, b)
 	if err != nil {
 		return nil, err
 	}
+	return parseDocument(payload)
+}
 
-	// Parse the payload.
+// InsecureParseDocument deserializes the document WITHOUT verifying any of
+// the authority signatures, so that anyone can forge the returned document.
+// It is only suitable for testing within a trusted boundary.
+func InsecureParseDocument(b []byte) (*pki.Document, error) {
+	payload, err := cert.GetCertified(b)
+	if err != nil {
+		return nil, err
+	}
+	return parseDocument(payload)
+}
+
+// GetSphinxGeometryVersion returns the SphinxGeometryVersion of the
+// document, without verifying its signatures.
+func GetSphinxGeometryVersion(b []byte) (uint64, error) {
+	d, err := insecureDecodeDocument(b)
+	if err != nil {
+		return 0, err
+	}
+	return d.SphinxGeometryVersion, nil
+}
+
+// GetPriorDocumentHash returns the PriorDocumentHash of the document, or nil
+// if it does not have one, without verifying its signatures.
+func GetPriorDocumentHash(b []byte) ([]byte, error) {
+	d, err := insecureDecodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.PriorDocumentHash) != 0 && len(d.PriorDocumentHash) != DocumentHashLength {
+		return nil, fmt.Errorf("Document has invalid PriorDocumentHash")
+	}
+	return d.PriorDocumentHash, nil
+}
+
+// GetBlacklist returns the Blacklist of the document, without verifying its
+// signatures.  The nodes listed are already absent from the Topology and
+// Providers of the parsed document.
+func GetBlacklist(b []byte) ([]*BlacklistEntry, error) {
+	d, err := insecureDecodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateBlacklist(d.Blacklist, d.Epoch); err != nil {
+		return nil, fmt.Errorf("Document has invalid Blacklist: %v", err)
+	}
+	return d.Blacklist, nil
+}
+
+// GetSphinxGeometry returns the SphinxGeometry of the document, or nil if
+// it does not have one, without verifying its signatures.
+func GetSphinxGeometry(b []byte) (*SphinxGeometry, error) {
+	d, err := insecureDecodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateSphinxGeometry(d.SphinxGeometry, len(d.Topology)); err != nil {
+		return nil, fmt.Errorf("Document has invalid SphinxGeometry: %v", err)
+	}
+	return d.SphinxGeometry, nil
+}
+
+// insecureDecodeDocument deserializes the wire representation of the
+// document, without verifying its signatures or validating it.
+func insecureDecodeDocument(b []byte) (*Document, error) {
+	payload, err := cert.GetCertified(b)
+	if err != nil {
+		return nil, err
+	}
 	d := new(Document)
 	dec := codec.NewDecoderBytes(payload, jsonHandle)
 	if err = dec.Decode(d); err != nil {
 		return nil, err
 	}
+	return d, nil
+}
+
+func parseDocument(payload []byte) (*pki.Document, error) {
+	// Parse the payload.
+	d := new(Document)
+	dec := codec.NewDecoderBytes(payload, jsonHandle)
+	err := dec.Decode(d)
+	if err != nil {
+		return nil, err
+	}
 
 	// Ensure the document is well formed.
 	if d.Version != DocumentVersion {
@@ -177,6 +325,19 @@ func VerifyAndParseDocument(b []byte, verifier cert.Verifier) (*pki.Document, er
 		}
 	}
 
+	if len(d.PriorDocumentHash) != 0 && len(d.PriorDocumentHash) != DocumentHashLength {
+		return nil, fmt.Errorf("Document has invalid PriorDocumentHash")
+	}
+	if err = validateBlacklist(d.Blacklist, d.Epoch); err != nil {
+		return nil, fmt.Errorf("Document has invalid Blacklist: %v", err)
+	}
+	if err = validateAuthorities(d.Authorities); err != nil {
+		return nil, fmt.Errorf("Document has invalid Authorities: %v", err)
+	}
+	if err = validateSphinxGeometry(d.SphinxGeometry, len(d.Topology)); err != nil {
+		return nil, fmt.Errorf("Document has invalid SphinxGeometry: %v", err)
+	}
+
 	doc := new(pki.Document)
 	doc.SharedRandomCommit = d.SharedRandomCommit
 	doc.SharedRandomValue = d.SharedRandomValue
@@ -192,6 +353,9 @@ func VerifyAndParseDocument(b []byte, verifier cert.Verifier) (*pki.Document, er
 	doc.LambdaDMaxDelay = d.LambdaDMaxDelay
 	doc.LambdaM = d.LambdaM
 	doc.LambdaMMaxDelay = d.LambdaMMaxDelay
+	// pki.Document has nowhere to carry the Blacklist, so it is applied
+	// here instead: blacklisted nodes are left out of the parsed Topology
+	// and Providers, and GetBlacklist returns the list itself.
 	doc.Topology = make([][]*pki.MixDescriptor, len(d.Topology))
 	doc.Providers = make([]*pki.MixDescriptor, 0, len(d.Providers))
 
@@ -205,6 +369,9 @@ func VerifyAndParseDocument(b []byte, verifier cert.Verifier) (*pki.Document, er
 			if err != nil {
 				return nil, err
 			}
+			if d.IsBlacklisted(desc.IdentityKey) {
+				continue
+			}
 			doc.Topology[layer] = append(doc.Topology[layer], desc)
 		}
 	}
@@ -218,6 +385,9 @@ func VerifyAndParseDocument(b []byte, verifier cert.Verifier) (*pki.Document, er
 		if err != nil {
 			return nil, err
 		}
+		if d.IsBlacklisted(desc.IdentityKey) {
+			continue
+		}
 		doc.Providers = append(doc.Providers, desc)
 	}
 
@@ -282,4 +452,10 @@ func init() {
 	jsonHandle.Canonical = true
 	jsonHandle.IntegerAsString = 'A'
 	jsonHandle.MapKeyAsString = true
+
+	strictJSONHandle = new(codec.JsonHandle)
+	strictJSONHandle.Canonical = true
+	strictJSONHandle.IntegerAsString = 'A'
+	strictJSONHandle.MapKeyAsString = true
+	strictJSONHandle.ErrorIfNoField = true
 }
@@ -132,3 +132,232 @@ func TestDocument(t *testing.T) {
 	// TODO: Ensure the descriptors are sane.
 	_ = assert
 }
+
+func TestDocumentBlacklist(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	sharedRandomCommit := make([]byte, SharedRandomLength)
+	binary.BigEndian.PutUint64(sharedRandomCommit[:8], debugTestEpoch)
+
+	var entries []*BlacklistEntry
+	for i := 0; i < 3; i++ {
+		bad, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err, "eddsa.NewKeypair()")
+		entries = append(entries, &BlacklistEntry{IdentityKey: bad.PublicKey().Bytes()})
+	}
+	entries[0].Until = debugTestEpoch + 1
+
+	newDoc := func(blacklist []*BlacklistEntry) *Document {
+		_, mixDesc := genDescriptor(require, 1, 0)
+		_, providerDesc := genDescriptor(require, 2, pki.LayerProvider)
+		return &Document{
+			Epoch:              debugTestEpoch,
+			Topology:           [][][]byte{{mixDesc}},
+			Providers:          [][]byte{providerDesc},
+			SharedRandomCommit: sharedRandomCommit,
+			SharedRandomValue:  make([]byte, SharedRandomValueLength),
+			Blacklist:          blacklist,
+		}
+	}
+
+	// Unsorted blacklists are rejected.
+	SortBlacklist(entries)
+	unsorted := []*BlacklistEntry{entries[2], entries[0], entries[1]}
+	signed, err := SignDocument(k, newDoc(unsorted))
+	require.NoError(err, "SignDocument()")
+	_, err = VerifyAndParseDocument(signed, k.PublicKey())
+	assert.Error(err, "VerifyAndParseDocument(unsorted)")
+
+	// Sorted, unexpired blacklists round trip.
+	signed, err = SignDocument(k, newDoc(entries))
+	require.NoError(err, "SignDocument()")
+	_, err = VerifyAndParseDocument(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseDocument()")
+	doc, err := FromPayload(k.PublicKey(), signed)
+	require.NoError(err, "FromPayload()")
+	require.Equal(entries, doc.Blacklist)
+	for _, e := range entries {
+		pk := new(eddsa.PublicKey)
+		require.NoError(pk.FromBytes(e.IdentityKey))
+		assert.True(doc.IsBlacklisted(pk))
+	}
+	assert.False(doc.IsBlacklisted(k.PublicKey()))
+	blacklist, err := GetBlacklist(signed)
+	require.NoError(err, "GetBlacklist()")
+	assert.Equal(entries, blacklist)
+
+	// Listed nodes are left out of the parsed document.
+	listedDesc, listedRaw := genDescriptor(require, 3, 0)
+	listed := append([]*BlacklistEntry{{IdentityKey: listedDesc.IdentityKey.Bytes()}}, entries...)
+	SortBlacklist(listed)
+	withListed := newDoc(listed)
+	withListed.Topology[0] = append(withListed.Topology[0], listedRaw)
+	signed, err = SignDocument(k, withListed)
+	require.NoError(err, "SignDocument()")
+	parsed, err := VerifyAndParseDocument(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseDocument(listed)")
+	require.Len(parsed.Topology[0], 1)
+	assert.NotEqual(listedDesc.IdentityKey.Bytes(), parsed.Topology[0][0].IdentityKey.Bytes())
+
+	// Expired entries are rejected.
+	for _, e := range entries {
+		if e.Until != 0 {
+			e.Until = debugTestEpoch
+		}
+	}
+	signed, err = SignDocument(k, newDoc(entries))
+	require.NoError(err, "SignDocument()")
+	_, err = VerifyAndParseDocument(signed, k.PublicKey())
+	assert.Error(err, "VerifyAndParseDocument(expired)")
+}
+
+func TestInsecureParseDocument(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	other, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+
+	_, mixDesc := genDescriptor(require, 1, 0)
+	_, providerDesc := genDescriptor(require, 2, pki.LayerProvider)
+	signed, err := SignDocument(k, &Document{
+		Epoch:                 debugTestEpoch,
+		Topology:              [][][]byte{{mixDesc}},
+		Providers:             [][]byte{providerDesc},
+		SharedRandomValue:     make([]byte, SharedRandomValueLength),
+		SphinxGeometryVersion: 2,
+	})
+	require.NoError(err, "SignDocument()")
+
+	_, err = VerifyAndParseDocument(signed, other.PublicKey())
+	require.Error(err, "VerifyAndParseDocument(other)")
+	doc, err := InsecureParseDocument(signed)
+	require.NoError(err, "InsecureParseDocument()")
+	require.Equal(uint64(debugTestEpoch), doc.Epoch)
+
+	v, err := GetSphinxGeometryVersion(signed)
+	require.NoError(err, "GetSphinxGeometryVersion()")
+	require.Equal(uint64(2), v)
+}
+
+func TestDocumentAuthorities(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	sharedRandomCommit := make([]byte, SharedRandomLength)
+	binary.BigEndian.PutUint64(sharedRandomCommit[:8], debugTestEpoch)
+
+	var entries []*AuthorityEntry
+	for i := 0; i < 3; i++ {
+		idKey, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err, "eddsa.NewKeypair()")
+		entries = append(entries, &AuthorityEntry{
+			IdentityKey: idKey.PublicKey().Bytes(),
+			LinkKey:     idKey.PublicKey().ToECDH().Bytes(),
+			Addresses:   []string{fmt.Sprintf("authority-%d.example.org:30001", i)},
+		})
+	}
+	SortAuthorities(entries)
+
+	newDoc := func(authorities []*AuthorityEntry) *Document {
+		_, mixDesc := genDescriptor(require, 1, 0)
+		_, providerDesc := genDescriptor(require, 2, pki.LayerProvider)
+		return &Document{
+			Epoch:              debugTestEpoch,
+			Topology:           [][][]byte{{mixDesc}},
+			Providers:          [][]byte{providerDesc},
+			SharedRandomCommit: sharedRandomCommit,
+			SharedRandomValue:  make([]byte, SharedRandomValueLength),
+			Authorities:        authorities,
+		}
+	}
+
+	// The authority set round trips.
+	signed, err := SignDocument(k, newDoc(entries))
+	require.NoError(err, "SignDocument()")
+	_, err = VerifyAndParseDocument(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseDocument()")
+	authorities, err := VerifyAndParseAuthorities(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseAuthorities()")
+	require.Equal(entries, authorities)
+
+	// Documents without one have an empty set.
+	signed, err = SignDocument(k, newDoc(nil))
+	require.NoError(err, "SignDocument()")
+	authorities, err = VerifyAndParseAuthorities(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseAuthorities()")
+	assert.Empty(authorities)
+
+	// Unsorted sets, and entries without addresses, are rejected.
+	for _, v := range [][]*AuthorityEntry{
+		{entries[2], entries[0], entries[1]},
+		{entries[0], {IdentityKey: entries[1].IdentityKey, LinkKey: entries[1].LinkKey}},
+	} {
+		signed, err = SignDocument(k, newDoc(v))
+		require.NoError(err, "SignDocument()")
+		_, err = VerifyAndParseDocument(signed, k.PublicKey())
+		assert.Error(err, "VerifyAndParseDocument()")
+		_, err = VerifyAndParseAuthorities(signed, k.PublicKey())
+		assert.Error(err, "VerifyAndParseAuthorities()")
+	}
+}
+
+func TestDocumentSphinxGeometry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	sharedRandomCommit := make([]byte, SharedRandomLength)
+	binary.BigEndian.PutUint64(sharedRandomCommit[:8], debugTestEpoch)
+
+	newDoc := func(g *SphinxGeometry) *Document {
+		_, mixDesc := genDescriptor(require, 1, 0)
+		_, providerDesc := genDescriptor(require, 2, pki.LayerProvider)
+		return &Document{
+			Epoch:              debugTestEpoch,
+			Topology:           [][][]byte{{mixDesc}},
+			Providers:          [][]byte{providerDesc},
+			SharedRandomCommit: sharedRandomCommit,
+			SharedRandomValue:  make([]byte, SharedRandomValueLength),
+			SphinxGeometry:     g,
+		}
+	}
+
+	// The geometry round trips.
+	geometry := &SphinxGeometry{Hops: 3, PerHopRoutingInfoLength: 65, PayloadLength: 50 * 1024}
+	signed, err := SignDocument(k, newDoc(geometry))
+	require.NoError(err, "SignDocument()")
+	_, err = VerifyAndParseDocument(signed, k.PublicKey())
+	require.NoError(err, "VerifyAndParseDocument()")
+	g, err := GetSphinxGeometry(signed)
+	require.NoError(err, "GetSphinxGeometry()")
+	require.Equal(geometry, g)
+
+	// Documents without one have none.
+	signed, err = SignDocument(k, newDoc(nil))
+	require.NoError(err, "SignDocument()")
+	g, err = GetSphinxGeometry(signed)
+	require.NoError(err, "GetSphinxGeometry()")
+	assert.Nil(g)
+
+	// Hops that do not match the layers, and zero lengths, are rejected.
+	for _, v := range []*SphinxGeometry{
+		{Hops: 5, PerHopRoutingInfoLength: 65, PayloadLength: 50 * 1024},
+		{Hops: 3, PayloadLength: 50 * 1024},
+		{Hops: 3, PerHopRoutingInfoLength: 65},
+	} {
+		signed, err = SignDocument(k, newDoc(v))
+		require.NoError(err, "SignDocument()")
+		_, err = VerifyAndParseDocument(signed, k.PublicKey())
+		assert.Error(err, "VerifyAndParseDocument()")
+		_, err = GetSphinxGeometry(signed)
+		assert.Error(err, "GetSphinxGeometry()")
+	}
+}
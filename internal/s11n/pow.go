@@ -0,0 +1,80 @@
+// pow.go - Descriptor submission proof-of-work.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package s11n
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// The descriptor submission proof-of-work is a nonce such that
+//
+//   SHA3-256(ProofOfWorkContext | BE64(epoch) | identityKey | BE64(nonce))
+//
+// has at least the required number of leading zero bits, where epoch is the
+// epoch the descriptor is posted for, and identityKey is the 32 byte Ed25519
+// identity public key of the node.  The nonce is carried in the signed
+// descriptor, so a proof can not be reused for another node or epoch.
+
+// ProofOfWorkContext is the domain separation prefix of the descriptor
+// submission proof-of-work hash.
+const ProofOfWorkContext = "katzenpost-descriptor-pow-v0"
+
+// ProofOfWorkHash returns the proof-of-work hash of the nonce for the node
+// identity key and epoch.
+func ProofOfWorkHash(epoch uint64, identityKey *eddsa.PublicKey, nonce uint64) []byte {
+	var b [8]byte
+	h := sha3.New256()
+	h.Write([]byte(ProofOfWorkContext))
+	binary.BigEndian.PutUint64(b[:], epoch)
+	h.Write(b[:])
+	h.Write(identityKey.Bytes())
+	binary.BigEndian.PutUint64(b[:], nonce)
+	h.Write(b[:])
+	return h.Sum(nil)
+}
+
+// VerifyProofOfWork returns true iff the nonce is a valid proof-of-work of
+// at least nBits bits for the node identity key and epoch.
+func VerifyProofOfWork(epoch uint64, identityKey *eddsa.PublicKey, nonce uint64, nBits int) bool {
+	return leadingZeroBits(ProofOfWorkHash(epoch, identityKey, nonce)) >= nBits
+}
+
+// SolveProofOfWork returns the smallest nonce that is a valid proof-of-work
+// of nBits bits for the node identity key and epoch.  The expected cost is
+// 2^nBits hash computations.
+func SolveProofOfWork(epoch uint64, identityKey *eddsa.PublicKey, nBits int) uint64 {
+	var nonce uint64
+	for !VerifyProofOfWork(epoch, identityKey, nonce, nBits) {
+		nonce++
+	}
+	return nonce
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
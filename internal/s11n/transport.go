@@ -0,0 +1,161 @@
+// transport.go - Katzenpost descriptor transport validation.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package s11n
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/katzenpost/core/pki"
+)
+
+const (
+	// TransportTorV2 is a Tor v2 onion service transport.
+	TransportTorV2 = pki.Transport("torv2")
+
+	// TransportTorV3 is a Tor v3 onion service transport.
+	TransportTorV3 = pki.Transport("torv3")
+
+	onionV2Length = 16
+	onionV3Length = 56
+	onionSuffix   = ".onion"
+	base32Charset = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+// ValidateTransports returns the subset of addrs whose transport is one of
+// allowed, and whose address list is non-empty and well formed for the
+// transport.  Transports without format specific validation are accepted
+// as long as their address list is non-empty.  If any transport is
+// excluded, an error describing every excluded transport, in sorted order,
+// is returned along with the subset.
+func ValidateTransports(addrs map[pki.Transport][]string, allowed []pki.Transport) (map[pki.Transport][]string, error) {
+	isAllowed := make(map[pki.Transport]bool)
+	for _, t := range allowed {
+		isAllowed[t] = true
+	}
+
+	transports := make([]string, 0, len(addrs))
+	for t := range addrs {
+		transports = append(transports, string(t))
+	}
+	sort.Strings(transports)
+
+	valid := make(map[pki.Transport][]string)
+	var invalid []string
+	for _, v := range transports {
+		t := pki.Transport(v)
+		if err := validateTransport(t, addrs[t], isAllowed[t]); err != nil {
+			invalid = append(invalid, fmt.Sprintf("'%v': %v", t, err))
+			continue
+		}
+		valid[t] = addrs[t]
+	}
+	if len(invalid) != 0 {
+		return valid, fmt.Errorf("invalid transports: %v", strings.Join(invalid, ", "))
+	}
+	return valid, nil
+}
+
+func validateTransport(t pki.Transport, addrs []string, isAllowed bool) error {
+	if !isAllowed {
+		return fmt.Errorf("transport not allowed")
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("empty address list")
+	}
+	for _, addr := range addrs {
+		if err := validateAddress(t, addr); err != nil {
+			return fmt.Errorf("invalid address '%v': %v", addr, err)
+		}
+	}
+	return nil
+}
+
+// ValidateAddresses returns an error iff any of the addresses of a
+// transport with format specific validation is malformed, regardless of
+// which transports are allowed.
+func ValidateAddresses(addrs map[pki.Transport][]string) error {
+	transports := make([]string, 0, len(addrs))
+	for t := range addrs {
+		transports = append(transports, string(t))
+	}
+	sort.Strings(transports)
+
+	for _, v := range transports {
+		t := pki.Transport(v)
+		for _, addr := range addrs[t] {
+			if err := validateAddress(t, addr); err != nil {
+				return fmt.Errorf("transport '%v': invalid address '%v': %v", t, addr, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAddress(t pki.Transport, addr string) error {
+	switch t {
+	case pki.TransportTCP, pki.TransportTCPv4, pki.TransportTCPv6:
+		_, _, err := splitHostPort(addr)
+		return err
+	case TransportTorV2:
+		return validateOnion(addr, onionV2Length)
+	case TransportTorV3:
+		return validateOnion(addr, onionV3Length)
+	}
+	return nil
+}
+
+func splitHostPort(addr string) (string, uint64, error) {
+	h, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(h) == 0 {
+		return "", 0, fmt.Errorf("missing host")
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	if port == 0 {
+		return "", 0, fmt.Errorf("port is 0")
+	}
+	return h, port, nil
+}
+
+func validateOnion(addr string, length int) error {
+	h, _, err := splitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(h, onionSuffix) {
+		return fmt.Errorf("not an onion address")
+	}
+	label := strings.TrimSuffix(h, onionSuffix)
+	if len(label) != length {
+		return fmt.Errorf("onion address is not %d characters", length)
+	}
+	for _, r := range label {
+		if !strings.ContainsRune(base32Charset, r) {
+			return fmt.Errorf("onion address contains invalid character %q", r)
+		}
+	}
+	return nil
+}
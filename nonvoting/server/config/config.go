@@ -325,7 +325,10 @@ func (cfg *Config) FixupAndValidate() error {
 		return errors.New("config: No Authority block was present")
 	}
 	if cfg.Logging == nil {
-		cfg.Logging = &defaultLogging
+		// Copy the defaults, as the section is modified during validation
+		// and may belong to one of several Configs in the same process.
+		logging := defaultLogging
+		cfg.Logging = &logging
 	}
 	if cfg.Parameters == nil {
 		cfg.Parameters = &Parameters{}
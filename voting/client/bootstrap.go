@@ -0,0 +1,138 @@
+// bootstrap.go - Katzenpost voting authority set discovery.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+)
+
+// Bootstrap fetches the current consensus from the seed authorities, one
+// at a time, and returns the authority set published in the first copy
+// that is signed by a majority of the seeds, and lists every seed with its
+// configured keys.  The returned peers can then be used as the Authorities
+// of a new Client, so that clients need only be configured with a few
+// seeds rather than the full authority set.
+func (c *Client) Bootstrap(ctx context.Context, seedPeers []*config.AuthorityPeer) ([]*config.AuthorityPeer, error) {
+	ctx, cancel, err := c.withHalt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	if len(seedPeers) == 0 {
+		return nil, errors.New("voting/Client: Bootstrap() requires seed authorities")
+	}
+	cfg := &Config{
+		LogBackend:    c.cfg.LogBackend,
+		Authorities:   seedPeers,
+		DialContextFn: c.cfg.DialContextFn,
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, err
+	}
+	verifiers := make([]cert.Verifier, len(seedPeers))
+	for i, peer := range seedPeers {
+		verifiers[i] = cert.Verifier(peer.IdentityPublicKey)
+	}
+	threshold := len(verifiers)/2 + 1
+
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	defer linkKey.Reset()
+
+	p := newConnector(cfg)
+	epoch, _, _ := epochtime.Now()
+	for _, seed := range seedPeers {
+		var peers []*config.AuthorityPeer
+		raw, err := p.fetchRawConsensus(ctx, linkKey, seed, epoch)
+		if err == nil {
+			peers, err = verifyAuthoritySet(raw, seedPeers, verifiers, threshold)
+		}
+		if err == nil {
+			return peers, nil
+		}
+		c.log.Errorf("Bootstrap(): Seed %v: %v", seed.IdentityPublicKey, err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("voting/Client: Bootstrap() failed with all %d seed authorities", len(seedPeers))
+}
+
+// verifyAuthoritySet returns the authority set published in the raw
+// consensus, iff it is signed by threshold of the seeds, and includes
+// every one of the seeds.
+func verifyAuthoritySet(raw []byte, seeds []*config.AuthorityPeer, verifiers []cert.Verifier, threshold int) ([]*config.AuthorityPeer, error) {
+	_, good, _, err := cert.VerifyThreshold(verifiers, threshold, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	entries, err := s11n.VerifyAndParseAuthorities(raw, good[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("consensus document has no authority set")
+	}
+
+	peers := make([]*config.AuthorityPeer, 0, len(entries))
+	for _, e := range entries {
+		peer := &config.AuthorityPeer{
+			IdentityPublicKey: new(eddsa.PublicKey),
+			LinkPublicKey:     new(ecdh.PublicKey),
+			Addresses:         e.Addresses,
+		}
+		if err = peer.IdentityPublicKey.FromBytes(e.IdentityKey); err != nil {
+			return nil, err
+		}
+		if err = peer.LinkPublicKey.FromBytes(e.LinkKey); err != nil {
+			return nil, err
+		}
+		if err = peer.Validate(); err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+
+	// The seeds must agree with the authority set on their own keys.
+	for _, seed := range seeds {
+		found := false
+		for _, peer := range peers {
+			if bytes.Equal(peer.IdentityPublicKey.Bytes(), seed.IdentityPublicKey.Bytes()) {
+				found = bytes.Equal(peer.LinkPublicKey.Bytes(), seed.LinkPublicKey.Bytes())
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("seed %v is not in the authority set", seed.IdentityPublicKey)
+		}
+	}
+	return peers, nil
+}
@@ -15,14 +15,30 @@
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
 // Package client implements the Katzenpost voting authority client.
+//
+// The errors returned by the Client can be told apart with errors.Is:
+// ErrNoConsensus when the authority has no consensus for the epoch, and
+// more specifically ErrConsensusGone when it never will, as the round for
+// the epoch failed or the consensus was pruned, ErrVerificationFailed when
+// the consensus is
+// not correctly signed by a threshold of the authorities, and
+// ErrPeerUnreachable when the authority could not be reached.  As required
+// by pki.Client, Get returns pki.ErrNoDocument instead when there will
+// never be a consensus for the epoch.
 package client
 
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 
 	"github.com/katzenpost/authority/internal/s11n"
 	"github.com/katzenpost/authority/voting/server/config"
@@ -32,14 +48,76 @@ import (
 	"github.com/katzenpost/core/crypto/rand"
 	"github.com/katzenpost/core/log"
 	"github.com/katzenpost/core/pki"
-	"github.com/katzenpost/core/utils"
 	"github.com/katzenpost/core/wire"
 	"github.com/katzenpost/core/wire/commands"
 	"gopkg.in/op/go-logging.v1"
 )
 
+// DefaultLoadWeight is the path selection weight of nodes that do not
+// advertise a LoadWeight.
+const DefaultLoadWeight = 1
+
+// maxCachedConsensus is the number of verified consensus documents retained
+// by GetConsensus.
+const maxCachedConsensus = 8
+
+// maxDescriptorsResponse is the maximum size in bytes of the descriptors
+// served by an authority's HTTP gateway for an epoch.
+const maxDescriptorsResponse = 64 * 1024 * 1024
+
 var defaultDialer = &net.Dialer{}
 
+// ErrNoConsensus is the error returned when the authority has no consensus
+// document for the requested epoch, as it is not ready yet or the voting
+// round for the epoch failed.
+var ErrNoConsensus = errors.New("voting/Client: no consensus for the requested epoch")
+
+// ErrVerificationFailed is the error wrapped by the errors returned when a
+// consensus document is malformed, for the wrong epoch, or not signed by a
+// threshold of the authorities.
+var ErrVerificationFailed = errors.New("voting/Client: consensus document failed verification")
+
+// ErrPeerUnreachable is the error wrapped by the errors returned when no
+// connection could be established to an authority, or the connection failed
+// during the request.
+var ErrPeerUnreachable = errors.New("voting/Client: authority is unreachable")
+
+// ErrConsensusGone is the error returned when the authority will never
+// serve a consensus for the requested epoch, either because the voting
+// round for it failed, or because the consensus is no longer retained.  The
+// wire protocol does not tell the two apart.
+var ErrConsensusGone = fmt.Errorf("%w: the authority will never serve it", ErrNoConsensus)
+
+// ErrStaleConsensus is the error returned when the authority answers with
+// the consensus document for an earlier epoch, as the round for the
+// requested epoch failed, and Config.AcceptStaleConsensus is not set.
+var ErrStaleConsensus = errors.New("voting/Client: authority served a stale consensus")
+
+// ErrClientClosed is the error returned by calls to a Client that has been
+// shut down.
+var ErrClientClosed = errors.New("voting/Client: client is shut down")
+
+// ErrIncompatibleDocument is the error returned when the consensus document
+// has a SphinxGeometryVersion other than the one the client supports.
+var ErrIncompatibleDocument = errors.New("voting/Client: consensus document has an incompatible SphinxGeometryVersion")
+
+// ErrNoSphinxGeometry is the error returned when the consensus document
+// does not publish the Sphinx packet geometry.
+var ErrNoSphinxGeometry = errors.New("voting/Client: consensus document has no SphinxGeometry")
+
+// ErrDescriptorsNotRetained is the error returned by GetDescriptors when the
+// authority no longer retains the descriptors for the requested epoch.
+var ErrDescriptorsNotRetained = errors.New("voting/Client: descriptors for the requested epoch are no longer retained")
+
+// ErrNoGateway is the error returned by GetDescriptors when there are no
+// Config.GatewayURLs to fetch the descriptors from.
+var ErrNoGateway = errors.New("voting/Client: no authority HTTP gateway is configured")
+
+// ErrBrokenChain is the error returned when the consensus document commits
+// to a prior document other than the cached consensus for the previous
+// epoch.
+var ErrBrokenChain = fmt.Errorf("%w: document does not chain to the prior consensus", ErrVerificationFailed)
+
 // authorityAuthenticator implements the PeerAuthenticator interface
 type authorityAuthenticator struct {
 	IdentityPublicKey *eddsa.PublicKey
@@ -72,15 +150,61 @@ type Config struct {
 	// DialContextFn is the optional alternative Dialer.DialContext function
 	// to be used when creating outgoing network connections.
 	DialContextFn func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// ProofOfWorkBits is the difficulty of the proof-of-work included with
+	// each posted descriptor, which must be at least the
+	// Debug.SubmissionPoWBits of every authority.  The default of 0 omits
+	// the proof-of-work.
+	ProofOfWorkBits int
+
+	// SphinxGeometryVersion is the Parameters.SphinxGeometryVersion the
+	// client supports.  Consensus documents with any other version are
+	// rejected with ErrIncompatibleDocument.  The default of 0 accepts
+	// every version.
+	SphinxGeometryVersion int
+
+	// InsecureSkipVerify makes the client accept consensus documents
+	// WITHOUT verifying the authority signatures, so that anyone able to
+	// tamper with the connection can substitute their own network.  It
+	// must only ever be used for testing within a trusted boundary.
+	InsecureSkipVerify bool
+
+	// AcceptStaleConsensus makes the client accept the consensus document
+	// for an earlier epoch, that authorities with
+	// Parameters.ServeLastGoodOnFailure set serve when the round for the
+	// requested epoch failed.  The Epoch of such a document is that of the
+	// round that produced it.  Stale documents are not cached.
+	AcceptStaleConsensus bool
+
+	// GatewayURLs are the base URLs of the authorities' HTTP gateways, for
+	// example "https://authority.example.org", which GetDescriptors fetches
+	// the accepted descriptors from, as the wire protocol has no command
+	// for them.
+	GatewayURLs []string
 }
 
 func (cfg *Config) validate() error {
 	if cfg.LogBackend == nil {
 		return fmt.Errorf("voting/client: LogBackend is mandatory")
 	}
+	if cfg.ProofOfWorkBits < 0 {
+		return fmt.Errorf("voting/client: Invalid ProofOfWorkBits: %v", cfg.ProofOfWorkBits)
+	}
+	if cfg.SphinxGeometryVersion < 0 {
+		return fmt.Errorf("voting/client: Invalid SphinxGeometryVersion: %v", cfg.SphinxGeometryVersion)
+	}
+	for _, v := range cfg.GatewayURLs {
+		u, err := url.Parse(v)
+		if err != nil {
+			return fmt.Errorf("voting/client: Invalid GatewayURL: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("voting/client: Invalid GatewayURL: '%v'", v)
+		}
+	}
 	for _, v := range cfg.Authorities {
 		for _, a := range v.Addresses {
-			if err := utils.EnsureAddrIPPort(a); err != nil {
+			if err := config.ValidatePeerAddress(a); err != nil {
 				return fmt.Errorf("voting/client: Invalid Address: %v", err)
 			}
 		}
@@ -172,9 +296,9 @@ func (p *connector) initSession(ctx context.Context, doneCh <-chan interface{},
 	go func() {
 		select {
 		case <-ctx.Done():
-			conn.Close()
 		case <-doneCh:
 		}
+		conn.Close()
 	}()
 
 	// Handshake.
@@ -215,7 +339,7 @@ func (p *connector) allPeersRoundTrip(ctx context.Context, linkKey *ecdh.Private
 		responses = append(responses, resp)
 	}
 	if len(responses) == 0 {
-		return nil, errors.New("allPeerRoundTrip failure, got zero responses")
+		return nil, fmt.Errorf("%w: no authority responded", ErrPeerUnreachable)
 	}
 	return responses, nil
 }
@@ -233,29 +357,89 @@ func (p *connector) randomPeerRoundTrip(ctx context.Context, linkKey *ecdh.Priva
 
 	conn, err := p.initSession(ctx, doneCh, linkKey, nil, p.cfg.Authorities[peerIndex])
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnreachable, err)
 	}
 	resp, err := p.roundTrip(conn.session, cmd)
-	return resp, err
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnreachable, err)
+	}
+	return resp, nil
 }
 
 // Client is a PKI client.
 type Client struct {
+	sync.Mutex
+
 	cfg       *Config
 	log       *logging.Logger
 	pool      *connector
+	http      *http.Client
 	verifiers []cert.Verifier
 	threshold int
+
+	consensusCache map[uint64]*cachedConsensus
+
+	haltCh   chan interface{}
+	haltOnce sync.Once
+}
+
+// Shutdown cancels the requests in flight, closing their connections, and
+// makes all subsequent calls return ErrClientClosed.  It is safe to call
+// Shutdown concurrently with other calls, and more than once.
+func (c *Client) Shutdown() {
+	c.haltOnce.Do(func() {
+		close(c.haltCh)
+
+		c.Lock()
+		defer c.Unlock()
+		c.consensusCache = make(map[uint64]*cachedConsensus)
+	})
+}
+
+func (c *Client) isHalted() bool {
+	select {
+	case <-c.haltCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// withHalt returns a context derived from ctx that is also cancelled by
+// Shutdown, or ErrClientClosed if the client is already shut down.
+func (c *Client) withHalt(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if c.isHalted() {
+		return nil, nil, ErrClientClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-c.haltCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel, nil
 }
 
 // Post posts the node's descriptor to the PKI for the provided epoch.
 func (c *Client) Post(ctx context.Context, epoch uint64, signingKey *eddsa.PrivateKey, d *pki.MixDescriptor) error {
+	ctx, cancel, err := c.withHalt(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
 	// Ensure that the descriptor we are about to post is well formed.
 	if err := s11n.IsDescriptorWellFormed(d, epoch); err != nil {
 		return err
 	}
 	// Make a serialized + signed + serialized descriptor.
-	signed, err := s11n.SignDescriptor(signingKey, d)
+	var nonce uint64
+	if c.cfg.ProofOfWorkBits > 0 {
+		nonce = s11n.SolveProofOfWork(epoch, signingKey.PublicKey(), c.cfg.ProofOfWorkBits)
+	}
+	signed, err := s11n.SignDescriptorWithProofOfWork(signingKey, d, nonce)
 	if err != nil {
 		return err
 	}
@@ -269,6 +453,9 @@ func (c *Client) Post(ctx context.Context, epoch uint64, signingKey *eddsa.Priva
 	}
 	responses, err := c.pool.allPeersRoundTrip(ctx, linkKey, signingKey.PublicKey(), cmd)
 	if err != nil {
+		if c.isHalted() {
+			return ErrClientClosed
+		}
 		return err
 	}
 	// Parse the post_descriptor_status command.
@@ -296,6 +483,276 @@ func (c *Client) Post(ctx context.Context, epoch uint64, signingKey *eddsa.Priva
 // Get returns the PKI document along with the raw serialized form for the provided epoch.
 func (c *Client) Get(ctx context.Context, epoch uint64) (*pki.Document, []byte, error) {
 	c.log.Debugf("Get(ctx, %d)", epoch)
+	doc, raw, err := c.get(ctx, epoch)
+	if err == ErrConsensusGone {
+		err = pki.ErrNoDocument
+	}
+	return doc, raw, err
+}
+
+// GetConsensus returns the consensus document for the provided epoch, after
+// verifying that it is signed by a majority of the configured authorities.
+// Verified documents are cached, and requests for a cached epoch do not
+// touch the network.  If the round for the epoch failed, or the authority no
+// longer retains the document, ErrConsensusGone is returned.  If the
+// document does not chain to the cached document for the previous epoch,
+// ErrBrokenChain is returned.  Nodes listed in the document's Blacklist are
+// omitted from the returned Topology and Providers.
+func (c *Client) GetConsensus(ctx context.Context, epoch uint64) (*pki.Document, error) {
+	doc, _, err := c.getConsensus(ctx, epoch)
+	return doc, err
+}
+
+// cachedConsensus is a verified consensus document, and its raw serialized
+// form.
+type cachedConsensus struct {
+	doc *pki.Document
+	raw []byte
+}
+
+// getConsensus is GetConsensus, that also returns the raw document.
+func (c *Client) getConsensus(ctx context.Context, epoch uint64) (*pki.Document, []byte, error) {
+	if c.isHalted() {
+		return nil, nil, ErrClientClosed
+	}
+	c.Lock()
+	cached, ok := c.consensusCache[epoch]
+	c.Unlock()
+	if ok {
+		return cached.doc, cached.raw, nil
+	}
+
+	doc, raw, err := c.get(ctx, epoch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.Epoch != epoch {
+		return doc, raw, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if err = c.checkChain(epoch, raw); err != nil {
+		return nil, nil, err
+	}
+	c.consensusCache[epoch] = &cachedConsensus{doc: doc, raw: raw}
+	for len(c.consensusCache) > maxCachedConsensus {
+		oldest := epoch
+		for e := range c.consensusCache {
+			if e < oldest {
+				oldest = e
+			}
+		}
+		delete(c.consensusCache, oldest)
+	}
+	return doc, raw, nil
+}
+
+// GetDescriptors returns the descriptors that an authority accepted for the
+// provided epoch, including those of nodes left out of the consensus, as
+// signed by each node and sorted by identity key.  The descriptors are
+// fetched from the HTTP gateway of one of the Config.GatewayURLs, which
+// unlike the wire protocol does not authenticate the authority, so the
+// signature of every descriptor is verified instead.  If the authority no
+// longer retains the descriptors for the epoch, ErrDescriptorsNotRetained
+// is returned.
+func (c *Client) GetDescriptors(ctx context.Context, epoch uint64) ([][]byte, error) {
+	ctx, cancel, err := c.withHalt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if len(c.cfg.GatewayURLs) == 0 {
+		return nil, ErrNoGateway
+	}
+
+	for _, idx := range rand.NewMath().Perm(len(c.cfg.GatewayURLs)) {
+		var descs [][]byte
+		descs, err = c.fetchDescriptors(ctx, c.cfg.GatewayURLs[idx], epoch)
+		if err == nil || err == ErrDescriptorsNotRetained {
+			return descs, err
+		}
+		if c.isHalted() {
+			return nil, ErrClientClosed
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.log.Warningf("Failed to fetch the descriptors for epoch %v from %v: %v", epoch, c.cfg.GatewayURLs[idx], err)
+	}
+	return nil, err
+}
+
+// fetchDescriptors fetches and verifies the descriptors for the epoch from
+// the HTTP gateway at gateway.
+func (c *Client) fetchDescriptors(ctx context.Context, gateway string, epoch uint64) ([][]byte, error) {
+	u := fmt.Sprintf("%s/descriptors?epoch=%d", strings.TrimSuffix(gateway, "/"), epoch)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnreachable, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return nil, ErrDescriptorsNotRetained
+	default:
+		return nil, fmt.Errorf("voting/Client: GetDescriptors() rejected by authority: %v", resp.Status)
+	}
+
+	var descs [][]byte
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxDescriptorsResponse)).Decode(&descs); err != nil {
+		return nil, fmt.Errorf("voting/Client: GetDescriptors() malformed reply: %v", err)
+	}
+	for _, raw := range descs {
+		verifier, err := s11n.GetVerifierFromDescriptor(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+		}
+		if _, err = s11n.VerifyAndParseDescriptor(verifier, raw, epoch); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+		}
+	}
+	return descs, nil
+}
+
+// LoadWeight returns the advisory path selection weight of the node, which
+// is relative to the other nodes in the same layer.  The weight is a hint
+// from the node's operator, and is not taken into account by the topology.
+func LoadWeight(desc *pki.MixDescriptor) uint64 {
+	if desc.LoadWeight == 0 {
+		return DefaultLoadWeight
+	}
+	return uint64(desc.LoadWeight)
+}
+
+// Parameters is the network parameters that the authorities agreed on for
+// an epoch.
+type Parameters struct {
+	SendRatePerMinute uint64
+	Mu                float64
+	MuMaxDelay        uint64
+	LambdaP           float64
+	LambdaPMaxDelay   uint64
+	LambdaL           float64
+	LambdaLMaxDelay   uint64
+	LambdaD           float64
+	LambdaDMaxDelay   uint64
+	LambdaM           float64
+	LambdaMMaxDelay   uint64
+}
+
+// GetParameters returns the network parameters from the consensus document
+// for the provided epoch, which is fetched, verified and cached exactly as
+// with GetConsensus.
+func (c *Client) GetParameters(ctx context.Context, epoch uint64) (*Parameters, error) {
+	doc, err := c.GetConsensus(ctx, epoch)
+	if err != nil {
+		return nil, err
+	}
+	return &Parameters{
+		SendRatePerMinute: doc.SendRatePerMinute,
+		Mu:                doc.Mu,
+		MuMaxDelay:        doc.MuMaxDelay,
+		LambdaP:           doc.LambdaP,
+		LambdaPMaxDelay:   doc.LambdaPMaxDelay,
+		LambdaL:           doc.LambdaL,
+		LambdaLMaxDelay:   doc.LambdaLMaxDelay,
+		LambdaD:           doc.LambdaD,
+		LambdaDMaxDelay:   doc.LambdaDMaxDelay,
+		LambdaM:           doc.LambdaM,
+		LambdaMMaxDelay:   doc.LambdaMMaxDelay,
+	}, nil
+}
+
+// SphinxGeometry is the Sphinx packet geometry that the authorities agreed
+// on for an epoch.
+type SphinxGeometry struct {
+	// Hops is the number of hops in a path, including both Providers.
+	Hops int
+
+	// PerHopRoutingInfoLength is the length in bytes of the routing
+	// information for each hop.
+	PerHopRoutingInfoLength int
+
+	// PayloadLength is the length in bytes of the packet payload.
+	PayloadLength int
+}
+
+// GetSphinxGeometry returns the Sphinx packet geometry from the consensus
+// document for the provided epoch, which is fetched, verified and cached
+// exactly as with GetConsensus, so that it need not be hardcoded.  If the
+// authorities do not publish the geometry, ErrNoSphinxGeometry is returned.
+func (c *Client) GetSphinxGeometry(ctx context.Context, epoch uint64) (*SphinxGeometry, error) {
+	_, raw, err := c.getConsensus(ctx, epoch)
+	if err != nil {
+		return nil, err
+	}
+	g, err := s11n.GetSphinxGeometry(raw)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, ErrNoSphinxGeometry
+	}
+	return &SphinxGeometry{
+		Hops:                    int(g.Hops),
+		PerHopRoutingInfoLength: int(g.PerHopRoutingInfoLength),
+		PayloadLength:           int(g.PayloadLength),
+	}, nil
+}
+
+// checkChain returns ErrBrokenChain iff the raw document for epoch commits
+// to a prior document, and the cached consensus for the previous epoch is
+// not that document.  Documents that are not chained, or whose prior
+// document is not cached, are not checked.
+func (c *Client) checkChain(epoch uint64, raw []byte) error {
+	// Lock is held.
+	prior, ok := c.consensusCache[epoch-1]
+	if !ok {
+		return nil
+	}
+	h, err := s11n.GetPriorDocumentHash(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if h == nil {
+		return nil
+	}
+	want, err := s11n.DocumentHash(prior.raw)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(h, want) {
+		c.log.Errorf("Consensus for epoch %v commits to prior document %x, not %x", epoch, h, want)
+		return ErrBrokenChain
+	}
+	return nil
+}
+
+// GetPriorDocumentHash returns the hash of the previous epoch's consensus
+// that the consensus document for the provided epoch commits to, or nil if
+// the authorities do not chain documents.  The document is fetched,
+// verified and cached exactly as with GetConsensus, which also checks the
+// hash against the cached document for the previous epoch, if any.
+func (c *Client) GetPriorDocumentHash(ctx context.Context, epoch uint64) ([]byte, error) {
+	_, raw, err := c.getConsensus(ctx, epoch)
+	if err != nil {
+		return nil, err
+	}
+	return s11n.GetPriorDocumentHash(raw)
+}
+
+func (c *Client) get(ctx context.Context, epoch uint64) (*pki.Document, []byte, error) {
+	ctx, cancel, err := c.withHalt(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
 
 	// Generate a random ecdh keypair to use for the link authentication.
 	linkKey, err := ecdh.NewKeypair(rand.Reader)
@@ -312,6 +769,13 @@ func (c *Client) Get(ctx context.Context, epoch uint64) (*pki.Document, []byte,
 	cmd := &commands.GetConsensus{Epoch: epoch}
 	resp, err := c.pool.randomPeerRoundTrip(ctx, linkKey, cmd)
 	if err != nil {
+		if c.isHalted() {
+			return nil, nil, ErrClientClosed
+		}
+		if ctx.Err() != nil {
+			// The connection was torn down due to the context.
+			return nil, nil, ctx.Err()
+		}
 		return nil, nil, err
 	}
 
@@ -322,48 +786,93 @@ func (c *Client) Get(ctx context.Context, epoch uint64) (*pki.Document, []byte,
 	}
 	switch r.ErrorCode {
 	case commands.ConsensusOk:
+	case commands.ConsensusNotFound:
+		return nil, nil, ErrNoConsensus
 	case commands.ConsensusGone:
-		return nil, nil, pki.ErrNoDocument
+		return nil, nil, ErrConsensusGone
 	default:
 		return nil, nil, fmt.Errorf("voting/Client: Get() rejected by authority: %v", getErrorToString(r.ErrorCode))
 	}
 
-	// Verify document signatures.
-	doc := &pki.Document{}
-	_, good, bad, err := cert.VerifyThreshold(c.verifiers, c.threshold, r.Payload)
+	doc, err := c.parse(r.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.Epoch < epoch {
+		if !c.cfg.AcceptStaleConsensus {
+			return nil, nil, ErrStaleConsensus
+		}
+		c.log.Warningf("Accepting stale consensus for epoch %v, instead of %v.", doc.Epoch, epoch)
+	} else if doc.Epoch != epoch {
+		return nil, nil, fmt.Errorf("%w: document for WRONG epoch: %v", ErrVerificationFailed, doc.Epoch)
+	}
+	return doc, r.Payload, nil
+}
+
+// Deserialize returns PKI document given the raw bytes.
+func (c *Client) Deserialize(raw []byte) (*pki.Document, error) {
+	return c.parse(raw)
+}
+
+// parse verifies and deserializes the raw consensus document, unless
+// Config.InsecureSkipVerify is set.
+func (c *Client) parse(raw []byte) (*pki.Document, error) {
+	if c.cfg.InsecureSkipVerify {
+		return c.insecureParse(raw)
+	}
+	return c.verifyAndParse(raw)
+}
+
+// verifyAndParse verifies that a threshold of the authorities signed the raw
+// consensus document, and deserializes it.
+func (c *Client) verifyAndParse(raw []byte) (*pki.Document, error) {
+	_, good, bad, err := cert.VerifyThreshold(c.verifiers, c.threshold, raw)
 	if err != nil {
 		c.log.Errorf("VerifyThreshold failure: %d good signatures, %d bad signatures: %v", len(good), len(bad), err)
-		return nil, nil, fmt.Errorf("voting/Client: Get() invalid consensus document: %s", err)
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
 	}
 	if len(good) == len(c.cfg.Authorities) {
 		c.log.Notice("OK, received fully signed consensus document.")
 	}
-	doc, err = s11n.VerifyAndParseDocument(r.Payload, good[0])
+	doc, err := s11n.VerifyAndParseDocument(raw, good[0])
 	if err != nil {
-		// XXX: somehow this returned a nil doc!
-		return nil, nil, err
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
 	}
-	if doc.Epoch != epoch {
-		return nil, nil, fmt.Errorf("voting/Client: Get() consensus document for WRONG epoch: %v", doc.Epoch)
-	}
-	if err != nil {
-		c.log.Errorf("voting/Client: Get() invalid consensus document: %s", err)
-		return nil, nil, fmt.Errorf("voting/Client: Get() invalid consensus document: %s", err)
+	if err = c.checkGeometryVersion(raw); err != nil {
+		return nil, err
 	}
-	return doc, r.Payload, nil
+	return doc, nil
 }
 
-// Deserialize returns PKI document given the raw bytes.
-func (c *Client) Deserialize(raw []byte) (*pki.Document, error) {
-	_, good, _, err := cert.VerifyThreshold(c.verifiers, c.threshold, raw)
+// insecureParse deserializes the raw consensus document WITHOUT verifying
+// any of the authority signatures, see Config.InsecureSkipVerify.
+func (c *Client) insecureParse(raw []byte) (*pki.Document, error) {
+	c.log.Warning("INSECURE: Skipping the verification of the consensus document signatures.")
+	doc, err := s11n.InsecureParseDocument(raw)
 	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if err = c.checkGeometryVersion(raw); err != nil {
 		return nil, err
 	}
-	doc, err := s11n.VerifyAndParseDocument(raw, good[0])
+	return doc, nil
+}
+
+// checkGeometryVersion returns ErrIncompatibleDocument iff the raw document
+// has a SphinxGeometryVersion other than the configured one.
+func (c *Client) checkGeometryVersion(raw []byte) error {
+	if c.cfg.SphinxGeometryVersion == 0 {
+		return nil
+	}
+	v, err := s11n.GetSphinxGeometryVersion(raw)
 	if err != nil {
-		fmt.Errorf("Deserialize failure: %s", err)
+		return err
 	}
-	return doc, err
+	if v != uint64(c.cfg.SphinxGeometryVersion) {
+		c.log.Errorf("Consensus has SphinxGeometryVersion %v, but %v is supported", v, c.cfg.SphinxGeometryVersion)
+		return ErrIncompatibleDocument
+	}
+	return nil
 }
 
 // New constructs a new pki.Client instance.
@@ -379,11 +888,21 @@ func New(cfg *Config) (pki.Client, error) {
 	c.cfg = cfg
 	c.log = cfg.LogBackend.GetLogger("pki/voting/Client")
 	c.pool = newConnector(cfg)
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if cfg.DialContextFn != nil {
+		transport.DialContext = cfg.DialContextFn
+	}
+	c.http = &http.Client{Transport: transport}
 	c.verifiers = make([]cert.Verifier, len(c.cfg.Authorities))
 	for i, auth := range c.cfg.Authorities {
 		c.verifiers[i] = cert.Verifier(auth.IdentityPublicKey)
 	}
 	c.threshold = len(c.verifiers)/2 + 1
+	c.consensusCache = make(map[uint64]*cachedConsensus)
+	c.haltCh = make(chan interface{})
+	if cfg.InsecureSkipVerify {
+		c.log.Warning("INSECURE: InsecureSkipVerify is set, consensus documents will NOT be verified!")
+	}
 	return c, nil
 }
 
@@ -20,8 +20,12 @@ package client
 import (
 	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -243,14 +247,25 @@ func multiSignTestDocument(signingKeys []*eddsa.PrivateKey, d *s11n.Document) ([
 	return signed, nil
 }
 
-func generateDoc(epoch uint64, signingKeys []*eddsa.PrivateKey) ([]byte, error) {
-	// XXX
+func generateDoc(epoch uint64, signingKeys []*eddsa.PrivateKey, geometryVersion uint64) ([]byte, error) {
+	return generateDocWithAuthorities(epoch, signingKeys, geometryVersion, nil, nil)
+}
+
+func generateDocWithAuthorities(epoch uint64, signingKeys []*eddsa.PrivateKey, geometryVersion uint64, authorities []*s11n.AuthorityEntry, geometry *s11n.SphinxGeometry) ([]byte, error) {
+	// Every layer needs a mix for the document to be well formed, however
+	// few authorities there are.
 	numMixes := len(signingKeys) - 2
+	if numMixes < 3 {
+		numMixes = 3
+	}
 	numProviders := 2
 	doc, err := generateMixnet(numMixes, numProviders, epoch)
 	if err != nil {
 		return nil, err
 	}
+	doc.SphinxGeometryVersion = geometryVersion
+	doc.Authorities = authorities
+	doc.SphinxGeometry = geometry
 	signed, err := multiSignTestDocument(signingKeys, doc)
 	if err != nil {
 		return nil, err
@@ -267,8 +282,14 @@ type conn struct {
 
 type mockDialer struct {
 	sync.Mutex
-	netMap map[string]*conn
-	log    *logging.Logger
+	netMap    map[string]*conn
+	log       *logging.Logger
+	errorCode uint8
+
+	geometryVersion uint64
+	staleBy         uint64
+	authorities     []*s11n.AuthorityEntry
+	geometry        *s11n.SphinxGeometry
 }
 
 func newMockDialer(logBackend *log.Backend) *mockDialer {
@@ -345,11 +366,15 @@ func (d *mockDialer) mockServer(address string, linkPrivateKey *ecdh.PrivateKey,
 	}
 	switch c := cmd.(type) {
 	case *commands.GetConsensus:
+		if d.errorCode != commands.ConsensusOk {
+			session.SendCommand(&commands.Consensus{ErrorCode: d.errorCode})
+			return
+		}
 		signingKeys := []*eddsa.PrivateKey{}
 		for _, v := range d.netMap {
 			signingKeys = append(signingKeys, v.signingKey)
 		}
-		rawDoc, err := generateDoc(c.Epoch, signingKeys)
+		rawDoc, err := generateDocWithAuthorities(c.Epoch-d.staleBy, signingKeys, d.geometryVersion, d.authorities, d.geometry)
 		if err != nil {
 			d.log.Errorf("mockServer session generateDoc failure: %s", err)
 			return
@@ -418,3 +443,784 @@ func TestClient(t *testing.T) {
 	require.Equal(epoch, doc.Epoch)
 	t.Logf("rawDoc size is %d", len(rawDoc))
 }
+
+func TestGetConsensus(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	peers := []*config.AuthorityPeer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	}
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:    logBackend,
+		Authorities:   peers,
+		DialContextFn: dialer.dial,
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	client := c.(*Client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	epoch, _, _ := epochtime.Now()
+	doc, err := client.GetConsensus(ctx, epoch)
+	require.NoError(err)
+	require.Equal(epoch, doc.Epoch)
+
+	// The second request is served from the cache, the mock authorities
+	// only answer a single request.
+	cached, err := client.GetConsensus(ctx, epoch)
+	require.NoError(err)
+	require.True(doc == cached)
+}
+
+func TestGetParameters(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	peers := []*config.AuthorityPeer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	}
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:    logBackend,
+		Authorities:   peers,
+		DialContextFn: dialer.dial,
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	client := c.(*Client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	epoch, _, _ := epochtime.Now()
+	params, err := client.GetParameters(ctx, epoch)
+	require.NoError(err)
+	require.Equal(0.25, params.Mu)
+	require.Equal(uint64(4000), params.MuMaxDelay)
+	require.Equal(1.2, params.LambdaP)
+	require.Equal(uint64(300), params.LambdaPMaxDelay)
+
+	// The document is cached, so the consensus agrees with the parameters.
+	doc, err := client.GetConsensus(ctx, epoch)
+	require.NoError(err)
+	require.Equal(doc.LambdaP, params.LambdaP)
+}
+
+func TestGetDescriptors(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 23
+	nodes, err := generateNodes(false, 3, epoch)
+	require.NoError(err)
+	var raws [][]byte
+	for _, n := range nodes {
+		raws = append(raws, n.raw)
+	}
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/descriptors", r.URL.Path)
+		switch r.URL.Query().Get("epoch") {
+		case "23":
+			json.NewEncoder(w).Encode(raws)
+		case "24":
+			json.NewEncoder(w).Encode([][]byte{raws[0][1:]})
+		default:
+			http.Error(w, "no longer retained", http.StatusGone)
+		}
+	}))
+	defer gateway.Close()
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peer, _, _, err := generatePeer(0)
+	require.NoError(err)
+	cfg := &Config{
+		LogBackend:  logBackend,
+		Authorities: []*config.AuthorityPeer{peer},
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	client := c.(*Client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err = client.GetDescriptors(ctx, epoch)
+	require.Equal(ErrNoGateway, err)
+
+	cfg.GatewayURLs = []string{gateway.URL + "/"}
+	descs, err := client.GetDescriptors(ctx, epoch)
+	require.NoError(err)
+	require.Equal(raws, descs)
+
+	// Descriptors that are not correctly self signed are rejected.
+	_, err = client.GetDescriptors(ctx, epoch+1)
+	require.True(errors.Is(err, ErrVerificationFailed))
+
+	_, err = client.GetDescriptors(ctx, epoch-1)
+	require.Equal(ErrDescriptorsNotRetained, err)
+}
+
+func TestSphinxGeometryVersion(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	dialer.geometryVersion = 2
+	peers := []*config.AuthorityPeer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	}
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:            logBackend,
+		Authorities:           peers,
+		DialContextFn:         dialer.dial,
+		SphinxGeometryVersion: 2,
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	epoch, _, _ := epochtime.Now()
+	_, raw, err := c.Get(ctx, epoch)
+	require.NoError(err)
+
+	// A client for a newer geometry refuses the document.
+	newer, err := New(&Config{
+		LogBackend:            logBackend,
+		Authorities:           peers,
+		SphinxGeometryVersion: 3,
+	})
+	require.NoError(err)
+	_, err = newer.Deserialize(raw)
+	require.Equal(ErrIncompatibleDocument, err)
+
+	// By default, every version is accepted.
+	any, err := New(&Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+	})
+	require.NoError(err)
+	_, err = any.Deserialize(raw)
+	require.NoError(err)
+
+	_, err = New(&Config{
+		LogBackend:            logBackend,
+		Authorities:           peers,
+		SphinxGeometryVersion: -1,
+	})
+	require.Error(err)
+}
+
+func TestGetSphinxGeometry(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	dialer.geometry = &s11n.SphinxGeometry{Hops: 5, PerHopRoutingInfoLength: 65, PayloadLength: 50 * 1024}
+	peers := []*config.AuthorityPeer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	}
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:    logBackend,
+		Authorities:   peers,
+		DialContextFn: dialer.dial,
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	client := c.(*Client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	epoch, _, _ := epochtime.Now()
+	g, err := client.GetSphinxGeometry(ctx, epoch)
+	require.NoError(err)
+	require.Equal(&SphinxGeometry{Hops: 5, PerHopRoutingInfoLength: 65, PayloadLength: 50 * 1024}, g)
+
+	// The document is cached, so the geometry is served without
+	// another connection.
+	g, err = client.GetSphinxGeometry(ctx, epoch)
+	require.NoError(err)
+	require.Equal(5, g.Hops)
+	_, err = client.GetConsensus(ctx, epoch)
+	require.NoError(err)
+
+	// Documents without a geometry have none to return.
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	raw, err := generateDoc(epoch+1, []*eddsa.PrivateKey{k}, 0)
+	require.NoError(err)
+	client.Lock()
+	client.consensusCache[epoch+1] = &cachedConsensus{doc: &pki.Document{Epoch: epoch + 1}, raw: raw}
+	client.Unlock()
+	_, err = client.GetSphinxGeometry(ctx, epoch+1)
+	require.Equal(ErrNoSphinxGeometry, err)
+}
+
+func TestDocumentChain(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peer, _, _, err := generatePeer(0)
+	require.NoError(err)
+	c, err := New(&Config{
+		LogBackend:    logBackend,
+		Authorities:   []*config.AuthorityPeer{peer},
+		DialContextFn: newMockDialer(logBackend).dial,
+	})
+	require.NoError(err)
+	client := c.(*Client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	const epoch = 23
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	prior, err := generateDoc(epoch-1, []*eddsa.PrivateKey{k}, 0)
+	require.NoError(err)
+	priorHash, err := s11n.DocumentHash(prior)
+	require.NoError(err)
+	chained := func(h []byte) []byte {
+		raw, err := s11n.SignDocument(k, &s11n.Document{Epoch: epoch, PriorDocumentHash: h})
+		require.NoError(err)
+		return raw
+	}
+
+	// Nothing is checked without the prior document.
+	client.Lock()
+	require.NoError(client.checkChain(epoch, chained(make([]byte, s11n.DocumentHashLength))))
+	client.consensusCache[epoch-1] = &cachedConsensus{doc: &pki.Document{Epoch: epoch - 1}, raw: prior}
+
+	// A document must commit to the cached prior document, if it is
+	// chained at all.
+	require.NoError(client.checkChain(epoch, chained(priorHash)))
+	require.NoError(client.checkChain(epoch, chained(nil)))
+	err = client.checkChain(epoch, chained(make([]byte, s11n.DocumentHashLength)))
+	require.Equal(ErrBrokenChain, err)
+	require.True(errors.Is(err, ErrVerificationFailed))
+
+	client.consensusCache[epoch] = &cachedConsensus{doc: &pki.Document{Epoch: epoch}, raw: chained(priorHash)}
+	client.Unlock()
+	h, err := client.GetPriorDocumentHash(ctx, epoch)
+	require.NoError(err)
+	require.Equal(priorHash, h)
+	h, err = client.GetPriorDocumentHash(ctx, epoch-1)
+	require.NoError(err)
+	require.Nil(h)
+}
+
+func TestBlacklist(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peer, idPrivKey, _, err := generatePeer(0)
+	require.NoError(err)
+	c, err := New(&Config{
+		LogBackend:    logBackend,
+		Authorities:   []*config.AuthorityPeer{peer},
+		DialContextFn: newMockDialer(logBackend).dial,
+	})
+	require.NoError(err)
+	client := c.(*Client)
+
+	const epoch = 23
+	d, err := generateMixnet(6, 2, epoch)
+	require.NoError(err)
+	raw, err := multiSignTestDocument([]*eddsa.PrivateKey{idPrivKey}, d)
+	require.NoError(err)
+	doc, err := client.verifyAndParse(raw)
+	require.NoError(err)
+	mix, provider := doc.Topology[0][0], doc.Providers[0]
+
+	// Listed nodes never reach the caller.
+	d.Blacklist = []*s11n.BlacklistEntry{
+		{IdentityKey: mix.IdentityKey.Bytes()},
+		{IdentityKey: provider.IdentityKey.Bytes(), Until: epoch + 1},
+	}
+	s11n.SortBlacklist(d.Blacklist)
+	raw, err = multiSignTestDocument([]*eddsa.PrivateKey{idPrivKey}, d)
+	require.NoError(err)
+	doc, err = client.verifyAndParse(raw)
+	require.NoError(err)
+	require.Len(doc.Topology[0], 1)
+	require.NotEqual(mix.IdentityKey.Bytes(), doc.Topology[0][0].IdentityKey.Bytes())
+	require.Len(doc.Providers, 1)
+	require.NotEqual(provider.IdentityKey.Bytes(), doc.Providers[0].IdentityKey.Bytes())
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peers := []*config.AuthorityPeer{}
+	for i := 0; i < 3; i++ {
+		peer, _, _, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+	}
+
+	// The document is signed by keys that are not the authorities'.
+	signingKeys := []*eddsa.PrivateKey{}
+	for i := 0; i < 3; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		signingKeys = append(signingKeys, k)
+	}
+	epoch, _, _ := epochtime.Now()
+	raw, err := generateDoc(epoch, signingKeys, 0)
+	require.NoError(err)
+
+	// By default, the signatures are verified.
+	c, err := New(&Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+	})
+	require.NoError(err)
+	_, err = c.Deserialize(raw)
+	require.Error(err)
+
+	insecure, err := New(&Config{
+		LogBackend:         logBackend,
+		Authorities:        peers,
+		InsecureSkipVerify: true,
+	})
+	require.NoError(err)
+	doc, err := insecure.Deserialize(raw)
+	require.NoError(err)
+	require.Equal(epoch, doc.Epoch)
+}
+
+func TestGetConsensusGone(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	dialer.errorCode = commands.ConsensusGone
+	peer, idPrivKey, linkPrivKey, err := generatePeer(0)
+	require.NoError(err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:    logBackend,
+		Authorities:   []*config.AuthorityPeer{peer},
+		DialContextFn: dialer.dial,
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	epoch, _, _ := epochtime.Now()
+	_, err = c.(*Client).GetConsensus(ctx, epoch-10)
+	require.Equal(ErrConsensusGone, err)
+	_, _, err = c.Get(ctx, epoch-10)
+	require.Equal(pki.ErrNoDocument, err)
+}
+
+func TestErrors(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	epoch, _, _ := epochtime.Now()
+	getConsensus := func(errorCode uint8, epoch uint64) error {
+		dialer := newMockDialer(logBackend)
+		dialer.errorCode = errorCode
+		peer, idPrivKey, linkPrivKey, err := generatePeer(0)
+		require.NoError(err)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+		wg.Wait()
+		c, err := New(&Config{
+			LogBackend:    logBackend,
+			Authorities:   []*config.AuthorityPeer{peer},
+			DialContextFn: dialer.dial,
+		})
+		require.NoError(err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_, err = c.(*Client).GetConsensus(ctx, epoch)
+		return err
+	}
+
+	// The consensus is not ready yet, or never will be.
+	err = getConsensus(commands.ConsensusNotFound, epoch)
+	require.True(errors.Is(err, ErrNoConsensus), "%v", err)
+	err = getConsensus(commands.ConsensusGone, epoch)
+	require.True(errors.Is(err, ErrConsensusGone), "%v", err)
+	require.True(errors.Is(err, ErrNoConsensus), "%v", err)
+
+	// The consensus is not signed by the authorities.
+	peers := []*config.AuthorityPeer{}
+	signingKeys := []*eddsa.PrivateKey{}
+	for i := 0; i < 3; i++ {
+		peer, _, _, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		signingKeys = append(signingKeys, k)
+	}
+	raw, err := generateDoc(epoch, signingKeys, 0)
+	require.NoError(err)
+	c, err := New(&Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+		DialContextFn: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	})
+	require.NoError(err)
+	_, err = c.Deserialize(raw)
+	require.True(errors.Is(err, ErrVerificationFailed), "%v", err)
+
+	// The authority is unreachable.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = c.(*Client).GetConsensus(ctx, epoch)
+	require.True(errors.Is(err, ErrPeerUnreachable), "%v", err)
+	_, err = fetchAndVerifyConsensus(ctx, c.(*Client).cfg, epoch, 1)
+	require.IsType(&DisagreementError{}, err)
+	for _, cc := range err.(*DisagreementError).Copies {
+		require.True(errors.Is(cc.Err, ErrPeerUnreachable), "%v", cc.Err)
+	}
+}
+
+func TestGetConsensusCancel(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peer, _, _, err := generatePeer(0)
+	require.NoError(err)
+
+	// The authority never answers.
+	cfg := &Config{
+		LogBackend:  logBackend,
+		Authorities: []*config.AuthorityPeer{peer},
+		DialContextFn: func(ctx context.Context, network, address string) (net.Conn, error) {
+			clientConn, _ := net.Pipe()
+			return clientConn, nil
+		},
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	epoch, _, _ := epochtime.Now()
+	start := time.Now()
+	_, err = c.(*Client).GetConsensus(ctx, epoch)
+	require.Equal(context.Canceled, err)
+	require.True(time.Since(start) < 5*time.Second)
+}
+
+func TestShutdown(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	peer, _, _, err := generatePeer(0)
+	require.NoError(err)
+
+	// The authority never answers.
+	cfg := &Config{
+		LogBackend:  logBackend,
+		Authorities: []*config.AuthorityPeer{peer},
+		DialContextFn: func(ctx context.Context, network, address string) (net.Conn, error) {
+			clientConn, _ := net.Pipe()
+			return clientConn, nil
+		},
+	}
+	c, err := New(cfg)
+	require.NoError(err)
+	client := c.(*Client)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		client.Shutdown()
+	}()
+
+	// The request in flight is cancelled.
+	epoch, _, _ := epochtime.Now()
+	start := time.Now()
+	_, err = client.GetConsensus(context.Background(), epoch)
+	require.Equal(ErrClientClosed, err)
+	require.True(time.Since(start) < 5*time.Second)
+
+	// Shutdown is idempotent, and subsequent calls fail.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Shutdown()
+		}()
+	}
+	wg.Wait()
+	_, _, err = client.Get(context.Background(), epoch)
+	require.Equal(ErrClientClosed, err)
+	_, err = client.GetParameters(context.Background(), epoch)
+	require.Equal(ErrClientClosed, err)
+	require.Equal(ErrClientClosed, client.Post(context.Background(), epoch, nil, nil))
+}
+
+func TestAgreedCopy(t *testing.T) {
+	require := require.New(t)
+
+	a := &ConsensusCopy{Hash: []byte{0x01}}
+	b := &ConsensusCopy{Hash: []byte{0x02}}
+	failed := &ConsensusCopy{Err: errors.New("connection refused")}
+
+	require.Equal(a, agreedCopy([]*ConsensusCopy{a, a, b}, 2))
+	require.Nil(agreedCopy([]*ConsensusCopy{a, b, failed}, 2))
+
+	// Failures never count towards a quorum.
+	require.Nil(agreedCopy([]*ConsensusCopy{failed, failed, failed}, 1))
+
+	// Two distinct documents reaching the quorum is a disagreement.
+	require.Nil(agreedCopy([]*ConsensusCopy{a, b}, 1))
+}
+
+func TestFetchAndVerifyConsensusDisagreement(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	dialer := newMockDialer(logBackend)
+	peers := []*config.AuthorityPeer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+		require.NoError(err)
+		peers = append(peers, peer)
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+	}
+	wg.Wait()
+	cfg := &Config{
+		LogBackend:    logBackend,
+		Authorities:   peers,
+		DialContextFn: dialer.dial,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	epoch, _, _ := epochtime.Now()
+
+	// Each mock authority generates its own document, so no two copies
+	// are identical.
+	doc, err := fetchAndVerifyConsensus(ctx, cfg, epoch, 2)
+	require.Nil(doc)
+	require.IsType(&DisagreementError{}, err)
+	dErr := err.(*DisagreementError)
+	require.Len(dErr.Copies, len(peers))
+	for _, c := range dErr.Copies {
+		require.NoError(c.Err)
+		require.NotNil(c.Hash)
+	}
+}
+
+func TestLoadWeight(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(uint64(DefaultLoadWeight), LoadWeight(&pki.MixDescriptor{}))
+	require.Equal(uint64(42), LoadWeight(&pki.MixDescriptor{LoadWeight: 42}))
+}
+
+func TestAcceptStaleConsensus(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	epoch, _, _ := epochtime.Now()
+	getStale := func(acceptStale bool) (*pki.Document, error) {
+		// The authority answers with the previous epoch's document.
+		dialer := newMockDialer(logBackend)
+		dialer.staleBy = 1
+		peer, idPrivKey, linkPrivKey, err := generatePeer(0)
+		require.NoError(err)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+		wg.Wait()
+		c, err := New(&Config{
+			LogBackend:           logBackend,
+			Authorities:          []*config.AuthorityPeer{peer},
+			DialContextFn:        dialer.dial,
+			AcceptStaleConsensus: acceptStale,
+		})
+		require.NoError(err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		return c.(*Client).GetConsensus(ctx, epoch)
+	}
+
+	_, err = getStale(false)
+	require.Equal(ErrStaleConsensus, err)
+
+	doc, err := getStale(true)
+	require.NoError(err)
+	require.Equal(epoch-1, doc.Epoch)
+}
+
+// BenchmarkVerifyConsensus measures the client side cost of verifying a
+// consensus document signed by each of 10 authorities.  There is no
+// aggregated counterpart to compare against: Ed25519 signatures can not be
+// soundly aggregated, and core/crypto/cert offers neither batch verification
+// nor a multi-signature encoding, so signature aggregation was declined.
+func BenchmarkVerifyConsensus(b *testing.B) {
+	const nrAuthorities = 10
+
+	logBackend, err := log.New("", "ERROR", false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	peers := []*config.AuthorityPeer{}
+	signingKeys := []*eddsa.PrivateKey{}
+	for i := 0; i < nrAuthorities; i++ {
+		peer, idPrivKey, _, err := generatePeer(i)
+		if err != nil {
+			b.Fatal(err)
+		}
+		peers = append(peers, peer)
+		signingKeys = append(signingKeys, idPrivKey)
+	}
+	epoch, _, _ := epochtime.Now()
+	raw, err := generateDoc(epoch, signingKeys, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, err := New(&Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(raw)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Deserialize(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	require := require.New(t)
+
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	c, err := New(&Config{LogBackend: logBackend})
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// newNetwork starts an authority for each of n peers, that serve a
+	// consensus signed by all of them, listing the first nrListed.
+	newNetwork := func(n, nrListed int) ([]*config.AuthorityPeer, *mockDialer) {
+		dialer := newMockDialer(logBackend)
+		peers := []*config.AuthorityPeer{}
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			peer, idPrivKey, linkPrivKey, err := generatePeer(i)
+			require.NoError(err)
+			peers = append(peers, peer)
+			wg.Add(1)
+			go dialer.mockServer(peer.Addresses[0], linkPrivKey, idPrivKey, &wg)
+		}
+		wg.Wait()
+		for _, v := range peers[:nrListed] {
+			dialer.authorities = append(dialer.authorities, &s11n.AuthorityEntry{
+				IdentityKey: v.IdentityPublicKey.Bytes(),
+				LinkKey:     v.LinkPublicKey.Bytes(),
+				Addresses:   v.Addresses,
+			})
+		}
+		s11n.SortAuthorities(dialer.authorities)
+		return peers, dialer
+	}
+	bootstrap := func(dialer *mockDialer, seeds []*config.AuthorityPeer) ([]*config.AuthorityPeer, error) {
+		c.(*Client).cfg.DialContextFn = dialer.dial
+		return c.(*Client).Bootstrap(ctx, seeds)
+	}
+
+	// The full set is learned from a majority of the seeds.
+	peers, dialer := newNetwork(3, 3)
+	set, err := bootstrap(dialer, peers[:2])
+	require.NoError(err)
+	require.Len(set, 3)
+	for _, peer := range peers {
+		found := false
+		for _, v := range set {
+			if v.IdentityPublicKey.Equal(peer.IdentityPublicKey) {
+				require.Equal(peer.LinkPublicKey.Bytes(), v.LinkPublicKey.Bytes())
+				require.Equal(peer.Addresses, v.Addresses)
+				found = true
+			}
+		}
+		require.True(found)
+	}
+
+	// Seeds that did not sign the consensus are refused.
+	peers, dialer = newNetwork(3, 3)
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	stranger := &config.AuthorityPeer{
+		IdentityPublicKey: k.PublicKey(),
+		LinkPublicKey:     peers[1].LinkPublicKey,
+		Addresses:         peers[1].Addresses,
+	}
+	_, err = bootstrap(dialer, []*config.AuthorityPeer{peers[0], stranger})
+	require.Error(err)
+
+	// As are seeds that are not in the authority set they signed.
+	peers, dialer = newNetwork(3, 2)
+	_, err = bootstrap(dialer, []*config.AuthorityPeer{peers[0], peers[2]})
+	require.Error(err)
+
+	_, err = c.(*Client).Bootstrap(ctx, nil)
+	require.Error(err)
+}
@@ -0,0 +1,224 @@
+// quorum.go - Katzenpost voting authority quorum consensus fetch.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/log"
+	"github.com/katzenpost/core/pki"
+	"github.com/katzenpost/core/wire/commands"
+	"golang.org/x/crypto/sha3"
+)
+
+// quorumFetchTimeout is the time allowed for fetching the consensus from
+// all of the authorities by FetchAndVerifyConsensus.
+const quorumFetchTimeout = 60 * time.Second
+
+// ConsensusCopy is the outcome of fetching the consensus from one authority.
+type ConsensusCopy struct {
+	// Peer is the authority the copy was fetched from.
+	Peer *config.AuthorityPeer
+
+	// Hash is the SHA3-256 digest of the raw document, if one was
+	// successfully fetched and verified.
+	Hash []byte
+
+	// Err is the reason the copy could not be fetched or verified, if any.
+	Err error
+
+	doc *pki.Document
+	raw []byte
+}
+
+func (c *ConsensusCopy) String() string {
+	if c.Err != nil {
+		return fmt.Sprintf("%v: %v", c.Peer.IdentityPublicKey, c.Err)
+	}
+	return fmt.Sprintf("%v: %v", c.Peer.IdentityPublicKey, hex.EncodeToString(c.Hash))
+}
+
+// DisagreementError is the error returned when no quorum of authorities
+// served byte-identical, correctly signed copies of the consensus.
+type DisagreementError struct {
+	// Epoch is the epoch of the requested consensus.
+	Epoch uint64
+
+	// Quorum is the number of identical copies that were required.
+	Quorum int
+
+	// Copies is the outcome of the fetch from each authority.
+	Copies []*ConsensusCopy
+}
+
+func (e *DisagreementError) Error() string {
+	s := make([]string, 0, len(e.Copies))
+	for _, c := range e.Copies {
+		s = append(s, c.String())
+	}
+	return fmt.Sprintf("voting/Client: no quorum of %d for the consensus for epoch %v: [%v]", e.Quorum, e.Epoch, strings.Join(s, ", "))
+}
+
+// FetchAndVerifyConsensus fetches the consensus for the given epoch from each
+// of the authorities independently, and returns the document if at least
+// quorum of them served byte-identical copies with valid threshold signatures.
+// If the authorities disagree, a *DisagreementError describing each copy is
+// returned instead.
+func FetchAndVerifyConsensus(peers []*config.AuthorityPeer, epoch uint64, quorum int) (*pki.Document, error) {
+	logBackend, err := log.New("", "ERROR", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), quorumFetchTimeout)
+	defer cancel()
+	return fetchAndVerifyConsensus(ctx, cfg, epoch, quorum)
+}
+
+func fetchAndVerifyConsensus(ctx context.Context, cfg *Config, epoch uint64, quorum int) (*pki.Document, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if quorum < 1 || quorum > len(cfg.Authorities) {
+		return nil, fmt.Errorf("voting/Client: invalid quorum %d for %d authorities", quorum, len(cfg.Authorities))
+	}
+
+	verifiers := make([]cert.Verifier, len(cfg.Authorities))
+	for i, auth := range cfg.Authorities {
+		verifiers[i] = cert.Verifier(auth.IdentityPublicKey)
+	}
+	threshold := len(verifiers)/2 + 1
+
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	defer linkKey.Reset()
+
+	p := newConnector(cfg)
+	copies := make([]*ConsensusCopy, 0, len(cfg.Authorities))
+	for _, peer := range cfg.Authorities {
+		c := &ConsensusCopy{Peer: peer}
+		c.doc, c.raw, c.Err = p.fetchConsensus(ctx, linkKey, peer, epoch, verifiers, threshold)
+		if c.Err == nil {
+			h := sha3.Sum256(c.raw)
+			c.Hash = h[:]
+		}
+		copies = append(copies, c)
+	}
+
+	if agreed := agreedCopy(copies, quorum); agreed != nil {
+		return agreed.doc, nil
+	}
+	return nil, &DisagreementError{
+		Epoch:  epoch,
+		Quorum: quorum,
+		Copies: copies,
+	}
+}
+
+func (p *connector) fetchConsensus(ctx context.Context, linkKey *ecdh.PrivateKey, peer *config.AuthorityPeer, epoch uint64, verifiers []cert.Verifier, threshold int) (*pki.Document, []byte, error) {
+	raw, err := p.fetchRawConsensus(ctx, linkKey, peer, epoch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, good, _, err := cert.VerifyThreshold(verifiers, threshold, raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	doc, err := s11n.VerifyAndParseDocument(raw, good[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if doc.Epoch != epoch {
+		return nil, nil, fmt.Errorf("%w: document for WRONG epoch: %v", ErrVerificationFailed, doc.Epoch)
+	}
+	return doc, raw, nil
+}
+
+// fetchRawConsensus fetches the consensus for epoch from peer, without
+// verifying it.
+func (p *connector) fetchRawConsensus(ctx context.Context, linkKey *ecdh.PrivateKey, peer *config.AuthorityPeer, epoch uint64) ([]byte, error) {
+	doneCh := make(chan interface{})
+	defer close(doneCh)
+
+	conn, err := p.initSession(ctx, doneCh, linkKey, nil, peer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnreachable, err)
+	}
+	defer conn.session.Close()
+	resp, err := p.roundTrip(conn.session, &commands.GetConsensus{Epoch: epoch})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnreachable, err)
+	}
+	r, ok := resp.(*commands.Consensus)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply: %T", resp)
+	}
+	switch r.ErrorCode {
+	case commands.ConsensusOk:
+	case commands.ConsensusNotFound, commands.ConsensusGone:
+		return nil, fmt.Errorf("%w: %v", ErrNoConsensus, getErrorToString(r.ErrorCode))
+	default:
+		return nil, fmt.Errorf("rejected by authority: %v", getErrorToString(r.ErrorCode))
+	}
+	return r.Payload, nil
+}
+
+// agreedCopy returns a copy of the consensus that is byte-identical to at
+// least quorum of the successfully fetched copies, or nil.  If more than one
+// distinct document reaches the quorum the authorities disagree, and nil is
+// returned rather than picking one.
+func agreedCopy(copies []*ConsensusCopy, quorum int) *ConsensusCopy {
+	counts := make(map[string]int)
+	first := make(map[string]*ConsensusCopy)
+	for _, c := range copies {
+		if c.Err != nil {
+			continue
+		}
+		k := string(c.Hash)
+		counts[k]++
+		if _, ok := first[k]; !ok {
+			first[k] = c
+		}
+	}
+
+	var agreed *ConsensusCopy
+	for k, n := range counts {
+		if n < quorum {
+			continue
+		}
+		if agreed != nil {
+			return nil
+		}
+		agreed = first[k]
+	}
+	return agreed
+}
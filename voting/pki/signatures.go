@@ -0,0 +1,196 @@
+// signatures.go - Katzenpost voting authority document signature auditing.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package pki implements offline verification routines for documents
+// produced by the Katzenpost voting authority, that do not require a
+// running authority or a network connection.
+package pki
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// SignatureStatus is the outcome of verifying a single document signature.
+type SignatureStatus int
+
+const (
+	// SignatureValid is a valid signature made by a configured peer.
+	SignatureValid SignatureStatus = iota
+
+	// SignatureInvalid is a signature that failed to verify.
+	SignatureInvalid
+
+	// SignatureUnknown is a valid signature made by a key that does not
+	// belong to any of the configured peers.
+	SignatureUnknown
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureUnknown:
+		return "valid, unknown signatory"
+	default:
+		return fmt.Sprintf("[unknown status: %d]", int(s))
+	}
+}
+
+// SignatureResult is the verification result of a single signature.
+type SignatureResult struct {
+	// IdentityKey is the key the signature claims to be made with, or nil
+	// if the key is malformed.
+	IdentityKey *eddsa.PublicKey
+
+	// Peer is the configured peer that owns IdentityKey, or nil.
+	Peer *config.AuthorityPeer
+
+	// Status is the verification status of the signature.
+	Status SignatureStatus
+
+	// Err is the reason the signature failed to verify, if any.
+	Err error
+}
+
+// SignatureReport is the result of auditing all of the signatures on a
+// document.
+type SignatureReport struct {
+	// Signatures contains one entry per signature present on the document,
+	// sorted by signatory identity key.
+	Signatures []*SignatureResult
+
+	// Missing is the list of configured peers that did not sign the
+	// document.
+	Missing []*config.AuthorityPeer
+
+	// Err is set iff the document could not be examined at all.
+	Err error
+}
+
+// NumValid returns the number of valid signatures made by configured peers.
+func (r *SignatureReport) NumValid() int {
+	n := 0
+	for _, v := range r.Signatures {
+		if v.Status == SignatureValid {
+			n++
+		}
+	}
+	return n
+}
+
+// String returns a human readable summary of the report.
+func (r *SignatureReport) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("malformed document: %v\n", r.Err)
+	}
+	b := new(strings.Builder)
+	for _, v := range r.Signatures {
+		if v.IdentityKey == nil {
+			fmt.Fprintf(b, "signature by malformed key: %v\n", v.Err)
+			continue
+		}
+		fmt.Fprintf(b, "signature by %v: %v", v.IdentityKey, v.Status)
+		if v.Err != nil {
+			fmt.Fprintf(b, ": %v", v.Err)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	for _, v := range r.Missing {
+		fmt.Fprintf(b, "signature by %v: missing\n", v.IdentityPublicKey)
+	}
+	fmt.Fprintf(b, "%d/%d configured peers signed\n", r.NumValid(), r.NumValid()+len(r.Missing)+r.numInvalidPeers())
+	return b.String()
+}
+
+func (r *SignatureReport) numInvalidPeers() int {
+	n := 0
+	for _, v := range r.Signatures {
+		if v.Status == SignatureInvalid && v.Peer != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// VerifyDocumentSignatures verifies every signature on the serialized
+// document doc, and reports which of the peers signed it.  Signatures made
+// by keys that are not in peers are verified against the key they claim,
+// and reported as SignatureUnknown if valid.
+//
+// Note that the certificate expiration is checked as part of signature
+// verification, so signatures on expired documents are reported as invalid.
+func VerifyDocumentSignatures(doc []byte, peers []*config.AuthorityPeer) *SignatureReport {
+	r := new(SignatureReport)
+	signatures, err := cert.GetSignatures(doc)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	peerMap := make(map[[eddsa.PublicKeySize]byte]*config.AuthorityPeer)
+	for _, v := range peers {
+		peerMap[v.IdentityPublicKey.ByteArray()] = v
+	}
+
+	signed := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, sig := range signatures {
+		res := &SignatureResult{Status: SignatureInvalid}
+		r.Signatures = append(r.Signatures, res)
+
+		pk := new(eddsa.PublicKey)
+		if err := pk.FromBytes(sig.Identity); err != nil {
+			res.Err = err
+			continue
+		}
+		res.IdentityKey = pk
+		id := pk.ByteArray()
+		res.Peer = peerMap[id]
+		signed[id] = true
+
+		if _, err := cert.Verify(pk, doc); err != nil {
+			res.Err = err
+			continue
+		}
+		if res.Peer != nil {
+			res.Status = SignatureValid
+		} else {
+			res.Status = SignatureUnknown
+		}
+	}
+	sort.SliceStable(r.Signatures, func(i, j int) bool {
+		a, b := r.Signatures[i].IdentityKey, r.Signatures[j].IdentityKey
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return bytes.Compare(a.Bytes(), b.Bytes()) < 0
+	})
+
+	for _, v := range peers {
+		if !signed[v.IdentityPublicKey.ByteArray()] {
+			r.Missing = append(r.Missing, v)
+		}
+	}
+	return r
+}
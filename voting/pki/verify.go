@@ -0,0 +1,75 @@
+// verify.go - Katzenpost voting authority document verification.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pki
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	cpki "github.com/katzenpost/core/pki"
+)
+
+// VerificationError is the error returned by VerifyDocument when the
+// document is not signed by a threshold of the peers.
+type VerificationError struct {
+	// Threshold is the number of valid peer signatures that was required.
+	Threshold int
+
+	// Report is the result of verifying each of the signatures.
+	Report *SignatureReport
+}
+
+func (e *VerificationError) Error() string {
+	if e.Report.Err != nil {
+		return fmt.Sprintf("pki: malformed document: %v", e.Report.Err)
+	}
+	var missing, invalid []string
+	for _, v := range e.Report.Missing {
+		missing = append(missing, v.IdentityPublicKey.String())
+	}
+	for _, v := range e.Report.Signatures {
+		if v.Status == SignatureInvalid && v.Peer != nil {
+			invalid = append(invalid, fmt.Sprintf("%v: %v", v.IdentityKey, v.Err))
+		}
+	}
+	return fmt.Sprintf("pki: %d valid signatures, need %d, missing: [%v], invalid: [%v]", e.Report.NumValid(), e.Threshold, strings.Join(missing, ", "), strings.Join(invalid, ", "))
+}
+
+// VerifyDocument verifies that the serialized consensus document doc is
+// signed by at least threshold of the peers, and returns the parsed
+// document.  If it is not, a *VerificationError identifying the missing and
+// invalid signatures is returned.
+func VerifyDocument(doc []byte, peers []*config.AuthorityPeer, threshold int) (*cpki.Document, error) {
+	if threshold <= 0 || threshold > len(peers) {
+		return nil, fmt.Errorf("pki: threshold %d is invalid for %d peers", threshold, len(peers))
+	}
+	r := VerifyDocumentSignatures(doc, peers)
+	if r.Err != nil || r.NumValid() < threshold {
+		return nil, &VerificationError{Threshold: threshold, Report: r}
+	}
+
+	for _, v := range r.Signatures {
+		if v.Status == SignatureValid {
+			return s11n.VerifyAndParseDocument(doc, v.IdentityKey)
+		}
+	}
+
+	// NOTREACHED
+	return nil, &VerificationError{Threshold: threshold, Report: r}
+}
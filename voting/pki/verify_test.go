@@ -0,0 +1,141 @@
+// verify_test.go - Katzenpost voting authority document verification tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pki
+
+import (
+	"testing"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	cpki "github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+const testEpoch = 23
+
+func genSignedDescriptor(require *require.Assertions, layer uint8) []byte {
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	desc := &cpki.MixDescriptor{
+		Name:        "node.example.org",
+		IdentityKey: identityKey.PublicKey(),
+		LinkKey:     linkKey.PublicKey(),
+		MixKeys:     make(map[uint64]*ecdh.PublicKey),
+		Addresses: map[cpki.Transport][]string{
+			cpki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+		Layer: layer,
+	}
+	for e := uint64(testEpoch); e < testEpoch+3; e++ {
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		desc.MixKeys[e] = mixKey.PublicKey()
+	}
+	signed, err := s11n.SignDescriptor(identityKey, desc)
+	require.NoError(err)
+	return signed
+}
+
+// impostor signs with one key, while claiming to be another.
+type impostor struct {
+	*eddsa.PrivateKey
+	identity []byte
+}
+
+func (i *impostor) Identity() []byte {
+	return i.identity
+}
+
+func TestVerifyDocument(t *testing.T) {
+	require := require.New(t)
+
+	keys := make([]*eddsa.PrivateKey, 0, 3)
+	peers := make([]*config.AuthorityPeer, 0, 3)
+	for i := 0; i < 3; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		keys = append(keys, k)
+		peers = append(peers, &config.AuthorityPeer{IdentityPublicKey: k.PublicKey()})
+	}
+	outsider, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+
+	unsigned, err := s11n.SignDocument(keys[0], &s11n.Document{
+		Epoch:             testEpoch,
+		Topology:          [][][]byte{{genSignedDescriptor(require, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(require, cpki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	require.NoError(err)
+	sign := func(doc []byte, signers ...cert.Signer) []byte {
+		for _, k := range signers {
+			doc, err = cert.SignMulti(k, doc)
+			require.NoError(err)
+		}
+		return doc
+	}
+
+	// A document signed by every peer verifies at any threshold.
+	doc := sign(unsigned, keys[1], keys[2])
+	for threshold := 1; threshold <= 3; threshold++ {
+		d, err := VerifyDocument(doc, peers, threshold)
+		require.NoError(err, "threshold %d", threshold)
+		require.Equal(uint64(testEpoch), d.Epoch)
+	}
+
+	// Tampered documents identify the signatures that fell short.
+	for _, v := range []struct {
+		name    string
+		doc     []byte
+		missing int
+		invalid int
+	}{
+		{"missing signature", sign(unsigned, keys[1]), 1, 0},
+		{"outsider signature", sign(unsigned, keys[1], outsider), 1, 0},
+		{"forged signature", sign(unsigned, keys[1], &impostor{outsider, keys[2].PublicKey().Bytes()}), 0, 1},
+	} {
+		_, err := VerifyDocument(v.doc, peers, 3)
+		require.Error(err, v.name)
+		verr, ok := err.(*VerificationError)
+		require.True(ok, "%v: %T", v.name, err)
+		require.Equal(2, verr.Report.NumValid(), v.name)
+		require.Len(verr.Report.Missing, v.missing, v.name)
+		require.Equal(v.invalid, verr.Report.numInvalidPeers(), v.name)
+
+		// But are good enough for a lower threshold.
+		_, err = VerifyDocument(v.doc, peers, 2)
+		require.NoError(err, v.name)
+	}
+
+	// Garbage isn't a document.
+	_, err = VerifyDocument([]byte("not a document"), peers, 1)
+	verr, ok := err.(*VerificationError)
+	require.True(ok, "%T", err)
+	require.Error(verr.Report.Err)
+
+	// Nor is any threshold acceptable.
+	_, err = VerifyDocument(doc, peers, 0)
+	require.Error(err)
+	_, err = VerifyDocument(doc, peers, 4)
+	require.Error(err)
+}
@@ -0,0 +1,99 @@
+// acks.go - Katzenpost voting authority peer acknowledgements.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// What is sent to the peer authorities with a Vote command, and
+// acknowledged by them with a VoteOk status.
+const (
+	sentVote      = "Vote"
+	sentSignature = "Signature"
+)
+
+// recordAck records that the peer authority pk acknowledged receiving the
+// vote or signature, per what, sent to it for epoch.
+func (s *state) recordAck(epoch uint64, pk [eddsa.PublicKeySize]byte, what string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.acks == nil {
+		s.acks = make(map[uint64]map[[eddsa.PublicKeySize]byte]map[string]bool)
+	}
+	if _, ok := s.acks[epoch]; !ok {
+		s.acks[epoch] = make(map[[eddsa.PublicKeySize]byte]map[string]bool)
+	}
+	if _, ok := s.acks[epoch][pk]; !ok {
+		s.acks[epoch][pk] = make(map[string]bool)
+	}
+	s.acks[epoch][pk][what] = true
+}
+
+// unacknowledged returns the identity keys of the peer authorities that
+// have not acknowledged receiving the vote or signature, per what, for
+// epoch.
+func (s *state) unacknowledged(epoch uint64, what string) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	var missing []string
+	for _, peer := range s.s.cfg.Authorities {
+		if !s.acks[epoch][peer.IdentityPublicKey.ByteArray()][what] {
+			missing = append(missing, peer.IdentityPublicKey.String())
+		}
+	}
+	return missing
+}
+
+// logAcks logs which of the peer authorities have acknowledged receiving
+// the vote or signature, per what, for epoch, once it has been sent to all
+// of them.
+func (s *state) logAcks(epoch uint64, what string) {
+	missing := s.unacknowledged(epoch, what)
+	nrPeers := len(s.s.cfg.Authorities)
+	if len(missing) == 0 {
+		s.log.Noticef("%v for epoch %v acknowledged by all %v peers.", what, epoch, nrPeers)
+		return
+	}
+	s.log.Warningf("%v for epoch %v acknowledged by %v of %v peers, missing: %v", what, epoch, nrPeers-len(missing), nrPeers, strings.Join(missing, ", "))
+}
+
+// ackStatus returns a line for each of the peer authorities, with its
+// identity key and which of the vote and signature sent to it for the
+// epoch it has acknowledged receiving.
+func (s *state) ackStatus(epoch uint64) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	acked := func(pk [eddsa.PublicKeySize]byte, what string) string {
+		if s.acks[epoch][pk][what] {
+			return strings.ToUpper(what)
+		}
+		return "-"
+	}
+	lines := make([]string, 0, len(s.s.cfg.Authorities))
+	for _, peer := range s.s.cfg.Authorities {
+		pk := peer.IdentityPublicKey.ByteArray()
+		lines = append(lines, fmt.Sprintf("%v %v %v", peer.IdentityPublicKey, acked(pk, sentVote), acked(pk, sentSignature)))
+	}
+	return lines
+}
@@ -0,0 +1,201 @@
+// acks_test.go - Katzenpost voting authority peer acknowledgement tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoteAcknowledgement(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tr := new(stallingTransport)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.Addresses = []string{"authority-0"}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	cfg.Debug.PeerIdleTimeout = 1
+	cfg.Debug.PeerDialBaseDelay = 10
+
+	s, err := NewWithTransport(cfg, tr)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// The authority is its own peer, and the first connection to it drops
+	// the vote without acknowledging it.
+	peer := &config.AuthorityPeer{
+		IdentityPublicKey: s.IdentityKey(),
+		LinkPublicKey:     s.linkKey.PublicKey(),
+		Addresses:         cfg.Authority.Addresses,
+	}
+	epoch, _, _ := epochtime.Now()
+	epoch++
+	sr := new(SharedRandom)
+	commit, err := sr.Commit(epoch)
+	require.NoError(err)
+	vote, err := s11n.SignDocument(s.identityKey, &s11n.Document{
+		Epoch:              epoch,
+		Topology:           [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:          [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomCommit: commit,
+	})
+	require.NoError(err)
+
+	st := s.state
+	pk := st.identityPubKey()
+	st.Lock()
+	s.cfg.Authorities = []*config.AuthorityPeer{peer}
+	st.authorizedAuthorities[pk] = true
+	st.authorityLinkKeys[pk] = peer.LinkPublicKey
+	st.votingEpoch = epoch
+	st.sendVoteToAuthorities([]byte(vote), epoch, sentVote, time.Now().Add(peerDeadline))
+	st.Unlock()
+
+	// The sender retries until the peer acknowledges the vote.
+	deadline := time.Now().Add(peerDeadline)
+	for len(st.unacknowledged(epoch, sentVote)) != 0 {
+		require.True(time.Now().Before(deadline), "vote not acknowledged")
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(int32(2), atomic.LoadInt32(&tr.nrDials))
+	require.Equal([]string{fmt.Sprintf("%v VOTE -", s.IdentityKey())}, st.ackStatus(epoch))
+	st.RLock()
+	_, ok := st.votes[epoch][pk]
+	st.RUnlock()
+	require.True(ok, "vote not recorded by the peer")
+
+	// Sending the vote again, as if the acknowledgement was lost, is
+	// acknowledged without the vote being taken as a signature.
+	require.NoError(st.sendVoteToPeer(peer, []byte(vote), epoch))
+	st.RLock()
+	_, ok = st.certificates[epoch][pk]
+	st.RUnlock()
+	require.False(ok, "repeated vote taken as a signature")
+}
+
+func TestObserverReceivesVotes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// A voting authority that lists an observer as a peer, and the
+	// observer, that lists the voting authority.
+	tr := new(MemoryTransport)
+	newConfig := func(addr string) *config.Config {
+		cfg := genTestConfig(require)
+		cfg.Authority.Addresses = []string{addr}
+		cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+		var err error
+		cfg.Debug.IdentityKey, err = eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		cfg.Debug.LinkKey, err = ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		return cfg
+	}
+	peerOf := func(cfg *config.Config) *config.AuthorityPeer {
+		return &config.AuthorityPeer{
+			IdentityPublicKey: cfg.Debug.IdentityKey.PublicKey(),
+			LinkPublicKey:     cfg.Debug.LinkKey.PublicKey(),
+			Addresses:         cfg.Authority.Addresses,
+		}
+	}
+	voterCfg := newConfig("authority-0")
+	defer os.RemoveAll(voterCfg.Authority.DataDir)
+	observerCfg := newConfig("observer-0")
+	defer os.RemoveAll(observerCfg.Authority.DataDir)
+	observerCfg.Debug.ObserverMode = true
+	observerPeer := peerOf(observerCfg)
+	observerPeer.Observer = true
+	voterCfg.Authorities = []*config.AuthorityPeer{observerPeer}
+	voterPeer := peerOf(voterCfg)
+	observerCfg.Authorities = []*config.AuthorityPeer{voterPeer}
+
+	voter, err := NewWithTransport(voterCfg, tr)
+	require.NoError(err)
+	defer voter.Wait()
+	defer voter.Shutdown()
+	observer, err := NewWithTransport(observerCfg, tr)
+	require.NoError(err)
+	defer observer.Wait()
+	defer observer.Shutdown()
+
+	// The voting authority does not count the observer.
+	voter.state.RLock()
+	require.Len(voter.state.verifiers, 1)
+	require.Equal(1, voter.state.threshold)
+	voter.state.RUnlock()
+
+	epoch, _, _ := epochtime.Now()
+	epoch++
+	sign := func(k *eddsa.PrivateKey) []byte {
+		sr := new(SharedRandom)
+		commit, err := sr.Commit(epoch)
+		require.NoError(err)
+		vote, err := s11n.SignDocument(k, &s11n.Document{
+			Epoch:              epoch,
+			Topology:           [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+			Providers:          [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+			SharedRandomCommit: commit,
+		})
+		require.NoError(err)
+		return []byte(vote)
+	}
+	for _, s := range []*Server{voter, observer} {
+		s.state.Lock()
+		s.state.votingEpoch = epoch
+		s.state.Unlock()
+	}
+
+	// The vote reaches the observer.
+	vote := sign(voter.identityKey)
+	voter.state.Lock()
+	voter.state.sendVoteToAuthorities(vote, epoch, sentVote, time.Now().Add(peerDeadline))
+	voter.state.Unlock()
+	deadline := time.Now().Add(peerDeadline)
+	for len(voter.state.unacknowledged(epoch, sentVote)) != 0 {
+		require.True(time.Now().Before(deadline), "vote not acknowledged by the observer")
+		time.Sleep(10 * time.Millisecond)
+	}
+	observer.state.RLock()
+	received, ok := observer.state.votes[epoch][voter.state.identityPubKey()]
+	observer.state.RUnlock()
+	require.True(ok, "vote not received by the observer")
+	require.Equal(vote, received.raw)
+
+	// A vote made by the observer is rejected.
+	err = observer.state.sendVoteToPeer(voterPeer, sign(observer.identityKey), epoch)
+	require.Error(err)
+	voter.state.RLock()
+	_, ok = voter.state.votes[epoch][observer.state.identityPubKey()]
+	voter.state.RUnlock()
+	require.False(ok, "vote by the observer recorded")
+}
@@ -0,0 +1,41 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+// backlog_unix.go - Katzenpost voting authority listen backlog.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// setListenBacklog re-issues listen(2) on the listener's socket, which
+// on these platforms adjusts the accept backlog of a listening socket.
+func setListenBacklog(l *net.TCPListener, backlog int) error {
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var lErr error
+	if err = rc.Control(func(fd uintptr) {
+		lErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return lErr
+}
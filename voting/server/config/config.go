@@ -19,26 +19,55 @@
 package config
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"net"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/BurntSushi/toml"
+	"github.com/katzenpost/authority/internal/s11n"
 	"github.com/katzenpost/core/crypto/ecdh"
 	"github.com/katzenpost/core/crypto/eddsa"
 	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
 	"github.com/katzenpost/core/utils"
+	"golang.org/x/crypto/sha3"
 	"golang.org/x/net/idna"
 )
 
 const (
-	defaultAddress          = ":62472"
-	defaultLogLevel         = "NOTICE"
-	defaultLayers           = 3
-	defaultMinNodesPerLayer = 2
-	absoluteMaxDelay        = 6 * 60 * 60 * 1000 // 6 hours.
+	defaultAddress           = ":62472"
+	defaultLogLevel          = "NOTICE"
+	defaultLayers            = 3
+	maxLayers                = 3
+	defaultMinNodesPerLayer  = 2
+	defaultMaxAddresses      = 32
+	defaultMaxDescriptorSize = 64 * 1024        // 64 KiB.
+	defaultMaxDocumentSize   = 16 * 1024 * 1024 // 16 MiB.
+	defaultMaxLoadWeight     = 100
+	defaultRotationOverlap   = 12
+	defaultDocumentRetention = 3
+	defaultGeometryVersion   = 1
+	defaultManagementSocket  = "management_sock"
+	defaultPeerDialRetries   = 10
+	defaultPeerDialDelay     = 500
+	defaultMaxConnections    = 128
+	defaultPeerKeepAlive     = 15
+	defaultPeerIdleTimeout   = 20
+	maxSubmissionPoWBits     = 64
+	absoluteMaxDelay         = 6 * 60 * 60 * 1000 // 6 hours.
+	minSaneMeanDelay         = 1                  // 1 ms.
+	minPhaseSlack            = 16                 // 1/16th of the epoch.
 
 	// rate limiting of client connections
 	defaultSendRatePerMinute = 100
@@ -58,10 +87,45 @@ const (
 	defaultLambdaMMaxPercentile = 0.99999
 )
 
+const (
+	// MissingServiceFlag is the Debug.MissingServicePolicy that logs and
+	// reports missing required services, and votes regardless.
+	MissingServiceFlag = "flag"
+
+	// MissingServiceWithhold is the Debug.MissingServicePolicy that logs
+	// missing required services, and withholds the vote for the epoch.
+	MissingServiceWithhold = "withhold"
+
+	// IdentifierPolicyLenient is the Debug.IdentifierPolicy that only
+	// rejects node identifiers that are empty, overly long, or contain
+	// whitespace or control characters.
+	IdentifierPolicyLenient = "lenient"
+
+	// IdentifierPolicyStrict is the Debug.IdentifierPolicy that additionally
+	// requires node identifiers to be valid DNS names, that are not
+	// reserved for local or invalid use.
+	IdentifierPolicyStrict = "strict"
+
+	maxIdentifierLength = 253
+)
+
+// reservedNames is the list of DNS names (and their subdomains) that can
+// never identify a node under IdentifierPolicyStrict.
+var reservedNames = []string{"localhost", "invalid", "local"}
+
+const (
+	// LogFormatText is the plain text log format.
+	LogFormatText = "text"
+
+	// LogFormatJSON is the log format with one JSON object per line.
+	LogFormatJSON = "json"
+)
+
 var defaultLogging = Logging{
 	Disable: false,
 	File:    "",
 	Level:   defaultLogLevel,
+	Format:  LogFormatText,
 }
 
 // Authority is the authority configuration.
@@ -73,8 +137,37 @@ type Authority struct {
 	// bind to for incoming connections.
 	Addresses []string
 
+	// PublicAddresses are the host/port combinations that the peers and
+	// clients reach the authority at, as published by the HTTP gateway,
+	// if they differ from the Addresses, for example behind NAT.  They
+	// default to the Addresses.
+	PublicAddresses []string
+
 	// DataDir is the absolute path to the authority's state files.
 	DataDir string
+
+	// PeersFile is the absolute path to a TOML file containing the list of
+	// peer authorities as [[Authorities]] entries, so that a single
+	// canonical list can be shared by all the authorities.  It is mutually
+	// exclusive with specifying the Authorities inline.
+	PeersFile string
+
+	// NextIdentityKey is the identity public key that the authority is
+	// rotating to.  The private key must already be present in the DataDir
+	// (See server.GenerateNextKeys).  Starting RotationOverlap epochs before
+	// RotationEpoch, consensus documents are signed with both the current
+	// and the next key, so that clients and nodes that know either key can
+	// verify them.
+	NextIdentityKey *eddsa.PublicKey
+
+	// RotationEpoch is the first epoch for which the authority uses
+	// NextIdentityKey as its identity key, once restarted.  It is
+	// mandatory iff NextIdentityKey is set.
+	RotationEpoch uint64
+
+	// RotationOverlap is the number of epochs before RotationEpoch during
+	// which consensus documents are signed with both keys.
+	RotationOverlap int
 }
 
 // Validate parses and checks the Authority configuration.
@@ -95,9 +188,91 @@ func (sCfg *Authority) validate() error {
 		}
 		sCfg.Addresses = []string{addr.String() + defaultAddress}
 	}
+	for _, v := range sCfg.PublicAddresses {
+		if err := ValidatePeerAddress(v); err != nil {
+			return fmt.Errorf("config: Authority: PublicAddress '%v' is invalid: %v", v, err)
+		}
+	}
 	if !filepath.IsAbs(sCfg.DataDir) {
 		return fmt.Errorf("config: Authority: DataDir '%v' is not an absolute path", sCfg.DataDir)
 	}
+	if sCfg.PeersFile != "" && !filepath.IsAbs(sCfg.PeersFile) {
+		return fmt.Errorf("config: Authority: PeersFile '%v' is not an absolute path", sCfg.PeersFile)
+	}
+	if sCfg.NextIdentityKey != nil && sCfg.RotationEpoch == 0 {
+		return errors.New("config: Authority: NextIdentityKey is set without a RotationEpoch")
+	}
+	if sCfg.NextIdentityKey == nil && sCfg.RotationEpoch != 0 {
+		return errors.New("config: Authority: RotationEpoch is set without a NextIdentityKey")
+	}
+	if sCfg.RotationOverlap < 0 {
+		return fmt.Errorf("config: Authority: RotationOverlap %v is invalid", sCfg.RotationOverlap)
+	}
+	return nil
+}
+
+func (sCfg *Authority) applyDefaults() {
+	if len(sCfg.PublicAddresses) == 0 {
+		sCfg.PublicAddresses = append([]string{}, sCfg.Addresses...)
+	}
+	if sCfg.RotationOverlap == 0 {
+		sCfg.RotationOverlap = defaultRotationOverlap
+	}
+}
+
+// DualSigning returns true iff an authority that has not yet switched to the
+// NextIdentityKey is to sign the consensus documents for the epoch with both
+// keys.  This starts RotationOverlap epochs before the RotationEpoch, and
+// continues past it until the authority is restarted.
+func (sCfg *Authority) DualSigning(epoch uint64) bool {
+	if sCfg.NextIdentityKey == nil {
+		return false
+	}
+	return epoch+uint64(sCfg.RotationOverlap) >= sCfg.RotationEpoch
+}
+
+type peersFile struct {
+	Authorities []*AuthorityPeer
+}
+
+func loadPeersFile(f string) ([]*AuthorityPeer, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("config: Authority: Failed to read PeersFile: %v", err)
+	}
+	peers := new(peersFile)
+	md, err := toml.Decode(string(b), peers)
+	if err != nil {
+		return nil, fmt.Errorf("config: Authority: Failed to parse PeersFile: %v", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+		return nil, fmt.Errorf("config: Authority: Undecoded keys in PeersFile: %v", undecoded)
+	}
+	for _, v := range peers.Authorities {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return peers.Authorities, nil
+}
+
+// Storage is the authority persisted state configuration.  The settings
+// can not be changed once the persisted state has been created, short of
+// deleting it.
+type Storage struct {
+	// Compress enables compression of the persisted state.
+	Compress bool
+
+	// EncryptionKeyFile is the absolute path to a file containing the
+	// passphrase from which the key used to encrypt the persisted state is
+	// derived.  If omitted, the persisted state is not encrypted.
+	EncryptionKeyFile string
+}
+
+func (sCfg *Storage) validate() error {
+	if sCfg.EncryptionKeyFile != "" && !filepath.IsAbs(sCfg.EncryptionKeyFile) {
+		return fmt.Errorf("config: Storage: EncryptionKeyFile '%v' is not an absolute path", sCfg.EncryptionKeyFile)
+	}
 	return nil
 }
 
@@ -111,6 +286,110 @@ type Logging struct {
 
 	// Level specifies the log level.
 	Level string
+
+	// Format specifies the log format, either "text" (the default) or
+	// "json".  In the json format each line is a JSON object with the
+	// timestamp, level, component and message fields.
+	Format string
+
+	// MaxSizeMB is the size in MiB past which the log File is rotated,
+	// keeping up to MaxBackups previous files as File.1 (the most recent)
+	// through File.MaxBackups.  The default of 0 disables the rotation,
+	// leaving it to an external tool (See Server.RotateLog).
+	MaxSizeMB int
+
+	// MaxBackups is the number of rotated log files to keep, and must be
+	// set iff MaxSizeMB is.
+	MaxBackups int
+}
+
+// Metrics is the authority metrics configuration.
+type Metrics struct {
+	// Address is the address to serve metrics on over HTTP, in the
+	// Prometheus text format, or the OpenMetrics text format if requested
+	// by the scraper.  If omitted, metrics are not served.
+	Address string
+
+	// Exemplars attaches OpenMetrics exemplars, referencing the epoch and
+	// document hash, to the consensus counters.  Exemplars are only
+	// included in the OpenMetrics format, so scrapers that do not support
+	// them are unaffected.
+	Exemplars bool
+}
+
+func (mCfg *Metrics) validate() error {
+	if mCfg.Address == "" {
+		return nil
+	}
+	if err := utils.EnsureAddrIPPort(mCfg.Address); err != nil {
+		return fmt.Errorf("config: Metrics: Address '%v' is invalid: %v", mCfg.Address, err)
+	}
+	return nil
+}
+
+// HealthCheck is the authority health check configuration.
+type HealthCheck struct {
+	// Address is the address to serve the health check on over HTTP, at
+	// /health.  The response is 200 if there is a consensus for the current
+	// epoch, and 503 otherwise.  If omitted, the health check is not served.
+	Address string
+}
+
+func (hCfg *HealthCheck) validate() error {
+	if hCfg.Address == "" {
+		return nil
+	}
+	if err := utils.EnsureAddrIPPort(hCfg.Address); err != nil {
+		return fmt.Errorf("config: HealthCheck: Address '%v' is invalid: %v", hCfg.Address, err)
+	}
+	return nil
+}
+
+// HTTPGateway is the authority HTTP gateway configuration.
+type HTTPGateway struct {
+	// Address is the address to serve the consensus documents, the
+	// accepted descriptors, the authority set and this authority's own
+	// votes on over HTTP, read-only, for clients that can not speak the
+	// wire protocol.  The gateway does not do TLS, and is expected to
+	// be put behind a reverse proxy that does.  If omitted, the gateway is
+	// not served.
+	Address string
+}
+
+func (gCfg *HTTPGateway) validate() error {
+	if gCfg.Address == "" {
+		return nil
+	}
+	if err := utils.EnsureAddrIPPort(gCfg.Address); err != nil {
+		return fmt.Errorf("config: HTTPGateway: Address '%v' is invalid: %v", gCfg.Address, err)
+	}
+	return nil
+}
+
+// Management is the authority management interface configuration.
+type Management struct {
+	// Enable enables the management interface.
+	Enable bool
+
+	// Path specifies the path to the management interface socket.  If left
+	// empty it will use `management_sock` under the DataDir.
+	Path string
+}
+
+func (mCfg *Management) applyDefaults(aCfg *Authority) {
+	if mCfg.Path == "" {
+		mCfg.Path = filepath.Join(aCfg.DataDir, defaultManagementSocket)
+	}
+}
+
+func (mCfg *Management) validate() error {
+	if !mCfg.Enable {
+		return nil
+	}
+	if !filepath.IsAbs(mCfg.Path) {
+		return fmt.Errorf("config: Management: Path '%v' is not an absolute path", mCfg.Path)
+	}
+	return nil
 }
 
 func (lCfg *Logging) validate() error {
@@ -123,6 +402,22 @@ func (lCfg *Logging) validate() error {
 		return fmt.Errorf("config: Logging: Level '%v' is invalid", lCfg.Level)
 	}
 	lCfg.Level = lvl // Force uppercase.
+	switch lCfg.Format {
+	case LogFormatText, LogFormatJSON:
+	case "":
+		lCfg.Format = LogFormatText
+	default:
+		return fmt.Errorf("config: Logging: Format '%v' is invalid", lCfg.Format)
+	}
+	if lCfg.MaxSizeMB < 0 {
+		return fmt.Errorf("config: Logging: MaxSizeMB %v is invalid", lCfg.MaxSizeMB)
+	}
+	if lCfg.MaxBackups < 0 {
+		return fmt.Errorf("config: Logging: MaxBackups %v is invalid", lCfg.MaxBackups)
+	}
+	if lCfg.MaxSizeMB > 0 && lCfg.MaxBackups == 0 {
+		return errors.New("config: Logging: MaxSizeMB is set, and MaxBackups is 0")
+	}
 	return nil
 }
 
@@ -169,47 +464,317 @@ type Parameters struct {
 
 	// LambdaMMaxDelay sets the maximum delay for LambdaP.
 	LambdaMMaxDelay uint64
+
+	// RequiredServices is the list of Kaetzchen capabilities (eg: "loop")
+	// that at least one Provider must offer for the network to be considered
+	// fully functional.  See Debug.MissingServicePolicy.
+	RequiredServices []string
+
+	// ChainDocuments includes the DocumentHash of the previous epoch's
+	// consensus in each document, forming a hash chain that can be used
+	// to detect forks in the history.  An authority that does not have
+	// the previous consensus uses an all zero hash, as does the first
+	// chained epoch.
+	ChainDocuments bool
+
+	// RequireMinNodes makes the authority refuse to sign a consensus in
+	// which any layer has fewer than Debug.MinNodesPerLayer nodes, leaving
+	// the epoch without a document.  If false, such a consensus is signed
+	// and a warning is logged.
+	RequireMinNodes bool
+
+	// Threshold is the number of authorities, including this one, that
+	// must agree for a node or set of parameters to be included in the
+	// consensus, and that must sign the consensus for it to be valid.  It
+	// must be more than half of the authorities, and defaults to a simple
+	// majority.  All authorities must use the same Threshold.
+	Threshold int
+
+	// DocumentRetentionEpochs is the number of past epochs for which the
+	// consensus documents are kept on disk and served to clients, along
+	// with the descriptors and votes they were made from.  As it only
+	// affects this authority, it is not part of the Hash.
+	DocumentRetentionEpochs int
+
+	// ServeLastGoodOnFailure makes the authority answer requests for an
+	// epoch whose voting round failed to reach a consensus with the most
+	// recent consensus document it still retains.  The stale document is
+	// served unmodified, so its Epoch is that of the round that produced
+	// it, and clients decide whether to accept it.  As it only affects
+	// this authority, it is not part of the Hash.
+	ServeLastGoodOnFailure bool
+
+	// DescriptorPhase is the duration in seconds, from the start of each
+	// epoch, during which nodes upload their descriptors for the next
+	// epoch.  It defaults to half of the epoch.
+	DescriptorPhase int
+
+	// VotePhase is the duration in seconds of the exchange of votes, after
+	// the DescriptorPhase.  It defaults to an eighth of the epoch.
+	VotePhase int
+
+	// RevealPhase is the duration in seconds of the exchange of reveals,
+	// after the VotePhase.  It defaults to an eighth of the epoch.
+	RevealPhase int
+
+	// SignaturePhase is the duration in seconds of the exchange of
+	// signatures, after the RevealPhase.  It defaults to an eighth of the
+	// epoch.  The four phases must leave at least a sixteenth of the epoch
+	// for publishing the consensus.  All authorities MUST use the same
+	// phase durations.
+	SignaturePhase int
+
+	// SphinxGeometryVersion identifies the packet geometry and parameter
+	// semantics the network uses, and is published in the consensus so
+	// that clients can refuse documents they do not understand.  It must
+	// be bumped for every incompatible change, and defaults to 1.
+	SphinxGeometryVersion int
+
+	// Layers is the number of non-provider layers in the network topology,
+	// at most 3.  It is part of every vote, and all authorities MUST use
+	// the same number of layers, which defaults to 3.
+	Layers int
+
+	// SphinxHops is the number of hops in a path, including both
+	// Providers, and must be Layers plus 2, which is the default.
+	SphinxHops int
+
+	// SphinxPerHopRoutingInfoLength is the length in bytes of the Sphinx
+	// routing information for each hop.
+	SphinxPerHopRoutingInfoLength int
+
+	// SphinxPayloadLength is the length in bytes of the Sphinx packet
+	// payload.
+	//
+	// The geometry is only published in the consensus if both
+	// SphinxPerHopRoutingInfoLength and SphinxPayloadLength are set, so
+	// that mix nodes and clients can read it instead of hardcoding it.
+	SphinxPayloadLength int
+}
+
+type phaseParameter struct {
+	name     string
+	duration int
+}
+
+// phases returns the name and duration of each of the voting phases.
+func (pCfg *Parameters) phases() []phaseParameter {
+	return []phaseParameter{
+		{"DescriptorPhase", pCfg.DescriptorPhase},
+		{"VotePhase", pCfg.VotePhase},
+		{"RevealPhase", pCfg.RevealPhase},
+		{"SignaturePhase", pCfg.SignaturePhase},
+	}
+}
+
+type lambdaParameter struct {
+	name     string
+	lambda   float64
+	maxDelay uint64
+}
+
+// lambdas returns the name, rate and maximum delay of each of the
+// exponential distributions.
+func (pCfg *Parameters) lambdas() []lambdaParameter {
+	return []lambdaParameter{
+		{"Mu", pCfg.Mu, pCfg.MuMaxDelay},
+		{"LambdaP", pCfg.LambdaP, pCfg.LambdaPMaxDelay},
+		{"LambdaL", pCfg.LambdaL, pCfg.LambdaLMaxDelay},
+		{"LambdaD", pCfg.LambdaD, pCfg.LambdaDMaxDelay},
+		{"LambdaM", pCfg.LambdaM, pCfg.LambdaMMaxDelay},
+	}
 }
 
 func (pCfg *Parameters) validate() error {
-	if pCfg.Mu < 0 {
-		return fmt.Errorf("config: Parameters: Mu %v is invalid", pCfg.Mu)
+	for _, v := range pCfg.lambdas() {
+		if v.lambda < 0 || math.IsNaN(v.lambda) || math.IsInf(v.lambda, 0) {
+			return fmt.Errorf("config: Parameters: %v %v is invalid", v.name, v.lambda)
+		}
+		if v.maxDelay > absoluteMaxDelay {
+			return fmt.Errorf("config: Parameters: %vMaxDelay %v is out of range", v.name, v.maxDelay)
+		}
 	}
-	if pCfg.MuMaxDelay > absoluteMaxDelay {
-		return fmt.Errorf("config: Parameters: MuMaxDelay %v is out of range", pCfg.MuMaxDelay)
+	for _, v := range pCfg.RequiredServices {
+		if v == "" {
+			return errors.New("config: Parameters: RequiredServices contains an empty entry")
+		}
 	}
-	if pCfg.LambdaP < 0 {
-		return fmt.Errorf("config: Parameters: LambdaP %v is invalid", pCfg.LambdaP)
+	if pCfg.DocumentRetentionEpochs < 0 {
+		return fmt.Errorf("config: Parameters: DocumentRetentionEpochs %v is invalid", pCfg.DocumentRetentionEpochs)
 	}
-	if pCfg.LambdaPMaxDelay > absoluteMaxDelay {
-		return fmt.Errorf("config: Parameters: LambdaPMaxDelay %v is out of range", pCfg.LambdaPMaxDelay)
+	for _, v := range pCfg.phases() {
+		if v.duration < 0 {
+			return fmt.Errorf("config: Parameters: %v %v is invalid", v.name, v.duration)
+		}
+	}
+	if pCfg.Layers < 0 || pCfg.Layers > maxLayers {
+		// This is a limitation of the Sphinx implementation.
+		return fmt.Errorf("config: Parameters: Layers %v is invalid", pCfg.Layers)
+	}
+	if pCfg.SphinxGeometryVersion < 0 {
+		return fmt.Errorf("config: Parameters: SphinxGeometryVersion %v is invalid", pCfg.SphinxGeometryVersion)
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"SphinxHops", pCfg.SphinxHops},
+		{"SphinxPerHopRoutingInfoLength", pCfg.SphinxPerHopRoutingInfoLength},
+		{"SphinxPayloadLength", pCfg.SphinxPayloadLength},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("config: Parameters: %v %v is invalid", v.name, v.value)
+		}
+	}
+	if (pCfg.SphinxPerHopRoutingInfoLength == 0) != (pCfg.SphinxPayloadLength == 0) {
+		return errors.New("config: Parameters: SphinxPerHopRoutingInfoLength and SphinxPayloadLength must be set together")
+	}
+
+	return nil
+}
+
+// validateDefaults checks the values derived by applyDefaults, which can
+// still be unusable when the configured rates are extreme.
+func (pCfg *Parameters) validateDefaults() error {
+	for _, v := range pCfg.lambdas() {
+		if v.maxDelay == 0 {
+			return fmt.Errorf("config: Parameters: %vMaxDelay is 0, %v %v is too large", v.name, v.name, v.lambda)
+		}
 	}
-	if pCfg.LambdaL < 0 {
-		return fmt.Errorf("config: Parameters: LambdaL %v is invalid", pCfg.LambdaP)
+	var total time.Duration
+	for _, v := range pCfg.phases() {
+		total += time.Duration(v.duration) * time.Second
 	}
-	if pCfg.LambdaLMaxDelay > absoluteMaxDelay {
-		return fmt.Errorf("config: Parameters: LambdaLMaxDelay %v is out of range", pCfg.LambdaPMaxDelay)
+	if budget := epochtime.Period - epochtime.Period/minPhaseSlack; total > budget {
+		return fmt.Errorf("config: Parameters: voting phases take %v, exceeding %v of the %v epoch", total, budget, epochtime.Period)
 	}
-	if pCfg.LambdaD < 0 {
-		return fmt.Errorf("config: Parameters: LambdaD %v is invalid", pCfg.LambdaP)
+	return nil
+}
+
+// fixupLayers applies the deprecated Debug.Layers alias and the default
+// Layers, and validates them.
+func (pCfg *Parameters) fixupLayers(dCfg *Debug) error {
+	if dCfg.Layers > 0 {
+		if pCfg.Layers == 0 {
+			pCfg.Layers = dCfg.Layers
+		} else if pCfg.Layers != dCfg.Layers {
+			return fmt.Errorf("config: Debug: Layers %v does not match Parameters.Layers %v", dCfg.Layers, pCfg.Layers)
+		}
 	}
-	if pCfg.LambdaDMaxDelay > absoluteMaxDelay {
-		return fmt.Errorf("config: Parameters: LambdaDMaxDelay %v is out of range", pCfg.LambdaPMaxDelay)
+	if pCfg.Layers == 0 {
+		pCfg.Layers = defaultLayers
 	}
-	if pCfg.LambdaM < 0 {
-		return fmt.Errorf("config: Parameters: LambdaM %v is invalid", pCfg.LambdaP)
+	dCfg.Layers = pCfg.Layers
+	return nil
+}
+
+// fixupGeometry applies the default SphinxHops for Layers, and validates
+// it.
+func (pCfg *Parameters) fixupGeometry() error {
+	if pCfg.SphinxHops == 0 {
+		pCfg.SphinxHops = pCfg.Layers + 2
 	}
-	if pCfg.LambdaMMaxDelay > absoluteMaxDelay {
-		return fmt.Errorf("config: Parameters: LambdaMMaxDelay %v is out of range", pCfg.LambdaPMaxDelay)
+	if pCfg.SphinxHops != pCfg.Layers+2 {
+		return fmt.Errorf("config: Parameters: SphinxHops %v does not match %v Layers", pCfg.SphinxHops, pCfg.Layers)
 	}
+	return nil
+}
 
+// fixupThreshold applies the default Threshold for nrAuthorities, and
+// validates it.
+func (pCfg *Parameters) fixupThreshold(nrAuthorities int) error {
+	if pCfg.Threshold == 0 {
+		pCfg.Threshold = nrAuthorities/2 + 1
+	}
+	if pCfg.Threshold <= nrAuthorities/2 || pCfg.Threshold > nrAuthorities {
+		return fmt.Errorf("config: Parameters: Threshold %v is invalid for %v authorities", pCfg.Threshold, nrAuthorities)
+	}
 	return nil
 }
 
+// Hash returns a deterministic SHA3-256 digest of all of the parameters, so
+// that authorities can easily tell if they are configured identically.
+func (pCfg *Parameters) Hash() []byte {
+	// Note: New fields MUST be added here, unless they are purely local
+	// policy like DocumentRetentionEpochs.
+	h := sha3.New256()
+	writeUint := func(v uint64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		h.Write(b[:])
+	}
+	writeUint(pCfg.SendRatePerMinute)
+	for _, v := range pCfg.lambdas() {
+		writeUint(math.Float64bits(v.lambda))
+		writeUint(v.maxDelay)
+	}
+	services := append([]string{}, pCfg.RequiredServices...)
+	sort.Strings(services)
+	writeUint(uint64(len(services)))
+	for _, v := range services {
+		writeUint(uint64(len(v)))
+		h.Write([]byte(v))
+	}
+	for _, v := range []bool{pCfg.ChainDocuments, pCfg.RequireMinNodes} {
+		if v {
+			writeUint(1)
+		} else {
+			writeUint(0)
+		}
+	}
+	writeUint(uint64(pCfg.Threshold))
+	for _, v := range pCfg.phases() {
+		writeUint(uint64(v.duration))
+	}
+	writeUint(uint64(pCfg.Layers))
+	writeUint(uint64(pCfg.SphinxGeometryVersion))
+	writeUint(uint64(pCfg.SphinxHops))
+	writeUint(uint64(pCfg.SphinxPerHopRoutingInfoLength))
+	writeUint(uint64(pCfg.SphinxPayloadLength))
+	return h.Sum(nil)
+}
+
+// Warnings returns a description of each parameter that is valid, but far
+// outside of the range that is likely to be useful.
+func (pCfg *Parameters) Warnings() []string {
+	var warnings []string
+	for _, v := range pCfg.lambdas() {
+		if v.lambda == 0 {
+			continue
+		}
+		mean := 1 / v.lambda
+		switch {
+		case mean < minSaneMeanDelay:
+			warnings = append(warnings, fmt.Sprintf("Parameters: %v %v has a mean delay of under %vms", v.name, v.lambda, minSaneMeanDelay))
+		case mean > float64(v.maxDelay):
+			warnings = append(warnings, fmt.Sprintf("Parameters: %v %v has a mean delay of %.0fms, exceeding %vMaxDelay %v", v.name, v.lambda, mean, v.name, v.maxDelay))
+		}
+	}
+	return warnings
+}
+
 func (pCfg *Parameters) applyDefaults() {
 	if pCfg.SendRatePerMinute == 0 {
 		pCfg.SendRatePerMinute = defaultSendRatePerMinute
 	}
+	if pCfg.DocumentRetentionEpochs == 0 {
+		pCfg.DocumentRetentionEpochs = defaultDocumentRetention
+	}
+	if pCfg.SphinxGeometryVersion == 0 {
+		pCfg.SphinxGeometryVersion = defaultGeometryVersion
+	}
+	if pCfg.DescriptorPhase == 0 {
+		pCfg.DescriptorPhase = int(epochtime.Period / 2 / time.Second)
+	}
+	if pCfg.VotePhase == 0 {
+		pCfg.VotePhase = int(epochtime.Period / 8 / time.Second)
+	}
+	if pCfg.RevealPhase == 0 {
+		pCfg.RevealPhase = int(epochtime.Period / 8 / time.Second)
+	}
+	if pCfg.SignaturePhase == 0 {
+		pCfg.SignaturePhase = int(epochtime.Period / 8 / time.Second)
+	}
 	if pCfg.Mu == 0 {
 		pCfg.Mu = defaultMu
 	}
@@ -253,7 +818,21 @@ type Debug struct {
 	// LinkKey specifies the link layer private key.
 	LinkKey *ecdh.PrivateKey `toml:"-"`
 
-	// Layers is the number of non-provider layers in the network topology.
+	// IdentityKeyCommand is the command, and its arguments, run at startup
+	// to obtain the identity private key instead of reading it from the
+	// DataDir, for integration with secret management.  The command must
+	// write the key to stdout, PEM encoded exactly as in the
+	// identity.private.pem file.  It is run directly, not by a shell.
+	IdentityKeyCommand []string
+
+	// IdentityKeyEnv is the name of the environment variable to read the
+	// PEM encoded identity private key from at startup, instead of reading
+	// it from the DataDir.  At most one of IdentityKey, IdentityKeyCommand
+	// and IdentityKeyEnv may be set.
+	IdentityKeyEnv string
+
+	// Layers is a deprecated alias of Parameters.Layers, that will be
+	// removed in the next release.  If both are set, they must match.
 	Layers int
 
 	// MinNodesPerLayer is the minimum number of nodes per layer required to
@@ -261,25 +840,342 @@ type Debug struct {
 	MinNodesPerLayer int
 
 	// GenerateOnly halts and cleans up the server right after long term
-	// key generation.
+	// key generation.  The authority command then prints the planned layer
+	// assignment of the whitelisted mixes (See server.PlanTopology).
 	GenerateOnly bool
+
+	// StartupWarmup is the time after startup during which the authority
+	// only observes (accepting descriptors, votes and consensus documents)
+	// and does not vote.  If the warmup ends before the descriptor upload
+	// deadline, the authority joins the round in progress, otherwise it
+	// joins the next one.  The default of 0 disables the warmup so that the
+	// authority votes as soon as possible.  As for any time.Duration, the
+	// TOML value is in nanoseconds.
+	StartupWarmup time.Duration
+
+	// LogConsensusInputs enables DEBUG level logging of every input to the
+	// deterministic consensus computation for each epoch (descriptor hashes,
+	// shared random value, threshold and resulting document hash), so that
+	// the consensus can be reproduced offline.  No private material is
+	// logged.
+	LogConsensusInputs bool
+
+	// MissingServicePolicy controls what happens when none of the Providers
+	// that uploaded a descriptor offer one of the Parameters.RequiredServices.
+	// "flag" (the default) logs an error and votes regardless, "withhold"
+	// logs an error and does not vote for the epoch.  Either way, the
+	// missing services are reported by the STATUS management command.
+	MissingServicePolicy string
+
+	// MaxAddressesPerNode is the maximum total number of addresses, across
+	// all transports, that a node descriptor may advertise.  Descriptors
+	// exceeding the limit are rejected outright, as they are signed by the
+	// node and can not be truncated.  All authorities should use the same
+	// limit, or nodes close to it will fail to reach a threshold of votes.
+	MaxAddressesPerNode int
+
+	// MaxLoadWeight is the maximum LoadWeight that a node descriptor may
+	// advertise, at most 255.  The weight is an advisory hint for client
+	// path selection, and descriptors exceeding the limit are rejected.
+	MaxLoadWeight int
+
+	// SubmissionPoWBits is the number of leading zero bits required of the
+	// proof-of-work that must accompany each descriptor submission, binding
+	// it to the epoch and node identity (See s11n.VerifyProofOfWork).  The
+	// default of 0 disables the requirement.  Nodes must be configured to
+	// produce a proof of at least this difficulty.
+	SubmissionPoWBits int
+
+	// StallWatchdogMargin is the number of seconds the voting state machine
+	// may run late before it is reported as stalled, with an error log, a
+	// RoundStalledEvent and a metric.  The default of 0 disables the
+	// watchdog.
+	StallWatchdogMargin int
+
+	// AllowEmptyNetwork allows the Mixes and Providers whitelist to be
+	// completely empty, for bootstrapping scenarios.  The authority will
+	// not vote until nodes are whitelisted.
+	AllowEmptyNetwork bool
+
+	// IdentifierPolicy controls the validation of whitelisted Provider
+	// identifiers and descriptor names.  "lenient" (the default) only
+	// rejects malformed identifiers, "strict" additionally requires valid,
+	// non-reserved DNS names.
+	IdentifierPolicy string
+
+	// MinRevealsForBeacon is the minimum number of authorities whose
+	// reveals match their commitments that are required to compute the
+	// shared random value.  Authorities revealing a value inconsistent with
+	// their commitment are logged and excluded.  If too few valid reveals
+	// remain, no shared random value and therefore no consensus is produced
+	// for the epoch, rather than falling back to a predictable value.  The
+	// default of 0 places no lower bound.
+	MinRevealsForBeacon int
+
+	// LenientDescriptorParsing makes the authority ignore descriptor fields
+	// that it does not know about instead of rejecting the descriptor, to
+	// ease version skew while nodes are being upgraded.  All authorities
+	// MUST use the same setting, or they will disagree on which nodes are
+	// included in the consensus.
+	LenientDescriptorParsing bool
+
+	// AllowedTransports is the set of transports that descriptors may
+	// advertise addresses for.  Descriptors with a transport that is not
+	// allowed, or that has an empty address list (See
+	// s11n.ValidateTransports), or with a malformed TCP or onion address
+	// are rejected, as they are self-signed and can not be stripped of the
+	// offending entries.  The default allows the TCP and Tor onion service
+	// transports.
+	AllowedTransports []string
+
+	// DescriptorSignatureAlgorithms is the set of signature algorithms that
+	// descriptors may be signed with (See
+	// s11n.RegisterSignatureAlgorithm).  A newer algorithm can be added
+	// alongside the old one for the duration of a migration.  Descriptors
+	// signed with any other algorithm are rejected.  The default only
+	// allows Ed25519.
+	DescriptorSignatureAlgorithms []string
+
+	// StrictTransports is deprecated, and has no effect, as descriptors
+	// with a transport that is not allowed are always rejected (See
+	// AllowedTransports).  It will be removed in the next release.
+	StrictTransports bool
+
+	// PeerDialMaxRetries is the maximum number of times that sending a
+	// vote, reveal or signature to a peer authority is retried after a
+	// connection failure.  Retries stop early at the end of the voting
+	// phase, and rejections by the peer are not retried.
+	PeerDialMaxRetries int
+
+	// PeerDialBaseDelay is the delay in milliseconds before the first
+	// retry, which doubles with each subsequent retry, with jitter.
+	PeerDialBaseDelay int
+
+	// ProductionMode rejects loopback and unspecified addresses in the
+	// Authority and Authorities sections, which can not be reached by
+	// peers on other hosts.  Such addresses are allowed otherwise, for
+	// testing.
+	ProductionMode bool
+
+	// AllowUnsafePermissions makes the authority start with a DataDir or
+	// private key files that are accessible by the group or other users,
+	// logging a warning instead of refusing to start.
+	AllowUnsafePermissions bool
+
+	// DescriptorUploadRateLimit is the maximum number of descriptor
+	// uploads accepted from each node identity per epoch.  Further uploads
+	// are rejected until the next epoch.  The default of 0 disables the
+	// limit.
+	DescriptorUploadRateLimit int
+
+	// ExcludeEquivocators excludes the votes of a peer authority that sent
+	// conflicting votes for an epoch from the tally for that epoch.
+	// Equivocation is always logged, and the conflicting votes are saved
+	// in the DataDir as evidence.
+	ExcludeEquivocators bool
+
+	// StrictPeerKeys refuses connections to peer authorities that present
+	// a link key other than the one in their Authorities entry, instead of
+	// only logging a warning.  Connections from such peers are always
+	// refused.
+	StrictPeerKeys bool
+
+	// MaxDescriptorSize is the maximum size in bytes of an uploaded
+	// descriptor.  It bounds the bytes read from a mix's connection after
+	// the handshake, so that the upload of a larger descriptor fails while
+	// it is being read, before it is decrypted and parsed.  A single wire
+	// protocol frame is in any case bounded by the core wire protocol.
+	MaxDescriptorSize int
+
+	// MaxDocumentSize is the maximum size in bytes of a vote or signed
+	// consensus received from a peer authority.  It bounds the bytes read
+	// from a peer authority's connection after the handshake, as
+	// MaxDescriptorSize does for mixes.
+	MaxDocumentSize int
+
+	// ObserverMode runs the authority as an observer, that follows the
+	// voting rounds and computes the consensus it expects from the votes
+	// it receives, but never votes or signs a consensus itself.  The
+	// voting authorities only send their votes to an observer that they
+	// list as a peer with Observer set.
+	ObserverMode bool
+
+	// EpochClockSkewTolerance is the time in seconds after the end of each
+	// voting phase that descriptors, votes, reveals and signatures are
+	// still accepted for it, to accommodate slightly skewed clocks.  The
+	// epoch schedule itself is unchanged.  It must be shorter than every
+	// voting phase, and defaults to 0.
+	EpochClockSkewTolerance int
+
+	// MaxConcurrentConnections is the maximum number of connections open
+	// at once.  Inbound connections beyond the limit are closed immediately
+	// after being accepted.  The connections to peer authorities count
+	// towards the limit, but are never refused.
+	MaxConcurrentConnections int
+
+	// ListenBacklog is the TCP accept backlog of the listeners.  The
+	// default of 0 uses the system default.
+	ListenBacklog int
+
+	// PeerKeepAlive is the TCP keepalive period in seconds of the
+	// connections to peer authorities, so that connections silently
+	// dropped by a NAT or firewall are detected.  It defaults to 15
+	// seconds, and a negative value disables keepalives.
+	PeerKeepAlive int
+
+	// MaxEpochDrift enables the clock drift guard, if positive.  When the
+	// local voting epoch differs by MaxEpochDrift epochs or more from the
+	// one signed by the majority of the peer authorities recently heard
+	// from, the local clock is presumably wrong, and the authority refuses
+	// to vote rather than vote for the wrong epoch.  1 is the strictest
+	// setting, and the default of 0 disables the guard.
+	MaxEpochDrift int
+
+	// PeerIdleTimeout is the time in seconds after which a connection to
+	// a peer authority that neither sent nor received any data is
+	// considered dead, and the exchange is retried on a new connection.
+	// It must leave the peer enough time to process a vote, and defaults
+	// to 20 seconds.
+	PeerIdleTimeout int
 }
 
 func (dCfg *Debug) validate() error {
-	if dCfg.Layers > defaultLayers {
+	nrKeySources := 0
+	for _, set := range []bool{dCfg.IdentityKey != nil, len(dCfg.IdentityKeyCommand) != 0, dCfg.IdentityKeyEnv != ""} {
+		if set {
+			nrKeySources++
+		}
+	}
+	if nrKeySources > 1 {
+		return errors.New("config: Debug: only one of IdentityKey, IdentityKeyCommand and IdentityKeyEnv may be set")
+	}
+	if len(dCfg.IdentityKeyCommand) != 0 && dCfg.IdentityKeyCommand[0] == "" {
+		return errors.New("config: Debug: IdentityKeyCommand is missing the command")
+	}
+	if dCfg.Layers > maxLayers {
 		// This is a limitation of the Sphinx implementation.
 		return fmt.Errorf("config: Debug: Layers %v exceeds maximum", dCfg.Layers)
 	}
+	if dCfg.StartupWarmup < 0 {
+		return fmt.Errorf("config: Debug: StartupWarmup %v is invalid", dCfg.StartupWarmup)
+	}
+	if dCfg.SubmissionPoWBits < 0 || dCfg.SubmissionPoWBits > maxSubmissionPoWBits {
+		return fmt.Errorf("config: Debug: SubmissionPoWBits %v is invalid", dCfg.SubmissionPoWBits)
+	}
+	if dCfg.DescriptorUploadRateLimit < 0 {
+		return fmt.Errorf("config: Debug: DescriptorUploadRateLimit %v is invalid", dCfg.DescriptorUploadRateLimit)
+	}
+	if dCfg.StallWatchdogMargin < 0 {
+		return fmt.Errorf("config: Debug: StallWatchdogMargin %v is invalid", dCfg.StallWatchdogMargin)
+	}
+	if dCfg.PeerDialMaxRetries < 0 {
+		return fmt.Errorf("config: Debug: PeerDialMaxRetries %v is invalid", dCfg.PeerDialMaxRetries)
+	}
+	if dCfg.PeerDialBaseDelay < 0 {
+		return fmt.Errorf("config: Debug: PeerDialBaseDelay %v is invalid", dCfg.PeerDialBaseDelay)
+	}
+	if dCfg.MinRevealsForBeacon < 0 {
+		return fmt.Errorf("config: Debug: MinRevealsForBeacon %v is invalid", dCfg.MinRevealsForBeacon)
+	}
+	if dCfg.MaxAddressesPerNode < 0 {
+		return fmt.Errorf("config: Debug: MaxAddressesPerNode %v is invalid", dCfg.MaxAddressesPerNode)
+	}
+	if dCfg.EpochClockSkewTolerance < 0 {
+		return fmt.Errorf("config: Debug: EpochClockSkewTolerance %v is invalid", dCfg.EpochClockSkewTolerance)
+	}
+	if dCfg.MaxConcurrentConnections < 0 {
+		return fmt.Errorf("config: Debug: MaxConcurrentConnections %v is invalid", dCfg.MaxConcurrentConnections)
+	}
+	if dCfg.ListenBacklog < 0 {
+		return fmt.Errorf("config: Debug: ListenBacklog %v is invalid", dCfg.ListenBacklog)
+	}
+	if dCfg.PeerIdleTimeout < 0 {
+		return fmt.Errorf("config: Debug: PeerIdleTimeout %v is invalid", dCfg.PeerIdleTimeout)
+	}
+	if dCfg.MaxEpochDrift < 0 {
+		return fmt.Errorf("config: Debug: MaxEpochDrift %v is invalid", dCfg.MaxEpochDrift)
+	}
+	if dCfg.MaxDescriptorSize < 0 {
+		return fmt.Errorf("config: Debug: MaxDescriptorSize %v is invalid", dCfg.MaxDescriptorSize)
+	}
+	if dCfg.MaxDocumentSize < 0 {
+		return fmt.Errorf("config: Debug: MaxDocumentSize %v is invalid", dCfg.MaxDocumentSize)
+	}
+	if dCfg.MaxLoadWeight < 0 || dCfg.MaxLoadWeight > math.MaxUint8 {
+		return fmt.Errorf("config: Debug: MaxLoadWeight %v is invalid", dCfg.MaxLoadWeight)
+	}
+	switch dCfg.MissingServicePolicy {
+	case "", MissingServiceFlag, MissingServiceWithhold:
+	default:
+		return fmt.Errorf("config: Debug: MissingServicePolicy '%v' is invalid", dCfg.MissingServicePolicy)
+	}
+	for _, v := range dCfg.AllowedTransports {
+		if pki.Transport(v) == pki.TransportInvalid {
+			return errors.New("config: Debug: AllowedTransports contains an invalid transport")
+		}
+	}
+	for _, v := range dCfg.DescriptorSignatureAlgorithms {
+		if !s11n.IsSignatureAlgorithmKnown(v) {
+			return fmt.Errorf("config: Debug: DescriptorSignatureAlgorithms '%v' is invalid", v)
+		}
+	}
+	switch dCfg.IdentifierPolicy {
+	case "", IdentifierPolicyLenient, IdentifierPolicyStrict:
+	default:
+		return fmt.Errorf("config: Debug: IdentifierPolicy '%v' is invalid", dCfg.IdentifierPolicy)
+	}
 	return nil
 }
 
 func (dCfg *Debug) applyDefaults() {
-	if dCfg.Layers <= 0 {
-		dCfg.Layers = defaultLayers
-	}
 	if dCfg.MinNodesPerLayer <= 0 {
 		dCfg.MinNodesPerLayer = defaultMinNodesPerLayer
 	}
+	if dCfg.MissingServicePolicy == "" {
+		dCfg.MissingServicePolicy = MissingServiceFlag
+	}
+	if dCfg.IdentifierPolicy == "" {
+		dCfg.IdentifierPolicy = IdentifierPolicyLenient
+	}
+	if dCfg.MaxAddressesPerNode == 0 {
+		dCfg.MaxAddressesPerNode = defaultMaxAddresses
+	}
+	if dCfg.MaxLoadWeight == 0 {
+		dCfg.MaxLoadWeight = defaultMaxLoadWeight
+	}
+	if dCfg.MaxDescriptorSize == 0 {
+		dCfg.MaxDescriptorSize = defaultMaxDescriptorSize
+	}
+	if dCfg.MaxDocumentSize == 0 {
+		dCfg.MaxDocumentSize = defaultMaxDocumentSize
+	}
+	if dCfg.MaxConcurrentConnections == 0 {
+		dCfg.MaxConcurrentConnections = defaultMaxConnections
+	}
+	if dCfg.PeerDialMaxRetries == 0 {
+		dCfg.PeerDialMaxRetries = defaultPeerDialRetries
+	}
+	if dCfg.PeerDialBaseDelay == 0 {
+		dCfg.PeerDialBaseDelay = defaultPeerDialDelay
+	}
+	if dCfg.PeerKeepAlive == 0 {
+		dCfg.PeerKeepAlive = defaultPeerKeepAlive
+	}
+	if dCfg.PeerIdleTimeout == 0 {
+		dCfg.PeerIdleTimeout = defaultPeerIdleTimeout
+	}
+	if dCfg.AllowedTransports == nil {
+		dCfg.AllowedTransports = []string{
+			string(pki.TransportTCP),
+			string(pki.TransportTCPv4),
+			string(pki.TransportTCPv6),
+			string(s11n.TransportTorV2),
+			string(s11n.TransportTorV3),
+		}
+	}
+	if dCfg.DescriptorSignatureAlgorithms == nil {
+		dCfg.DescriptorSignatureAlgorithms = []string{s11n.SignatureAlgorithmEd25519}
+	}
 }
 
 // AuthorityPeer is the connecting information
@@ -289,21 +1185,35 @@ type AuthorityPeer struct {
 	IdentityPublicKey *eddsa.PublicKey
 	// LinkPublicKey is the peer's public link layer key.
 	LinkPublicKey *ecdh.PublicKey
-	// Addresses are the IP address/port combinations that the peer authority
-	// uses for the Directory Authority service.
+	// Addresses are the host/port combinations that the peer authority
+	// uses for the Directory Authority service, where the host is an IPv4
+	// address, a bracketed IPv6 address, or a DNS hostname.  They are
+	// tried in order when connecting to the peer.
 	Addresses []string
+	// NextIdentityPublicKey is the identity key that the peer is rotating
+	// to, its Authority.NextIdentityKey.  Signatures by it on the peer's
+	// certificate are merged into the consensus along with the peer's own.
+	NextIdentityPublicKey *eddsa.PublicKey
+	// Observer marks the peer as an authority in Debug.ObserverMode.  It
+	// is sent the votes, reveals and signatures of every round, but it is
+	// not one of the voting authorities, so it does not count towards the
+	// Threshold, and its votes are rejected.
+	Observer bool
 }
 
 // Validate parses and checks the AuthorityPeer configuration.
 func (a *AuthorityPeer) Validate() error {
 	for _, v := range a.Addresses {
-		if err := utils.EnsureAddrIPPort(v); err != nil {
+		if err := ValidatePeerAddress(v); err != nil {
 			return fmt.Errorf("config: AuthorityPeer: Address '%v' is invalid: %v", v, err)
 		}
 	}
 	if a.IdentityPublicKey == nil {
 		return fmt.Errorf("config: %v: AuthorityPeer is missing Identifier", a)
 	}
+	if a.NextIdentityPublicKey != nil && a.NextIdentityPublicKey.Equal(a.IdentityPublicKey) {
+		return fmt.Errorf("config: %v: AuthorityPeer NextIdentityPublicKey is the IdentityPublicKey", a.IdentityPublicKey)
+	}
 	return nil
 }
 
@@ -315,15 +1225,24 @@ type Node struct {
 
 	// IdentityKey is the node's identity signing key.
 	IdentityKey *eddsa.PublicKey
+
+	// Layer is the optional 0-indexed layer that the node is always placed
+	// in, for Mixes only.  Mixes without a Layer are assigned to layers
+	// automatically.  All authorities MUST use the same Layer for each
+	// node, or they will disagree on the topology.
+	Layer *int
 }
 
-func (n *Node) validate(isProvider bool) error {
+func (n *Node) validate(isProvider bool, identifierPolicy string, layers int) error {
 	section := "Mixes"
 	if isProvider {
 		section = "Providers"
 		if n.Identifier == "" {
 			return fmt.Errorf("config: %v: Node is missing Identifier", section)
 		}
+		if err := ValidateIdentifier(n.Identifier, identifierPolicy); err != nil {
+			return fmt.Errorf("config: %v: Node has invalid Identifier: %v", section, err)
+		}
 		var err error
 		n.Identifier, err = idna.Lookup.ToASCII(n.Identifier)
 		if err != nil {
@@ -332,22 +1251,241 @@ func (n *Node) validate(isProvider bool) error {
 	} else if n.Identifier != "" {
 		return fmt.Errorf("config: %v: Node has Identifier set", section)
 	}
+	if n.Layer != nil {
+		if isProvider {
+			return fmt.Errorf("config: %v: Node has Layer set", section)
+		}
+		if *n.Layer < 0 || *n.Layer >= layers {
+			return fmt.Errorf("config: %v: Node has invalid Layer %v", section, *n.Layer)
+		}
+	}
 	if n.IdentityKey == nil {
 		return fmt.Errorf("config: %v: Node is missing IdentityKey", section)
 	}
 	return nil
 }
 
+// BlacklistEntry is a node that the authority votes to publish in the
+// consensus blacklist, which clients must never route through.  An entry is
+// only published if a threshold of authorities vote for it with the same
+// Until.  While the entry has not expired, the authority also refuses the
+// node's descriptors and leaves it out of its vote, even if whitelisted.
+//
+// An entry is either a table, or the node's identity key alone for an entry
+// that does not expire, as in `Blacklist = [ "<IdentityKey>" ]`.
+type BlacklistEntry struct {
+	// IdentityKey is the node's identity signing key.
+	IdentityKey *eddsa.PublicKey
+
+	// Until is the first epoch the authority no longer votes for the entry,
+	// or 0 if the entry does not expire.
+	Until uint64
+}
+
+// blacklistTable is a BlacklistEntry without the UnmarshalTOML method, to
+// decode the table form with.
+type blacklistTable BlacklistEntry
+
+// UnmarshalTOML decodes the BlacklistEntry from either of its forms.
+func (e *BlacklistEntry) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case string:
+		e.IdentityKey = new(eddsa.PublicKey)
+		if err := e.IdentityKey.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: Blacklist: IdentityKey '%v' is invalid: %v", v, err)
+		}
+		return nil
+	case map[string]interface{}:
+		// The decoder does not track the keys of the table once it is
+		// handed to UnmarshalTOML, so check them here instead.
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return err
+		}
+		md, err := toml.Decode(buf.String(), (*blacklistTable)(e))
+		if err != nil {
+			return fmt.Errorf("config: Blacklist: %v", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("config: Blacklist: Undecoded keys in entry: %v", undecoded)
+		}
+		return nil
+	default:
+		return fmt.Errorf("config: Blacklist: Entry '%v' is invalid", data)
+	}
+}
+
+func (e *BlacklistEntry) validate() error {
+	if e.IdentityKey == nil {
+		return errors.New("config: Blacklist: Entry is missing IdentityKey")
+	}
+	return nil
+}
+
+// ScheduledParameters is a change to the voted network parameters that
+// takes effect from a future epoch onwards.  Fields that are left as 0 keep
+// the value in effect before the change, except that the MaxDelay of a
+// scheduled rate is derived from the new rate, as for the Parameters, unless
+// it is scheduled as well.  As with the Parameters, all authorities MUST be
+// configured with the same schedule.
+type ScheduledParameters struct {
+	// Epoch is the first epoch for which the authority votes the new
+	// values.  Entries that already took effect keep applying, and once a
+	// later entry takes effect too, the authority warns that the earlier
+	// one can be folded into the Parameters.
+	Epoch uint64
+
+	SendRatePerMinute uint64
+	Mu                float64
+	MuMaxDelay        uint64
+	LambdaP           float64
+	LambdaPMaxDelay   uint64
+	LambdaL           float64
+	LambdaLMaxDelay   uint64
+	LambdaD           float64
+	LambdaDMaxDelay   uint64
+	LambdaM           float64
+	LambdaMMaxDelay   uint64
+}
+
+func (sCfg *ScheduledParameters) validate() error {
+	p := &Parameters{
+		Mu:              sCfg.Mu,
+		MuMaxDelay:      sCfg.MuMaxDelay,
+		LambdaP:         sCfg.LambdaP,
+		LambdaPMaxDelay: sCfg.LambdaPMaxDelay,
+		LambdaL:         sCfg.LambdaL,
+		LambdaLMaxDelay: sCfg.LambdaLMaxDelay,
+		LambdaD:         sCfg.LambdaD,
+		LambdaDMaxDelay: sCfg.LambdaDMaxDelay,
+		LambdaM:         sCfg.LambdaM,
+		LambdaMMaxDelay: sCfg.LambdaMMaxDelay,
+	}
+	for _, v := range p.lambdas() {
+		if v.lambda < 0 || math.IsNaN(v.lambda) || math.IsInf(v.lambda, 0) {
+			return fmt.Errorf("config: ParameterSchedule: Epoch %v: %v %v is invalid", sCfg.Epoch, v.name, v.lambda)
+		}
+		if v.maxDelay > absoluteMaxDelay {
+			return fmt.Errorf("config: ParameterSchedule: Epoch %v: %vMaxDelay %v is out of range", sCfg.Epoch, v.name, v.maxDelay)
+		}
+	}
+	return nil
+}
+
+// apply overwrites the parameters with each of the non-zero scheduled
+// values, and derives the MaxDelay of each rate that changed.
+func (sCfg *ScheduledParameters) apply(pCfg *Parameters) {
+	setUint := func(dst *uint64, v uint64) {
+		if v != 0 {
+			*dst = v
+		}
+	}
+	// A new rate invalidates the MaxDelay derived from the old one, which
+	// applyDefaults derives again unless a new MaxDelay is scheduled too.
+	setRate := func(lambda *float64, maxDelay *uint64, v float64, vMaxDelay uint64) {
+		if v != 0 {
+			*lambda = v
+			*maxDelay = vMaxDelay
+		}
+		setUint(maxDelay, vMaxDelay)
+	}
+	setUint(&pCfg.SendRatePerMinute, sCfg.SendRatePerMinute)
+	setRate(&pCfg.Mu, &pCfg.MuMaxDelay, sCfg.Mu, sCfg.MuMaxDelay)
+	setRate(&pCfg.LambdaP, &pCfg.LambdaPMaxDelay, sCfg.LambdaP, sCfg.LambdaPMaxDelay)
+	setRate(&pCfg.LambdaL, &pCfg.LambdaLMaxDelay, sCfg.LambdaL, sCfg.LambdaLMaxDelay)
+	setRate(&pCfg.LambdaD, &pCfg.LambdaDMaxDelay, sCfg.LambdaD, sCfg.LambdaDMaxDelay)
+	setRate(&pCfg.LambdaM, &pCfg.LambdaMMaxDelay, sCfg.LambdaM, sCfg.LambdaMMaxDelay)
+	pCfg.applyDefaults()
+}
+
+// ValidateIdentifier returns an error iff the node identifier is not
+// acceptable under the given Debug.IdentifierPolicy.
+func ValidateIdentifier(id string, policy string) error {
+	if id == "" {
+		return errors.New("identifier is empty")
+	}
+	if len(id) > maxIdentifierLength {
+		return fmt.Errorf("identifier exceeds %d bytes", maxIdentifierLength)
+	}
+	for _, r := range id {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("identifier %q contains invalid character %q", id, r)
+		}
+	}
+	if policy != IdentifierPolicyStrict {
+		return nil
+	}
+
+	name, err := idna.Lookup.ToASCII(id)
+	if err != nil {
+		return fmt.Errorf("identifier '%v' is not a valid DNS name: %v", id, err)
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("identifier '%v' has an invalid DNS label length", id)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("identifier '%v' has a DNS label with a leading or trailing hyphen", id)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+				return fmt.Errorf("identifier '%v' contains invalid DNS character %q", id, c)
+			}
+		}
+	}
+	for _, reserved := range reservedNames {
+		if name == reserved || strings.HasSuffix(name, "."+reserved) {
+			return fmt.Errorf("identifier '%v' is a reserved name", id)
+		}
+	}
+	return nil
+}
+
 // Config is the top level authority configuration.
 type Config struct {
 	Authority   *Authority
 	Authorities []*AuthorityPeer
 	Logging     *Logging
+	Metrics     *Metrics
+	HealthCheck *HealthCheck
+	HTTPGateway *HTTPGateway
+	Management  *Management
+	Storage     *Storage
 	Parameters  *Parameters
 	Debug       *Debug
 
 	Mixes     []*Node
 	Providers []*Node
+	Blacklist []*BlacklistEntry
+
+	// ParameterSchedule is the list of future changes to the Parameters,
+	// sorted by Epoch once validated.  See ParametersAt.
+	ParameterSchedule []*ScheduledParameters
+
+	// AddressVerifier is the optional function used to check that each
+	// address advertised in a descriptor is reachable and serving the mix
+	// protocol, before the descriptor is accepted.  If nil, no verification
+	// is done.  It can only be set programmatically.
+	//
+	// Descriptors are self-signed, so individual addresses can not be
+	// stripped from them.  Instead, addresses that fail verification are
+	// logged and ignored, and the descriptor is rejected iff none of its
+	// addresses verify.  As each authority only votes for descriptors that
+	// it has accepted, and a descriptor must receive a threshold of votes to
+	// appear in the consensus, authorities that disagree about reachability
+	// can not split the network: a node is only listed if a majority of the
+	// authorities could verify it.
+	AddressVerifier func(addr string, transport string) error `toml:"-"`
+
+	// TopologyBuilder is the optional custom layer assignment algorithm
+	// used when generating the consensus document.  If nil, the built-in
+	// algorithm that preserves the previous epoch's layer assignment where
+	// possible is used.  See TopologyBuilder for the determinism
+	// requirements.  It can only be set programmatically.
+	TopologyBuilder TopologyBuilder `toml:"-"`
+
+	peersFromFile bool
 }
 
 // FixupAndValidate applies defaults to config entries and validates the
@@ -359,7 +1497,25 @@ func (cfg *Config) FixupAndValidate() error {
 		return errors.New("config: No Authority block was present")
 	}
 	if cfg.Logging == nil {
-		cfg.Logging = &defaultLogging
+		// Copy the defaults, as the section is modified during validation
+		// and may belong to one of several Configs in the same process.
+		logging := defaultLogging
+		cfg.Logging = &logging
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = &Metrics{}
+	}
+	if cfg.HealthCheck == nil {
+		cfg.HealthCheck = &HealthCheck{}
+	}
+	if cfg.HTTPGateway == nil {
+		cfg.HTTPGateway = &HTTPGateway{}
+	}
+	if cfg.Management == nil {
+		cfg.Management = &Management{}
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = &Storage{}
 	}
 	if cfg.Parameters == nil {
 		cfg.Parameters = &Parameters{}
@@ -372,28 +1528,102 @@ func (cfg *Config) FixupAndValidate() error {
 	if err := cfg.Authority.validate(); err != nil {
 		return err
 	}
+	if cfg.Authority.PeersFile != "" && !cfg.peersFromFile {
+		if len(cfg.Authorities) != 0 {
+			return errors.New("config: Authority: PeersFile is set, and Authorities are specified inline")
+		}
+		peers, err := loadPeersFile(cfg.Authority.PeersFile)
+		if err != nil {
+			return err
+		}
+		cfg.Authorities = peers
+		cfg.peersFromFile = true
+	}
 	if err := cfg.Logging.validate(); err != nil {
 		return err
 	}
+	if err := cfg.Metrics.validate(); err != nil {
+		return err
+	}
+	if err := cfg.HealthCheck.validate(); err != nil {
+		return err
+	}
+	if err := cfg.HTTPGateway.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Storage.validate(); err != nil {
+		return err
+	}
 	if err := cfg.Parameters.validate(); err != nil {
 		return err
 	}
 	if err := cfg.Debug.validate(); err != nil {
 		return err
 	}
+	cfg.Authority.applyDefaults()
+	cfg.Management.applyDefaults(cfg.Authority)
+	if err := cfg.Management.validate(); err != nil {
+		return err
+	}
 	cfg.Parameters.applyDefaults()
 	cfg.Debug.applyDefaults()
+	if err := cfg.Parameters.validateDefaults(); err != nil {
+		return err
+	}
+	if skew := cfg.Debug.EpochClockSkewTolerance; skew > 0 {
+		for _, v := range cfg.Parameters.phases() {
+			if skew >= v.duration {
+				return fmt.Errorf("config: Debug: EpochClockSkewTolerance %v is not shorter than the %v %v", skew, v.name, v.duration)
+			}
+		}
+		if slack := epochtime.Period / minPhaseSlack; time.Duration(skew)*time.Second >= slack {
+			return fmt.Errorf("config: Debug: EpochClockSkewTolerance %v is not shorter than the %v slack at the end of the epoch", skew, slack)
+		}
+	}
+	// The authority itself is not one of the Authorities, and only votes
+	// if it is not an observer.
+	nrAuthorities := len(cfg.VotingAuthorities()) + 1
+	if cfg.Debug.ObserverMode {
+		if nrAuthorities == 1 {
+			return errors.New("config: Debug: ObserverMode is set, and no voting Authorities are specified")
+		}
+		nrAuthorities--
+	}
+	if err := cfg.Parameters.fixupThreshold(nrAuthorities); err != nil {
+		return err
+	}
+	if err := cfg.Parameters.fixupLayers(cfg.Debug); err != nil {
+		return err
+	}
+	if err := cfg.Parameters.fixupGeometry(); err != nil {
+		return err
+	}
+
+	if cfg.Debug.ProductionMode {
+		if err := validatePublicAddresses("Authority", cfg.Authority.PublicAddresses); err != nil {
+			return err
+		}
+		for _, v := range cfg.Authorities {
+			if err := validatePublicAddresses("Authorities", v.Addresses); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(cfg.Mixes) == 0 && len(cfg.Providers) == 0 && !cfg.Debug.AllowEmptyNetwork {
+		return errors.New("config: No Mixes or Providers are whitelisted, and Debug.AllowEmptyNetwork is not set")
+	}
 
 	allNodes := make([]*Node, 0, len(cfg.Mixes)+len(cfg.Providers))
 	for _, v := range cfg.Mixes {
-		if err := v.validate(false); err != nil {
+		if err := v.validate(false, cfg.Debug.IdentifierPolicy, cfg.Parameters.Layers); err != nil {
 			return err
 		}
 		allNodes = append(allNodes, v)
 	}
 	idMap := make(map[string]*Node)
 	for _, v := range cfg.Providers {
-		if err := v.validate(true); err != nil {
+		if err := v.validate(true, cfg.Debug.IdentifierPolicy, cfg.Parameters.Layers); err != nil {
 			return err
 		}
 		if _, ok := idMap[v.Identifier]; ok {
@@ -411,7 +1641,141 @@ func (cfg *Config) FixupAndValidate() error {
 		}
 		pkMap[tmp] = v
 	}
+	blacklisted := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, v := range cfg.Blacklist {
+		if err := v.validate(); err != nil {
+			return err
+		}
+		pk := v.IdentityKey.ByteArray()
+		if blacklisted[pk] {
+			return fmt.Errorf("config: Blacklist: IdentityKey '%v' is present more than once", v.IdentityKey)
+		}
+		blacklisted[pk] = true
+	}
+	scheduled := make(map[uint64]bool)
+	for _, v := range cfg.ParameterSchedule {
+		if v == nil {
+			return errors.New("config: ParameterSchedule: Entry is empty")
+		}
+		if err := v.validate(); err != nil {
+			return err
+		}
+		if scheduled[v.Epoch] {
+			return fmt.Errorf("config: ParameterSchedule: Epoch %v is present more than once", v.Epoch)
+		}
+		scheduled[v.Epoch] = true
+	}
+	sort.Slice(cfg.ParameterSchedule, func(i, j int) bool {
+		return cfg.ParameterSchedule[i].Epoch < cfg.ParameterSchedule[j].Epoch
+	})
+	for _, v := range cfg.ParameterSchedule {
+		p := cfg.ParametersAt(v.Epoch)
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("config: ParameterSchedule: Epoch %v: %v", v.Epoch, err)
+		}
+		if err := p.validateDefaults(); err != nil {
+			return fmt.Errorf("config: ParameterSchedule: Epoch %v: %v", v.Epoch, err)
+		}
+	}
+
+	return nil
+}
+
+// ScheduleWarnings returns a description of each ParameterSchedule entry
+// that is superseded by a later entry that already took effect, and so can
+// be folded into the Parameters.  Such entries still apply, in order.
+func (cfg *Config) ScheduleWarnings() []string {
+	var warnings []string
+	now, _, _ := epochtime.Now()
+	for i, v := range cfg.ParameterSchedule {
+		if next := i + 1; next < len(cfg.ParameterSchedule) && cfg.ParameterSchedule[next].Epoch <= now {
+			warnings = append(warnings, fmt.Sprintf("ParameterSchedule: Epoch %v is superseded by Epoch %v, and can be folded into the Parameters", v.Epoch, cfg.ParameterSchedule[next].Epoch))
+		}
+	}
+	return warnings
+}
+
+// ParametersAt returns the Parameters that the authority votes for the
+// given epoch, with every ParameterSchedule entry up to and including the
+// epoch applied in order.  The returned value must not be modified.
+func (cfg *Config) ParametersAt(epoch uint64) *Parameters {
+	if len(cfg.ParameterSchedule) == 0 || cfg.ParameterSchedule[0].Epoch > epoch {
+		return cfg.Parameters
+	}
+	p := *cfg.Parameters
+	for _, v := range cfg.ParameterSchedule {
+		if v.Epoch > epoch {
+			break
+		}
+		v.apply(&p)
+	}
+	return &p
+}
+
+// VotingAuthorities returns the Authorities that vote, leaving out the
+// observers.
+func (cfg *Config) VotingAuthorities() []*AuthorityPeer {
+	peers := make([]*AuthorityPeer, 0, len(cfg.Authorities))
+	for _, v := range cfg.Authorities {
+		if !v.Observer {
+			peers = append(peers, v)
+		}
+	}
+	return peers
+}
+
+// ValidatePeerAddress checks that addr is a host/port combination that a
+// peer authority can be dialed at.  The host must be an IPv4 address, a
+// bracketed IPv6 address (eg: "[::1]:30001") or a DNS hostname.
+func ValidatePeerAddress(addr string) error {
+	h, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port '%v'", p)
+	}
+	if port == 0 {
+		return errors.New("port is 0")
+	}
+	if net.ParseIP(h) != nil {
+		return nil
+	}
+	return validateHostname(h)
+}
+
+func validateHostname(h string) error {
+	h = strings.TrimSuffix(h, ".")
+	if h == "" || len(h) > 253 {
+		return fmt.Errorf("invalid host '%v'", h)
+	}
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid host '%v'", h)
+		}
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			default:
+				return fmt.Errorf("invalid host '%v'", h)
+			}
+		}
+	}
+	return nil
+}
 
+func validatePublicAddresses(section string, addrs []string) error {
+	for _, v := range addrs {
+		h, _, err := net.SplitHostPort(v)
+		if err != nil {
+			return fmt.Errorf("config: %v: Address '%v' is invalid: %v", section, v, err)
+		}
+		ip := net.ParseIP(h)
+		if h == "" || strings.EqualFold(h, "localhost") || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified())) {
+			return fmt.Errorf("config: %v: Address '%v' is not reachable by peers, and Debug.ProductionMode is set", section, v)
+		}
+	}
 	return nil
 }
 
@@ -423,7 +1787,7 @@ func Load(b []byte, forceGenOnly bool) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+	if undecoded := undecodedKeys(md); len(undecoded) != 0 {
 		return nil, fmt.Errorf("config: Undecoded keys in config file: %v", undecoded)
 	}
 	if err := cfg.FixupAndValidate(); err != nil {
@@ -437,6 +1801,69 @@ func Load(b []byte, forceGenOnly bool) (*Config, error) {
 	return cfg, nil
 }
 
+// undecodedKeys returns the keys of the config file that were not decoded,
+// less those of the Blacklist entries, which BlacklistEntry.UnmarshalTOML
+// checks itself.
+func undecodedKeys(md toml.MetaData) []toml.Key {
+	var undecoded []toml.Key
+	for _, k := range md.Undecoded() {
+		if len(k) > 1 && strings.EqualFold(k[0], "Blacklist") {
+			continue
+		}
+		undecoded = append(undecoded, k)
+	}
+	return undecoded
+}
+
+// Save writes the Config to the file f as TOML, such that LoadFile returns
+// an identical Config.  Private keys and the programmatic hooks are always
+// omitted, as are the Authorities if they were loaded from the PeersFile.
+func (cfg *Config) Save(f string) error {
+	c := *cfg
+	if c.peersFromFile {
+		c.Authorities = nil
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(&c); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f, buf.Bytes(), 0600)
+}
+
+// redacted is the value of each secret in the EffectiveConfig.
+const redacted = "[REDACTED]"
+
+// EffectiveConfig returns the Config as TOML, with the keys of every table
+// sorted, so that the configs of several authorities can be compared after
+// FixupAndValidate has applied the defaults.  Private keys that are set are
+// replaced with "[REDACTED]", and the programmatic hooks are omitted.
+func (cfg *Config) EffectiveConfig() string {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return fmt.Sprintf("# config: failed to encode the config: %v\n", err)
+	}
+
+	// Round trip through a map, which the encoder writes sorted by key,
+	// unlike the fields of a struct.
+	m := make(map[string]interface{})
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return fmt.Sprintf("# config: failed to decode the config: %v\n", err)
+	}
+	if dbg, ok := m["Debug"].(map[string]interface{}); ok && cfg.Debug != nil {
+		if cfg.Debug.IdentityKey != nil {
+			dbg["IdentityKey"] = redacted
+		}
+		if cfg.Debug.LinkKey != nil {
+			dbg["LinkKey"] = redacted
+		}
+	}
+	buf.Reset()
+	if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+		return fmt.Sprintf("# config: failed to encode the config: %v\n", err)
+	}
+	return buf.String()
+}
+
 // LoadFile loads, parses and validates the provided file and returns the
 // Config.
 func LoadFile(f string, forceGenOnly bool) (*Config, error) {
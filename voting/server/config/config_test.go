@@ -0,0 +1,1079 @@
+// config_test.go - Katzenpost voting authority server configuration tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyWhitelist(t *testing.T) {
+	require := require.New(t)
+
+	newConfig := func() *Config {
+		return &Config{
+			Authority: &Authority{
+				Addresses: []string{"127.0.0.1:29483"},
+				DataDir:   "/var/lib/katzenpost-authority",
+			},
+		}
+	}
+
+	// A completely empty whitelist is rejected by default.
+	cfg := newConfig()
+	require.Error(cfg.FixupAndValidate())
+
+	// Unless explicitly allowed.
+	cfg = newConfig()
+	cfg.Debug = &Debug{AllowEmptyNetwork: true}
+	require.NoError(cfg.FixupAndValidate())
+
+	// A whitelist with any nodes at all is not empty.
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg = newConfig()
+	cfg.Mixes = []*Node{{IdentityKey: k.PublicKey()}}
+	require.NoError(cfg.FixupAndValidate())
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	require := require.New(t)
+
+	valid := []string{
+		"provider.example.org",
+		"Provider.Example.ORG",
+		"provider-1.example.org.",
+		"xn--bcher-kva.example.org",
+	}
+	for _, id := range valid {
+		require.NoError(ValidateIdentifier(id, IdentifierPolicyLenient), "lenient: %v", id)
+		require.NoError(ValidateIdentifier(id, IdentifierPolicyStrict), "strict: %v", id)
+	}
+
+	invalid := []string{
+		"",
+		"provider example.org",
+		"provider\texample.org",
+		"provider\x00.example.org",
+		"provider\n",
+		strings.Repeat("a", maxIdentifierLength+1),
+	}
+	for _, id := range invalid {
+		require.Error(ValidateIdentifier(id, IdentifierPolicyLenient), "lenient: %q", id)
+		require.Error(ValidateIdentifier(id, IdentifierPolicyStrict), "strict: %q", id)
+	}
+
+	// Only rejected by the strict policy.
+	strictOnly := []string{
+		"provider_1.example.org",
+		"-provider.example.org",
+		"provider..example.org",
+		strings.Repeat("a", 64) + ".example.org",
+		"localhost",
+		"provider.localhost",
+		"provider.invalid",
+	}
+	for _, id := range strictOnly {
+		require.NoError(ValidateIdentifier(id, IdentifierPolicyLenient), "lenient: %v", id)
+		require.Error(ValidateIdentifier(id, IdentifierPolicyStrict), "strict: %v", id)
+	}
+
+	// The policy also applies to the whitelist.
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg := &Config{
+		Authority: &Authority{
+			Addresses: []string{"127.0.0.1:29483"},
+			DataDir:   "/var/lib/katzenpost-authority",
+		},
+		Providers: []*Node{{Identifier: "provider example.org", IdentityKey: k.PublicKey()}},
+	}
+	require.Error(cfg.FixupAndValidate())
+	cfg.Providers[0].Identifier = "Provider.example.org"
+	require.NoError(cfg.FixupAndValidate())
+}
+
+func TestParametersBounds(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	newConfig := func(p *Parameters) *Config {
+		return &Config{
+			Authority: &Authority{
+				Addresses: []string{"127.0.0.1:29483"},
+				DataDir:   "/var/lib/katzenpost-authority",
+			},
+			Parameters: p,
+			Mixes:      []*Node{{IdentityKey: k.PublicKey()}},
+		}
+	}
+
+	// The defaults are sane.
+	cfg := newConfig(nil)
+	require.NoError(cfg.FixupAndValidate())
+	require.Empty(cfg.Parameters.Warnings())
+
+	// Invalid rates are rejected, naming the field.
+	for _, p := range []*Parameters{
+		{Mu: -1},
+		{LambdaL: math.NaN()},
+		{LambdaM: math.Inf(1)},
+	} {
+		err := newConfig(p).FixupAndValidate()
+		require.Error(err)
+	}
+	err = newConfig(&Parameters{LambdaD: -0.5}).FixupAndValidate()
+	require.Contains(err.Error(), "LambdaD -0.5")
+
+	// So are rates so large that the maximum delay rounds to 0.
+	err = newConfig(&Parameters{Mu: 1e9}).FixupAndValidate()
+	require.Error(err)
+	require.Contains(err.Error(), "MuMaxDelay")
+
+	// Valid, but implausible values only produce warnings.
+	cfg = newConfig(&Parameters{LambdaP: 2, LambdaM: 0.001, LambdaMMaxDelay: 10})
+	require.NoError(cfg.FixupAndValidate())
+	warnings := cfg.Parameters.Warnings()
+	require.Len(warnings, 2)
+	require.Contains(warnings[0], "LambdaP")
+	require.Contains(warnings[1], "LambdaMMaxDelay")
+}
+
+func TestPeersFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority-config")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	const peers = `
+[[Authorities]]
+   IdentityPublicKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+   Addresses = [ "192.0.2.7:29483" ]
+
+[[Authorities]]
+   IdentityPublicKey = "CAFE95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+   Addresses = [ "192.0.2.6:29483" ]
+`
+	peersFile := filepath.Join(dir, "peers.toml")
+	require.NoError(ioutil.WriteFile(peersFile, []byte(peers), 0600))
+
+	newConfig := func() *Config {
+		return &Config{
+			Authority: &Authority{
+				Addresses: []string{"127.0.0.1:29483"},
+				DataDir:   "/var/lib/katzenpost-authority",
+				PeersFile: peersFile,
+			},
+			Mixes: []*Node{{IdentityKey: k.PublicKey()}},
+		}
+	}
+
+	// The peers are loaded from the file.
+	cfg := newConfig()
+	require.NoError(cfg.FixupAndValidate())
+	require.Len(cfg.Authorities, 2)
+	require.Equal([]string{"192.0.2.6:29483"}, cfg.Authorities[1].Addresses)
+
+	// Validating again does not load them twice.
+	require.NoError(cfg.FixupAndValidate())
+	require.Len(cfg.Authorities, 2)
+
+	// Inline peers are not merged with the file.
+	cfg = newConfig()
+	cfg.Authorities = []*AuthorityPeer{{IdentityPublicKey: k.PublicKey()}}
+	require.Error(cfg.FixupAndValidate())
+
+	// Relative paths and malformed files are rejected.
+	cfg = newConfig()
+	cfg.Authority.PeersFile = "peers.toml"
+	require.Error(cfg.FixupAndValidate())
+	require.NoError(ioutil.WriteFile(peersFile, []byte("[[Authorities]]\n  Bogus = 1\n"), 0600))
+	require.Error(newConfig().FixupAndValidate())
+}
+
+func TestParametersHash(t *testing.T) {
+	require := require.New(t)
+
+	p := &Parameters{
+		Mu:               0.001,
+		RequiredServices: []string{"loop", "keyserver"},
+	}
+	p.applyDefaults()
+	h := p.Hash()
+	require.Len(h, 32)
+
+	q := *p
+	q.RequiredServices = []string{"keyserver", "loop"}
+	require.Equal(h, q.Hash(), "RequiredServices order")
+
+	for _, fn := range []func(p *Parameters){
+		func(p *Parameters) { p.SendRatePerMinute++ },
+		func(p *Parameters) { p.Mu = 0.002 },
+		func(p *Parameters) { p.LambdaMMaxDelay++ },
+		func(p *Parameters) { p.RequiredServices = []string{"loop"} },
+		func(p *Parameters) { p.ChainDocuments = true },
+		func(p *Parameters) { p.Threshold = 3 },
+		func(p *Parameters) { p.VotePhase++ },
+		func(p *Parameters) { p.SphinxGeometryVersion++ },
+	} {
+		q := *p
+		fn(&q)
+		require.NotEqual(h, q.Hash())
+	}
+}
+
+func TestParametersThreshold(t *testing.T) {
+	require := require.New(t)
+
+	// Defaults to a simple majority.
+	p := &Parameters{}
+	require.NoError(p.fixupThreshold(5))
+	require.Equal(3, p.Threshold)
+	p = &Parameters{}
+	require.NoError(p.fixupThreshold(4))
+	require.Equal(3, p.Threshold)
+	p = &Parameters{}
+	require.NoError(p.fixupThreshold(1))
+	require.Equal(1, p.Threshold)
+
+	for _, v := range []struct {
+		threshold, nrAuthorities int
+		ok                       bool
+	}{
+		{4, 5, true},
+		{5, 5, true},
+		{2, 5, false},
+		{6, 5, false},
+		{-1, 5, false},
+		{2, 4, false},
+	} {
+		p := &Parameters{Threshold: v.threshold}
+		err := p.fixupThreshold(v.nrAuthorities)
+		if v.ok {
+			require.NoError(err, "Threshold %v of %v", v.threshold, v.nrAuthorities)
+		} else {
+			require.Error(err, "Threshold %v of %v", v.threshold, v.nrAuthorities)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+
+	a := &Authority{
+		Addresses:       []string{"127.0.0.1:29483"},
+		DataDir:         "/dev/null",
+		NextIdentityKey: k.PublicKey(),
+	}
+	require.Error(a.validate(), "NextIdentityKey without RotationEpoch")
+
+	a.RotationEpoch = 100
+	require.NoError(a.validate())
+	a.applyDefaults()
+	require.Equal(defaultRotationOverlap, a.RotationOverlap)
+
+	a.RotationOverlap = 10
+	require.False(a.DualSigning(89))
+	require.True(a.DualSigning(90))
+	require.True(a.DualSigning(99))
+	require.True(a.DualSigning(100), "not restarted yet")
+
+	a.NextIdentityKey = nil
+	require.Error(a.validate(), "RotationEpoch without NextIdentityKey")
+	require.False(a.DualSigning(99))
+
+	// A peer's next key must differ from its current one.
+	next, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	peer := &AuthorityPeer{IdentityPublicKey: k.PublicKey(), NextIdentityPublicKey: next.PublicKey()}
+	require.NoError(peer.Validate())
+	peer.NextIdentityPublicKey = k.PublicKey()
+	require.Error(peer.Validate())
+}
+
+func TestLoggingFormat(t *testing.T) {
+	require := require.New(t)
+
+	l := &Logging{}
+	require.NoError(l.validate())
+	require.Equal(LogFormatText, l.Format)
+
+	l = &Logging{Format: LogFormatJSON}
+	require.NoError(l.validate())
+	require.Equal(LogFormatJSON, l.Format)
+
+	l = &Logging{Format: "xml"}
+	require.Error(l.validate())
+}
+
+func TestLoggingRotation(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError((&Logging{MaxSizeMB: 10, MaxBackups: 3}).validate())
+	require.NoError((&Logging{MaxBackups: 3}).validate())
+	require.Error((&Logging{MaxSizeMB: -1, MaxBackups: 3}).validate())
+	require.Error((&Logging{MaxSizeMB: 10, MaxBackups: -1}).validate())
+	require.Error((&Logging{MaxSizeMB: 10}).validate())
+}
+
+func TestMaxLoadWeight(t *testing.T) {
+	require := require.New(t)
+
+	d := &Debug{}
+	d.applyDefaults()
+	require.Equal(defaultMaxLoadWeight, d.MaxLoadWeight)
+	require.NoError(d.validate())
+
+	d.MaxLoadWeight = 256
+	require.Error(d.validate())
+	d.MaxLoadWeight = -1
+	require.Error(d.validate())
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	require := require.New(t)
+
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg := &Config{
+		Authority: &Authority{
+			Identifier: "authority.example.org",
+			Addresses:  []string{"127.0.0.1:29483"},
+			DataDir:    "/var/lib/katzenpost-authority",
+		},
+		Debug: &Debug{IdentityKey: identityKey},
+		Mixes: []*Node{{IdentityKey: identityKey.PublicKey()}},
+	}
+	require.NoError(cfg.FixupAndValidate())
+
+	s := cfg.EffectiveConfig()
+	require.Equal(s, cfg.EffectiveConfig())
+
+	// The private key is redacted, and unset ones are omitted.
+	require.Contains(s, "IdentityKey = \"[REDACTED]\"")
+	require.NotContains(s, fmt.Sprintf("%x", identityKey.Bytes()))
+	require.NotContains(s, "LinkKey =")
+
+	// The defaults are filled in, and the keys sorted.
+	require.Contains(s, fmt.Sprintf("SendRatePerMinute = %v", defaultSendRatePerMinute))
+	require.Contains(s, fmt.Sprintf("Layers = %v", defaultLayers))
+	require.Contains(s, fmt.Sprintf("DocumentRetentionEpochs = %v", defaultDocumentRetention))
+	require.True(strings.Index(s, "DataDir =") < strings.Index(s, "Identifier ="))
+}
+
+func TestIdentityKeySources(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	cfg, err := Load([]byte(base+"\n[Debug]\n  IdentityKeyCommand = [ \"vault\", \"kv\", \"get\", \"authority\" ]\n"), false)
+	require.NoError(err)
+	require.Equal([]string{"vault", "kv", "get", "authority"}, cfg.Debug.IdentityKeyCommand)
+
+	// The sources of the identity key are mutually exclusive.
+	for _, v := range []string{
+		"[Debug]\n  IdentityKeyCommand = [ \"cat\" ]\n  IdentityKeyEnv = \"KEY\"\n",
+		"[Debug]\n  IdentityKeyCommand = [ \"\" ]\n",
+	} {
+		_, err := Load([]byte(base+v), false)
+		require.Error(err, "%v", v)
+	}
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg.Debug.IdentityKey = k
+	require.Error(cfg.FixupAndValidate())
+}
+
+func TestSave(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority-config")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	newKey := func() *eddsa.PrivateKey {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		return k
+	}
+	identityKey := newKey()
+	cfg := &Config{
+		Authority: &Authority{
+			Identifier: "authority.example.org",
+			Addresses:  []string{"127.0.0.1:29483"},
+			DataDir:    "/var/lib/katzenpost-authority",
+		},
+		Authorities: []*AuthorityPeer{{
+			IdentityPublicKey:     newKey().PublicKey(),
+			NextIdentityPublicKey: newKey().PublicKey(),
+			LinkPublicKey:         newKey().PublicKey().ToECDH(),
+			Addresses:             []string{"192.0.2.7:29483"},
+		}},
+		Parameters: &Parameters{RequiredServices: []string{"loop"}},
+		Debug:      &Debug{IdentityKey: identityKey},
+		Mixes:      []*Node{{IdentityKey: newKey().PublicKey()}},
+		Providers:  []*Node{{Identifier: "provider.example.org", IdentityKey: newKey().PublicKey()}},
+		Blacklist:  []*BlacklistEntry{{IdentityKey: newKey().PublicKey(), Until: 23}},
+	}
+	require.NoError(cfg.FixupAndValidate())
+
+	// The saved config loads to the same config, less the private keys.
+	f := filepath.Join(dir, "authority.toml")
+	require.NoError(cfg.Save(f))
+	b, err := ioutil.ReadFile(f)
+	require.NoError(err)
+	require.NotContains(string(b), "IdentityKey = \"\"")
+	loaded, err := LoadFile(f, false)
+	require.NoError(err)
+	require.Nil(loaded.Debug.IdentityKey)
+	loaded.Debug.IdentityKey = identityKey
+	require.Equal(cfg, loaded)
+
+	// And saves identically.
+	f2 := filepath.Join(dir, "authority2.toml")
+	require.NoError(loaded.Save(f2))
+	b2, err := ioutil.ReadFile(f2)
+	require.NoError(err)
+	require.Equal(b, b2)
+
+	// Peers loaded from the PeersFile are not inlined.
+	peersFile := filepath.Join(dir, "peers.toml")
+	require.NoError(ioutil.WriteFile(peersFile, []byte("[[Authorities]]\n  IdentityPublicKey = \"BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8\"\n"), 0600))
+	loaded.Authorities = nil
+	loaded.Authority.PeersFile = peersFile
+	require.NoError(loaded.FixupAndValidate())
+	require.NoError(loaded.Save(f))
+	loaded, err = LoadFile(f, false)
+	require.NoError(err)
+	require.Len(loaded.Authorities, 1)
+}
+
+func TestProductionMode(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	newConfig := func(addr, peerAddr string) *Config {
+		return &Config{
+			Authority: &Authority{
+				Addresses: []string{addr},
+				DataDir:   "/var/lib/katzenpost-authority",
+			},
+			Authorities: []*AuthorityPeer{{
+				IdentityPublicKey: k.PublicKey(),
+				Addresses:         []string{peerAddr},
+			}},
+			Mixes: []*Node{{IdentityKey: k.PublicKey()}},
+			Debug: &Debug{ProductionMode: true},
+		}
+	}
+
+	require.NoError(newConfig("192.0.2.1:29483", "[2001:db8::7]:29483").FixupAndValidate())
+	// The error names the offending address.
+	for _, v := range []struct{ addr, peerAddr, bad string }{
+		{"127.0.0.1:29483", "192.0.2.7:29483", "127.0.0.1:29483"},
+		{"0.0.0.0:29483", "192.0.2.7:29483", "0.0.0.0:29483"},
+		{"192.0.2.1:29483", "[::1]:29483", "[::1]:29483"},
+		{"192.0.2.1:29483", "[::]:29483", "[::]:29483"},
+	} {
+		err := newConfig(v.addr, v.peerAddr).FixupAndValidate()
+		require.Error(err, "%v", v)
+		require.Contains(err.Error(), v.bad)
+	}
+
+	// Loopback addresses are fine for testing.
+	cfg := newConfig("127.0.0.1:29483", "127.0.0.1:29484")
+	cfg.Debug.ProductionMode = false
+	require.NoError(cfg.FixupAndValidate())
+	require.Equal(cfg.Authority.Addresses, cfg.Authority.PublicAddresses)
+
+	// Binding to all interfaces is fine, as long as the public addresses
+	// are reachable.
+	cfg = newConfig("0.0.0.0:29483", "192.0.2.7:29483")
+	cfg.Authority.PublicAddresses = []string{"authority.example.org:29483"}
+	require.NoError(cfg.FixupAndValidate())
+	cfg = newConfig("0.0.0.0:29483", "192.0.2.7:29483")
+	cfg.Authority.PublicAddresses = []string{"authority.example.org"}
+	require.Error(cfg.FixupAndValidate())
+}
+
+func TestNodeLayer(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	n := &Node{IdentityKey: k.PublicKey()}
+	for _, layer := range []int{0, 2} {
+		n.Layer = &layer
+		require.NoError(n.validate(false, IdentifierPolicyLenient, 3), "layer %v", layer)
+	}
+	for _, layer := range []int{-1, 3} {
+		n.Layer = &layer
+		require.Error(n.validate(false, IdentifierPolicyLenient, 3), "layer %v", layer)
+	}
+
+	// Providers are not part of the topology.
+	layer := 0
+	p := &Node{Identifier: "provider.example.org", IdentityKey: k.PublicKey(), Layer: &layer}
+	require.Error(p.validate(true, IdentifierPolicyLenient, 3))
+}
+
+func TestVotingPhases(t *testing.T) {
+	require := require.New(t)
+
+	// The defaults match the historical schedule.
+	p := &Parameters{}
+	require.NoError(p.validate())
+	p.applyDefaults()
+	require.NoError(p.validateDefaults())
+	require.Equal(epochtime.Period/2, time.Duration(p.DescriptorPhase)*time.Second)
+	require.Equal(epochtime.Period/8, time.Duration(p.VotePhase)*time.Second)
+
+	// Longer exchanges between the authorities, at the expense of the
+	// descriptor uploads.
+	period := int(epochtime.Period / time.Second)
+	p = &Parameters{
+		DescriptorPhase: period / 4,
+		VotePhase:       period / 5,
+		RevealPhase:     period / 5,
+		SignaturePhase:  period / 5,
+	}
+	require.NoError(p.validate())
+	p.applyDefaults()
+	require.NoError(p.validateDefaults())
+
+	// Too little slack to publish the consensus.
+	p.SignaturePhase = period / 3
+	require.Error(p.validateDefaults())
+
+	// Phases can not be negative.
+	p = &Parameters{VotePhase: -1}
+	require.Error(p.validate())
+}
+
+func TestSphinxGeometryVersion(t *testing.T) {
+	require := require.New(t)
+
+	p := &Parameters{}
+	require.NoError(p.validate())
+	p.applyDefaults()
+	require.Equal(1, p.SphinxGeometryVersion)
+
+	p = &Parameters{SphinxGeometryVersion: 2}
+	p.applyDefaults()
+	require.Equal(2, p.SphinxGeometryVersion)
+
+	p = &Parameters{SphinxGeometryVersion: -1}
+	require.Error(p.validate())
+}
+
+func TestManagement(t *testing.T) {
+	require := require.New(t)
+
+	a := &Authority{DataDir: "/var/lib/katzenpost-authority"}
+	m := &Management{Enable: true}
+	m.applyDefaults(a)
+	require.Equal("/var/lib/katzenpost-authority/management_sock", m.Path)
+	require.NoError(m.validate())
+
+	m = &Management{Enable: true, Path: "management_sock"}
+	m.applyDefaults(a)
+	require.Error(m.validate())
+}
+
+func TestObserverMode(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	newConfig := func(nrPeers int) *Config {
+		cfg := &Config{
+			Authority: &Authority{
+				Addresses: []string{"127.0.0.1:29483"},
+				DataDir:   "/var/lib/katzenpost-authority",
+			},
+			Mixes: []*Node{{IdentityKey: k.PublicKey()}},
+			Debug: &Debug{ObserverMode: true},
+		}
+		for i := 0; i < nrPeers; i++ {
+			cfg.Authorities = append(cfg.Authorities, &AuthorityPeer{
+				IdentityPublicKey: k.PublicKey(),
+				Addresses:         []string{fmt.Sprintf("127.0.0.1:%d", 29484+i)},
+			})
+		}
+		return cfg
+	}
+
+	// The observer is not counted, so the Threshold is the one that the
+	// four voting authorities use.
+	cfg := newConfig(4)
+	require.NoError(cfg.FixupAndValidate())
+	require.Equal(3, cfg.Parameters.Threshold)
+
+	cfg = newConfig(4)
+	cfg.Debug.ObserverMode = false
+	require.NoError(cfg.FixupAndValidate())
+	require.Equal(3, cfg.Parameters.Threshold)
+
+	// A Threshold that needs the observer is invalid.
+	cfg = newConfig(4)
+	cfg.Parameters = &Parameters{Threshold: 5}
+	require.Error(cfg.FixupAndValidate())
+
+	// The voting authorities do not count the observers they list either.
+	cfg = newConfig(5)
+	cfg.Debug.ObserverMode = false
+	cfg.Authorities[4].Observer = true
+	require.NoError(cfg.FixupAndValidate())
+	require.Equal(3, cfg.Parameters.Threshold)
+	require.Len(cfg.VotingAuthorities(), 4)
+
+	// There is nothing to observe without voting peers.
+	require.Error(newConfig(0).FixupAndValidate())
+	cfg = newConfig(1)
+	cfg.Authorities[0].Observer = true
+	require.Error(cfg.FixupAndValidate())
+}
+
+func TestEpochClockSkewTolerance(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	period := int(epochtime.Period / time.Second)
+	newConfig := func(skew int) *Config {
+		return &Config{
+			Authority: &Authority{
+				Addresses: []string{"127.0.0.1:29483"},
+				DataDir:   "/var/lib/katzenpost-authority",
+			},
+			Mixes: []*Node{{IdentityKey: k.PublicKey()}},
+			Parameters: &Parameters{
+				DescriptorPhase: period / 2,
+				VotePhase:       period / 8,
+				RevealPhase:     period / 8,
+				SignaturePhase:  period / 32,
+			},
+			Debug: &Debug{EpochClockSkewTolerance: skew},
+		}
+	}
+
+	require.NoError(newConfig(0).FixupAndValidate())
+	require.NoError(newConfig(period/32 - 1).FixupAndValidate())
+	require.Error(newConfig(-1).FixupAndValidate())
+
+	// The tolerance must be shorter than every phase.
+	require.Error(newConfig(period / 32).FixupAndValidate())
+}
+
+func TestBlacklist(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	const entry = `
+[[Blacklist]]
+  IdentityKey = "%s"
+`
+	const good = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+
+	// Blacklisting a whitelisted node is allowed.
+	cfg, err := Load([]byte(base+fmt.Sprintf(entry, good)), false)
+	require.NoError(err)
+	require.Len(cfg.Blacklist, 1)
+
+	// Malformed, missing and duplicate keys are rejected.
+	for _, v := range []string{
+		fmt.Sprintf(entry, "bogus"),
+		fmt.Sprintf(entry, good[:32]),
+		"\n[[Blacklist]]\n  Until = 23\n",
+		fmt.Sprintf(entry, good) + fmt.Sprintf(entry, good),
+		fmt.Sprintf(entry, good) + "  Bogus = 1\n",
+		"\nBlacklist = [ \"bogus\" ]\n",
+		fmt.Sprintf("\nBlacklist = [ \"%s\", \"%s\" ]\n", good, good),
+	} {
+		_, err := Load([]byte(v+base), false)
+		require.Error(err, "%v", v)
+	}
+
+	// The plain list of keys blacklists each node until further notice.
+	cfg, err = Load([]byte(fmt.Sprintf("Blacklist = [ \"%s\" ]\n", good)+base), false)
+	require.NoError(err)
+	require.Len(cfg.Blacklist, 1)
+	require.True(cfg.Blacklist[0].IdentityKey.Equal(cfg.Mixes[0].IdentityKey))
+	require.Equal(uint64(0), cfg.Blacklist[0].Until)
+
+	// Either form reloads from what is saved.
+	dir, err := ioutil.TempDir("", "authority-config")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "authority.toml")
+	require.NoError(cfg.Save(f))
+	saved, err := LoadFile(f, false)
+	require.NoError(err)
+	require.Equal(cfg.Blacklist[0].IdentityKey.Bytes(), saved.Blacklist[0].IdentityKey.Bytes())
+}
+
+func TestMaxConcurrentConnections(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	cfg, err := Load([]byte(base), false)
+	require.NoError(err)
+	require.Equal(defaultMaxConnections, cfg.Debug.MaxConcurrentConnections)
+	require.Equal(0, cfg.Debug.ListenBacklog)
+
+	cfg, err = Load([]byte(base+"\n[Debug]\n  MaxConcurrentConnections = 8\n  ListenBacklog = 64\n"), false)
+	require.NoError(err)
+	require.Equal(8, cfg.Debug.MaxConcurrentConnections)
+	require.Equal(64, cfg.Debug.ListenBacklog)
+
+	for _, v := range []string{
+		"\n[Debug]\n  MaxConcurrentConnections = -1\n",
+		"\n[Debug]\n  ListenBacklog = -1\n",
+	} {
+		_, err := Load([]byte(base+v), false)
+		require.Error(err, "%v", v)
+	}
+}
+
+func TestPeerAddresses(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	peer := func(addrs ...string) *AuthorityPeer {
+		return &AuthorityPeer{IdentityPublicKey: k.PublicKey(), Addresses: addrs}
+	}
+
+	for _, v := range []string{
+		"127.0.0.1:30001",
+		"[::1]:30001",
+		"[2001:db8::23]:443",
+		"authority.example.org:443",
+		"authority.example.org.:443",
+		"authority-1:30001",
+	} {
+		require.NoError(ValidatePeerAddress(v), "%v", v)
+	}
+	require.NoError(peer("[::1]:30001", "authority.example.org:443", "127.0.0.1:30001").Validate())
+
+	for _, v := range []string{
+		"::1:30001",
+		"[::1]",
+		"authority.example.org",
+		"authority.example.org:0",
+		"authority.example.org:65536",
+		"authority.example.org:https",
+		":443",
+		"-authority.example.org:443",
+		"authority..example.org:443",
+		"authority_1.example.org:443",
+	} {
+		require.Error(ValidatePeerAddress(v), "%v", v)
+		require.Error(peer("127.0.0.1:30001", v).Validate(), "%v", v)
+	}
+
+	// The authority itself binds to IP literals, including IPv6.
+	cfg := &Config{
+		Authority: &Authority{
+			Addresses: []string{"[::1]:29483", "127.0.0.1:29483"},
+			DataDir:   "/var/lib/katzenpost-authority",
+		},
+		Authorities: []*AuthorityPeer{peer("[::1]:30001", "authority.example.org:443")},
+		Mixes:       []*Node{{IdentityKey: k.PublicKey()}},
+	}
+	require.NoError(cfg.FixupAndValidate())
+}
+
+func TestParameterSchedule(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[Parameters]
+  Mu = 0.001
+  SendRatePerMinute = 100
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	const entry = `
+[[ParameterSchedule]]
+  Epoch = %d
+  Mu = %v
+`
+	now, _, _ := epochtime.Now()
+
+	// Duplicate epochs, and invalid values are rejected.
+	for _, v := range []string{
+		fmt.Sprintf(entry, now+2, 0.002) + fmt.Sprintf(entry, now+2, 0.003),
+		fmt.Sprintf(entry, now+2, -0.002),
+		fmt.Sprintf(entry, now+2, 0.002) + "  MuMaxDelay = 1000000000\n",
+	} {
+		_, err := Load([]byte(base+v), false)
+		require.Error(err, "%v", v)
+	}
+
+	// The scheduled values take effect exactly at their epoch, and
+	// accumulate in epoch order regardless of the order in the file.
+	cfg, err := Load([]byte(base+fmt.Sprintf(entry, now+5, 0.003)+fmt.Sprintf(entry, now+2, 0.002)), false)
+	require.NoError(err)
+	require.Len(cfg.ParameterSchedule, 2)
+	require.Equal(now+2, cfg.ParameterSchedule[0].Epoch)
+
+	require.Equal(0.001, cfg.ParametersAt(now+1).Mu)
+	require.Equal(0.002, cfg.ParametersAt(now+2).Mu)
+	require.Equal(0.002, cfg.ParametersAt(now+4).Mu)
+	require.Equal(0.003, cfg.ParametersAt(now+5).Mu)
+	require.Equal(0.003, cfg.ParametersAt(now+100).Mu)
+	require.Equal(uint64(100), cfg.ParametersAt(now+5).SendRatePerMinute)
+	require.Equal(uint64(rand.ExpQuantile(0.003, defaultMuMaxPercentile)), cfg.ParametersAt(now+5).MuMaxDelay)
+	require.NotEqual(cfg.Parameters.MuMaxDelay, cfg.ParametersAt(now+5).MuMaxDelay)
+
+	// The base Parameters are left unmodified.
+	require.Equal(0.001, cfg.Parameters.Mu)
+	require.NotEqual(cfg.Parameters.Hash(), cfg.ParametersAt(now+2).Hash())
+
+	// Once an entry takes effect, the config still loads, and reloads
+	// from what it saves.
+	cfg, err = Load([]byte(base+fmt.Sprintf(entry, now-1, 0.002)+fmt.Sprintf(entry, now+2, 0.003)), false)
+	require.NoError(err)
+	require.Equal(0.002, cfg.ParametersAt(now).Mu)
+
+	dir, err := ioutil.TempDir("", "authority-config")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "authority.toml")
+	require.NoError(cfg.Save(f))
+	saved, err := LoadFile(f, false)
+	require.NoError(err)
+	require.Equal(cfg.ParameterSchedule, saved.ParameterSchedule)
+	require.Equal(cfg.ParametersAt(now).Hash(), saved.ParametersAt(now).Hash())
+	require.Empty(cfg.ScheduleWarnings())
+
+	// As does a config with entries superseded by then, with a warning.
+	cfg, err = Load([]byte(base+fmt.Sprintf(entry, now-1, 0.002)+fmt.Sprintf(entry, now, 0.003)), false)
+	require.NoError(err)
+	require.Equal(0.003, cfg.ParametersAt(now).Mu)
+	require.Len(cfg.ScheduleWarnings(), 1)
+}
+
+func TestSphinxGeometry(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+
+	// By default, the hops follow the layers, and no geometry is published.
+	cfg, err := Load([]byte(base), false)
+	require.NoError(err)
+	require.Equal(cfg.Parameters.Layers+2, cfg.Parameters.SphinxHops)
+	require.Equal(0, cfg.Parameters.SphinxPayloadLength)
+
+	cfg, err = Load([]byte(base+`
+[Parameters]
+  SphinxHops = 4
+  SphinxPerHopRoutingInfoLength = 65
+  SphinxPayloadLength = 51200
+
+[Debug]
+  Layers = 2
+`), false)
+	require.NoError(err)
+	require.Equal(4, cfg.Parameters.SphinxHops)
+
+	// Geometry that is inconsistent with the Layers, or incomplete, is
+	// rejected.
+	for _, v := range []string{
+		"[Parameters]\n  SphinxHops = 5\n[Debug]\n  Layers = 2\n",
+		"[Parameters]\n  SphinxHops = 4\n",
+		"[Parameters]\n  SphinxHops = -1\n",
+		"[Parameters]\n  SphinxPayloadLength = 51200\n",
+		"[Parameters]\n  SphinxPerHopRoutingInfoLength = 65\n",
+	} {
+		_, err := Load([]byte(base+v), false)
+		require.Error(err, "%v", v)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	cfg, err := Load([]byte(base), false)
+	require.NoError(err)
+	require.Equal(defaultLayers, cfg.Parameters.Layers)
+	require.Equal(defaultLayers, cfg.Debug.Layers)
+	h := cfg.Parameters.Hash()
+
+	cfg, err = Load([]byte(base+"\n[Parameters]\n  Layers = 2\n"), false)
+	require.NoError(err)
+	require.Equal(2, cfg.Parameters.Layers)
+	require.Equal(2, cfg.Debug.Layers)
+	require.NotEqual(h, cfg.Parameters.Hash())
+
+	// The deprecated Debug.Layers is an alias.
+	cfg, err = Load([]byte(base+"\n[Debug]\n  Layers = 2\n"), false)
+	require.NoError(err)
+	require.Equal(2, cfg.Parameters.Layers)
+
+	for _, v := range []string{
+		"[Parameters]\n  Layers = 2\n[Debug]\n  Layers = 1\n",
+		"[Parameters]\n  Layers = 4\n",
+		"[Parameters]\n  Layers = -1\n",
+	} {
+		_, err := Load([]byte(base+v), false)
+		require.Error(err, "%v", v)
+	}
+}
+
+func TestPeerKeepAlive(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	cfg, err := Load([]byte(base), false)
+	require.NoError(err)
+	require.Equal(defaultPeerKeepAlive, cfg.Debug.PeerKeepAlive)
+	require.Equal(defaultPeerIdleTimeout, cfg.Debug.PeerIdleTimeout)
+
+	// Keepalives can be disabled, but the idle timeout can not.
+	cfg, err = Load([]byte(base+"\n[Debug]\n  PeerKeepAlive = -1\n  PeerIdleTimeout = 5\n"), false)
+	require.NoError(err)
+	require.Equal(-1, cfg.Debug.PeerKeepAlive)
+	require.Equal(5, cfg.Debug.PeerIdleTimeout)
+
+	_, err = Load([]byte(base+"\n[Debug]\n  PeerIdleTimeout = -1\n"), false)
+	require.Error(err)
+}
+
+func TestDescriptorSignatureAlgorithms(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	cfg, err := Load([]byte(base), false)
+	require.NoError(err)
+	require.Equal([]string{"ed25519"}, cfg.Debug.DescriptorSignatureAlgorithms)
+
+	// Only algorithms that descriptors can be verified with are allowed.
+	_, err = Load([]byte(base+"\n[Debug]\n  DescriptorSignatureAlgorithms = [ \"ed25519\", \"rot13\" ]\n"), false)
+	require.Error(err)
+}
+
+func TestDefaultSectionsNotShared(t *testing.T) {
+	require := require.New(t)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "/var/lib/katzenpost-authority"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	a, err := Load([]byte(base), false)
+	require.NoError(err)
+	b, err := Load([]byte(base), false)
+	require.NoError(err)
+
+	// Every defaulted section belongs to its own Config, so that several
+	// authorities in the same process do not modify each other's.
+	require.False(a.Logging == b.Logging)
+	require.False(a.Metrics == b.Metrics)
+	require.False(a.HealthCheck == b.HealthCheck)
+	require.False(a.HTTPGateway == b.HTTPGateway)
+	require.False(a.Management == b.Management)
+	require.False(a.Storage == b.Storage)
+	require.False(a.Parameters == b.Parameters)
+	require.False(a.Debug == b.Debug)
+
+	a.Logging.Level = "DEBUG"
+	a.Debug.AllowedTransports[0] = "bogus"
+	require.Equal(defaultLogLevel, b.Logging.Level)
+	require.NotEqual("bogus", b.Debug.AllowedTransports[0])
+
+	// Neither do the defaulted public addresses alias the bind addresses.
+	a.Authority.PublicAddresses[0] = "authority.example.org:29483"
+	require.Equal("127.0.0.1:29483", a.Authority.Addresses[0])
+}
@@ -0,0 +1,42 @@
+// topology.go - Katzenpost voting authority topology builder hook.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "github.com/katzenpost/core/pki"
+
+// Topology is the assignment of mix nodes to layers.
+type Topology struct {
+	// Layers is the list of nodes in each layer, entry i being layer i.
+	Layers [][]*pki.MixDescriptor
+}
+
+// TopologyBuilder is the interface used to assign mix nodes to layers when
+// generating the consensus document.
+//
+// IMPORTANT: Build MUST be deterministic.  Given the same descriptors,
+// number of layers and parameters it must return exactly the same Topology,
+// including the order of nodes within each layer, on every authority and on
+// every invocation.  It must not depend on map iteration order, the local
+// clock, local randomness or any other per-authority state.  Authorities
+// that build different topologies sign different documents, and no
+// consensus will be reached.  All of the authorities must use the same
+// TopologyBuilder.
+type TopologyBuilder interface {
+	// Build assigns every one of the descriptors, which are sorted by
+	// identity key, to exactly one of layers layers.
+	Build(descriptors []*pki.MixDescriptor, layers int, params *Parameters) (*Topology, error)
+}
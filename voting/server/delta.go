@@ -0,0 +1,311 @@
+// delta.go - Katzenpost voting authority vote and consensus differences.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/pki"
+)
+
+// ParameterDelta is a network parameter that differs between two documents.
+type ParameterDelta struct {
+	// Name is the name of the parameter.
+	Name string `json:"name"`
+
+	// Old is the parameter's value in the first document.
+	Old string `json:"old"`
+
+	// New is the parameter's value in the second document.
+	New string `json:"new"`
+}
+
+// documentDiff is the difference between two documents.
+type documentDiff struct {
+	// removed is the sorted list of nodes only listed in the first document.
+	removed [][eddsa.PublicKeySize]byte
+
+	// added is the sorted list of nodes only listed in the second document.
+	added [][eddsa.PublicKeySize]byte
+
+	// parameters is the list of network parameters that differ.
+	parameters []*ParameterDelta
+}
+
+func diffDocuments(a, b *pki.Document) *documentDiff {
+	aNodes, bNodes := documentNodes(a), documentNodes(b)
+	d := &documentDiff{
+		removed: absentNodes(aNodes, bNodes),
+		added:   absentNodes(bNodes, aNodes),
+	}
+
+	params := []struct {
+		name string
+		a, b interface{}
+	}{
+		{"SendRatePerMinute", a.SendRatePerMinute, b.SendRatePerMinute},
+		{"Mu", a.Mu, b.Mu},
+		{"MuMaxDelay", a.MuMaxDelay, b.MuMaxDelay},
+		{"LambdaP", a.LambdaP, b.LambdaP},
+		{"LambdaPMaxDelay", a.LambdaPMaxDelay, b.LambdaPMaxDelay},
+		{"LambdaL", a.LambdaL, b.LambdaL},
+		{"LambdaLMaxDelay", a.LambdaLMaxDelay, b.LambdaLMaxDelay},
+		{"LambdaD", a.LambdaD, b.LambdaD},
+		{"LambdaDMaxDelay", a.LambdaDMaxDelay, b.LambdaDMaxDelay},
+		{"LambdaM", a.LambdaM, b.LambdaM},
+		{"LambdaMMaxDelay", a.LambdaMMaxDelay, b.LambdaMMaxDelay},
+	}
+	for _, p := range params {
+		if p.a != p.b {
+			d.parameters = append(d.parameters, &ParameterDelta{
+				Name: p.name,
+				Old:  fmt.Sprint(p.a),
+				New:  fmt.Sprint(p.b),
+			})
+		}
+	}
+	return d
+}
+
+// VoteDelta is the difference between the vote an authority cast for an
+// epoch and the consensus that was reached.
+type VoteDelta struct {
+	// Epoch is the epoch of the vote and consensus.
+	Epoch uint64
+
+	// Excluded is the list of nodes the authority voted for that are not
+	// in the consensus.
+	Excluded []*eddsa.PublicKey
+
+	// Included is the list of nodes in the consensus that the authority did
+	// not vote for.
+	Included []*eddsa.PublicKey
+
+	// Parameters is the list of network parameters the authority was
+	// outvoted on, with Old being the voted and New the consensus value.
+	Parameters []*ParameterDelta
+}
+
+// IsEmpty returns true iff the vote agreed with the consensus.
+func (d *VoteDelta) IsEmpty() bool {
+	return len(d.Excluded) == 0 && len(d.Included) == 0 && len(d.Parameters) == 0
+}
+
+// VoteVsConsensus returns the difference between the Server's vote for the
+// given epoch and the consensus, or nil if either is not retained.
+func (s *Server) VoteVsConsensus(epoch uint64) *VoteDelta {
+	return s.state.voteVsConsensus(epoch)
+}
+
+func (s *state) voteVsConsensus(epoch uint64) *VoteDelta {
+	s.RLock()
+	defer s.RUnlock()
+
+	vote, ok := s.votes[epoch][s.identityPubKey()]
+	if !ok {
+		return nil
+	}
+	consensus, ok := s.documents[epoch]
+	if !ok {
+		return nil
+	}
+
+	diff := diffDocuments(vote.doc, consensus.doc)
+	delta := &VoteDelta{
+		Epoch:      epoch,
+		Parameters: diff.parameters,
+	}
+	for _, pk := range diff.removed {
+		id := new(eddsa.PublicKey)
+		id.FromBytes(pk[:])
+		delta.Excluded = append(delta.Excluded, id)
+	}
+	for _, pk := range diff.added {
+		id := new(eddsa.PublicKey)
+		id.FromBytes(pk[:])
+		delta.Included = append(delta.Included, id)
+	}
+	return delta
+}
+
+// DiffNode is a node listed in a Diff.
+type DiffNode struct {
+	// Name is the node's name.
+	Name string `json:"name"`
+
+	// IdentityKey is the node's identity key.
+	IdentityKey string `json:"identity_key"`
+}
+
+// LayerDiff is the difference between the nodes of a layer in two
+// documents.  Nodes that moved between layers are removed from one layer,
+// and added to the other.
+type LayerDiff struct {
+	// Added is the list of nodes only in the layer of the second document.
+	Added []*DiffNode `json:"added"`
+
+	// Removed is the list of nodes only in the layer of the first document.
+	Removed []*DiffNode `json:"removed"`
+
+	// Modified is the list of nodes in the layer of both documents, with
+	// different descriptors.  The rotation of the mix keys is not counted
+	// as a modification.
+	Modified []*DiffNode `json:"modified"`
+}
+
+// IsEmpty returns true iff the layer is the same in both documents.
+func (d *LayerDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Diff is the difference between two consensus documents, typically for
+// consecutive epochs.
+type Diff struct {
+	// FromEpoch is the epoch of the first document.
+	FromEpoch uint64 `json:"from_epoch"`
+
+	// ToEpoch is the epoch of the second document.
+	ToEpoch uint64 `json:"to_epoch"`
+
+	// Layers is the difference of each mix layer, by layer index.
+	Layers []*LayerDiff `json:"layers"`
+
+	// Providers is the difference of the Providers.
+	Providers *LayerDiff `json:"providers"`
+
+	// Parameters is the list of network parameters that differ.
+	Parameters []*ParameterDelta `json:"parameters"`
+}
+
+// IsEmpty returns true iff the documents list the same nodes, in the same
+// layers, with the same parameters.
+func (d *Diff) IsEmpty() bool {
+	for _, l := range d.Layers {
+		if !l.IsEmpty() {
+			return false
+		}
+	}
+	return d.Providers.IsEmpty() && len(d.Parameters) == 0
+}
+
+// String returns a human readable description of the difference.
+func (d *Diff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Epoch %v -> %v:", d.FromEpoch, d.ToEpoch)
+	if d.IsEmpty() {
+		b.WriteString(" no changes\n")
+		return b.String()
+	}
+	b.WriteString("\n")
+	writeLayer := func(name string, l *LayerDiff) {
+		if l.IsEmpty() {
+			return
+		}
+		fmt.Fprintf(&b, "  %v: %d added, %d removed, %d modified\n", name, len(l.Added), len(l.Removed), len(l.Modified))
+		for _, v := range []struct {
+			prefix string
+			nodes  []*DiffNode
+		}{{"+", l.Added}, {"-", l.Removed}, {"~", l.Modified}} {
+			for _, n := range v.nodes {
+				fmt.Fprintf(&b, "    %v %v (%v)\n", v.prefix, n.Name, n.IdentityKey)
+			}
+		}
+	}
+	for i, l := range d.Layers {
+		writeLayer(fmt.Sprintf("Layer %d", i), l)
+	}
+	writeLayer("Providers", d.Providers)
+	for _, p := range d.Parameters {
+		fmt.Fprintf(&b, "  %v: %v -> %v\n", p.Name, p.Old, p.New)
+	}
+	return b.String()
+}
+
+// DocumentDiff returns the difference between the documents a and b, with
+// a being the older document.
+func DocumentDiff(a, b *pki.Document) *Diff {
+	d := &Diff{
+		FromEpoch:  a.Epoch,
+		ToEpoch:    b.Epoch,
+		Providers:  diffLayer(a.Providers, b.Providers),
+		Parameters: diffDocuments(a, b).parameters,
+	}
+	nrLayers := len(a.Topology)
+	if len(b.Topology) > nrLayers {
+		nrLayers = len(b.Topology)
+	}
+	layer := func(doc *pki.Document, i int) []*pki.MixDescriptor {
+		if i < len(doc.Topology) {
+			return doc.Topology[i]
+		}
+		return nil
+	}
+	for i := 0; i < nrLayers; i++ {
+		d.Layers = append(d.Layers, diffLayer(layer(a, i), layer(b, i)))
+	}
+	return d
+}
+
+func diffLayer(a, b []*pki.MixDescriptor) *LayerDiff {
+	aDescs := make(map[[eddsa.PublicKeySize]byte]*pki.MixDescriptor)
+	for _, desc := range a {
+		aDescs[desc.IdentityKey.ByteArray()] = desc
+	}
+	bDescs := make(map[[eddsa.PublicKeySize]byte]*pki.MixDescriptor)
+	for _, desc := range b {
+		bDescs[desc.IdentityKey.ByteArray()] = desc
+	}
+
+	d := new(LayerDiff)
+	for _, desc := range b {
+		prev, ok := aDescs[desc.IdentityKey.ByteArray()]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, newDiffNode(desc))
+		case descriptorChanged(prev, desc):
+			d.Modified = append(d.Modified, newDiffNode(desc))
+		}
+	}
+	for _, desc := range a {
+		if _, ok := bDescs[desc.IdentityKey.ByteArray()]; !ok {
+			d.Removed = append(d.Removed, newDiffNode(desc))
+		}
+	}
+	for _, l := range [][]*DiffNode{d.Added, d.Removed, d.Modified} {
+		sort.Slice(l, func(i, j int) bool { return l[i].IdentityKey < l[j].IdentityKey })
+	}
+	return d
+}
+
+func newDiffNode(desc *pki.MixDescriptor) *DiffNode {
+	return &DiffNode{
+		Name:        desc.Name,
+		IdentityKey: desc.IdentityKey.String(),
+	}
+}
+
+// descriptorChanged returns true iff the descriptors a and b differ in
+// anything but their mix keys, which nodes rotate every epoch.
+func descriptorChanged(a, b *pki.MixDescriptor) bool {
+	ac, bc := *a, *b
+	ac.MixKeys, bc.MixKeys = nil, nil
+	return !reflect.DeepEqual(&ac, &bc)
+}
@@ -0,0 +1,155 @@
+// delta_test.go - Katzenpost voting authority vote and consensus difference tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoteVsConsensus(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 23
+	var descs []*pki.MixDescriptor
+	for i := 0; i < 4; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		descs = append(descs, &pki.MixDescriptor{IdentityKey: k.PublicKey()})
+	}
+	authorityKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	s := &Server{
+		identityKey: authorityKey,
+		state: &state{
+			votes:     make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+			documents: make(map[uint64]*document),
+		},
+	}
+	s.state.s = s
+
+	vote := &pki.Document{
+		Epoch:     epoch,
+		Mu:        0.5,
+		LambdaP:   0.1,
+		Topology:  [][]*pki.MixDescriptor{{descs[0], descs[1]}},
+		Providers: []*pki.MixDescriptor{descs[2]},
+	}
+	consensus := &pki.Document{
+		Epoch:     epoch,
+		Mu:        0.25,
+		LambdaP:   0.1,
+		Topology:  [][]*pki.MixDescriptor{{descs[0], descs[3]}},
+		Providers: []*pki.MixDescriptor{descs[2]},
+	}
+
+	// Nothing is reported without both the vote and the consensus.
+	require.Nil(s.VoteVsConsensus(epoch))
+	s.state.votes[epoch] = map[[eddsa.PublicKeySize]byte]*document{
+		authorityKey.PublicKey().ByteArray(): {doc: vote},
+	}
+	require.Nil(s.VoteVsConsensus(epoch))
+	s.state.documents[epoch] = &document{doc: consensus}
+
+	delta := s.VoteVsConsensus(epoch)
+	require.NotNil(delta)
+	require.Equal(uint64(epoch), delta.Epoch)
+	require.False(delta.IsEmpty())
+	require.Len(delta.Excluded, 1)
+	require.True(delta.Excluded[0].Equal(descs[1].IdentityKey))
+	require.Len(delta.Included, 1)
+	require.True(delta.Included[0].Equal(descs[3].IdentityKey))
+	require.Equal([]*ParameterDelta{{Name: "Mu", Old: "0.5", New: "0.25"}}, delta.Parameters)
+
+	// A vote that matches the consensus has no differences.
+	s.state.documents[epoch] = &document{doc: vote}
+	require.True(s.VoteVsConsensus(epoch).IsEmpty())
+}
+
+func TestDocumentDiff(t *testing.T) {
+	require := require.New(t)
+
+	var descs []*pki.MixDescriptor
+	for i := 0; i < 5; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		descs = append(descs, &pki.MixDescriptor{Name: "node", IdentityKey: k.PublicKey()})
+	}
+	mixKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+
+	a := &pki.Document{
+		Epoch:     23,
+		Mu:        0.5,
+		Topology:  [][]*pki.MixDescriptor{{descs[0], descs[1]}, {descs[2]}},
+		Providers: []*pki.MixDescriptor{descs[3]},
+	}
+
+	// Identical documents, but for the rotated mix keys.
+	rotated := *descs[3]
+	rotated.MixKeys = map[uint64]*ecdh.PublicKey{24: mixKey.PublicKey()}
+	b := &pki.Document{
+		Epoch:     24,
+		Mu:        0.5,
+		Topology:  [][]*pki.MixDescriptor{{descs[1], descs[0]}, {descs[2]}},
+		Providers: []*pki.MixDescriptor{&rotated},
+	}
+	d := DocumentDiff(a, b)
+	require.True(d.IsEmpty())
+	require.Equal("Epoch 23 -> 24: no changes\n", d.String())
+
+	// descs[1] moves to the second layer, descs[2] leaves, descs[4] joins,
+	// and the Provider changes its weight.
+	weighted := *descs[3]
+	weighted.LoadWeight = 10
+	b = &pki.Document{
+		Epoch:     24,
+		Mu:        0.25,
+		Topology:  [][]*pki.MixDescriptor{{descs[0]}, {descs[1], descs[4]}},
+		Providers: []*pki.MixDescriptor{&weighted},
+	}
+	d = DocumentDiff(a, b)
+	require.False(d.IsEmpty())
+	require.Len(d.Layers, 2)
+	require.Empty(d.Layers[0].Added)
+	require.Equal([]*DiffNode{newDiffNode(descs[1])}, d.Layers[0].Removed)
+	require.Len(d.Layers[1].Added, 2)
+	require.Equal([]*DiffNode{newDiffNode(descs[2])}, d.Layers[1].Removed)
+	require.Empty(d.Providers.Added)
+	require.Empty(d.Providers.Removed)
+	require.Equal([]*DiffNode{newDiffNode(descs[3])}, d.Providers.Modified)
+	require.Equal([]*ParameterDelta{{Name: "Mu", Old: "0.5", New: "0.25"}}, d.Parameters)
+
+	s := d.String()
+	require.True(strings.HasPrefix(s, "Epoch 23 -> 24:\n  Layer 0: 0 added, 1 removed, 0 modified\n"), s)
+	require.Contains(s, "  Providers: 0 added, 0 removed, 1 modified\n")
+	require.Contains(s, "  Mu: 0.5 -> 0.25\n")
+
+	// The difference round trips through JSON.
+	raw, err := json.Marshal(d)
+	require.NoError(err)
+	d2 := new(Diff)
+	require.NoError(json.Unmarshal(raw, d2))
+	require.Equal(d, d2)
+}
@@ -0,0 +1,112 @@
+// drift.go - Katzenpost voting authority clock drift guard.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/wire/commands"
+)
+
+// epochClaimLifetime is how long the epoch claimed by a peer authority is
+// considered current, in epochs.  It spans the previous voting round, so
+// that the claims are available when deciding to vote in the next one.
+const epochClaimLifetime = 2
+
+// epochClaim is the voting epoch most recently claimed by a peer
+// authority, relative to the voting epoch of the local clock.
+type epochClaim struct {
+	offset int64
+	round  uint64
+	at     time.Time
+}
+
+// observeVoteEpoch records the epoch claimed by a vote or signature, from
+// any epoch.  Only the Epoch signed into the document counts, as the Epoch
+// of the command is not signed, and the caller has checked that the vote
+// was sent by its signer over the signer's own link.
+func (s *state) observeVoteEpoch(vote *commands.Vote) {
+	if !s.authorizedAuthorities[vote.PublicKey.ByteArray()] || !s.isVerifier(vote.PublicKey.Bytes()) {
+		return
+	}
+	doc, err := s11n.VerifyAndParseDocument(vote.Payload, vote.PublicKey)
+	if err != nil {
+		return
+	}
+	if err := checkVoteEpoch(doc, doc.Epoch); err != nil {
+		return
+	}
+	s.observeEpochClaim(vote.PublicKey, doc.Epoch)
+}
+
+// observeEpochClaim records that the peer authority pk claimed to be
+// voting for epoch.  Each peer is counted once per local voting round, by
+// the first claim it makes in it.
+func (s *state) observeEpochClaim(pk *eddsa.PublicKey, epoch uint64) {
+	if s.epochClaims == nil {
+		s.epochClaims = make(map[[eddsa.PublicKeySize]byte]epochClaim)
+	}
+	if c, ok := s.epochClaims[pk.ByteArray()]; ok && c.round == s.votingEpoch {
+		return
+	}
+	now, _, _ := epochNow()
+	s.epochClaims[pk.ByteArray()] = epochClaim{
+		offset: int64(epoch) - int64(now+1),
+		round:  s.votingEpoch,
+		at:     time.Now(),
+	}
+}
+
+// checkClockDrift returns an error iff Debug.MaxEpochDrift is set, and the
+// majority of the peer authorities recently heard from claim a voting epoch
+// that differs from the local one by at least as much, in which case the
+// local clock is presumably wrong.
+func (s *state) checkClockDrift() error {
+	maxDrift := int64(s.s.cfg.Debug.MaxEpochDrift)
+	if maxDrift <= 0 {
+		return nil
+	}
+
+	var nrClaims, nrDrifted int
+	var worst int64
+	now := time.Now()
+	for pk, c := range s.epochClaims {
+		if now.Sub(c.at) > epochClaimLifetime*epochtime.Period {
+			delete(s.epochClaims, pk)
+			continue
+		}
+		nrClaims++
+		offset := c.offset
+		if offset < 0 {
+			offset = -offset
+		}
+		if offset >= maxDrift {
+			nrDrifted++
+			if offset > worst {
+				worst = offset
+			}
+		}
+	}
+	if nrDrifted*2 > nrClaims {
+		return fmt.Errorf("local epoch differs by up to %v from %v of %v peer authorities", worst, nrDrifted, nrClaims)
+	}
+	return nil
+}
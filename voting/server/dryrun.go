@@ -0,0 +1,151 @@
+// dryrun.go - Katzenpost voting authority dry-run consensus computation.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/log"
+	"github.com/katzenpost/core/pki"
+)
+
+// DryRun returns the consensus document for the next epoch that the
+// authorities would produce with the validated configuration cfg, if every
+// node listed in descriptors uploaded that descriptor and every authority
+// accepted it.  Descriptors are used as is, without signatures.  No
+// listeners are opened and the persisted state is not touched.
+//
+// As no previous consensus is taken into account, the layer assignment is
+// the one used when bootstrapping a network, and will differ from the one in
+// a real consensus.  An error describing the problem is returned iff the
+// configuration would not produce a usable document.
+func DryRun(cfg *config.Config, descriptors []*pki.MixDescriptor) (*pki.Document, error) {
+	logBackend, err := log.New("", "ERROR", true)
+	if err != nil {
+		return nil, err
+	}
+	epoch, _, _ := epochNow()
+	s := &state{
+		s: &Server{
+			cfg:        cfg,
+			logBackend: logBackend,
+			fatalErrCh: make(chan error, 2),
+		},
+		log:         logBackend.GetLogger("dryrun"),
+		documents:   make(map[uint64]*document),
+		mixLayers:   pinnedLayers(cfg.Mixes),
+		votingEpoch: epoch + 1,
+	}
+
+	mixes := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, v := range cfg.Mixes {
+		mixes[v.IdentityKey.ByteArray()] = true
+	}
+	providers := make(map[[eddsa.PublicKeySize]byte]string)
+	for _, v := range cfg.Providers {
+		providers[v.IdentityKey.ByteArray()] = v.Identifier
+	}
+
+	// Stand in for the signed descriptors with the identity keys, which are
+	// unique once duplicates are rejected.
+	m := make(map[[eddsa.PublicKeySize]byte]*descriptor)
+	var nodes, providerNodes []*descriptor
+	for _, desc := range descriptors {
+		pk := desc.IdentityKey.ByteArray()
+		if _, ok := m[pk]; ok {
+			return nil, fmt.Errorf("server: DryRun: node %v has more than one descriptor", desc.IdentityKey)
+		}
+		if !isAuthorized(desc, mixes, providers) {
+			return nil, fmt.Errorf("server: DryRun: node %v (%v) is not authorized", desc.IdentityKey, desc.Name)
+		}
+		if isBlacklisted(cfg.Blacklist, desc.IdentityKey, s.votingEpoch) {
+			// Excluded from the vote, as if the upload was refused.
+			continue
+		}
+		if err := checkAddressLimit(desc, cfg.Debug.MaxAddressesPerNode); err != nil {
+			return nil, fmt.Errorf("server: DryRun: node %v: %v", desc.IdentityKey, err)
+		}
+		if err := checkLoadWeight(desc, cfg.Debug.MaxLoadWeight); err != nil {
+			return nil, fmt.Errorf("server: DryRun: node %v: %v", desc.IdentityKey, err)
+		}
+		d := &descriptor{desc: desc, raw: pk[:]}
+		m[pk] = d
+		if desc.Layer == pki.LayerProvider {
+			providerNodes = append(providerNodes, d)
+		} else {
+			nodes = append(nodes, d)
+		}
+	}
+	if len(providerNodes) == 0 {
+		return nil, fmt.Errorf("server: DryRun: no Providers, need at least 1")
+	}
+	if minNodes := cfg.Parameters.Layers * cfg.Debug.MinNodesPerLayer; len(nodes) < minNodes {
+		return nil, fmt.Errorf("server: DryRun: %v mixes for %v layers, need at least %v", len(nodes), cfg.Parameters.Layers, minNodes)
+	}
+	if missing := missingServices(cfg.Parameters.RequiredServices, m); len(missing) > 0 {
+		if cfg.Debug.MissingServicePolicy == config.MissingServiceWithhold {
+			return nil, fmt.Errorf("server: DryRun: no Provider offers the required services %v", missing)
+		}
+	}
+
+	// Assemble the document the same way as a vote, less the signatures.
+	sortNodesByPublicKey(nodes)
+	var zeros [32]byte
+	sDoc := s.getDocument(append(nodes, providerNodes...), cfg.ParametersAt(s.votingEpoch), zeros[:])
+	select {
+	case err := <-s.s.fatalErrCh:
+		return nil, fmt.Errorf("server: DryRun: failed to generate the topology: %v", err)
+	default:
+	}
+
+	doc := &pki.Document{
+		Epoch:             sDoc.Epoch,
+		SendRatePerMinute: sDoc.SendRatePerMinute,
+		Mu:                sDoc.Mu,
+		MuMaxDelay:        sDoc.MuMaxDelay,
+		LambdaP:           sDoc.LambdaP,
+		LambdaPMaxDelay:   sDoc.LambdaPMaxDelay,
+		LambdaL:           sDoc.LambdaL,
+		LambdaLMaxDelay:   sDoc.LambdaLMaxDelay,
+		LambdaD:           sDoc.LambdaD,
+		LambdaDMaxDelay:   sDoc.LambdaDMaxDelay,
+		LambdaM:           sDoc.LambdaM,
+		LambdaMMaxDelay:   sDoc.LambdaMMaxDelay,
+		Topology:          make([][]*pki.MixDescriptor, len(sDoc.Topology)),
+		SharedRandomValue: sDoc.SharedRandomValue,
+	}
+	if err := checkLayerSizes(sDoc.Topology, cfg.Debug.MinNodesPerLayer); err != nil {
+		return nil, fmt.Errorf("server: DryRun: %v", err)
+	}
+	for layer, ids := range sDoc.Topology {
+		for _, id := range ids {
+			var pk [eddsa.PublicKeySize]byte
+			copy(pk[:], id)
+			desc := *m[pk].desc
+			desc.Layer = uint8(layer)
+			doc.Topology[layer] = append(doc.Topology[layer], &desc)
+		}
+	}
+	for _, id := range sDoc.Providers {
+		var pk [eddsa.PublicKeySize]byte
+		copy(pk[:], id)
+		doc.Providers = append(doc.Providers, m[pk].desc)
+	}
+	return doc, nil
+}
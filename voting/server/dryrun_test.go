@@ -0,0 +1,183 @@
+// dryrun_test.go - Katzenpost voting authority dry-run tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+type singleLayerTopologyBuilder struct{}
+
+func (b *singleLayerTopologyBuilder) Build(descs []*pki.MixDescriptor, layers int, params *config.Parameters) (*config.Topology, error) {
+	t := &config.Topology{Layers: make([][]*pki.MixDescriptor, layers)}
+	t.Layers[0] = descs
+	return t, nil
+}
+
+func TestDryRun(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Parameters.Layers = 2
+	cfg.Debug.MaxAddressesPerNode = 32
+	cfg.Mixes = append(cfg.Mixes, genTestNode(require, ""))
+
+	var descs []*pki.MixDescriptor
+	for _, v := range cfg.Mixes {
+		descs = append(descs, &pki.MixDescriptor{Name: "mix", IdentityKey: v.IdentityKey, Layer: 0})
+	}
+	for _, v := range cfg.Providers {
+		descs = append(descs, &pki.MixDescriptor{Name: v.Identifier, IdentityKey: v.IdentityKey, Layer: pki.LayerProvider})
+	}
+
+	doc, err := DryRun(cfg, descs)
+	require.NoError(err)
+	require.Len(doc.Topology, 2)
+	for layer, nodes := range doc.Topology {
+		require.Len(nodes, 1)
+		require.Equal(uint8(layer), nodes[0].Layer)
+	}
+	require.Len(doc.Providers, 1)
+
+	// The document is deterministic.
+	doc2, err := DryRun(cfg, descs)
+	require.NoError(err)
+	require.Equal(doc, doc2)
+
+	// Too few mixes.
+	_, err = DryRun(cfg, descs[1:])
+	require.Error(err)
+	require.Contains(err.Error(), "need at least 2")
+
+	// No providers.
+	_, err = DryRun(cfg, descs[:2])
+	require.Error(err)
+
+	// Nodes that aren't whitelisted.
+	stranger := genTestNode(require, "")
+	_, err = DryRun(cfg, append(descs, &pki.MixDescriptor{Name: "stranger", IdentityKey: stranger.IdentityKey}))
+	require.Error(err)
+	require.Contains(err.Error(), "not authorized")
+
+	// Layers that end up under populated.
+	cfg.TopologyBuilder = &singleLayerTopologyBuilder{}
+	_, err = DryRun(cfg, descs)
+	require.Error(err)
+	require.Contains(err.Error(), "layer 1 has 0 nodes, need at least 1")
+}
+
+func TestDryRunBlacklist(t *testing.T) {
+	require := require.New(t)
+
+	// DryRun computes the document for the epoch after now.
+	const now = 1000
+	defer pinEpochClock(now, 0)()
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Mixes = append(cfg.Mixes, genTestNode(require, ""))
+
+	var descs []*pki.MixDescriptor
+	for _, v := range cfg.Mixes {
+		descs = append(descs, &pki.MixDescriptor{Name: "mix", IdentityKey: v.IdentityKey, Layer: 0})
+	}
+	for _, v := range cfg.Providers {
+		descs = append(descs, &pki.MixDescriptor{Name: v.Identifier, IdentityKey: v.IdentityKey, Layer: pki.LayerProvider})
+	}
+	inTopology := func(doc *pki.Document, id *eddsa.PublicKey) bool {
+		for _, nodes := range doc.Topology {
+			for _, v := range nodes {
+				if v.IdentityKey.Equal(id) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// The whitelisted mix is left out of the document while blacklisted.
+	bad := cfg.Mixes[0].IdentityKey
+	cfg.Blacklist = []*config.BlacklistEntry{{IdentityKey: bad}}
+	doc, err := DryRun(cfg, descs)
+	require.NoError(err)
+	require.Equal(uint64(now+1), doc.Epoch)
+	require.False(inTopology(doc, bad), "blacklisted mix in the topology")
+	require.True(inTopology(doc, cfg.Mixes[1].IdentityKey))
+
+	// Expired entries no longer apply.
+	require.True(isBlacklisted(cfg.Blacklist, bad, now+1))
+	cfg.Blacklist[0].Until = now + 1
+	require.False(isBlacklisted(cfg.Blacklist, bad, now+1))
+	doc, err = DryRun(cfg, descs)
+	require.NoError(err)
+	require.True(inTopology(doc, bad), "expired blacklist entry applied")
+}
+
+func TestPinnedLayers(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Parameters.Layers = 3
+	cfg.Debug.MaxAddressesPerNode = 32
+	for len(cfg.Mixes) < 6 {
+		cfg.Mixes = append(cfg.Mixes, genTestNode(require, ""))
+	}
+	entry := 0
+	cfg.Mixes[1].Layer = &entry
+	cfg.Mixes[3].Layer = &entry
+	cfg.Mixes[4].Layer = &entry
+
+	var descs []*pki.MixDescriptor
+	for _, v := range cfg.Mixes {
+		descs = append(descs, &pki.MixDescriptor{Name: "mix", IdentityKey: v.IdentityKey, Layer: 0})
+	}
+	for _, v := range cfg.Providers {
+		descs = append(descs, &pki.MixDescriptor{Name: v.Identifier, IdentityKey: v.IdentityKey, Layer: pki.LayerProvider})
+	}
+
+	doc, err := DryRun(cfg, descs)
+	require.NoError(err)
+	require.Len(doc.Topology, 3)
+
+	// The pinned mixes are in the entry layer, and the others fill the
+	// remaining layers.
+	layerOf := make(map[[32]byte]int)
+	for layer, nodes := range doc.Topology {
+		for _, v := range nodes {
+			layerOf[v.IdentityKey.ByteArray()] = layer
+		}
+	}
+	require.Len(layerOf, 6)
+	for _, i := range []int{1, 3, 4} {
+		require.Equal(0, layerOf[cfg.Mixes[i].IdentityKey.ByteArray()])
+	}
+	require.Len(doc.Topology[0], 4)
+	require.Len(doc.Topology[1], 1)
+	require.Len(doc.Topology[2], 1)
+
+	// The plan agrees on the pinned mixes.
+	plan, err := PlanTopology(cfg)
+	require.NoError(err)
+	require.Len(plan[0], 4)
+}
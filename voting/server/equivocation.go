@@ -0,0 +1,81 @@
+// equivocation.go - Katzenpost voting authority equivocation detection.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/pki"
+	"golang.org/x/crypto/sha3"
+)
+
+// isVote returns true iff doc is a vote, rather than a consensus document
+// being signed.  Only votes carry a shared random commit.
+func isVote(doc *pki.Document) bool {
+	return len(doc.SharedRandomCommit) != 0
+}
+
+// sameCertified returns true iff the signed blobs a and b certify the same
+// content, regardless of their signatures.
+func sameCertified(a, b []byte) bool {
+	ca, err := cert.GetCertified(a)
+	if err != nil {
+		return false
+	}
+	cb, err := cert.GetCertified(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ca, cb)
+}
+
+// onEquivocation records that the peer with the identity key pk sent the
+// conflicting votes prev and raw for epoch, and saves both as evidence.
+func (s *state) onEquivocation(epoch uint64, pk [eddsa.PublicKeySize]byte, prev, raw []byte) {
+	// Lock is held (called from onVoteUpload).
+	s.log.Errorf("Authority %x equivocated for epoch %v: votes %s and %s", pk, epoch, sha256b64(prev), sha256b64(raw))
+
+	if s.equivocators == nil {
+		s.equivocators = make(map[uint64]map[[eddsa.PublicKeySize]byte]bool)
+	}
+	if _, ok := s.equivocators[epoch]; !ok {
+		s.equivocators[epoch] = make(map[[eddsa.PublicKeySize]byte]bool)
+	}
+	s.equivocators[epoch][pk] = true
+	if s.s.cfg.Debug.ExcludeEquivocators {
+		s.log.Errorf("Excluding Authority %x from the tally for epoch %v", pk, epoch)
+	}
+
+	for _, v := range [][]byte{prev, raw} {
+		h := sha3.Sum256(v)
+		f := filepath.Join(s.s.cfg.Authority.DataDir, fmt.Sprintf("equivocation-%d-%x-%x.vote", epoch, pk, h[:8]))
+		if err := ioutil.WriteFile(f, v, 0600); err != nil {
+			s.log.Errorf("Failed to save the equivocation evidence: %v", err)
+		}
+	}
+}
+
+// isExcluded returns true iff the votes of the peer with the identity key pk
+// are excluded from the tally for epoch due to equivocation.
+func (s *state) isExcluded(epoch uint64, pk [eddsa.PublicKeySize]byte) bool {
+	return s.s.cfg.Debug.ExcludeEquivocators && s.equivocators[epoch][pk]
+}
@@ -0,0 +1,158 @@
+// events.go - Katzenpost voting authority server events.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// eventQueueLength is the number of events buffered for the consumer of
+// Server.Events before further events are discarded.
+const eventQueueLength = 64
+
+// Event is an operational event emitted by the Server.
+type Event interface {
+	fmt.Stringer
+}
+
+// NodeAtRiskEvent is the event emitted the first epoch a node that is listed
+// in the previous consensus fails to upload a descriptor before the upload
+// deadline.  Unless the node uploads a descriptor that the other authorities
+// accept, it will be dropped from the consensus for Epoch.
+type NodeAtRiskEvent struct {
+	// Epoch is the epoch the node failed to upload a descriptor for.
+	Epoch uint64
+
+	// IdentityKey is the node's identity key.
+	IdentityKey *eddsa.PublicKey
+}
+
+// String returns a human readable representation of the event.
+func (e *NodeAtRiskEvent) String() string {
+	return fmt.Sprintf("NodeAtRisk: epoch %v: %v", e.Epoch, e.IdentityKey)
+}
+
+// NodeDroppedEvent is the event emitted when a node that is listed in the
+// previous consensus is excluded from the consensus for Epoch.
+type NodeDroppedEvent struct {
+	// Epoch is the epoch of the consensus the node is excluded from.
+	Epoch uint64
+
+	// IdentityKey is the node's identity key.
+	IdentityKey *eddsa.PublicKey
+}
+
+// String returns a human readable representation of the event.
+func (e *NodeDroppedEvent) String() string {
+	return fmt.Sprintf("NodeDropped: epoch %v: %v", e.Epoch, e.IdentityKey)
+}
+
+// RoundStalledEvent is the event emitted when the voting state machine
+// failed to run within Debug.StallWatchdogMargin of when it was scheduled
+// to, which indicates a bug or deadlock.
+type RoundStalledEvent struct {
+	// State is the state the state machine is stuck in.
+	State string
+
+	// Epoch is the epoch being voted on.
+	Epoch uint64
+
+	// Deadline is the time the state machine was scheduled to run.
+	Deadline time.Time
+}
+
+// String returns a human readable representation of the event.
+func (e *RoundStalledEvent) String() string {
+	return fmt.Sprintf("RoundStalled: epoch %v: state %v since %v", e.Epoch, e.State, e.Deadline)
+}
+
+// RoundStartedEvent is the event emitted when the voting state machine
+// starts accepting descriptors for the voting round for Epoch.
+type RoundStartedEvent struct {
+	// Epoch is the epoch being voted on.
+	Epoch uint64
+}
+
+// String returns a human readable representation of the event.
+func (e *RoundStartedEvent) String() string {
+	return fmt.Sprintf("RoundStarted: epoch %v", e.Epoch)
+}
+
+// VoteCastEvent is the event emitted when the authority has voted, and
+// sent its vote to the other authorities.
+type VoteCastEvent struct {
+	// Epoch is the epoch voted on.
+	Epoch uint64
+}
+
+// String returns a human readable representation of the event.
+func (e *VoteCastEvent) String() string {
+	return fmt.Sprintf("VoteCast: epoch %v", e.Epoch)
+}
+
+// ConsensusReachedEvent is the event emitted when the authority has
+// collected a threshold of signatures on the consensus for Epoch.
+type ConsensusReachedEvent struct {
+	// Epoch is the epoch of the consensus.
+	Epoch uint64
+
+	// DocumentHash is the base64 encoded SHA256 digest of the certified
+	// consensus document.
+	DocumentHash string
+}
+
+// String returns a human readable representation of the event.
+func (e *ConsensusReachedEvent) String() string {
+	return fmt.Sprintf("ConsensusReached: epoch %v: %v", e.Epoch, e.DocumentHash)
+}
+
+// ConsensusFailedEvent is the event emitted when the voting round for Epoch
+// ended without the authority reaching a consensus.
+type ConsensusFailedEvent struct {
+	// Epoch is the epoch voted on.
+	Epoch uint64
+
+	// Reason describes why no consensus was reached.
+	Reason string
+}
+
+// String returns a human readable representation of the event.
+func (e *ConsensusFailedEvent) String() string {
+	return fmt.Sprintf("ConsensusFailed: epoch %v: %v", e.Epoch, e.Reason)
+}
+
+// Events returns the channel on which the Server emits events.  Events are
+// discarded if the channel is not drained promptly, and the channel is
+// closed when the Server is shut down.
+func (s *Server) Events() <-chan Event {
+	return s.eventCh
+}
+
+func (s *Server) emitEvent(ev Event) {
+	if s.eventCh == nil {
+		// Not a Server created by New, for example in DryRun.
+		return
+	}
+	select {
+	case s.eventCh <- ev:
+	default:
+		s.log.Debugf("Event queue full, discarding: %v", ev)
+	}
+}
@@ -0,0 +1,87 @@
+// events_test.go - Voting authority server events tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundEvents(t *testing.T) {
+	require := require.New(t)
+
+	// A lone authority, that is idle until the test drives the state
+	// machine through a round.
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Shutdown()
+
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	for _, layer := range []uint8{0, pki.LayerProvider} {
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		require.NoError(s.injectDescriptor(epoch, &pki.MixDescriptor{
+			Name:    "node.example.org",
+			LinkKey: linkKey.PublicKey(),
+			MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+			Addresses: map[pki.Transport][]string{
+				pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+			},
+			Layer: layer,
+		}))
+	}
+
+	// Every phase of the round is due at once.
+	st := s.state
+	st.Lock()
+	st.startTime = time.Now().Add(-time.Hour)
+	st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+	st.Unlock()
+	for i := 0; i < 5; i++ {
+		st.fsm()
+	}
+
+	var events []Event
+	for len(events) < 4 {
+		select {
+		case ev := <-s.Events():
+			events = append(events, ev)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", events)
+		}
+	}
+	require.Equal(&RoundStartedEvent{Epoch: epoch}, events[0])
+	require.Equal(&VoteCastEvent{Epoch: epoch}, events[1])
+	reached, ok := events[2].(*ConsensusReachedEvent)
+	require.True(ok, "%v", events[2])
+	require.Equal(epoch, reached.Epoch)
+	require.NotEmpty(reached.DocumentHash)
+	require.Equal(&RoundStartedEvent{Epoch: epoch + 1}, events[3])
+}
@@ -0,0 +1,257 @@
+// gateway.go - Katzenpost voting authority server HTTP gateway.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gatewayAuthority is an authority in the body of an /authorities response.
+type gatewayAuthority struct {
+	IdentityKey string   `json:"identity_key"`
+	LinkKey     string   `json:"link_key,omitempty"`
+	Addresses   []string `json:"addresses"`
+}
+
+// gatewayEpoch returns the epoch in the epoch query parameter of r, or the
+// current epoch if there is none, writing an error response and returning
+// false if the request is invalid.
+func gatewayEpoch(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	epoch, _, _ := epochNow()
+	if v := r.URL.Query().Get("epoch"); v != "" {
+		var err error
+		if epoch, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid epoch", http.StatusBadRequest)
+			return 0, false
+		}
+	}
+	return epoch, true
+}
+
+// gatewayDocument returns the document for the requested epoch, see
+// gatewayEpoch, and the epoch, writing an error response and returning nil
+// if it is not available.  Documents are retained and served as for
+// GetConsensus requests over the wire protocol.
+func (s *Server) gatewayDocument(w http.ResponseWriter, r *http.Request) (*document, uint64) {
+	epoch, ok := gatewayEpoch(w, r)
+	if !ok {
+		return nil, 0
+	}
+	doc, err := s.state.GetConsensus(epoch)
+	if err != nil {
+		http.Error(w, "no document for epoch "+strconv.FormatUint(epoch, 10), http.StatusNotFound)
+		return nil, 0
+	}
+	return doc, epoch
+}
+
+// acceptsGzip returns true iff the client accepts gzip compressed responses,
+// per the Accept-Encoding header of r, either by name or with "*".
+func acceptsGzip(r *http.Request) bool {
+	var gzipQ, anyQ float64 = -1, -1
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		sp := strings.Split(v, ";")
+		switch strings.TrimSpace(sp[0]) {
+		case "gzip":
+			gzipQ = encodingQuality(sp[1:])
+		case "*":
+			anyQ = encodingQuality(sp[1:])
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// encodingQuality returns the q value among the parameters of an
+// Accept-Encoding entry, 1 if it has none, or 0 if it is malformed.
+func encodingQuality(params []string) float64 {
+	for _, p := range params {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") {
+			continue
+		}
+		q, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+// writeGatewayDocument writes the body written by fn as the response, gzip
+// compressed iff the client accepts it.  Only the transfer is compressed,
+// so clients verify the signatures on the decompressed document.  Go HTTP
+// clients, including the one GetDescriptors of the voting client uses,
+// request and decompress gzip responses transparently.
+func (s *Server) writeGatewayDocument(w http.ResponseWriter, r *http.Request, contentType string, fn func(io.Writer) error) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept-Encoding")
+	var err error
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		err = fn(gz)
+		if cErr := gz.Close(); err == nil {
+			err = cErr
+		}
+	} else {
+		err = fn(w)
+	}
+	if err != nil {
+		s.log.Warningf("HTTP gateway: Failed to write the response to %v for %v: %v", r.RemoteAddr, r.URL, err)
+	}
+}
+
+func (s *Server) serveGatewayConsensus(w http.ResponseWriter, r *http.Request) {
+	doc, _ := s.gatewayDocument(w, r)
+	if doc == nil {
+		return
+	}
+	s.writeGatewayDocument(w, r, "application/json", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(doc.doc)
+	})
+}
+
+// serveGatewayRawConsensus serves the signed document, as sent over the
+// wire protocol, so that clients can verify the signatures themselves.  It
+// is streamed from the cached document, without a copy per request.
+func (s *Server) serveGatewayRawConsensus(w http.ResponseWriter, r *http.Request) {
+	doc, epoch := s.gatewayDocument(w, r)
+	if doc == nil {
+		return
+	}
+	s.writeGatewayDocument(w, r, "application/octet-stream", func(w io.Writer) error {
+		_, err := s.WriteConsensus(w, epoch)
+		return err
+	})
+}
+
+// serveGatewayDescriptors serves the descriptors accepted for the requested
+// epoch, exactly as signed by each node, as a JSON array of base64 strings.
+// Epochs whose descriptors are no longer retained are Gone.
+func (s *Server) serveGatewayDescriptors(w http.ResponseWriter, r *http.Request) {
+	epoch, ok := gatewayEpoch(w, r)
+	if !ok {
+		return
+	}
+	descs, err := s.GetDescriptors(epoch)
+	switch err {
+	case nil:
+	case ErrDescriptorsNotRetained:
+		http.Error(w, "descriptors for epoch "+strconv.FormatUint(epoch, 10)+" are no longer retained", http.StatusGone)
+		return
+	default:
+		s.log.Errorf("Failed to load the descriptors for epoch %v: %v", epoch, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.writeGatewayDocument(w, r, "application/json", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(descs)
+	})
+}
+
+// serveGatewayVote serves the vote this authority cast for the epoch at the
+// end of the /vote/ path, exactly as it signed it, so that third parties can
+// verify it against the authority's identity key.  See OwnVote.
+func (s *Server) serveGatewayVote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	epoch, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/vote/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid epoch", http.StatusBadRequest)
+		return
+	}
+	vote, err := s.OwnVote(epoch)
+	if err != nil {
+		http.Error(w, "no vote for epoch "+strconv.FormatUint(epoch, 10), http.StatusNotFound)
+		return
+	}
+	s.writeGatewayDocument(w, r, "application/octet-stream", func(w io.Writer) error {
+		_, err := w.Write(vote)
+		return err
+	})
+}
+
+func (s *Server) serveGatewayAuthorities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Only the voting authorities are published, at the addresses that
+	// clients can reach them at.
+	auths := make([]*gatewayAuthority, 0, len(s.cfg.Authorities)+1)
+	if !s.cfg.Debug.ObserverMode {
+		addrs := s.cfg.Authority.PublicAddresses
+		if len(addrs) == 0 {
+			addrs = s.cfg.Authority.Addresses
+		}
+		auths = append(auths, &gatewayAuthority{
+			IdentityKey: s.IdentityKey().String(),
+			LinkKey:     s.linkKey.PublicKey().String(),
+			Addresses:   addrs,
+		})
+	}
+	for _, peer := range s.cfg.VotingAuthorities() {
+		a := &gatewayAuthority{
+			IdentityKey: peer.IdentityPublicKey.String(),
+			Addresses:   peer.Addresses,
+		}
+		if peer.LinkPublicKey != nil {
+			a.LinkKey = peer.LinkPublicKey.String()
+		}
+		auths = append(auths, a)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auths)
+}
+
+func (s *Server) gatewayHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consensus", s.serveGatewayConsensus)
+	mux.HandleFunc("/consensus/raw", s.serveGatewayRawConsensus)
+	mux.HandleFunc("/descriptors", s.serveGatewayDescriptors)
+	mux.HandleFunc("/authorities", s.serveGatewayAuthorities)
+	mux.HandleFunc("/vote/", s.serveGatewayVote)
+	return mux
+}
+
+func (s *Server) initHTTPGatewayListener() error {
+	l, err := net.Listen("tcp", s.cfg.HTTPGateway.Address)
+	if err != nil {
+		return err
+	}
+	s.gatewayServer = &http.Server{Handler: s.gatewayHandler()}
+
+	s.log.Noticef("Serving the HTTP gateway on: %v", l.Addr())
+	go s.gatewayServer.Serve(l)
+	return nil
+}
@@ -0,0 +1,362 @@
+// gateway_test.go - Katzenpost voting authority server HTTP gateway tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/client"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/log"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPGateway(t *testing.T) {
+	require := require.New(t)
+
+	now, _, _ := epochtime.Now()
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	observerKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	s := &Server{
+		cfg: &config.Config{
+			Authority: &config.Authority{
+				Addresses:       []string{"0.0.0.0:29483"},
+				PublicAddresses: []string{"authority.example.org:29483"},
+			},
+			Authorities: []*config.AuthorityPeer{{
+				IdentityPublicKey: peerKey.PublicKey(),
+				Addresses:         []string{"192.0.2.1:29484"},
+			}, {
+				IdentityPublicKey: observerKey.PublicKey(),
+				Addresses:         []string{"192.0.2.2:29485"},
+				Observer:          true,
+			}},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{},
+		},
+		identityKey: identityKey,
+		linkKey:     linkKey,
+	}
+	s.state = &state{
+		s: s,
+		documents: map[uint64]*document{
+			now:     {doc: &pki.Document{Epoch: now}, raw: []byte("current")},
+			now - 1: {doc: &pki.Document{Epoch: now - 1}, raw: []byte("previous")},
+		},
+	}
+	get := func(h http.HandlerFunc, target string) *http.Response {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", target, nil))
+		return w.Result()
+	}
+
+	// The document for the epoch in the query, or the current epoch.
+	for epoch, target := range map[uint64]string{
+		now:     "/consensus",
+		now - 1: fmt.Sprintf("/consensus?epoch=%v", now-1),
+	} {
+		resp := get(s.serveGatewayConsensus, target)
+		require.Equal(http.StatusOK, resp.StatusCode, target)
+		require.Equal("application/json", resp.Header.Get("Content-Type"))
+		doc := new(pki.Document)
+		require.NoError(json.NewDecoder(resp.Body).Decode(doc))
+		require.Equal(epoch, doc.Epoch, target)
+	}
+
+	// The signed document, as served over the wire protocol.
+	resp := get(s.serveGatewayRawConsensus, fmt.Sprintf("/consensus/raw?epoch=%v", now-1))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal([]byte("previous"), b)
+
+	// Documents that are not retained, and invalid epochs.
+	resp = get(s.serveGatewayConsensus, fmt.Sprintf("/consensus?epoch=%v", now-2))
+	require.Equal(http.StatusNotFound, resp.StatusCode)
+	resp = get(s.serveGatewayRawConsensus, "/consensus/raw?epoch=yesterday")
+	require.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// The voting authorities, starting with this authority at its public
+	// addresses, without the observers.
+	resp = get(s.serveGatewayAuthorities, "/authorities")
+	require.Equal(http.StatusOK, resp.StatusCode)
+	var auths []*gatewayAuthority
+	require.NoError(json.NewDecoder(resp.Body).Decode(&auths))
+	require.Equal([]*gatewayAuthority{
+		{
+			IdentityKey: identityKey.PublicKey().String(),
+			LinkKey:     linkKey.PublicKey().String(),
+			Addresses:   []string{"authority.example.org:29483"},
+		},
+		{
+			IdentityKey: peerKey.PublicKey().String(),
+			Addresses:   []string{"192.0.2.1:29484"},
+		},
+	}, auths)
+
+	// Observers do not publish themselves.
+	s.cfg.Debug.ObserverMode = true
+	resp = get(s.serveGatewayAuthorities, "/authorities")
+	auths = nil
+	require.NoError(json.NewDecoder(resp.Body).Decode(&auths))
+	require.Len(auths, 1)
+	require.Equal(peerKey.PublicKey().String(), auths[0].IdentityKey)
+}
+
+func TestHTTPGatewayDescriptors(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	now, _, _ := epochtime.Now()
+	epoch := now + 1
+	for _, layer := range []uint8{0, pki.LayerProvider} {
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		require.NoError(s.injectDescriptor(epoch, &pki.MixDescriptor{
+			Name:    "node.example.org",
+			LinkKey: linkKey.PublicKey(),
+			MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+			Addresses: map[pki.Transport][]string{
+				pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+			},
+			Layer: layer,
+		}))
+	}
+	get := func(target string) *http.Response {
+		w := httptest.NewRecorder()
+		s.serveGatewayDescriptors(w, httptest.NewRequest("GET", target, nil))
+		return w.Result()
+	}
+
+	// The descriptors exactly as signed by each node.
+	resp := get(fmt.Sprintf("/descriptors?epoch=%v", epoch))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	var descs [][]byte
+	require.NoError(json.NewDecoder(resp.Body).Decode(&descs))
+	require.Len(descs, 2)
+	for _, raw := range descs {
+		verifier, err := s11n.GetVerifierFromDescriptor(raw)
+		require.NoError(err)
+		_, err = s11n.VerifyAndParseDescriptor(verifier, raw, epoch)
+		require.NoError(err)
+	}
+
+	// The voting client fetches them through the gateway, gzip compressed,
+	// as Go's HTTP client asks for it.
+	encodings := make(chan string, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.gatewayHandler().ServeHTTP(w, r)
+		encodings <- w.Header().Get("Content-Encoding")
+	}))
+	defer gateway.Close()
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	c, err := client.New(&client.Config{
+		LogBackend:  logBackend,
+		GatewayURLs: []string{gateway.URL},
+	})
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fetched, err := c.(*client.Client).GetDescriptors(ctx, epoch)
+	require.NoError(err)
+	require.ElementsMatch(descs, fetched)
+	require.Equal("gzip", <-encodings)
+
+	// Retained epochs without descriptors, and epochs that are no longer
+	// retained.
+	resp = get(fmt.Sprintf("/descriptors?epoch=%v", now))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.NoError(json.NewDecoder(resp.Body).Decode(&descs))
+	require.Empty(descs)
+	resp = get(fmt.Sprintf("/descriptors?epoch=%v", now-uint64(cfg.Parameters.DocumentRetentionEpochs)-1))
+	require.Equal(http.StatusGone, resp.StatusCode)
+	_, err = s.GetDescriptors(now - uint64(cfg.Parameters.DocumentRetentionEpochs) - 1)
+	require.Equal(ErrDescriptorsNotRetained, err)
+}
+
+func TestHTTPGatewayVote(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 1000
+	defer pinEpochClock(epoch, 0)()
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	signed := []byte("signed vote")
+	st := s.state
+	st.Lock()
+	st.votes[epoch] = map[[eddsa.PublicKeySize]byte]*document{
+		st.identityPubKey(): &document{raw: signed},
+	}
+	st.Unlock()
+	get := func(target string) *http.Response {
+		w := httptest.NewRecorder()
+		s.gatewayHandler().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w.Result()
+	}
+
+	// The vote exactly as it was signed.
+	resp := get(fmt.Sprintf("/vote/%v", epoch))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(signed, body)
+
+	// Epochs without a vote, and malformed epochs.
+	resp = get(fmt.Sprintf("/vote/%v", epoch+1))
+	require.Equal(http.StatusNotFound, resp.StatusCode)
+	for _, target := range []string{"/vote/", "/vote/x", "/vote/1000/raw"} {
+		resp = get(target)
+		require.Equal(http.StatusBadRequest, resp.StatusCode, target)
+	}
+}
+
+// genGatewayDocument returns a signed document for epoch, with nrNodes mixes,
+// and the key that signed it.
+func genGatewayDocument(assert *assert.Assertions, epoch uint64, nrNodes int) ([]byte, *eddsa.PrivateKey) {
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	topology := make([][][]byte, 3)
+	for i := 0; i < nrNodes; i++ {
+		topology[i%3] = append(topology[i%3], genSignedDescriptor(assert, epoch, uint8(i%3)))
+	}
+	signed, err := s11n.SignDocument(k, &s11n.Document{
+		Epoch:     epoch,
+		Topology:  topology,
+		Providers: [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+	})
+	assert.NoError(err)
+	return []byte(signed), k
+}
+
+func TestHTTPGatewayCompression(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 23
+	raw, k := genGatewayDocument(assert.New(t), epoch, 9)
+	s := &Server{
+		state: &state{
+			documents: map[uint64]*document{epoch: {raw: raw}},
+		},
+	}
+	get := func(acceptEncoding string) *http.Response {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", fmt.Sprintf("/consensus/raw?epoch=%v", epoch), nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		s.serveGatewayRawConsensus(w, r)
+		return w.Result()
+	}
+
+	// Clients that accept gzip get the compressed document, which verifies
+	// once decompressed.
+	for _, v := range []string{"gzip", "deflate, gzip;q=0.5", "*", "gzip, *;q=0"} {
+		resp := get(v)
+		require.Equal(http.StatusOK, resp.StatusCode)
+		require.Equal("gzip", resp.Header.Get("Content-Encoding"), v)
+		gz, err := gzip.NewReader(resp.Body)
+		require.NoError(err)
+		b, err := ioutil.ReadAll(gz)
+		require.NoError(err)
+		require.Equal(raw, b)
+		_, err = s11n.VerifyAndParseDocument(b, k.PublicKey())
+		require.NoError(err)
+	}
+
+	// Other clients get the document as is.
+	for _, v := range []string{"", "deflate", "gzip;q=0", "*;q=0", "gzip;q=0, *"} {
+		resp := get(v)
+		require.Equal(http.StatusOK, resp.StatusCode)
+		require.Empty(resp.Header.Get("Content-Encoding"), v)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(err)
+		require.Equal(raw, b)
+	}
+}
+
+func benchmarkGatewayConsensus(b *testing.B, acceptEncoding string) {
+	const (
+		epoch   = 23
+		nrNodes = 300
+	)
+
+	raw, _ := genGatewayDocument(assert.New(b), epoch, nrNodes)
+	s := &Server{
+		state: &state{
+			documents: map[uint64]*document{epoch: {raw: raw}},
+		},
+	}
+	r := httptest.NewRequest("GET", fmt.Sprintf("/consensus/raw?epoch=%v", epoch), nil)
+	r.Header.Set("Accept-Encoding", acceptEncoding)
+
+	var n int
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		s.serveGatewayRawConsensus(w, r)
+		n = w.Body.Len()
+	}
+	b.ReportMetric(float64(n), "transfer-bytes/op")
+}
+
+func BenchmarkGatewayConsensusIdentity(b *testing.B) {
+	benchmarkGatewayConsensus(b, "identity")
+}
+
+func BenchmarkGatewayConsensusGzip(b *testing.B) {
+	benchmarkGatewayConsensus(b, "gzip")
+}
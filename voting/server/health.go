@@ -0,0 +1,75 @@
+// health.go - Katzenpost voting authority server health check.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// healthStatus is the body of a health check response.
+type healthStatus struct {
+	Epoch              uint64 `json:"epoch"`
+	LastConsensusEpoch uint64 `json:"last_consensus_epoch"`
+	State              string `json:"state"`
+}
+
+// health returns the health check status, and true iff there is a consensus
+// for the current epoch.
+func (s *state) health() (*healthStatus, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now, _, _ := epochNow()
+	st := &healthStatus{
+		Epoch: now,
+		State: s.state,
+	}
+	for e := range s.documents {
+		if e > st.LastConsensusEpoch {
+			st.LastConsensusEpoch = e
+		}
+	}
+	_, ok := s.documents[now]
+	return st, ok
+}
+
+func (s *Server) serveHealthCheck(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.state.health()
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
+
+func (s *Server) initHealthCheckListener() error {
+	l, err := net.Listen("tcp", s.cfg.HealthCheck.Address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.serveHealthCheck)
+	s.healthServer = &http.Server{Handler: mux}
+
+	s.log.Noticef("Serving the health check on: %v", l.Addr())
+	go s.healthServer.Serve(l)
+	return nil
+}
@@ -0,0 +1,60 @@
+// health_test.go - Katzenpost voting authority server health check tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/katzenpost/core/epochtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	require := require.New(t)
+
+	now, _, _ := epochtime.Now()
+	s := &Server{}
+	s.state = &state{
+		s:         s,
+		state:     stateAcceptVote,
+		documents: map[uint64]*document{now - 1: {}},
+	}
+	check := func() (int, *healthStatus) {
+		w := httptest.NewRecorder()
+		s.serveHealthCheck(w, httptest.NewRequest("GET", "/health", nil))
+		st := new(healthStatus)
+		require.NoError(json.NewDecoder(w.Result().Body).Decode(st))
+		return w.Result().StatusCode, st
+	}
+
+	// Without a consensus for the current epoch, the authority is not ready.
+	code, st := check()
+	require.Equal(http.StatusServiceUnavailable, code)
+	require.Equal(&healthStatus{
+		Epoch:              now,
+		LastConsensusEpoch: now - 1,
+		State:              stateAcceptVote,
+	}, st)
+
+	s.state.documents[now] = &document{}
+	code, st = check()
+	require.Equal(http.StatusOK, code)
+	require.Equal(now, st.LastConsensusEpoch)
+}
@@ -0,0 +1,183 @@
+// keygen.go - Katzenpost voting authority key generation.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/utils"
+)
+
+const (
+	identityPrivateKeyFile     = "identity.private.pem"
+	identityPublicKeyFile      = "identity.public.pem"
+	nextIdentityPrivateKeyFile = "identity.next.private.pem"
+	nextIdentityPublicKeyFile  = "identity.next.public.pem"
+	linkPrivateKeyFile         = "link.private.pem"
+	linkPublicKeyFile          = "link.public.pem"
+
+	identityKeyCommandTimeout = 30 * time.Second
+)
+
+// externalIdentityKey returns the identity key written to stdout by
+// Debug.IdentityKeyCommand, or held in the environment variable named by
+// Debug.IdentityKeyEnv, or nil if neither is configured.
+func externalIdentityKey(dCfg *config.Debug) (*eddsa.PrivateKey, error) {
+	var b []byte
+	switch {
+	case len(dCfg.IdentityKeyCommand) != 0:
+		ctx, cancel := context.WithTimeout(context.Background(), identityKeyCommandTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, dCfg.IdentityKeyCommand[0], dCfg.IdentityKeyCommand[1:]...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("server: Debug.IdentityKeyCommand failed: %v", err)
+		}
+		b = out
+	case dCfg.IdentityKeyEnv != "":
+		v, ok := os.LookupEnv(dCfg.IdentityKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("server: Debug.IdentityKeyEnv: %v is not set", dCfg.IdentityKeyEnv)
+		}
+		b = []byte(v)
+	default:
+		return nil, nil
+	}
+	defer utils.ExplicitBzero(b)
+
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, errors.New("server: the external identity key is not PEM encoded")
+	}
+	defer utils.ExplicitBzero(blk.Bytes)
+	k := new(eddsa.PrivateKey)
+	if err := k.FromBytes(blk.Bytes); err != nil {
+		return nil, fmt.Errorf("server: the external identity key is invalid: %v", err)
+	}
+	return k, nil
+}
+
+// GenerateKeys generates a new identity key pair, and persists it in
+// cfg.Authority.DataDir exactly as the Server loads it at startup, creating
+// the DataDir if needed.  The public key is returned, so that it can be
+// distributed to the other authorities.  Existing keys are never
+// overwritten.  Like the Server, it refuses to write the keys to a DataDir
+// that is accessible by others, unless Debug.AllowUnsafePermissions is set.
+func GenerateKeys(cfg *config.Config) (*eddsa.PublicKey, error) {
+	return generateKeys(cfg, identityPrivateKeyFile, identityPublicKeyFile)
+}
+
+// GenerateNextKeys is like GenerateKeys, except that it generates the key
+// pair that the Server will rotate to, see config.Authority.NextIdentityKey.
+func GenerateNextKeys(cfg *config.Config) (*eddsa.PublicKey, error) {
+	return generateKeys(cfg, nextIdentityPrivateKeyFile, nextIdentityPublicKeyFile)
+}
+
+func generateKeys(cfg *config.Config, privName, pubName string) (*eddsa.PublicKey, error) {
+	dataDir := cfg.Authority.DataDir
+	if err := initDataDir(dataDir); err != nil {
+		return nil, err
+	}
+	if err := checkDataDirPermissions(dataDir); err != nil {
+		if cfg.Debug == nil || !cfg.Debug.AllowUnsafePermissions {
+			return nil, err
+		}
+	}
+
+	privFile := filepath.Join(dataDir, privName)
+	pubFile := filepath.Join(dataDir, pubName)
+	for _, f := range []string{privFile, pubFile} {
+		if _, err := os.Lstat(f); err == nil {
+			return nil, fmt.Errorf("authority: identity key file '%v' already exists", f)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("authority: failed to stat() identity key file: %v", err)
+		}
+	}
+
+	k, err := eddsa.Load(privFile, pubFile, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Reset()
+
+	// Copy the public key, as resetting the key pair clobbers it.
+	pk := new(eddsa.PublicKey)
+	if err = pk.FromBytes(k.PublicKey().Bytes()); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// loadNextIdentityKey loads the key pair that the Server is rotating to,
+// which unlike the current identity key is never generated on the fly.
+func loadNextIdentityKey(dataDir string, pk *eddsa.PublicKey) (*eddsa.PrivateKey, error) {
+	privFile := filepath.Join(dataDir, nextIdentityPrivateKeyFile)
+	pubFile := filepath.Join(dataDir, nextIdentityPublicKeyFile)
+	if _, err := os.Lstat(privFile); err != nil {
+		return nil, fmt.Errorf("authority: failed to find the next identity key: %v", err)
+	}
+	k, err := eddsa.Load(privFile, pubFile, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if !k.PublicKey().Equal(pk) {
+		k.Reset()
+		return nil, fmt.Errorf("authority: next identity key in DataDir does not match NextIdentityKey %v", pk)
+	}
+	return k, nil
+}
+
+// initNextIdentityKey loads the key configured as the NextIdentityKey, and
+// either switches to it if the RotationEpoch has been reached, or keeps it
+// for signing alongside the current key.
+func (s *Server) initNextIdentityKey() error {
+	aCfg := s.cfg.Authority
+	if aCfg.NextIdentityKey.Equal(s.identityKey.PublicKey()) {
+		return fmt.Errorf("authority: NextIdentityKey %v is the current identity key", aCfg.NextIdentityKey)
+	}
+	next, err := loadNextIdentityKey(aCfg.DataDir, aCfg.NextIdentityKey)
+	if err != nil {
+		return err
+	}
+
+	epoch, _, _ := epochNow()
+	if epoch >= aCfg.RotationEpoch {
+		s.log.Noticef("Identity key rotated from %v to %v as of epoch %v.", s.identityKey.PublicKey(), next.PublicKey(), aCfg.RotationEpoch)
+		s.log.Notice("Replace the identity key files in the DataDir with the next ones, and remove NextIdentityKey.")
+		s.identityKey.Reset()
+		s.identityKey = next
+		return nil
+	}
+
+	var overlapEpoch uint64
+	if aCfg.RotationEpoch > uint64(aCfg.RotationOverlap) {
+		overlapEpoch = aCfg.RotationEpoch - uint64(aCfg.RotationOverlap)
+	}
+	s.log.Noticef("Identity key rotation to %v: signing with both keys from epoch %v, switching at epoch %v (current epoch %v).", next.PublicKey(), overlapEpoch, aCfg.RotationEpoch, epoch)
+	s.log.Notice("The switch happens when the authority is restarted at or after the rotation epoch.")
+	s.nextIdentityKey = next
+	return nil
+}
@@ -0,0 +1,157 @@
+// keygen_test.go - Voting authority key generation tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKeys(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.DataDir = filepath.Join(cfg.Authority.DataDir, "authority")
+
+	pk, err := GenerateKeys(cfg)
+	require.NoError(err, "GenerateKeys()")
+
+	// Existing keys are not overwritten.
+	_, err = GenerateKeys(cfg)
+	require.Error(err)
+
+	// The server uses the generated key.
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+	require.True(pk.Equal(s.IdentityKey()))
+}
+
+func TestGenerateKeysPermissions(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+
+	// Keys are not written to a world accessible DataDir.
+	require.NoError(os.Chmod(cfg.Authority.DataDir, 0777))
+	_, err := GenerateKeys(cfg)
+	require.Error(err)
+
+	// Unless Debug.AllowUnsafePermissions is set, as for the Server.
+	cfg.Debug.AllowUnsafePermissions = true
+	_, err = GenerateKeys(cfg)
+	require.NoError(err)
+}
+
+func TestNextIdentityKey(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	current, err := GenerateKeys(cfg)
+	require.NoError(err, "GenerateKeys()")
+
+	// The next key must be generated beforehand.
+	epoch, _, _ := epochtime.Now()
+	cfg.Authority.NextIdentityKey = current
+	cfg.Authority.RotationEpoch = epoch + 10
+	cfg.Authority.RotationOverlap = 5
+	_, err = New(cfg)
+	require.Error(err, "NextIdentityKey is the current key")
+
+	next, err := GenerateNextKeys(cfg)
+	require.NoError(err, "GenerateNextKeys()")
+	other, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg.Authority.NextIdentityKey = other.PublicKey()
+	_, err = New(cfg)
+	require.Error(err, "NextIdentityKey mismatch")
+
+	// Before the rotation epoch, the current key is used.
+	cfg.Authority.NextIdentityKey = next
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	require.True(current.Equal(s.IdentityKey()))
+	require.True(next.Equal(s.nextIdentityKey.PublicKey()))
+	s.Shutdown()
+	s.Wait()
+
+	// From the rotation epoch on, the next key is used.
+	cfg.Authority.RotationEpoch = epoch
+	s, err = New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+	require.True(next.Equal(s.IdentityKey()))
+	require.Nil(s.nextIdentityKey)
+}
+
+func TestExternalIdentityKey(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "ED25519 PRIVATE KEY", Bytes: k.Bytes()})
+	dir, err := ioutil.TempDir("", "authority-key")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "identity.private.pem")
+	require.NoError(ioutil.WriteFile(keyFile, keyPEM, 0600))
+
+	// The key is read from the output of the command, and not generated.
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.IdentityKeyCommand = []string{"cat", keyFile}
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	require.True(k.PublicKey().Equal(s.IdentityKey()))
+	s.Shutdown()
+	s.Wait()
+	_, err = os.Lstat(filepath.Join(cfg.Authority.DataDir, identityPrivateKeyFile))
+	require.True(os.IsNotExist(err), "identity key generated")
+
+	// Or from the environment.
+	const env = "AUTHORITY_TEST_IDENTITY_KEY"
+	require.NoError(os.Setenv(env, string(keyPEM)))
+	defer os.Unsetenv(env)
+	dCfg := &config.Debug{IdentityKeyEnv: env}
+	ek, err := externalIdentityKey(dCfg)
+	require.NoError(err)
+	require.True(k.PublicKey().Equal(ek.PublicKey()))
+
+	// Failing commands, unset variables and garbage are fatal.
+	for _, v := range []*config.Debug{
+		{IdentityKeyCommand: []string{"false"}},
+		{IdentityKeyCommand: []string{"echo", "not a key"}},
+		{IdentityKeyEnv: env + "_UNSET"},
+	} {
+		_, err = externalIdentityKey(v)
+		require.Error(err, "%+v", v)
+	}
+}
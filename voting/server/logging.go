@@ -0,0 +1,246 @@
+// logging.go - Katzenpost voting authority structured logging.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/katzenpost/core/log"
+	"gopkg.in/op/go-logging.v1"
+)
+
+// logBackend is the source of the Server's loggers, either a core/log
+// Backend for the text format, or a jsonLogBackend.
+type logBackend interface {
+	GetLogger(module string) *logging.Logger
+	Rotate() error
+}
+
+// clientLogBackend returns the backend for the loggers of the voting clients
+// that the Server uses, which only log to a core/log Backend.  With the
+// other backends, their output is discarded, and the Server logs the outcome
+// of their requests itself.
+func (s *Server) clientLogBackend() (*log.Backend, error) {
+	if b, ok := s.logBackend.(*log.Backend); ok {
+		return b, nil
+	}
+	return log.New("", s.cfg.Logging.Level, true)
+}
+
+type jsonLogRecord struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Message   string `json:"message"`
+}
+
+// textLogFormat matches the format of the core/log Backend.
+const textLogFormat = "%{time:15:04:05.000} %{level:.4s} %{module}: %{message}"
+
+// logFile is a log file that is rotated once it exceeds maxSize bytes,
+// keeping up to maxBackups previous files as path.1 (the most recent)
+// through path.maxBackups.  A maxSize of 0 disables the rotation.
+type logFile struct {
+	sync.Mutex
+
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openLogFile(path string, maxSize int64, maxBackups int) (*logFile, error) {
+	l := &logFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	// Lock is held, or l is not yet shared.
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// Write implements the io.Writer interface, rotating the file first if
+// the write would take it past maxSize.
+func (l *logFile) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Reopen reopens the file, after it was moved by an external tool.
+func (l *logFile) Reopen() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.open()
+}
+
+func (l *logFile) rotate() error {
+	// Lock is held.
+	backup := func(i int) string {
+		return fmt.Sprintf("%s.%d", l.path, i)
+	}
+	if err := os.Remove(backup(l.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := l.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, backup(1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// textLogBackend is a logging backend in the core/log text format, that
+// writes to a logFile, so that it can be rotated by size.
+type textLogBackend struct {
+	leveled logging.LeveledBackend
+	file    *logFile
+}
+
+// GetLogger returns a logger for the given module.
+func (b *textLogBackend) GetLogger(module string) *logging.Logger {
+	l := logging.MustGetLogger(module)
+	l.SetBackend(b.leveled)
+	return l
+}
+
+// Rotate reopens the log file.
+func (b *textLogBackend) Rotate() error {
+	return b.file.Reopen()
+}
+
+// newTextLogBackend returns a textLogBackend logging to the file at path at
+// the given level, rotating it once it exceeds maxSize bytes.
+func newTextLogBackend(path, level string, maxSize int64, maxBackups int) (*textLogBackend, error) {
+	lvl, err := logging.LogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(textLogBackend)
+	if b.file, err = openLogFile(path, maxSize, maxBackups); err != nil {
+		return nil, err
+	}
+	formatted := logging.NewBackendFormatter(logging.NewLogBackend(b.file, "", 0), logging.MustStringFormatter(textLogFormat))
+	b.leveled = logging.AddModuleLevel(formatted)
+	b.leveled.SetLevel(lvl, "")
+	return b, nil
+}
+
+// jsonLogBackend is a logging backend that writes each record as a single
+// line JSON object, to a file or stdout.
+type jsonLogBackend struct {
+	sync.Mutex
+
+	leveled logging.LeveledBackend
+	w       io.Writer
+	file    *logFile
+}
+
+// Log implements the logging.Backend interface.
+func (b *jsonLogBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	line, err := json.Marshal(&jsonLogRecord{
+		Timestamp: rec.Time.UTC().Format(time.RFC3339Nano),
+		Level:     level.String(),
+		Component: rec.Module,
+		Message:   rec.Message(),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	_, err = b.w.Write(append(line, '\n'))
+	return err
+}
+
+// GetLogger returns a logger for the given module.
+func (b *jsonLogBackend) GetLogger(module string) *logging.Logger {
+	l := logging.MustGetLogger(module)
+	l.SetBackend(b.leveled)
+	return l
+}
+
+// Rotate reopens the log file, if logging to a file.
+func (b *jsonLogBackend) Rotate() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Reopen()
+}
+
+// newJSONLogBackend returns a jsonLogBackend logging to the file at path, or
+// to stdout if path is empty, at the given level.  The file is rotated once
+// it exceeds maxSize bytes, unless maxSize is 0.
+func newJSONLogBackend(path, level string, maxSize int64, maxBackups int) (*jsonLogBackend, error) {
+	lvl, err := logging.LogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &jsonLogBackend{
+		w: os.Stdout,
+	}
+	if path != "" {
+		if b.file, err = openLogFile(path, maxSize, maxBackups); err != nil {
+			return nil, err
+		}
+		b.w = b.file
+	}
+	b.leveled = logging.AddModuleLevel(b)
+	b.leveled.SetLevel(lvl, "")
+	return b, nil
+}
@@ -0,0 +1,143 @@
+// logging_test.go - Voting authority structured logging tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readJSONLog(require *require.Assertions, path string) []*jsonLogRecord {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	var records []*jsonLogRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		rec := new(jsonLogRecord)
+		require.NoError(json.Unmarshal([]byte(line), rec), "line: %v", line)
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestJSONLogBackend(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority_logging")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authority.log")
+
+	b, err := newJSONLogBackend(path, "NOTICE", 0, 0)
+	require.NoError(err)
+	log := b.GetLogger("state")
+	log.Noticef("Voting for epoch %v", 23)
+	log.Debug("Not logged")
+
+	records := readJSONLog(require, path)
+	require.Len(records, 1)
+	require.Equal("NOTICE", records[0].Level)
+	require.Equal("state", records[0].Component)
+	require.Equal("Voting for epoch 23", records[0].Message)
+	ts, err := time.Parse(time.RFC3339Nano, records[0].Timestamp)
+	require.NoError(err)
+	require.True(time.Since(ts) < time.Minute)
+
+	// Rotating reopens the file.
+	rotated := path + ".1"
+	require.NoError(os.Rename(path, rotated))
+	require.NoError(b.Rotate())
+	log.Error("After rotation")
+	require.Len(readJSONLog(require, rotated), 1)
+	records = readJSONLog(require, path)
+	require.Len(records, 1)
+	require.Equal("ERROR", records[0].Level)
+}
+
+func TestLogFileRotation(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority_logging")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authority.log")
+
+	f, err := openLogFile(path, 100, 2)
+	require.NoError(err)
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 2; i++ {
+		_, err = f.Write(line)
+		require.NoError(err)
+	}
+
+	// The second write would exceed the limit, so it went to a new file.
+	b, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.Equal(line, b)
+	b, err = ioutil.ReadFile(path + ".1")
+	require.NoError(err)
+	require.Equal(line, b)
+	_, err = os.Stat(path + ".2")
+	require.True(os.IsNotExist(err))
+
+	// At most MaxBackups rotated files are kept.
+	for i := 0; i < 4; i++ {
+		_, err = f.Write(line)
+		require.NoError(err)
+	}
+	_, err = os.Stat(path + ".2")
+	require.NoError(err)
+	_, err = os.Stat(path + ".3")
+	require.True(os.IsNotExist(err))
+
+	// Reopening picks up the size of an existing file.
+	g, err := openLogFile(path, 100, 2)
+	require.NoError(err)
+	require.Equal(int64(len(line)), g.size)
+}
+
+func TestTextLogBackendRotation(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority_logging")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authority.log")
+
+	b, err := newTextLogBackend(path, "NOTICE", 1024, 1)
+	require.NoError(err)
+	log := b.GetLogger("state")
+	msg := strings.Repeat("x", 100)
+	for i := 0; i < 12; i++ {
+		log.Notice(msg)
+	}
+
+	rotated, err := ioutil.ReadFile(path + ".1")
+	require.NoError(err)
+	current, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.True(len(rotated) <= 1024)
+	require.Equal(12, strings.Count(string(rotated)+string(current), msg))
+	_, err = os.Stat(path + ".2")
+	require.True(os.IsNotExist(err))
+}
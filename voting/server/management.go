@@ -0,0 +1,350 @@
+// management.go - Katzenpost voting authority management interface.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/thwack"
+)
+
+const (
+	cmdAcks            = "ACKS"
+	cmdConsensusStatus = "CONSENSUS_STATUS"
+	cmdDrain           = "DRAIN"
+	cmdMissing         = "MISSING"
+	cmdStatus          = "STATUS"
+	cmdPeers           = "PEERS"
+	cmdTally           = "TALLY"
+	cmdVotes           = "VOTES"
+
+	consensusFinalized = "FINALIZED"
+	consensusPending   = "PENDING"
+	statusDraining     = "DRAINING"
+	statusMissing      = "MISSING_SERVICES"
+)
+
+// hasConsensus returns true iff there is a consensus document for the epoch.
+func (s *state) hasConsensus(epoch uint64) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.documents[epoch]
+	return ok
+}
+
+// drain stops the authority from taking part in any voting round that it
+// has not already voted in, while it continues to serve the documents it
+// has.  It lasts until the authority is restarted.
+func (s *state) drain() {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.draining {
+		s.log.Noticef("Draining, no longer taking part in new voting rounds.")
+	}
+	s.draining = true
+}
+
+func (s *state) isDraining() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.draining
+}
+
+// roundStatus returns the epoch being voted on and the voting state.
+func (s *state) roundStatus() (uint64, string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.votingEpoch, s.state
+}
+
+// missingServices returns the required services that no Provider offered
+// for the epoch, when it was last checked before voting.
+func (s *state) missingServices(epoch uint64) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.flagged[epoch]
+}
+
+// peerStatus returns a line for each of the peer authorities, with its
+// identity key and which of the vote, reveal and signature for the epoch
+// have been received from it.
+func (s *state) peerStatus(epoch uint64) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	received := func(ok bool, what string) string {
+		if ok {
+			return what
+		}
+		return "-"
+	}
+	lines := make([]string, 0, len(s.s.cfg.Authorities))
+	for _, peer := range s.s.cfg.Authorities {
+		pk := peer.IdentityPublicKey.ByteArray()
+		_, voted := s.votes[epoch][pk]
+		_, revealed := s.reveals[epoch][pk]
+		_, signed := s.certificates[epoch][pk]
+		lines = append(lines, fmt.Sprintf("%v %v %v %v", peer.IdentityPublicKey,
+			received(voted, "VOTE"), received(revealed, "REVEAL"), received(signed, "SIGNATURE")))
+	}
+	return lines
+}
+
+// tallyStatus returns a line for each of the descriptors in the votes for
+// the epoch received so far, with the node's name and identity key, and the
+// number of votes for the descriptor out of the threshold needed for it to
+// be included in the consensus.  The lines are sorted by identity key.
+func (s *state) tallyStatus(epoch uint64) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	counts := make(map[string]int)
+	for _, vote := range s.parsedVotes(epoch) {
+		for _, rawDesc := range vote.Providers {
+			counts[string(rawDesc)]++
+		}
+		for _, l := range vote.Topology {
+			for _, rawDesc := range l {
+				counts[string(rawDesc)]++
+			}
+		}
+	}
+	nodes := make([]*descriptor, 0, len(counts))
+	for rawDesc := range counts {
+		verifier, err := s11n.GetVerifierFromDescriptor([]byte(rawDesc))
+		if err != nil {
+			continue
+		}
+		desc, err := s11n.VerifyAndParseDescriptor(verifier, []byte(rawDesc), epoch)
+		if err != nil {
+			continue
+		}
+		nodes = append(nodes, &descriptor{desc: desc, raw: []byte(rawDesc)})
+	}
+	sortNodesByPublicKey(nodes)
+	lines := make([]string, 0, len(nodes))
+	for _, v := range nodes {
+		lines = append(lines, fmt.Sprintf("%v %v %d/%d", v.desc.Name, v.desc.IdentityKey, counts[string(v.raw)], s.threshold))
+	}
+	return lines
+}
+
+// parseEpochArg parses the optional epoch argument of the command line l,
+// returning def if it is omitted, and false on a syntax error.
+func parseEpochArg(c *thwack.Conn, l string, def uint64) (uint64, bool) {
+	sp := strings.Fields(l)
+	switch len(sp) {
+	case 1:
+		return def, true
+	case 2:
+		epoch, err := strconv.ParseUint(sp[1], 10, 64)
+		if err != nil {
+			c.Log().Debugf("[%v] Invalid epoch: %v", sp[0], err)
+			return 0, false
+		}
+		return epoch, true
+	default:
+		c.Log().Debugf("Invalid syntax: '%v'", l)
+		return 0, false
+	}
+}
+
+// writeLines writes a multi-line reply, with one line per entry.
+func writeLines(c *thwack.Conn, lines []string) error {
+	for _, l := range lines {
+		if err := c.Writer().PrintfLine("%d-%s", thwack.StatusOk, l); err != nil {
+			return err
+		}
+	}
+	return c.WriteReply(thwack.StatusOk)
+}
+
+// onConsensusStatus handles `CONSENSUS_STATUS [epoch]`, replying with the
+// epoch, which defaults to the current one, whether the consensus for it is
+// FINALIZED or PENDING, and DRAINING if the authority is draining.  This
+// allows the authorities to be restarted one at a time, each once the
+// round it took part in has completed.
+func (s *Server) onConsensusStatus(c *thwack.Conn, l string) error {
+	now, _, _ := epochNow()
+	epoch, ok := parseEpochArg(c, l, now)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+
+	status := consensusPending
+	if s.state.hasConsensus(epoch) {
+		status = consensusFinalized
+	}
+	if s.state.isDraining() {
+		return c.Writer().PrintfLine("%d %d %s %s", thwack.StatusOk, epoch, status, statusDraining)
+	}
+	return c.Writer().PrintfLine("%d %d %s", thwack.StatusOk, epoch, status)
+}
+
+// onDrain handles `DRAIN`, see state.drain.
+func (s *Server) onDrain(c *thwack.Conn, l string) error {
+	if len(strings.Fields(l)) != 1 {
+		c.Log().Debugf("[%v] Invalid syntax: '%v'", cmdDrain, l)
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	s.state.drain()
+	return c.WriteReply(thwack.StatusOk)
+}
+
+// onStatus handles `STATUS`, replying with the current epoch, the epoch
+// being voted on, the voting state, DRAINING if the authority is draining,
+// and MISSING_SERVICES followed by a comma separated list if no Provider
+// offers some of the Parameters.RequiredServices for the epoch.
+func (s *Server) onStatus(c *thwack.Conn, l string) error {
+	if len(strings.Fields(l)) != 1 {
+		c.Log().Debugf("[%v] Invalid syntax: '%v'", cmdStatus, l)
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	now, _, _ := epochNow()
+	votingEpoch, state := s.state.roundStatus()
+	status := fmt.Sprintf("%d %d %d %s", thwack.StatusOk, now, votingEpoch, state)
+	if s.state.isDraining() {
+		status += " " + statusDraining
+	}
+	if missing := s.state.missingServices(votingEpoch); len(missing) > 0 {
+		status += " " + statusMissing + " " + strings.Join(missing, ",")
+	}
+	return c.Writer().PrintfLine("%s", status)
+}
+
+// onPeers handles `PEERS [epoch]`, see state.peerStatus.  The epoch
+// defaults to the one being voted on.
+func (s *Server) onPeers(c *thwack.Conn, l string) error {
+	votingEpoch, _ := s.state.roundStatus()
+	epoch, ok := parseEpochArg(c, l, votingEpoch)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	return writeLines(c, s.state.peerStatus(epoch))
+}
+
+// onAcks handles `ACKS [epoch]`, see state.ackStatus.  The epoch defaults
+// to the one being voted on.
+func (s *Server) onAcks(c *thwack.Conn, l string) error {
+	votingEpoch, _ := s.state.roundStatus()
+	epoch, ok := parseEpochArg(c, l, votingEpoch)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	return writeLines(c, s.state.ackStatus(epoch))
+}
+
+// onMissing handles `MISSING [epoch]`, see state.missingDescriptors.  The
+// epoch defaults to the one being voted on.
+func (s *Server) onMissing(c *thwack.Conn, l string) error {
+	votingEpoch, _ := s.state.roundStatus()
+	epoch, ok := parseEpochArg(c, l, votingEpoch)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	s.state.RLock()
+	missing := s.state.missingDescriptors(epoch)
+	s.state.RUnlock()
+	return writeLines(c, missing)
+}
+
+// onTally handles `TALLY [epoch]`, see state.tallyStatus.  The epoch
+// defaults to the one being voted on.
+func (s *Server) onTally(c *thwack.Conn, l string) error {
+	votingEpoch, _ := s.state.roundStatus()
+	epoch, ok := parseEpochArg(c, l, votingEpoch)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	return writeLines(c, s.state.tallyStatus(epoch))
+}
+
+// onVotes handles `VOTES [epoch]`, replying with a line for each of the
+// signed votes for the epoch, with the identity key of the authority that
+// cast it, and the vote as received in base64.  The lines are sorted by
+// identity key.  The epoch defaults to the one being voted on.
+func (s *Server) onVotes(c *thwack.Conn, l string) error {
+	votingEpoch, _ := s.state.roundStatus()
+	epoch, ok := parseEpochArg(c, l, votingEpoch)
+	if !ok {
+		return c.WriteReply(thwack.StatusSyntaxError)
+	}
+	votes, err := s.GetVotes(epoch)
+	if err != nil {
+		return writeLines(c, nil)
+	}
+	lines := make([]string, 0, len(votes))
+	for id, raw := range votes {
+		pk := new(eddsa.PublicKey)
+		if err := pk.FromBytes(id[:]); err != nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%v %v", pk, base64.StdEncoding.EncodeToString(raw)))
+	}
+	sort.Strings(lines)
+	return writeLines(c, lines)
+}
+
+func (s *Server) initManagement() error {
+	// Remove the socket left behind by an unclean shutdown.
+	if err := os.Remove(s.cfg.Management.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	mgmtCfg := &thwack.Config{
+		Net:         "unix",
+		Addr:        s.cfg.Management.Path,
+		ServiceName: s.cfg.Authority.Identifier + " Katzenpost Authority",
+		LogModule:   "authority/mgmt",
+		NewLoggerFn: s.logBackend.GetLogger,
+	}
+	m, err := thwack.New(mgmtCfg)
+	if err != nil {
+		return err
+	}
+	for cmd, fn := range map[string]thwack.CommandHandlerFn{
+		cmdAcks:            s.onAcks,
+		cmdConsensusStatus: s.onConsensusStatus,
+		cmdDrain:           s.onDrain,
+		cmdMissing:         s.onMissing,
+		cmdStatus:          s.onStatus,
+		cmdPeers:           s.onPeers,
+		cmdTally:           s.onTally,
+		cmdVotes:           s.onVotes,
+	} {
+		if err = m.RegisterCommand(cmd, fn); err != nil {
+			m.Halt()
+			return err
+		}
+	}
+	m.Start()
+	s.management = m
+	s.log.Noticef("Serving the management interface on: %v", s.cfg.Management.Path)
+	return nil
+}
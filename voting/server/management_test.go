@@ -0,0 +1,253 @@
+// management_test.go - Katzenpost voting authority management tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/pki"
+	"github.com/katzenpost/core/thwack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialManagement connects to the management interface, and returns a
+// func that sends a command and returns the reply.
+func dialManagement(require *require.Assertions, path string) (*textproto.Conn, func(string, ...interface{}) (int, string)) {
+	conn, err := textproto.Dial("unix", path)
+	require.NoError(err)
+	_, _, err = conn.ReadResponse(int(thwack.StatusServiceReady))
+	require.NoError(err)
+	return conn, func(format string, args ...interface{}) (int, string) {
+		_, err := conn.Cmd(format, args...)
+		require.NoError(err)
+		code, msg, err := conn.ReadResponse(0)
+		require.NoError(err)
+		return code, msg
+	}
+}
+
+func TestManagement(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 1000
+	defer pinEpochClock(epoch, 0)()
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	logPath := filepath.Join(cfg.Authority.DataDir, "authority.log")
+	cfg.Logging = &config.Logging{
+		Level:  "DEBUG",
+		Format: config.LogFormatJSON,
+		File:   logPath,
+	}
+	cfg.Management = &config.Management{Enable: true}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	conn, command := dialManagement(require, cfg.Management.Path)
+	defer conn.Close()
+
+	// The consensus for the next epoch is still being voted on.
+	code, msg := command("%v %d", cmdConsensusStatus, epoch+1)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Equal(fmt.Sprintf("%d PENDING", epoch+1), msg)
+
+	s.state.Lock()
+	s.state.documents[epoch] = &document{}
+	s.state.Unlock()
+	code, msg = command(cmdConsensusStatus)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Equal(fmt.Sprintf("%d FINALIZED", epoch), msg)
+
+	code, _ = command("%v soon", cmdConsensusStatus)
+	require.Equal(int(thwack.StatusSyntaxError), code)
+
+	// Once drained, the authority sits out the next round, but still has
+	// its documents.
+	code, _ = command(cmdDrain)
+	require.Equal(int(thwack.StatusOk), code)
+	code, msg = command(cmdConsensusStatus)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Equal(fmt.Sprintf("%d FINALIZED DRAINING", epoch), msg)
+
+	s.state.Lock()
+	s.state.state = stateAcceptDescriptor
+	s.state.votingEpoch = epoch + 1
+	s.state.Unlock()
+	s.state.fsm()
+
+	s.state.RLock()
+	require.Equal(stateBootstrap, s.state.state)
+	require.False(s.state.voted(epoch + 1))
+	s.state.RUnlock()
+	require.True(s.state.hasConsensus(epoch))
+
+	drained := false
+	for _, rec := range readJSONLog(require, logPath) {
+		if strings.HasPrefix(rec.Message, "Draining, not voting for epoch") {
+			drained = true
+		}
+	}
+	require.True(drained)
+}
+
+func TestManagementIntrospection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The authority is voting for the epoch after now.
+	const now = 1000
+	defer pinEpochClock(now, 0)()
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	peerLinkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authorities = []*config.AuthorityPeer{
+		{
+			IdentityPublicKey: peerKey.PublicKey(),
+			LinkPublicKey:     peerLinkKey.PublicKey(),
+			Addresses:         []string{"127.0.0.1:1"},
+		},
+	}
+	cfg.Management = &config.Management{Enable: true}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	conn, command := dialManagement(require, cfg.Management.Path)
+	defer conn.Close()
+
+	// Both authorities vote for the same mix, only the peer for the
+	// provider.
+	const epoch = now + 1
+	mix := genSignedDescriptor(assert, epoch, 0)
+	provider := genSignedDescriptor(assert, epoch, pki.LayerProvider)
+	vote := func(k *eddsa.PrivateKey, providers [][]byte) *document {
+		signed, err := s11n.SignDocument(k, &s11n.Document{
+			Epoch:     epoch,
+			Topology:  [][][]byte{{mix}},
+			Providers: providers,
+		})
+		require.NoError(err)
+		return &document{raw: signed}
+	}
+	peerPk := peerKey.PublicKey().ByteArray()
+	s.state.Lock()
+	s.state.state = stateAcceptVote
+	s.state.votingEpoch = epoch
+	s.state.votes[epoch] = map[[eddsa.PublicKeySize]byte]*document{
+		s.state.identityPubKey(): vote(s.identityKey, nil),
+		peerPk:                   vote(peerKey, [][]byte{provider}),
+	}
+	s.state.reveals[epoch] = map[[eddsa.PublicKeySize]byte][]byte{
+		peerPk: make([]byte, s11n.SharedRandomLength),
+	}
+	s.state.Unlock()
+
+	code, msg := command(cmdStatus)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Equal(fmt.Sprintf("%d %d %s", now, epoch, stateAcceptVote), msg)
+
+	// Required services that no Provider offers are flagged.
+	s.state.Lock()
+	s.state.flagged[epoch] = []string{"loop", "keyserver"}
+	s.state.Unlock()
+	code, msg = command(cmdStatus)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Equal(fmt.Sprintf("%d %d %s MISSING_SERVICES loop,keyserver", now, epoch, stateAcceptVote), msg)
+
+	code, msg = command(cmdPeers)
+	require.Equal(int(thwack.StatusOk), code)
+	lines := strings.Split(msg, "\n")
+	require.Len(lines, 2)
+	require.Equal(fmt.Sprintf("%v VOTE REVEAL -", peerKey.PublicKey()), lines[0])
+
+	s.state.recordAck(epoch, peerPk, sentSignature)
+	code, msg = command(cmdAcks)
+	require.Equal(int(thwack.StatusOk), code)
+	lines = strings.Split(msg, "\n")
+	require.Len(lines, 2)
+	require.Equal(fmt.Sprintf("%v - SIGNATURE", peerKey.PublicKey()), lines[0])
+
+	code, msg = command(cmdTally)
+	require.Equal(int(thwack.StatusOk), code)
+	lines = strings.Split(msg, "\n")
+	require.Len(lines, 3)
+	counts := make(map[string]bool)
+	for _, l := range lines[:2] {
+		sp := strings.Fields(l)
+		require.Len(sp, 3)
+		counts[sp[2]] = true
+	}
+	require.Equal(map[string]bool{"2/2": true, "1/2": true}, counts)
+
+	code, _ = command("%v %v %v", cmdTally, epoch, epoch)
+	require.Equal(int(thwack.StatusSyntaxError), code)
+
+	// Each signed vote is returned as received, and verifies against the
+	// key of the authority that cast it.
+	code, msg = command(cmdVotes)
+	require.Equal(int(thwack.StatusOk), code)
+	lines = strings.Split(msg, "\n")
+	require.Len(lines, 3)
+	keys := map[string]*eddsa.PublicKey{
+		s.IdentityKey().String():     s.IdentityKey(),
+		peerKey.PublicKey().String(): peerKey.PublicKey(),
+	}
+	for _, l := range lines[:2] {
+		sp := strings.Fields(l)
+		require.Len(sp, 2)
+		pk, ok := keys[sp[0]]
+		require.True(ok, "%v", sp[0])
+		raw, err := base64.StdEncoding.DecodeString(sp[1])
+		require.NoError(err)
+		v, err := s11n.FromPayload(pk, raw)
+		require.NoError(err)
+		require.Equal(epoch, v.Epoch)
+	}
+
+	votes, err := s.GetVotes(epoch)
+	require.NoError(err)
+	require.Len(votes, 2)
+	_, err = s.GetVotes(epoch + 1)
+	require.Equal(ErrNoVote, err)
+
+	code, msg = command("%v %d", cmdVotes, epoch+1)
+	require.Equal(int(thwack.StatusOk), code)
+	require.Len(strings.Split(msg, "\n"), 1)
+}
@@ -0,0 +1,366 @@
+// metrics.go - Katzenpost voting authority server metrics.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MetricNodesAtRisk is the number of nodes listed in the previous
+	// consensus that failed to upload a descriptor for the current voting
+	// epoch.
+	MetricNodesAtRisk = "authority_nodes_at_risk"
+
+	// MetricNodesDroppedTotal is the total number of nodes that were
+	// excluded from a consensus after being listed in the previous one.
+	MetricNodesDroppedTotal = "authority_nodes_dropped_total"
+
+	// MetricRoundStallsTotal is the total number of times the voting state
+	// machine was detected as stalled.
+	MetricRoundStallsTotal = "authority_round_stalls_total"
+
+	// MetricConsensusReachedTotal is the total number of epochs for which a
+	// consensus was reached.
+	MetricConsensusReachedTotal = "authority_consensus_reached_total"
+
+	// MetricConsensusGeneratedTotal is the total number of epochs for which
+	// this authority tabulated the votes and signed a consensus document.
+	MetricConsensusGeneratedTotal = "authority_consensus_generated_total"
+
+	// MetricVotingEpoch is the epoch that is currently being voted on.
+	MetricVotingEpoch = "authority_voting_epoch"
+
+	// MetricVotingState is the state of the voting state machine, see
+	// votingStateValues.
+	MetricVotingState = "authority_voting_state"
+
+	// MetricVotesReceived is the number of votes, including this
+	// authority's own, received for the voting epoch.
+	MetricVotesReceived = "authority_votes_received"
+
+	// MetricRevealsReceived is the number of reveals, including this
+	// authority's own, received for the voting epoch.
+	MetricRevealsReceived = "authority_reveals_received"
+
+	// MetricSignaturesCollected is the number of signed consensus documents,
+	// including this authority's own, collected for the voting epoch.
+	MetricSignaturesCollected = "authority_signatures_collected"
+
+	// MetricGoroutines is the number of goroutines in the process.
+	MetricGoroutines = "authority_goroutines"
+
+	// MetricOpenConnections is the number of authority protocol connections
+	// currently open.
+	MetricOpenConnections = "authority_open_connections"
+
+	// MetricMemoryInUseBytes is the number of bytes of heap memory in use.
+	MetricMemoryInUseBytes = "authority_memory_in_use_bytes"
+
+	// MetricPhaseDurationSeconds is a histogram of the wall-clock time the
+	// voting state machine spent in each state, labeled by phase.
+	MetricPhaseDurationSeconds = "authority_phase_duration_seconds"
+
+	// MetricRoundDurationSeconds is a histogram of the wall-clock time from
+	// entering the descriptor upload phase to leaving the signature phase.
+	MetricRoundDurationSeconds = "authority_round_duration_seconds"
+
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// votingStateValues is the value of MetricVotingState for each state of the
+// voting state machine.
+var votingStateValues = map[string]float64{
+	stateBootstrap:        0,
+	stateAcceptDescriptor: 1,
+	stateAcceptVote:       2,
+	stateAcceptReveal:     3,
+	stateAcceptSignature:  4,
+}
+
+type metricDesc struct {
+	isCounter bool
+	help      string
+}
+
+var metricDescs = map[string]metricDesc{
+	MetricNodesAtRisk:             {false, "Nodes from the previous consensus without a descriptor for the voting epoch."},
+	MetricNodesDroppedTotal:       {true, "Nodes excluded from a consensus after being listed in the previous one."},
+	MetricRoundStallsTotal:        {true, "Voting rounds detected as stalled."},
+	MetricConsensusReachedTotal:   {true, "Epochs for which a consensus was reached."},
+	MetricConsensusGeneratedTotal: {true, "Epochs for which a consensus document was tabulated and signed."},
+	MetricVotingEpoch:             {false, "Epoch being voted on."},
+	MetricVotingState:             {false, "Voting state: 0 bootstrap, 1 accept_desc, 2 accept_vote, 3 accept_reveal, 4 accept_signature."},
+	MetricVotesReceived:           {false, "Votes received for the voting epoch."},
+	MetricRevealsReceived:         {false, "Reveals received for the voting epoch."},
+	MetricSignaturesCollected:     {false, "Signed consensus documents collected for the voting epoch."},
+	MetricGoroutines:              {false, "Goroutines in the process."},
+	MetricOpenConnections:         {false, "Authority protocol connections currently open."},
+	MetricMemoryInUseBytes:        {false, "Bytes of heap memory in use."},
+}
+
+// durationBuckets are the upper bounds, in seconds, of the duration
+// histogram buckets.  They grow exponentially from a quarter of a second to
+// a little over two hours, which covers the phases of both the test and
+// the production epoch schedules.
+var durationBuckets = exponentialBuckets(0.25, 2, 16)
+
+type histogramDesc struct {
+	label   string
+	help    string
+	buckets []float64
+}
+
+var histogramDescs = map[string]histogramDesc{
+	MetricPhaseDurationSeconds: {"phase", "Time spent in each voting phase.", durationBuckets},
+	MetricRoundDurationSeconds: {"", "Time taken by a full voting round.", durationBuckets},
+}
+
+func exponentialBuckets(start, factor float64, n int) []float64 {
+	b := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		b = append(b, start)
+		start *= factor
+	}
+	return b
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, le := range buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type exemplar struct {
+	epoch        uint64
+	documentHash string
+	value        float64
+	timestamp    time.Time
+}
+
+type metrics struct {
+	sync.Mutex
+
+	values     map[string]float64
+	exemplars  map[string]*exemplar
+	histograms map[string]map[string]*histogram
+
+	withExemplars bool
+}
+
+func (m *metrics) set(name string, v float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.values[name] = v
+}
+
+func (m *metrics) add(name string, v float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.values[name] += v
+}
+
+// addWithExemplar increments the counter, and if exemplars are enabled
+// records the epoch and document hash the increment relates to.
+func (m *metrics) addWithExemplar(name string, v float64, epoch uint64, documentHash string) {
+	m.Lock()
+	defer m.Unlock()
+	m.values[name] += v
+	if m.withExemplars {
+		m.exemplars[name] = &exemplar{
+			epoch:        epoch,
+			documentHash: documentHash,
+			value:        v,
+			timestamp:    time.Now(),
+		}
+	}
+}
+
+// observe records v in the named histogram, under the label value label
+// if the histogram is labeled.
+func (m *metrics) observe(name, label string, v float64) {
+	m.Lock()
+	defer m.Unlock()
+	desc := histogramDescs[name]
+	h, ok := m.histograms[name][label]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(desc.buckets))}
+		m.histograms[name][label] = h
+	}
+	h.observe(desc.buckets, v)
+}
+
+func (m *metrics) snapshot() map[string]float64 {
+	m.Lock()
+	defer m.Unlock()
+	ret := make(map[string]float64, len(m.values))
+	for k, v := range m.values {
+		ret[k] = v
+	}
+	return ret
+}
+
+// writeText writes the metrics in the Prometheus text format, or if
+// openMetrics is set, in the OpenMetrics text format which is the only one
+// that can carry exemplars.
+func (m *metrics) writeText(w io.Writer, openMetrics bool) error {
+	m.Lock()
+	defer m.Unlock()
+
+	names := make([]string, 0, len(m.values))
+	for k := range m.values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	b := new(bytes.Buffer)
+	for _, name := range names {
+		desc := metricDescs[name]
+		family, typ := name, "gauge"
+		if desc.isCounter {
+			typ = "counter"
+			if openMetrics {
+				// OpenMetrics counter families are named without the
+				// suffix of their samples.
+				family = strings.TrimSuffix(name, "_total")
+			}
+		}
+		fmt.Fprintf(b, "# HELP %s %s\n", family, desc.help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", family, typ)
+		fmt.Fprintf(b, "%s %v", name, m.values[name])
+		if e, ok := m.exemplars[name]; ok && openMetrics {
+			ts := float64(e.timestamp.UnixNano()) / float64(time.Second)
+			fmt.Fprintf(b, " # {epoch=\"%d\",document_hash=\"%s\"} %v %.3f", e.epoch, e.documentHash, e.value, ts)
+		}
+		b.WriteString("\n")
+	}
+	m.writeHistograms(b)
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (m *metrics) writeHistograms(b *bytes.Buffer) {
+	// Lock is held.
+	names := make([]string, 0, len(m.histograms))
+	for k := range m.histograms {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		desc := histogramDescs[name]
+		fmt.Fprintf(b, "# HELP %s %s\n", name, desc.help)
+		fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+
+		labels := make([]string, 0, len(m.histograms[name]))
+		for k := range m.histograms[name] {
+			labels = append(labels, k)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			h := m.histograms[name][label]
+			prefix := ""
+			if desc.label != "" {
+				prefix = fmt.Sprintf("%s=\"%s\",", desc.label, label)
+			}
+			for i, le := range desc.buckets {
+				fmt.Fprintf(b, "%s_bucket{%sle=\"%v\"} %d\n", name, prefix, le, h.counts[i])
+			}
+			fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+			suffix := ""
+			if desc.label != "" {
+				suffix = fmt.Sprintf("{%s}", strings.TrimSuffix(prefix, ","))
+			}
+			fmt.Fprintf(b, "%s_sum%s %v\n", name, suffix, h.sum)
+			fmt.Fprintf(b, "%s_count%s %d\n", name, suffix, h.count)
+		}
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Only use OpenMetrics if the scraper asks for it, everything else
+	// gets the Prometheus format without exemplars.
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+	m.writeText(w, openMetrics)
+}
+
+func newMetrics(withExemplars bool) *metrics {
+	m := &metrics{
+		values:        make(map[string]float64),
+		exemplars:     make(map[string]*exemplar),
+		histograms:    make(map[string]map[string]*histogram),
+		withExemplars: withExemplars,
+	}
+	for name := range metricDescs {
+		m.values[name] = 0
+	}
+	for name := range histogramDescs {
+		m.histograms[name] = make(map[string]*histogram)
+	}
+	return m
+}
+
+// Metrics returns a snapshot of the Server's metrics, keyed by name.
+func (s *Server) Metrics() map[string]float64 {
+	s.updateResourceMetrics()
+	return s.metrics.snapshot()
+}
+
+func (s *Server) initMetricsListener() error {
+	l, err := net.Listen("tcp", s.cfg.Metrics.Address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// The resource usage gauges are sampled on demand.
+		s.updateResourceMetrics()
+		s.metrics.ServeHTTP(w, r)
+	})
+	s.metricsServer = &http.Server{Handler: mux}
+
+	s.log.Noticef("Serving metrics on: %v", l.Addr())
+	go s.metricsServer.Serve(l)
+	return nil
+}
@@ -0,0 +1,150 @@
+// metrics_test.go - Voting authority server metrics tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(require *require.Assertions, m *metrics, accept string) (string, string) {
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	body, err := ioutil.ReadAll(w.Result().Body)
+	require.NoError(err)
+	return w.Result().Header.Get("Content-Type"), string(body)
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	require := require.New(t)
+
+	const (
+		exemplar = `authority_consensus_reached_total 1 # {epoch="23",document_hash="hash"} 1 `
+		sample   = "authority_consensus_reached_total 1\n"
+	)
+
+	m := newMetrics(true)
+	m.addWithExemplar(MetricConsensusReachedTotal, 1, 23, "hash")
+
+	// Scrapers that support OpenMetrics get the exemplar.
+	contentType, body := scrapeMetrics(require, m, "application/openmetrics-text; version=1.0.0")
+	require.Equal(openMetricsContentType, contentType)
+	require.Contains(body, "# TYPE authority_consensus_reached counter\n")
+	require.Contains(body, exemplar)
+	require.True(strings.HasSuffix(body, "# EOF\n"))
+
+	// Everything else gets the Prometheus text format, without exemplars.
+	contentType, body = scrapeMetrics(require, m, "")
+	require.Equal(prometheusContentType, contentType)
+	require.Contains(body, "# TYPE authority_consensus_reached_total counter\n")
+	require.Contains(body, sample)
+	require.NotContains(body, " # {")
+	require.NotContains(body, "# EOF")
+
+	// Exemplars are only recorded if enabled.
+	m = newMetrics(false)
+	m.addWithExemplar(MetricConsensusReachedTotal, 1, 23, "hash")
+	_, body = scrapeMetrics(require, m, "application/openmetrics-text")
+	require.Contains(body, sample)
+}
+
+func TestRoundMetrics(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 23
+	s := &state{
+		s:           &Server{metrics: newMetrics(false)},
+		state:       stateAcceptReveal,
+		votingEpoch: epoch,
+		votes: map[uint64]map[[eddsa.PublicKeySize]byte]*document{
+			epoch: {{0x01}: nil, {0x02}: nil, {0x03}: nil},
+		},
+		reveals: map[uint64]map[[eddsa.PublicKeySize]byte][]byte{
+			epoch:     {{0x01}: nil, {0x02}: nil},
+			epoch - 1: {{0x01}: nil, {0x02}: nil, {0x03}: nil},
+		},
+		certificates: make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+	s.updateRoundMetrics()
+
+	m := s.s.metrics.snapshot()
+	require.Equal(float64(epoch), m[MetricVotingEpoch])
+	require.Equal(float64(3), m[MetricVotingState])
+	require.Equal(float64(3), m[MetricVotesReceived])
+	require.Equal(float64(2), m[MetricRevealsReceived])
+	require.Equal(float64(0), m[MetricSignaturesCollected])
+
+	_, body := scrapeMetrics(require, s.s.metrics, "")
+	require.Contains(body, "# TYPE authority_votes_received gauge\n")
+	require.Contains(body, "authority_reveals_received 2\n")
+}
+
+func TestPhaseDurationMetrics(t *testing.T) {
+	require := require.New(t)
+
+	s := &state{
+		s:     &Server{metrics: newMetrics(false)},
+		state: stateBootstrap,
+	}
+	now := time.Unix(1000, 0)
+	step := func(next string, d time.Duration) {
+		from := s.state
+		s.state = next
+		now = now.Add(d)
+		s.recordTransition(from, now)
+	}
+
+	// The time spent before the first transition is unknown.
+	step(stateAcceptDescriptor, 10*time.Second)
+	step(stateAcceptVote, 100*time.Second)
+	step(stateAcceptReveal, 2*time.Second)
+	step(stateAcceptSignature, 3*time.Second)
+	step(stateAcceptDescriptor, 5*time.Second)
+
+	// Staying in a state is not a transition.
+	step(stateAcceptDescriptor, time.Second)
+
+	// A round abandoned for bootstrap is not recorded.
+	step(stateBootstrap, 50*time.Second)
+
+	_, body := scrapeMetrics(require, s.s.metrics, "")
+	require.Contains(body, "# TYPE authority_phase_duration_seconds histogram\n")
+	require.NotContains(body, `phase="bootstrap"`)
+	require.Contains(body, `authority_phase_duration_seconds_bucket{phase="accept_desc",le="64"} 1`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_bucket{phase="accept_desc",le="128"} 2`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_bucket{phase="accept_desc",le="+Inf"} 2`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_sum{phase="accept_desc"} 151`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_count{phase="accept_vote"} 1`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_bucket{phase="accept_signature",le="4"} 0`+"\n")
+	require.Contains(body, `authority_phase_duration_seconds_bucket{phase="accept_signature",le="8"} 1`+"\n")
+
+	require.Contains(body, "# TYPE authority_round_duration_seconds histogram\n")
+	require.Contains(body, `authority_round_duration_seconds_bucket{le="64"} 0`+"\n")
+	require.Contains(body, `authority_round_duration_seconds_bucket{le="128"} 1`+"\n")
+	require.Contains(body, "authority_round_duration_seconds_sum 110\n")
+	require.Contains(body, "authority_round_duration_seconds_count 1\n")
+}
@@ -0,0 +1,71 @@
+// peerkeys.go - Katzenpost voting authority peer key tracking.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// checkPeerLinkKey returns true iff linkKey is the configured link key of
+// the peer authority with the identity key pk.  Mismatches are logged, as
+// are changes from the link key last presented by the peer, which is
+// recorded in the database.
+func (s *state) checkPeerLinkKey(pk [eddsa.PublicKeySize]byte, linkKey *ecdh.PublicKey) bool {
+	s.RLock()
+	configured, ok := s.authorityLinkKeys[pk]
+	s.RUnlock()
+
+	matches := ok && configured.Equal(linkKey)
+	if !matches {
+		s.log.Warningf("SECURITY: Peer authority %x presented link key %v, which differs from the configured %v.", pk, linkKey, configured)
+	}
+	s.recordPeerLinkKey(pk, linkKey)
+	return matches
+}
+
+// recordPeerLinkKey records linkKey as the link key last presented by the
+// peer authority with the identity key pk.
+func (s *state) recordPeerLinkKey(pk [eddsa.PublicKeySize]byte, linkKey *ecdh.PublicKey) {
+	b := linkKey.Bytes()
+	var prev []byte
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(peerKeysBucket)).Get(pk[:]); v != nil {
+			prev = append([]byte{}, v...)
+		}
+		return nil
+	}); err != nil {
+		s.log.Errorf("Failed to look up the recorded link key of peer authority %x: %v", pk, err)
+		return
+	}
+	if bytes.Equal(prev, b) {
+		return
+	}
+	if prev != nil {
+		s.log.Warningf("SECURITY: Peer authority %x changed its link key from %x to %v.", pk, prev, linkKey)
+	}
+
+	// The record is advisory, so failing to update it is not fatal.
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(peerKeysBucket)).Put(pk[:], b)
+	}); err != nil {
+		s.log.Errorf("Failed to record the link key of peer authority %x: %v", pk, err)
+	}
+}
@@ -0,0 +1,99 @@
+// peerkeys_test.go - Katzenpost voting authority peer key tracking tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerLinkKeyChange(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authority")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "authority.log")
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "WARNING", Format: config.LogFormatJSON, File: logFile},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{},
+		},
+	}
+	require.NoError(srv.initLogging())
+
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	newLinkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	pk := peerKey.PublicKey().ByteArray()
+	s := &state{
+		s:                     srv,
+		log:                   srv.logBackend.GetLogger("state"),
+		authorizedAuthorities: map[[eddsa.PublicKeySize]byte]bool{pk: true},
+		authorityLinkKeys:     map[[eddsa.PublicKeySize]byte]*ecdh.PublicKey{pk: linkKey.PublicKey()},
+	}
+	defer openTestDB(assert.New(t), s)()
+	creds := func(k *ecdh.PrivateKey) *wire.PeerCredentials {
+		return &wire.PeerCredentials{
+			AdditionalData: pk[:],
+			PublicKey:      k.PublicKey(),
+		}
+	}
+
+	// The configured key is quietly recorded.
+	require.True(s.IsPeerValid(creds(linkKey)))
+	b, err := ioutil.ReadFile(logFile)
+	require.NoError(err)
+	require.Empty(b)
+
+	// The peer changes its key, which is logged, and recorded.
+	require.True(s.IsPeerValid(creds(newLinkKey)))
+	var warnings []string
+	for _, rec := range readJSONLog(require, logFile) {
+		if rec.Level == "WARNING" && strings.HasPrefix(rec.Message, "SECURITY:") {
+			warnings = append(warnings, rec.Message)
+		}
+	}
+	require.Len(warnings, 2)
+	require.Contains(warnings[0], "differs from the configured")
+	require.Contains(warnings[1], "changed its link key")
+	require.NoError(s.db.View(func(tx *bolt.Tx) error {
+		require.Equal(newLinkKey.PublicKey().Bytes(), tx.Bucket([]byte(peerKeysBucket)).Get(pk[:]))
+		return nil
+	}))
+
+	// Under the strict mode, the connection is refused.
+	srv.cfg.Debug.StrictPeerKeys = true
+	require.False(s.IsPeerValid(creds(newLinkKey)))
+	require.True(s.IsPeerValid(creds(linkKey)))
+}
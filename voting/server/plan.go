@@ -0,0 +1,94 @@
+// plan.go - Katzenpost voting authority topology planning.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+)
+
+// PlanTopology returns the layer assignment of the whitelisted mixes in
+// the validated configuration cfg, as computed when bootstrapping a network
+// with an all-zero shared random value.  Mixes pinned to a layer are placed
+// in that layer.  The mixes of each layer are sorted by identity key.
+//
+// The layer of each mix in a real consensus depends on the shared random
+// value, so only the number of mixes per layer is authoritative.
+func PlanTopology(cfg *config.Config) ([][]*eddsa.PublicKey, error) {
+	keys := make([]*eddsa.PublicKey, 0, len(cfg.Mixes))
+	var pinned []*config.Node
+	for _, v := range cfg.Mixes {
+		if v.Layer != nil {
+			pinned = append(pinned, v)
+			continue
+		}
+		keys = append(keys, v.IdentityKey)
+	}
+	sortPublicKeys(keys)
+
+	var srv [32]byte
+	rng, err := NewDeterministicRandReader(srv[:])
+	if err != nil {
+		return nil, err
+	}
+	nodeIndexes := rng.Perm(len(keys))
+	topology := make([][]*eddsa.PublicKey, cfg.Parameters.Layers)
+	for idx, layer := 0, 0; idx < len(keys); idx++ {
+		topology[layer] = append(topology[layer], keys[nodeIndexes[idx]])
+		layer++
+		layer = layer % len(topology)
+	}
+	for _, v := range pinned {
+		topology[*v.Layer] = append(topology[*v.Layer], v.IdentityKey)
+	}
+	for _, l := range topology {
+		sortPublicKeys(l)
+	}
+	return topology, nil
+}
+
+// WriteTopologyPlan writes the topology returned by PlanTopology to w, in
+// a human readable form.
+func WriteTopologyPlan(w io.Writer, cfg *config.Config) error {
+	topology, err := PlanTopology(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "Topology: %d mixes in %d layers (%d providers)\n", len(cfg.Mixes), len(topology), len(cfg.Providers)); err != nil {
+		return err
+	}
+	for layer, l := range topology {
+		if _, err = fmt.Fprintf(w, "Layer %d: %d mixes\n", layer, len(l)); err != nil {
+			return err
+		}
+		for _, k := range l {
+			if _, err = fmt.Fprintf(w, "\t%s\n", k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortPublicKeys(keys []*eddsa.PublicKey) {
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i].Bytes(), keys[j].Bytes()) < 0 })
+}
@@ -0,0 +1,67 @@
+// plan_test.go - Katzenpost voting authority topology planning tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanTopology(t *testing.T) {
+	require := require.New(t)
+
+	cfg := &config.Config{
+		Parameters: &config.Parameters{Layers: 3},
+		Debug:      &config.Debug{},
+	}
+	for i := 0; i < 7; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		cfg.Mixes = append(cfg.Mixes, &config.Node{IdentityKey: k.PublicKey()})
+	}
+
+	topology, err := PlanTopology(cfg)
+	require.NoError(err)
+	require.Len(topology, 3)
+	require.Len(topology[0], 3)
+	require.Len(topology[1], 2)
+	require.Len(topology[2], 2)
+	seen := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, l := range topology {
+		for i, k := range l {
+			if i > 0 {
+				require.True(bytes.Compare(l[i-1].Bytes(), k.Bytes()) < 0)
+			}
+			seen[k.ByteArray()] = true
+		}
+	}
+	require.Len(seen, 7)
+
+	// The plan does not depend on the order of the whitelist.
+	var a, b bytes.Buffer
+	require.NoError(WriteTopologyPlan(&a, cfg))
+	cfg.Mixes[0], cfg.Mixes[6] = cfg.Mixes[6], cfg.Mixes[0]
+	require.NoError(WriteTopologyPlan(&b, cfg))
+	require.Equal(a.String(), b.String())
+	require.True(strings.HasPrefix(a.String(), "Topology: 7 mixes in 3 layers (0 providers)\nLayer 0: 3 mixes\n"))
+}
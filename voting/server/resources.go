@@ -0,0 +1,64 @@
+// resources.go - Katzenpost voting authority resource usage.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ResourceStats is a snapshot of the resources used by the process the
+// Server runs in.
+type ResourceStats struct {
+	// Goroutines is the number of goroutines in the process.
+	Goroutines int
+
+	// Connections is the number of inbound and outbound authority protocol
+	// connections currently open by the Server.
+	Connections int
+
+	// MemoryInUse is the number of bytes of heap memory in use.
+	MemoryInUse uint64
+}
+
+// ResourceStats returns a snapshot of the Server's resource usage.  As the
+// goroutine count and memory are process wide, they include the usage of
+// anything else running in the same process.
+func (s *Server) ResourceStats() ResourceStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return ResourceStats{
+		Goroutines:  runtime.NumGoroutine(),
+		Connections: int(atomic.LoadInt32(&s.nrConns)),
+		MemoryInUse: m.HeapInuse,
+	}
+}
+
+func (s *Server) updateResourceMetrics() {
+	st := s.ResourceStats()
+	s.metrics.set(MetricGoroutines, float64(st.Goroutines))
+	s.metrics.set(MetricOpenConnections, float64(st.Connections))
+	s.metrics.set(MetricMemoryInUseBytes, float64(st.MemoryInUse))
+}
+
+func (s *Server) connOpened() {
+	atomic.AddInt32(&s.nrConns, 1)
+}
+
+func (s *Server) connClosed() {
+	atomic.AddInt32(&s.nrConns, -1)
+}
@@ -0,0 +1,104 @@
+// resources_test.go - Katzenpost voting authority resource usage tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceStatsBounded(t *testing.T) {
+	require := require.New(t)
+
+	// A peer authority that hangs up on every connection.
+	peerListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer peerListener.Close()
+	go func() {
+		for {
+			conn, err := peerListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	peerIdentity, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	peerLink, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	cfg.Authorities = []*config.AuthorityPeer{
+		{
+			IdentityPublicKey: peerIdentity.PublicKey(),
+			LinkPublicKey:     peerLink.PublicKey(),
+			Addresses:         []string{peerListener.Addr().String()},
+		},
+	}
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	baseline := s.ResourceStats()
+
+	// Simulate many rounds worth of peer exchanges and inbound connections,
+	// without retrying the failed exchanges.
+	epoch, _, _ := epochtime.Now()
+	const nrRounds = 100
+	for i := 0; i < nrRounds; i++ {
+		s.state.Lock()
+		s.state.sendVoteToAuthorities([]byte("vote"), epoch+uint64(i), sentVote, time.Now())
+		s.state.Unlock()
+		s.state.sendRevealToAuthorities([]byte("reveal"), epoch+uint64(i), time.Now())
+
+		conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+		require.NoError(err)
+		conn.Close()
+	}
+
+	// Every goroutine and connection spawned by the rounds must go away.
+	const slack = 2
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st := s.ResourceStats()
+		if st.Connections == 0 && st.Goroutines <= baseline.Goroutines+slack {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resources not released, baseline: %+v, now: %+v", baseline, st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	m := s.Metrics()
+	require.Equal(float64(0), m[MetricOpenConnections])
+	require.NotZero(m[MetricGoroutines])
+	require.NotZero(m[MetricMemoryInUseBytes])
+}
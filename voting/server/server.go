@@ -18,18 +18,24 @@
 package server
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/katzenpost/authority/voting/server/config"
 	"github.com/katzenpost/core/crypto/ecdh"
 	"github.com/katzenpost/core/crypto/eddsa"
 	"github.com/katzenpost/core/crypto/rand"
 	"github.com/katzenpost/core/log"
+	"github.com/katzenpost/core/thwack"
 	"gopkg.in/op/go-logging.v1"
 )
 
@@ -37,20 +43,47 @@ import (
 // terminates due to the `GenerateOnly` debug config option.
 var ErrGenerateOnly = errors.New("server: GenerateOnly set")
 
+// ErrNoVote is the error returned when the Server did not cast a vote for
+// the requested epoch, or the vote is no longer retained.
+var ErrNoVote = errors.New("server: no vote for the requested epoch")
+
+// ErrNoDocument is the error returned when the Server does not have a
+// consensus document for the requested epoch.
+var ErrNoDocument = errors.New("server: no document for the requested epoch")
+
+// ErrDescriptorsNotRetained is the error returned when the Server no longer
+// retains the descriptors for the requested epoch.
+var ErrDescriptorsNotRetained = errors.New("server: descriptors for the requested epoch are no longer retained")
+
+// ErrPeersChanged is the error returned when reloading the configuration
+// would change the authority peers, which requires a restart.
+var ErrPeersChanged = errors.New("server: authority peers changed, restart required")
+
 // Server is a voting authority server instance.
 type Server struct {
 	sync.WaitGroup
 
 	cfg *config.Config
 
-	identityKey *eddsa.PrivateKey
-	linkKey     *ecdh.PrivateKey
+	identityKey     *eddsa.PrivateKey
+	nextIdentityKey *eddsa.PrivateKey
+	linkKey         *ecdh.PrivateKey
 
-	logBackend *log.Backend
+	logBackend logBackend
 	log        *logging.Logger
 
 	state     *state
+	transport Transport
 	listeners []net.Listener
+	metrics   *metrics
+	eventCh   chan Event
+
+	metricsServer *http.Server
+	healthServer  *http.Server
+	gatewayServer *http.Server
+	management    *thwack.Server
+	nrConns       int32
+	descUploads   uploadLimiter
 
 	fatalErrCh chan error
 	haltedCh   chan interface{}
@@ -58,8 +91,11 @@ type Server struct {
 }
 
 func (s *Server) initDataDir() error {
+	return initDataDir(s.cfg.Authority.DataDir)
+}
+
+func initDataDir(d string) error {
 	const dirMode = os.ModeDir | 0700
-	d := s.cfg.Authority.DataDir
 
 	// Initialize the data directory, by ensuring that it exists (or can be
 	// created), and that it has the appropriate permissions.
@@ -71,15 +107,37 @@ func (s *Server) initDataDir() error {
 		if err = os.Mkdir(d, dirMode); err != nil {
 			return fmt.Errorf("authority: failed to create DataDir: %v", err)
 		}
-	} else {
-		if !fi.IsDir() {
-			return fmt.Errorf("authority: DataDir '%v' is not a directory", d)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("authority: DataDir '%v' is not a directory", d)
+	}
+
+	return nil
+}
+
+// checkDataDirPermissions returns an error if the DataDir dir, or any of
+// the private key files in it, are accessible by the group or other users.
+func checkDataDirPermissions(dir string) error {
+	const unsafeBits = 0077
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("authority: failed to stat() DataDir: %v", err)
+	}
+	if fi.Mode().Perm()&unsafeBits != 0 {
+		return fmt.Errorf("authority: DataDir '%v' has unsafe permissions '%v'", dir, fi.Mode())
+	}
+	for _, v := range []string{identityPrivateKeyFile, nextIdentityPrivateKeyFile, linkPrivateKeyFile} {
+		f := filepath.Join(dir, v)
+		fi, err := os.Stat(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("authority: failed to stat() key file: %v", err)
 		}
-		if fi.Mode() != dirMode {
-			return fmt.Errorf("authority: DataDir '%v' has invalid permissions '%v'", d, fi.Mode())
+		if fi.Mode().Perm()&unsafeBits != 0 {
+			return fmt.Errorf("authority: key file '%v' has unsafe permissions '%v'", f, fi.Mode())
 		}
 	}
-
 	return nil
 }
 
@@ -91,8 +149,15 @@ func (s *Server) initLogging() error {
 		}
 	}
 
+	maxSize := int64(s.cfg.Logging.MaxSizeMB) * 1024 * 1024
 	var err error
-	s.logBackend, err = log.New(p, s.cfg.Logging.Level, s.cfg.Logging.Disable)
+	if s.cfg.Logging.Format == config.LogFormatJSON && !s.cfg.Logging.Disable {
+		s.logBackend, err = newJSONLogBackend(p, s.cfg.Logging.Level, maxSize, s.cfg.Logging.MaxBackups)
+	} else if maxSize > 0 && p != "" && !s.cfg.Logging.Disable {
+		s.logBackend, err = newTextLogBackend(p, s.cfg.Logging.Level, maxSize, s.cfg.Logging.MaxBackups)
+	} else {
+		s.logBackend, err = log.New(p, s.cfg.Logging.Level, s.cfg.Logging.Disable)
+	}
 	if err == nil {
 		s.log = s.logBackend.GetLogger("authority")
 	}
@@ -104,6 +169,58 @@ func (s *Server) IdentityKey() *eddsa.PublicKey {
 	return s.identityKey.PublicKey()
 }
 
+// OwnVote returns the signed vote exactly as the Server submitted it to the
+// other authorities for the given epoch, so that third parties can verify it
+// against the Server's identity key and the published consensus.  Votes are
+// only retained for a few epochs.  The HTTP gateway serves them as
+// /vote/{epoch}.
+func (s *Server) OwnVote(epoch uint64) ([]byte, error) {
+	return s.state.ownVote(epoch)
+}
+
+// GetVotes returns the signed votes received for the given epoch, including
+// the Server's own, keyed by the identity key of the authority that cast
+// each one.  Every vote is exactly as it was received, and can be verified
+// independently against the authority's identity key, which allows failed
+// rounds to be analysed after the fact.  Votes are only retained for
+// Parameters.DocumentRetentionEpochs epochs.  The management interface
+// exposes the same information with the VOTES command.
+func (s *Server) GetVotes(epoch uint64) (map[[eddsa.PublicKeySize]byte][]byte, error) {
+	return s.state.signedVotes(epoch)
+}
+
+// GetDescriptors returns every descriptor that the Server accepted for the
+// given epoch, exactly as signed by each node and sorted by identity key,
+// including those of nodes that did not make it into the consensus.
+// Descriptors are only retained for Parameters.DocumentRetentionEpochs
+// epochs, after which ErrDescriptorsNotRetained is returned.  The HTTP
+// gateway serves them as /descriptors.
+func (s *Server) GetDescriptors(epoch uint64) ([][]byte, error) {
+	return s.state.signedDescriptors(epoch)
+}
+
+// CanonicalBytes returns the canonical serialized form of the consensus
+// document for the given epoch, exactly as it is certified by the
+// authorities' signatures and hashed by s11n.DocumentHash, so that third
+// parties can recompute the hash without having to reserialize the
+// document.
+func (s *Server) CanonicalBytes(epoch uint64) ([]byte, error) {
+	return s.state.canonicalBytes(epoch)
+}
+
+// WriteConsensus writes the signed consensus document for the given epoch to
+// w.  The cached serialized document is streamed directly, without making a
+// per request copy.  The HTTP gateway serves the raw document with it,
+// while the wire protocol has to frame the whole document as the payload of
+// a single Consensus command, which shares the cached bytes instead.
+func (s *Server) WriteConsensus(w io.Writer, epoch uint64) (int64, error) {
+	doc, err := s.state.GetConsensus(epoch)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, bytes.NewReader(doc.raw))
+}
+
 // RotateLog rotates the log file
 // if logging to a file is enabled.
 func (s *Server) RotateLog() {
@@ -142,8 +259,19 @@ func (s *Server) listenWorker(l net.Listener) {
 			continue
 		}
 
+		max := s.cfg.Debug.MaxConcurrentConnections
+		if max > 0 && atomic.LoadInt32(&s.nrConns) >= int32(max) {
+			s.log.Warningf("Refusing connection from %v: %v connections in progress", conn.RemoteAddr(), max)
+			conn.Close()
+			continue
+		}
+
+		// Connections are handled concurrently, so that a slow or stalled
+		// peer does not hold up the others, and counted before the next
+		// Accept so that the limit holds.
+		s.connOpened()
 		s.Add(1)
-		s.onConn(conn)
+		go s.onConn(conn)
 	}
 
 	// NOTREACHED
@@ -152,6 +280,26 @@ func (s *Server) listenWorker(l net.Listener) {
 func (s *Server) halt() {
 	s.log.Notice("Starting graceful shutdown.")
 
+	// Halt the metrics server.
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+		s.metricsServer = nil
+	}
+	if s.healthServer != nil {
+		s.healthServer.Close()
+		s.healthServer = nil
+	}
+	if s.gatewayServer != nil {
+		s.gatewayServer.Close()
+		s.gatewayServer = nil
+	}
+
+	// Halt the management interface.
+	if s.management != nil {
+		s.management.Halt()
+		s.management = nil
+	}
+
 	// Halt the listeners.
 	for idx, l := range s.listeners {
 		if l != nil {
@@ -170,20 +318,52 @@ func (s *Server) halt() {
 	}
 
 	s.identityKey.Reset()
+	if s.nextIdentityKey != nil {
+		s.nextIdentityKey.Reset()
+	}
 	s.linkKey.Reset()
 	close(s.fatalErrCh)
+	close(s.eventCh)
 
 	s.log.Notice("Shutdown complete.")
 	close(s.haltedCh)
 }
 
+// validateWhitelist ensures that there are enough mixes and providers
+// whitelisted to form a topology, assuming all of them post a descriptor.
+func validateWhitelist(mixes, providers []*config.Node, layers int, dbg *config.Debug) error {
+	if len(mixes) == 0 && len(providers) == 0 && dbg.AllowEmptyNetwork {
+		return nil
+	}
+	if len(providers) < 1 {
+		return fmt.Errorf("server: No Providers specified in the config")
+	}
+	if len(mixes) < layers*dbg.MinNodesPerLayer {
+		return fmt.Errorf("server: Insufficient nodes whitelisted, got %v , need %v", len(mixes), layers*dbg.MinNodesPerLayer)
+	}
+	return nil
+}
+
 // New returns a new Server instance parameterized with the specific
 // configuration.
 func New(cfg *config.Config) (*Server, error) {
+	return NewWithTransport(cfg, &tcpTransport{
+		backlog:   cfg.Debug.ListenBacklog,
+		keepAlive: time.Duration(cfg.Debug.PeerKeepAlive) * time.Second,
+	})
+}
+
+// NewWithTransport returns a new Server instance parameterized with the
+// specific configuration, that listens on and dials its peers over the
+// transport t instead of TCP.
+func NewWithTransport(cfg *config.Config, t Transport) (*Server, error) {
 	s := new(Server)
 	s.cfg = cfg
+	s.transport = t
 	s.fatalErrCh = make(chan error)
 	s.haltedCh = make(chan interface{})
+	s.eventCh = make(chan Event, eventQueueLength)
+	s.metrics = newMetrics(cfg.Metrics != nil && cfg.Metrics.Exemplars)
 
 	// Do the early initialization and bring up logging.
 	if err := s.initDataDir(); err != nil {
@@ -194,9 +374,28 @@ func New(cfg *config.Config) (*Server, error) {
 	}
 
 	s.log.Notice("Katzenpost is still pre-alpha.  DO NOT DEPEND ON IT FOR STRONG SECURITY OR ANONYMITY.")
+	if err := checkDataDirPermissions(s.cfg.Authority.DataDir); err != nil {
+		if !s.cfg.Debug.AllowUnsafePermissions {
+			s.log.Errorf("Refusing to start: %v", err)
+			return nil, err
+		}
+		s.log.Warningf("Debug.AllowUnsafePermissions is set: %v", err)
+	}
 	if s.cfg.Logging.Level == "DEBUG" {
 		s.log.Warning("Unsafe Debug logging is enabled.")
 	}
+	if s.cfg.Parameters != nil {
+		for _, w := range s.cfg.Parameters.Warnings() {
+			s.log.Warning(w)
+		}
+		s.log.Noticef("Parameters hash: %x (voted: %x)", s.cfg.Parameters.Hash(), votedParameters(s.cfg.Parameters).Hash())
+		for _, v := range s.cfg.ParameterSchedule {
+			s.log.Noticef("Parameters scheduled for epoch %v (voted: %x)", v.Epoch, votedParameters(s.cfg.ParametersAt(v.Epoch)).Hash())
+		}
+		for _, w := range s.cfg.ScheduleWarnings() {
+			s.log.Warning(w)
+		}
+	}
 
 	// Initialize the authority identity key.
 	var err error
@@ -204,28 +403,45 @@ func New(cfg *config.Config) (*Server, error) {
 		s.log.Warning("Debug.IdentityKey MUST NOT be used for production deployments.")
 		s.identityKey = new(eddsa.PrivateKey)
 		s.identityKey.FromBytes(s.cfg.Debug.IdentityKey.Bytes())
+	} else if s.identityKey, err = externalIdentityKey(s.cfg.Debug); err != nil {
+		s.log.Errorf("Failed to initialize identity key: %v", err)
+		return nil, err
+	} else if s.identityKey != nil {
+		s.log.Notice("Identity key loaded from an external source.")
 	} else {
-		identityPrivateKeyFile := filepath.Join(s.cfg.Authority.DataDir, "identity.private.pem")
-		identityPublicKeyFile := filepath.Join(s.cfg.Authority.DataDir, "identity.public.pem")
-		if s.identityKey, err = eddsa.Load(identityPrivateKeyFile, identityPublicKeyFile, rand.Reader); err != nil {
+		privFile := filepath.Join(s.cfg.Authority.DataDir, identityPrivateKeyFile)
+		pubFile := filepath.Join(s.cfg.Authority.DataDir, identityPublicKeyFile)
+		if s.identityKey, err = eddsa.Load(privFile, pubFile, rand.Reader); err != nil {
 			s.log.Errorf("Failed to initialize identity key: %v", err)
 			return nil, err
 		}
 	}
+	if s.cfg.Authority.NextIdentityKey != nil {
+		if err = s.initNextIdentityKey(); err != nil {
+			s.log.Errorf("Failed to initialize next identity key: %v", err)
+			return nil, err
+		}
+	}
 
 	if s.cfg.Debug.LinkKey != nil {
 		s.log.Warning("Debug.LinkKey MUST NOT be used for production deployments.")
 		s.linkKey = new(ecdh.PrivateKey)
 		s.linkKey.FromBytes(s.cfg.Debug.LinkKey.Bytes())
 	} else {
-		linkPrivateKeyFile := filepath.Join(s.cfg.Authority.DataDir, "link.private.pem")
-		linkPublicKeyFile := filepath.Join(s.cfg.Authority.DataDir, "link.public.pem")
-		if s.linkKey, err = ecdh.Load(linkPrivateKeyFile, linkPublicKeyFile, rand.Reader); err != nil {
+		privFile := filepath.Join(s.cfg.Authority.DataDir, linkPrivateKeyFile)
+		pubFile := filepath.Join(s.cfg.Authority.DataDir, linkPublicKeyFile)
+		if s.linkKey, err = ecdh.Load(privFile, pubFile, rand.Reader); err != nil {
 			s.log.Errorf("Failed to initialize link key: %v", err)
 			return nil, err
 		}
 	}
 
+	if s.cfg.Debug.LenientDescriptorParsing {
+		s.log.Notice("Descriptor parsing is lenient, unknown descriptor fields are ignored.")
+	} else {
+		s.log.Notice("Descriptor parsing is strict, descriptors with unknown fields are rejected.")
+	}
+
 	s.log.Noticef("Authority identity public key is: %s", s.identityKey.PublicKey())
 	s.log.Noticef("Authority link public key is: %s", s.linkKey.PublicKey())
 
@@ -233,13 +449,11 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, ErrGenerateOnly
 	}
 
-	// Ensure that there are enough mixes and providers whitelisted to form
-	// a topology, assuming all of them post a descriptor.
-	if len(cfg.Providers) < 1 {
-		return nil, fmt.Errorf("server: No Providers specified in the config")
+	if len(cfg.Mixes) == 0 && len(cfg.Providers) == 0 && cfg.Debug.AllowEmptyNetwork {
+		s.log.Warning("No Mixes or Providers are whitelisted, the authority will not vote.")
 	}
-	if len(cfg.Mixes) < cfg.Debug.Layers*cfg.Debug.MinNodesPerLayer {
-		return nil, fmt.Errorf("server: Insufficient nodes whitelisted, got %v , need %v", len(cfg.Mixes), cfg.Debug.Layers*cfg.Debug.MinNodesPerLayer)
+	if err := validateWhitelist(cfg.Mixes, cfg.Providers, cfg.Parameters.Layers, cfg.Debug); err != nil {
+		return nil, err
 	}
 
 	// Past this point, failures need to call s.Shutdown() to do cleanup.
@@ -265,9 +479,35 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, err
 	}
 
+	// Start serving metrics, if configured.
+	if s.cfg.Metrics != nil && s.cfg.Metrics.Address != "" {
+		if err = s.initMetricsListener(); err != nil {
+			s.log.Errorf("Failed to start metrics listener: %v", err)
+			return nil, err
+		}
+	}
+	if s.cfg.HealthCheck != nil && s.cfg.HealthCheck.Address != "" {
+		if err = s.initHealthCheckListener(); err != nil {
+			s.log.Errorf("Failed to start health check listener: %v", err)
+			return nil, err
+		}
+	}
+	if s.cfg.HTTPGateway != nil && s.cfg.HTTPGateway.Address != "" {
+		if err = s.initHTTPGatewayListener(); err != nil {
+			s.log.Errorf("Failed to start HTTP gateway listener: %v", err)
+			return nil, err
+		}
+	}
+	if s.cfg.Management != nil && s.cfg.Management.Enable {
+		if err = s.initManagement(); err != nil {
+			s.log.Errorf("Failed to start management interface: %v", err)
+			return nil, err
+		}
+	}
+
 	// Start up the listeners.
 	for _, v := range s.cfg.Authority.Addresses {
-		l, err := net.Listen("tcp", v)
+		l, err := s.transport.Listen(v)
 		if err != nil {
 			s.log.Errorf("Failed to start listener '%v': %v", v, err)
 			continue
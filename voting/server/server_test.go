@@ -0,0 +1,809 @@
+// server_test.go - Voting authority server tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
+	"github.com/katzenpost/core/wire/commands"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
+)
+
+func genTestNode(require *require.Assertions, identifier string) *config.Node {
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err, "eddsa.NewKeypair()")
+	return &config.Node{
+		Identifier:  identifier,
+		IdentityKey: k.PublicKey(),
+	}
+}
+
+func genTestConfig(require *require.Assertions) *config.Config {
+	dataDir, err := ioutil.TempDir("", "authority")
+	require.NoError(err, "ioutil.TempDir()")
+
+	return &config.Config{
+		Authority: &config.Authority{
+			Addresses: []string{"127.0.0.1:0"},
+			DataDir:   dataDir,
+		},
+		Logging: &config.Logging{
+			Level: "DEBUG",
+		},
+		Parameters: &config.Parameters{
+			Layers: 1,
+		},
+		Debug: &config.Debug{
+			MinNodesPerLayer: 1,
+		},
+		Mixes:     []*config.Node{genTestNode(require, "")},
+		Providers: []*config.Node{genTestNode(require, "provider.example.org")},
+	}
+}
+
+// pinEpochClock pins the clock of the authorities to elapsed into epoch,
+// until the returned function restores it.  It must only be called while no
+// authority is running.
+func pinEpochClock(epoch uint64, elapsed time.Duration) func() {
+	epochNow = func() (uint64, time.Duration, time.Duration) {
+		return epoch, elapsed, epochtime.Period - elapsed
+	}
+	return func() {
+		epochNow = epochtime.Now
+	}
+}
+
+// genTestAuthorities brings up nrAuthorities authorities that are each
+// other's peers over the transport tr, idle until the test drives their
+// state machines.  tune is called on each configuration before the
+// authority is created.  The returned function tears the authorities down.
+func genTestAuthorities(require *require.Assertions, tr Transport, nrAuthorities int, tune func(*config.Config)) ([]*Server, func()) {
+	cfgs := make([]*config.Config, 0, nrAuthorities)
+	peers := make([]*config.AuthorityPeer, 0, nrAuthorities)
+	for i := 0; i < nrAuthorities; i++ {
+		cfg := genTestConfig(require)
+		cfg.Authority.Addresses = []string{fmt.Sprintf("authority-%d", i)}
+		cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+		identityKey, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		cfg.Debug.IdentityKey = identityKey
+		cfg.Debug.LinkKey = linkKey
+		if tune != nil {
+			tune(cfg)
+		}
+		cfgs = append(cfgs, cfg)
+		peers = append(peers, &config.AuthorityPeer{
+			IdentityPublicKey: identityKey.PublicKey(),
+			LinkPublicKey:     linkKey.PublicKey(),
+			Addresses:         cfg.Authority.Addresses,
+		})
+	}
+
+	servers := make([]*Server, 0, nrAuthorities)
+	cleanup := func() {
+		for _, s := range servers {
+			s.Shutdown()
+			s.Wait()
+		}
+		for _, cfg := range cfgs {
+			os.RemoveAll(cfg.Authority.DataDir)
+		}
+	}
+	for i, cfg := range cfgs {
+		for j, peer := range peers {
+			if i != j {
+				cfg.Authorities = append(cfg.Authorities, peer)
+			}
+		}
+		s, err := NewWithTransport(cfg, tr)
+		if err != nil {
+			cleanup()
+		}
+		require.NoError(err, "NewWithTransport()")
+
+		servers = append(servers, s)
+
+		// End the warmup, once the worker is asleep after its first pass.
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			s.state.Lock()
+			if s.state.votingEpoch != 0 {
+				s.state.startTime = time.Now().Add(-time.Hour)
+				s.state.Unlock()
+				break
+			}
+			s.state.Unlock()
+			require.True(time.Now().Before(deadline), "worker did not start")
+		}
+	}
+	return servers, cleanup
+}
+
+// runTestRound uploads the same descriptors to every authority, and drives
+// the authorities through the voting round for epoch in lock step, waiting
+// for the peers to deliver every vote, reveal and signature before moving
+// on to the next phase.  The authorities must be bootstrapping, at a time
+// at which they still join the round.
+func runTestRound(t *testing.T, servers []*Server, epoch uint64) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, layer := range []uint8{0, pki.LayerProvider} {
+		raw := genSignedDescriptor(assert, epoch, layer)
+		verifier, err := s11n.GetVerifierFromDescriptor(raw)
+		require.NoError(err)
+		desc, err := s11n.VerifyAndParseDescriptor(verifier, raw, epoch)
+		require.NoError(err)
+		for _, s := range servers {
+			require.NoError(s.state.onDescriptorUpload(raw, desc, epoch))
+		}
+	}
+
+	step := func(want string, wantEpoch uint64) {
+		for _, s := range servers {
+			s.state.fsm()
+			s.state.RLock()
+			got, votingEpoch := s.state.state, s.state.votingEpoch
+			s.state.RUnlock()
+			require.Equal(want, got)
+			require.Equal(wantEpoch, votingEpoch)
+		}
+	}
+	waitFor := func(what string, count func(*state) int) {
+		deadline := time.Now().Add(10 * time.Second)
+		for _, s := range servers {
+			for {
+				s.state.RLock()
+				n := count(s.state)
+				s.state.RUnlock()
+				if n == len(servers) {
+					break
+				}
+				require.True(time.Now().Before(deadline), "%v has %d of %d %v", s.IdentityKey(), n, len(servers), what)
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
+	step(stateAcceptDescriptor, epoch)
+	step(stateAcceptVote, epoch)
+	waitFor("votes", func(st *state) int { return len(st.votes[epoch]) })
+	step(stateAcceptReveal, epoch)
+	waitFor("reveals", func(st *state) int { return len(st.reveals[epoch]) })
+	step(stateAcceptSignature, epoch)
+	waitFor("signatures", func(st *state) int { return len(st.certificates[epoch]) })
+	step(stateAcceptDescriptor, epoch+1)
+
+	// Every authority reached the same consensus, signed by all of them.
+	var certified []byte
+	for _, s := range servers {
+		d, err := s.state.GetConsensus(epoch)
+		require.NoError(err)
+		sigs, err := cert.GetSignatures(d.raw)
+		require.NoError(err)
+		require.Len(sigs, len(servers))
+		c, err := cert.GetCertified(d.raw)
+		require.NoError(err)
+		if certified == nil {
+			certified = c
+		}
+		require.Equal(certified, c)
+	}
+}
+
+func TestMultipleInstances(t *testing.T) {
+	require := require.New(t)
+
+	// Bring up several independent authorities in the same process, each
+	// with its own configuration, keys, state and listeners, idle until the
+	// test drives their state machines.
+	const nrInstances = 3
+	servers := make([]*Server, 0, nrInstances)
+	for i := 0; i < nrInstances; i++ {
+		cfg := genTestConfig(require)
+		defer os.RemoveAll(cfg.Authority.DataDir)
+		cfg.Debug.StartupWarmup = time.Hour
+		s, err := New(cfg)
+		require.NoError(err, "New()")
+		servers = append(servers, s)
+	}
+
+	for i, a := range servers {
+		for _, b := range servers[i+1:] {
+			require.False(a.IdentityKey().Equal(b.IdentityKey()), "instances share an identity key")
+			require.NotEqual(a.listeners[0].Addr().String(), b.listeners[0].Addr().String())
+		}
+	}
+
+	// Each instance runs a round of its own, on the descriptors uploaded
+	// to it alone.
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	for _, s := range servers {
+		for _, layer := range []uint8{0, pki.LayerProvider} {
+			linkKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			mixKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			require.NoError(s.injectDescriptor(epoch, &pki.MixDescriptor{
+				Name:    "node.example.org",
+				LinkKey: linkKey.PublicKey(),
+				MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+				Addresses: map[pki.Transport][]string{
+					pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+				},
+				Layer: layer,
+			}))
+		}
+		st := s.state
+		st.Lock()
+		st.startTime = time.Now().Add(-time.Hour)
+		st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+		st.Unlock()
+		for i := 0; i < 5; i++ {
+			st.fsm()
+		}
+	}
+
+	// Every instance reached a consensus signed by itself alone, on its
+	// own descriptors, and saw none of the others' votes.
+	hashes := make(map[string]bool)
+	for _, s := range servers {
+		d, err := s.state.GetConsensus(epoch)
+		require.NoError(err)
+		_, err = cert.Verify(s.IdentityKey(), d.raw)
+		require.NoError(err)
+		sigs, err := cert.GetSignatures(d.raw)
+		require.NoError(err)
+		require.Len(sigs, 1)
+		certified, err := cert.GetCertified(d.raw)
+		require.NoError(err)
+		hashes[sha256b64(certified)] = true
+
+		s.state.RLock()
+		require.Len(s.state.votes[epoch], 1)
+		_, ok := s.state.votes[epoch][s.state.identityPubKey()]
+		s.state.RUnlock()
+		require.True(ok, "instance has no vote of its own")
+	}
+	require.Len(hashes, nrInstances, "instances produced the same document")
+
+	// Tearing down the instances concurrently must not interfere.
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *Server) {
+			defer wg.Done()
+			s.Shutdown()
+			s.Wait()
+		}(s)
+	}
+	wg.Wait()
+}
+
+func TestPhaseDurationsRound(t *testing.T) {
+	require := require.New(t)
+
+	// The authorities accept descriptors until three quarters into the
+	// epoch, and are past the default half of the epoch already, so they
+	// only join the round with the configured phase durations.
+	const epoch = 1000
+	defer pinEpochClock(epoch, epochtime.Period*2/3)()
+	phase := int(epochtime.Period / 20 / time.Second)
+	servers, cleanup := genTestAuthorities(require, new(MemoryTransport), 3, func(cfg *config.Config) {
+		cfg.Parameters.DescriptorPhase = 15 * phase
+		cfg.Parameters.VotePhase = phase
+		cfg.Parameters.RevealPhase = phase
+		cfg.Parameters.SignaturePhase = phase
+	})
+	defer cleanup()
+	for _, s := range servers {
+		require.Equal(epochtime.Period*3/4, s.state.deadlines.mixPublish)
+		require.Equal(epochtime.Period*9/10, s.state.deadlines.publishConsensus)
+	}
+
+	runTestRound(t, servers, epoch+1)
+}
+
+func TestEmptyNetwork(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Mixes = nil
+	cfg.Providers = nil
+	cfg.Debug.AllowEmptyNetwork = true
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Run the descriptor acceptance phase, which must withhold the vote
+	// rather than vote on an empty network.
+	epoch, _, _ := epochtime.Now()
+	s.state.Lock()
+	s.state.state = stateAcceptDescriptor
+	s.state.votingEpoch = epoch + 1
+	s.state.Unlock()
+	s.state.fsm()
+
+	s.state.RLock()
+	defer s.state.RUnlock()
+	require.Equal(stateBootstrap, s.state.state)
+	require.False(s.state.voted(epoch + 1))
+}
+
+// discardResponseWriter is a http.ResponseWriter that discards the body.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+// BenchmarkConsensusServing serves a large document to concurrent clients
+// of the HTTP gateway.  The memory allocated per request is independent of
+// the size of the document, which is shared by all of them.
+func BenchmarkConsensusServing(b *testing.B) {
+	const (
+		epoch   = 23
+		docSize = 1 << 20
+	)
+
+	raw := make([]byte, docSize)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		b.Fatal(err)
+	}
+	s := &Server{
+		state: &state{
+			documents: map[uint64]*document{
+				epoch: {raw: raw},
+			},
+		},
+	}
+	target := fmt.Sprintf("/consensus/raw?epoch=%v", epoch)
+
+	b.SetBytes(docSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := httptest.NewRequest("GET", target, nil)
+		for pb.Next() {
+			s.serveGatewayRawConsensus(&discardResponseWriter{header: make(http.Header)}, r)
+		}
+	})
+}
+
+func TestCanonicalBytes(t *testing.T) {
+	require := require.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	const epoch = 23
+	signed, err := s11n.SignDocument(k, &s11n.Document{Epoch: epoch})
+	require.NoError(err)
+	s := &Server{
+		state: &state{
+			documents: map[uint64]*document{
+				epoch: {raw: signed},
+			},
+		},
+	}
+
+	raw, err := s.CanonicalBytes(epoch)
+	require.NoError(err)
+	certified, err := cert.GetCertified(signed)
+	require.NoError(err)
+	require.Equal(certified, raw)
+
+	// The bytes are the ones the document hash is computed over.
+	h, err := s11n.DocumentHash(signed)
+	require.NoError(err)
+	rawHash := sha3.Sum256(raw)
+	require.Equal(h, rawHash[:])
+
+	_, err = s.CanonicalBytes(epoch + 1)
+	require.Equal(ErrNoDocument, err)
+}
+
+func TestServeLastGoodOnFailure(t *testing.T) {
+	require := require.New(t)
+
+	// A lone authority, that is idle until the test drives the state
+	// machine through the rounds.
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	for _, e := range []uint64{epoch, epoch + 1} {
+		for _, layer := range []uint8{0, pki.LayerProvider} {
+			linkKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			mixKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			require.NoError(s.injectDescriptor(e, &pki.MixDescriptor{
+				Name:    "node.example.org",
+				LinkKey: linkKey.PublicKey(),
+				MixKeys: map[uint64]*ecdh.PublicKey{e: mixKey.PublicKey()},
+				Addresses: map[pki.Transport][]string{
+					pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+				},
+				Layer: layer,
+			}))
+		}
+	}
+
+	// The first round succeeds.
+	st := s.state
+	st.Lock()
+	st.startTime = time.Now().Add(-time.Hour)
+	st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+	st.Unlock()
+	for i := 0; i < 5; i++ {
+		st.fsm()
+	}
+	good, err := st.GetConsensus(epoch)
+	require.NoError(err)
+
+	// The second fails, as a lone authority can never meet a Threshold of
+	// two.
+	st.Lock()
+	st.threshold = 2
+	st.Unlock()
+	for i := 0; i < 4; i++ {
+		st.fsm()
+	}
+	st.RLock()
+	require.True(st.failed[epoch+1])
+	st.RUnlock()
+	_, err = st.GetConsensus(epoch + 1)
+	require.Equal(errGone, err)
+
+	// Unless the last good document is served in its place.
+	cfg.Parameters.ServeLastGoodOnFailure = true
+	stale, err := st.GetConsensus(epoch + 1)
+	require.NoError(err)
+	require.Equal(good, stale)
+	require.Equal(epoch, stale.doc.Epoch)
+
+	// Epochs that did not fail are unaffected.
+	_, err = st.GetConsensus(epoch + 2)
+	require.Equal(errNotYet, err)
+}
+
+func TestParameterSchedule(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	cfg.ParameterSchedule = []*config.ScheduledParameters{
+		{Epoch: epoch + 1, Mu: cfg.Parameters.Mu * 2, SendRatePerMinute: 42},
+	}
+	for _, e := range []uint64{epoch, epoch + 1} {
+		for _, layer := range []uint8{0, pki.LayerProvider} {
+			linkKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			mixKey, err := ecdh.NewKeypair(rand.Reader)
+			require.NoError(err)
+			require.NoError(s.injectDescriptor(e, &pki.MixDescriptor{
+				Name:    "node.example.org",
+				LinkKey: linkKey.PublicKey(),
+				MixKeys: map[uint64]*ecdh.PublicKey{e: mixKey.PublicKey()},
+				Addresses: map[pki.Transport][]string{
+					pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+				},
+				Layer: layer,
+			}))
+		}
+	}
+
+	// Run two rounds, the second of which is for the scheduled epoch.
+	st := s.state
+	st.Lock()
+	st.startTime = time.Now().Add(-time.Hour)
+	st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+	st.Unlock()
+	for i := 0; i < 9; i++ {
+		st.fsm()
+	}
+
+	before, err := st.GetConsensus(epoch)
+	require.NoError(err)
+	require.Equal(cfg.Parameters.Mu, before.doc.Mu)
+	require.Equal(cfg.Parameters.SendRatePerMinute, before.doc.SendRatePerMinute)
+
+	after, err := st.GetConsensus(epoch + 1)
+	require.NoError(err)
+	require.Equal(cfg.Parameters.Mu*2, after.doc.Mu)
+	require.Equal(uint64(42), after.doc.SendRatePerMinute)
+	require.Equal(cfg.Parameters.LambdaP, after.doc.LambdaP)
+}
+
+func TestDataDirPermissions(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	require.NoError(checkDataDirPermissions(cfg.Authority.DataDir))
+
+	// A world accessible DataDir is refused.
+	require.NoError(os.Chmod(cfg.Authority.DataDir, 0777))
+	require.Error(checkDataDirPermissions(cfg.Authority.DataDir))
+	_, err := New(cfg)
+	require.Error(err)
+
+	// Unless Debug.AllowUnsafePermissions is set.
+	cfg.Debug.AllowUnsafePermissions = true
+	s, err := New(cfg)
+	require.NoError(err)
+	s.Shutdown()
+	s.Wait()
+
+	// So are readable private key files.
+	require.NoError(os.Chmod(cfg.Authority.DataDir, 0700))
+	require.NoError(checkDataDirPermissions(cfg.Authority.DataDir))
+	require.NoError(os.Chmod(filepath.Join(cfg.Authority.DataDir, identityPrivateKeyFile), 0644))
+	require.Error(checkDataDirPermissions(cfg.Authority.DataDir))
+	cfg.Debug.AllowUnsafePermissions = false
+	_, err = New(cfg)
+	require.Error(err)
+}
+
+func TestTooFewDescriptors(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	cfg.Logging.File = "authority.log"
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Only a provider uploads a descriptor, so there are no mixes.
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	mixKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	require.NoError(s.injectDescriptor(epoch, &pki.MixDescriptor{
+		Name:    "provider.example.org",
+		LinkKey: linkKey.PublicKey(),
+		MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+		Layer: pki.LayerProvider,
+	}))
+
+	st := s.state
+	st.Lock()
+	st.state = stateAcceptDescriptor
+	st.votingEpoch = epoch
+	st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+	st.Unlock()
+	st.fsm()
+	st.RLock()
+	require.Equal(stateBootstrap, st.state)
+	require.False(st.voted(epoch))
+
+	// Each whitelisted node that has not uploaded a descriptor is named.
+	mix := fmt.Sprintf("%v mix", cfg.Mixes[0].IdentityKey)
+	provider := fmt.Sprintf("%v provider provider.example.org", cfg.Providers[0].IdentityKey)
+	require.ElementsMatch([]string{mix, provider}, st.missingDescriptors(epoch))
+	st.RUnlock()
+
+	b, err := ioutil.ReadFile(filepath.Join(cfg.Authority.DataDir, "authority.log"))
+	require.NoError(err)
+	require.Contains(string(b), "got 0 mixes, need 1")
+	require.Contains(string(b), mix)
+}
+
+func TestClockDrift(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	now, elapsed, _ := epochtime.Now()
+	epoch := now + 1
+	for _, layer := range []uint8{0, pki.LayerProvider} {
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		require.NoError(s.injectDescriptor(epoch, &pki.MixDescriptor{
+			Name:    "node.example.org",
+			LinkKey: linkKey.PublicKey(),
+			MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+			Addresses: map[pki.Transport][]string{
+				pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+			},
+			Layer: layer,
+		}))
+	}
+
+	// The peers all vote for the epoch before the local one, as if the
+	// local clock was an epoch ahead.
+	st := s.state
+	var peers []*eddsa.PrivateKey
+	st.Lock()
+	for i := 0; i < 3; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		peers = append(peers, k)
+		st.authorizedAuthorities[k.PublicKey().ByteArray()] = true
+		st.verifiers = append(st.verifiers, k.PublicKey())
+	}
+	st.Unlock()
+	sendVote := func(k *eddsa.PrivateKey, sender *eddsa.PrivateKey, e uint64) {
+		sr := new(SharedRandom)
+		commit, err := sr.Commit(e)
+		require.NoError(err)
+		payload, err := s11n.SignDocument(k, &s11n.Document{
+			Epoch:              e,
+			Topology:           [][][]byte{{genSignedDescriptor(assert, e, 0)}},
+			Providers:          [][]byte{genSignedDescriptor(assert, e, pki.LayerProvider)},
+			SharedRandomCommit: commit,
+		})
+		require.NoError(err)
+		s.onVote(&commands.Vote{Epoch: e, PublicKey: k.PublicKey(), Payload: payload}, sender.PublicKey())
+	}
+	castVotes := func(e uint64) {
+		for _, k := range peers {
+			sendVote(k, k, e)
+		}
+	}
+	castVotes(epoch - 1)
+
+	// The guard is opt-in.
+	st.Lock()
+	require.NoError(st.checkClockDrift())
+	cfg.Debug.MaxEpochDrift = 1
+	require.Error(st.checkClockDrift())
+
+	// The authority abstains.
+	st.state = stateAcceptDescriptor
+	st.votingEpoch = epoch
+	st.deadlines = phaseDeadlines{mixPublish: elapsed + time.Hour}
+	st.Unlock()
+	st.fsm()
+	st.RLock()
+	require.Equal(stateBootstrap, st.state)
+	require.False(st.voted(epoch))
+	st.RUnlock()
+
+	// In the next round, the peers agree with the local clock.  Neither
+	// a peer relaying the vote of another, nor the same peer claiming
+	// another epoch in the same round, is counted.
+	castVotes(epoch)
+	sendVote(peers[0], peers[1], epoch-1)
+	sendVote(peers[0], peers[0], epoch-1)
+	sendVote(peers[1], peers[1], epoch-1)
+	st.Lock()
+	require.NoError(st.checkClockDrift())
+
+	// Once the peers agree, it votes.
+	st.state = stateAcceptDescriptor
+	st.votingEpoch = epoch
+	st.Unlock()
+	st.fsm()
+	st.RLock()
+	defer st.RUnlock()
+	require.Equal(stateAcceptVote, st.state)
+	require.True(st.voted(epoch))
+}
+
+func TestStartupWarmupAcceptsVotes(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	peer, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	st := s.state
+	st.Lock()
+	st.authorizedAuthorities[peer.PublicKey().ByteArray()] = true
+	st.verifiers = append(st.verifiers, peer.PublicKey())
+	st.Unlock()
+
+	// The authority does not vote while warming up, but it accepts the
+	// votes for the round in progress.
+	st.fsm()
+	st.RLock()
+	require.Equal(stateBootstrap, st.state)
+	epoch := st.votingEpoch
+	require.NotZero(epoch)
+	require.False(st.voted(epoch))
+	st.RUnlock()
+
+	sr := new(SharedRandom)
+	commit, err := sr.Commit(epoch)
+	require.NoError(err)
+	payload, err := s11n.SignDocument(peer, &s11n.Document{
+		Epoch:              epoch,
+		Topology:           [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:          [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomCommit: commit,
+	})
+	require.NoError(err)
+	resp := s.onVote(&commands.Vote{Epoch: epoch, PublicKey: peer.PublicKey(), Payload: payload}, peer.PublicKey())
+	require.Equal(commands.VoteOk, resp.(*commands.VoteStatus).ErrorCode)
+
+	st.RLock()
+	defer st.RUnlock()
+	require.Contains(st.votes[epoch], peer.PublicKey().ByteArray())
+}
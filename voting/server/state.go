@@ -53,6 +53,10 @@ import (
 const (
 	descriptorsBucket     = "descriptors"
 	documentsBucket       = "documents"
+	votesBucket           = "votes"
+	revealsBucket         = "reveals"
+	certificatesBucket    = "certificates"
+	peerKeysBucket        = "peerKeys"
 	stateAcceptDescriptor = "accept_desc"
 	stateAcceptVote       = "accept_vote"
 	stateAcceptReveal     = "accept_reveal"
@@ -60,15 +64,62 @@ const (
 	stateBootstrap        = "bootstrap"
 )
 
+// peerDeadline bounds each exchange with a peer authority.
+const peerDeadline = 60 * time.Second
+
 var (
-	mixPublishDeadline       = epochtime.Period / 2
-	authorityVoteDeadline    = mixPublishDeadline + epochtime.Period/8
-	authorityRevealDeadline  = authorityVoteDeadline + epochtime.Period/8
-	publishConsensusDeadline = authorityRevealDeadline + epochtime.Period/8
-	errGone                  = errors.New("authority: Requested epoch will never get a Document")
-	errNotYet                = errors.New("authority: Document is not ready yet")
+	errGone   = errors.New("authority: Requested epoch will never get a Document")
+	errNotYet = errors.New("authority: Document is not ready yet")
+
+	// epochNow returns the current epoch, the time elapsed since it began
+	// and the time until the next one.  Tests replace it to pin the clock.
+	epochNow = epochtime.Now
 )
 
+// phaseDeadlines is the time elapsed since the start of an epoch at which
+// each phase of the voting round for the next epoch ends.
+type phaseDeadlines struct {
+	mixPublish       time.Duration
+	authorityVote    time.Duration
+	authorityReveal  time.Duration
+	publishConsensus time.Duration
+
+	// skewTolerance is how long after each deadline the state machine
+	// waits before closing the phase, to accommodate peers and nodes with
+	// slightly skewed clocks.
+	skewTolerance time.Duration
+}
+
+// newPhaseDeadlines returns the deadlines of the phases configured in pCfg.
+// Phases left unset last as long as the config defaults them to.
+func newPhaseDeadlines(pCfg *config.Parameters) phaseDeadlines {
+	phase := func(seconds int, fraction time.Duration) time.Duration {
+		if seconds == 0 {
+			return epochtime.Period / fraction
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	var d phaseDeadlines
+	d.mixPublish = phase(pCfg.DescriptorPhase, 2)
+	d.authorityVote = d.mixPublish + phase(pCfg.VotePhase, 8)
+	d.authorityReveal = d.authorityVote + phase(pCfg.RevealPhase, 8)
+	d.publishConsensus = d.authorityReveal + phase(pCfg.SignaturePhase, 8)
+	return d
+}
+
+// until returns the time from elapsed until the phase ending at deadline
+// is closed, including the clock skew tolerance.
+func (d *phaseDeadlines) until(deadline, elapsed time.Duration) time.Duration {
+	return deadline + d.skewTolerance - elapsed
+}
+
+// withinGrace returns how long after deadline elapsed is, and true iff it
+// is past the deadline but within the clock skew tolerance.
+func (d *phaseDeadlines) withinGrace(deadline, elapsed time.Duration) (time.Duration, bool) {
+	late := elapsed - deadline
+	return late, late > 0 && late <= d.skewTolerance
+}
+
 type descriptor struct {
 	desc *pki.MixDescriptor
 	raw  []byte
@@ -76,6 +127,10 @@ type descriptor struct {
 
 type document struct {
 	doc *pki.Document
+
+	// raw is the signed serialized document.  It is computed once per
+	// epoch, and shared by every request that serves the document, so it
+	// MUST NOT be modified.
 	raw []byte
 }
 
@@ -83,33 +138,54 @@ type state struct {
 	sync.RWMutex
 	worker.Worker
 
-	s   *Server
-	log *logging.Logger
+	s         *Server
+	log       *logging.Logger
+	deadlines phaseDeadlines
 
-	db *bolt.DB
+	db      *bolt.DB
+	storage *blobCodec
 
 	authorizedMixes       map[[eddsa.PublicKeySize]byte]bool
 	authorizedProviders   map[[eddsa.PublicKeySize]byte]string
+	mixLayers             map[[eddsa.PublicKeySize]byte]int
 	authorizedAuthorities map[[eddsa.PublicKeySize]byte]bool
 	authorityLinkKeys     map[[eddsa.PublicKeySize]byte]*ecdh.PublicKey
+	authorityNextKeys     map[[eddsa.PublicKeySize]byte][eddsa.PublicKeySize]byte
 
 	documents    map[uint64]*document
 	descriptors  map[uint64]map[[eddsa.PublicKeySize]byte]*descriptor
 	votes        map[uint64]map[[eddsa.PublicKeySize]byte]*document
 	reveals      map[uint64]map[[eddsa.PublicKeySize]byte][]byte
 	certificates map[uint64]map[[eddsa.PublicKeySize]byte][]byte
+	equivocators map[uint64]map[[eddsa.PublicKeySize]byte]bool
+	acks         map[uint64]map[[eddsa.PublicKeySize]byte]map[string]bool
+	atRisk       map[[eddsa.PublicKeySize]byte]uint64
+	observed     map[uint64]string
+	failed       map[uint64]bool
+	flagged      map[uint64][]string
+	epochClaims  map[[eddsa.PublicKeySize]byte]epochClaim
 
 	updateCh chan interface{}
+	watchdog *stallWatchdog
 
+	startTime   time.Time
 	votingEpoch uint64
+	prunedEpoch uint64
 	verifiers   []cert.Verifier
 	threshold   int
 	dissenters  int
 	state       string
+	draining    bool
+
+	phaseStart time.Time
+	roundStart time.Time
 }
 
 func (s *state) Halt() {
 	s.Worker.Halt()
+	if s.watchdog != nil {
+		s.watchdog.Halt()
+	}
 
 	// Gracefully close the persistence store.
 	s.db.Sync()
@@ -140,61 +216,139 @@ func (s *state) worker() {
 func (s *state) fsm() <-chan time.Time {
 	s.Lock()
 	var sleep time.Duration
-	epoch, elapsed, nextEpoch := epochtime.Now()
+	epoch, elapsed, nextEpoch := epochNow()
 	s.log.Debugf("Current epoch %d, remaining time: %s", epoch, nextEpoch)
 
+	prevState := s.state
 	switch s.state {
 	case stateBootstrap:
 		s.backgroundFetchConsensus(epoch - 1)
 		s.backgroundFetchConsensus(epoch)
-		if elapsed > mixPublishDeadline {
+		if warmup := s.warmupRemaining(); warmup > 0 {
+			// Accept the votes of the round in progress, so that they
+			// count if the warmup ends in time to join it.
+			s.log.Debugf("Warming up, not voting for another %s", warmup)
+			s.votingEpoch = epoch + 1
+			sleep = warmup
+			if sleep > nextEpoch {
+				sleep = nextEpoch
+			}
+			break
+		}
+		if s.draining {
+			s.log.Debugf("Draining, not voting until restarted")
+			sleep = nextEpoch
+			break
+		}
+		if s.voted(epoch+1) && elapsed < s.deadlines.publishConsensus {
+			// We voted in this round before restarting, so rejoin it
+			// instead of sitting it out.
+			s.log.Noticef("Resuming the voting round for epoch %d", epoch+1)
+			s.votingEpoch = epoch + 1
+			if elapsed < s.deadlines.authorityReveal {
+				s.state = stateAcceptVote
+				sleep = s.deadlines.until(s.deadlines.authorityVote, elapsed)
+			} else {
+				s.state = stateAcceptReveal
+			}
+			break
+		}
+		if elapsed > s.deadlines.mixPublish {
 			s.log.Debugf("Too late to vote this round, sleeping until %s", nextEpoch)
 			sleep = nextEpoch
 			s.votingEpoch = epoch + 2
 			s.state = stateBootstrap
 		} else {
 			s.votingEpoch = epoch + 1
-			sleep = mixPublishDeadline - elapsed
+			sleep = s.deadlines.until(s.deadlines.mixPublish, elapsed)
 			s.state = stateAcceptDescriptor
 		}
 		s.log.Debugf("Bootstrapping for %d", s.votingEpoch)
 	case stateAcceptDescriptor:
+		s.checkNodesAtRisk(s.votingEpoch)
+		if s.draining && !s.voted(s.votingEpoch) {
+			s.log.Noticef("Draining, not voting for epoch %d", s.votingEpoch)
+			sleep = nextEpoch
+			s.votingEpoch = epoch + 2
+			s.state = stateBootstrap
+			break
+		}
+		if s.s.cfg.Debug.ObserverMode {
+			// Observers tally the votes of the other authorities, whatever
+			// descriptors were uploaded here.
+			s.log.Debugf("Observing the vote for epoch %v", s.votingEpoch)
+			s.state = stateAcceptVote
+			sleep = s.deadlines.until(s.deadlines.authorityVote, elapsed)
+			break
+		}
+		if err := s.checkClockDrift(); err != nil {
+			s.log.Criticalf("Not voting for epoch %d, the local clock is presumably wrong: %v", s.votingEpoch, err)
+			sleep = nextEpoch
+			s.votingEpoch = epoch + 2
+			s.state = stateBootstrap
+			break
+		}
+		if s.isEmptyNetwork() {
+			s.log.Errorf("Not voting for epoch %d because no Mixes or Providers are whitelisted!", s.votingEpoch)
+			sleep = nextEpoch
+			s.votingEpoch = epoch + 2
+			s.state = stateBootstrap
+			break
+		}
 		if !s.hasEnoughDescriptors(s.descriptors[s.votingEpoch]) {
-			s.log.Debugf("Not voting because insufficient descriptors uploaded for epoch %d!", s.votingEpoch)
+			s.log.Errorf("Not voting because insufficient descriptors uploaded for epoch %d: %v", s.votingEpoch, s.descriptorShortfall(s.descriptors[s.votingEpoch]))
+			if missing := s.missingDescriptors(s.votingEpoch); len(missing) > 0 {
+				s.log.Errorf("Whitelisted nodes without a descriptor for epoch %d: %v", s.votingEpoch, strings.Join(missing, ", "))
+			}
 			sleep = nextEpoch
 			s.votingEpoch = epoch + 2 // wait until next epoch begins and bootstrap
 			s.state = stateBootstrap
 			break
 		}
+		if missing := missingServices(s.s.cfg.Parameters.RequiredServices, s.descriptors[s.votingEpoch]); len(missing) > 0 {
+			s.log.Errorf("No Provider offers required services %v for epoch %d!", missing, s.votingEpoch)
+			s.flagged[s.votingEpoch] = missing
+			if s.s.cfg.Debug.MissingServicePolicy == config.MissingServiceWithhold {
+				s.log.Errorf("Not voting for epoch %d due to missing services.", s.votingEpoch)
+				sleep = nextEpoch
+				s.votingEpoch = epoch + 2
+				s.state = stateBootstrap
+				break
+			}
+		}
 		if !s.voted(s.votingEpoch) {
 			s.log.Debugf("Voting for epoch %v", s.votingEpoch)
 			s.vote(s.votingEpoch)
 			s.state = stateAcceptVote
-			sleep = authorityVoteDeadline - elapsed
+			sleep = s.deadlines.until(s.deadlines.authorityVote, elapsed)
 		}
 	case stateAcceptVote:
 		s.reveal(s.votingEpoch)
 		s.state = stateAcceptReveal
-		sleep = authorityRevealDeadline - elapsed
+		sleep = s.deadlines.until(s.deadlines.authorityReveal, elapsed)
 	case stateAcceptReveal:
 		// we have collect all of the reveal values
 		// now we compute the shared random value
 		// and produce a consensus from votes
-		if !s.isTabulated(s.votingEpoch) {
+		if s.s.cfg.Debug.ObserverMode {
+			s.observe(s.votingEpoch)
+		} else if !s.isTabulated(s.votingEpoch) {
 			s.log.Debugf("Tabulating for epoch %v", s.votingEpoch)
 			s.tabulate(s.votingEpoch)
 		}
 		s.state = stateAcceptSignature
-		sleep = publishConsensusDeadline - elapsed
+		sleep = s.deadlines.until(s.deadlines.publishConsensus, elapsed)
 	case stateAcceptSignature:
 		s.log.Debugf("Combining signatures for epoch %v", s.votingEpoch)
-		s.consense(s.votingEpoch)
+		err := s.consense(s.votingEpoch)
 		if _, ok := s.documents[s.votingEpoch]; ok {
 			s.state = stateAcceptDescriptor
-			sleep = mixPublishDeadline + nextEpoch
+			sleep = nextEpoch + s.deadlines.until(s.deadlines.mixPublish, 0)
 			s.votingEpoch++
 		} else {
 			// failed to make consensus. try to join next round.
+			s.s.emitEvent(&ConsensusFailedEvent{Epoch: s.votingEpoch, Reason: err.Error()})
+			s.failed[s.votingEpoch] = true
 			s.state = stateBootstrap
 			s.votingEpoch = epoch + 2 // vote on epoch+2 in epoch+1
 			sleep = nextEpoch
@@ -202,12 +356,87 @@ func (s *state) fsm() <-chan time.Time {
 	default:
 	}
 	s.pruneDocuments()
+	s.recordTransition(prevState, time.Now())
+	if s.state == stateAcceptDescriptor && prevState != stateAcceptDescriptor {
+		s.s.emitEvent(&RoundStartedEvent{Epoch: s.votingEpoch})
+	}
+	s.updateRoundMetrics()
 	s.log.Debugf("authority: FSM in state %v until %s", s.state, sleep)
+	if s.watchdog != nil {
+		s.watchdog.progress(s.state, s.votingEpoch, time.Now().Add(sleep))
+	}
 	s.Unlock()
 	return time.After(sleep)
 }
 
-func (s *state) consense(epoch uint64) {
+// updateRoundMetrics samples the progress of the current voting round.
+func (s *state) updateRoundMetrics() {
+	// Lock is held.
+	m := s.s.metrics
+	m.set(MetricVotingEpoch, float64(s.votingEpoch))
+	m.set(MetricVotingState, votingStateValues[s.state])
+	m.set(MetricVotesReceived, float64(len(s.votes[s.votingEpoch])))
+	m.set(MetricRevealsReceived, float64(len(s.reveals[s.votingEpoch])))
+	m.set(MetricSignaturesCollected, float64(len(s.certificates[s.votingEpoch])))
+}
+
+// recordTransition records how long the state machine spent in the state
+// from, and if it completed a round, how long the round took.
+func (s *state) recordTransition(from string, now time.Time) {
+	// Lock is held.
+	if s.state == from {
+		return
+	}
+	m := s.s.metrics
+	if !s.phaseStart.IsZero() {
+		m.observe(MetricPhaseDurationSeconds, from, now.Sub(s.phaseStart).Seconds())
+	}
+	s.phaseStart = now
+
+	// A round that was resumed after a restart has no known start, and one
+	// that was abandoned before the signature phase never completes, neither
+	// is recorded.
+	if from == stateAcceptSignature && !s.roundStart.IsZero() {
+		m.observe(MetricRoundDurationSeconds, "", now.Sub(s.roundStart).Seconds())
+	}
+	switch s.state {
+	case stateAcceptDescriptor:
+		s.roundStart = now
+	case stateBootstrap:
+		s.roundStart = time.Time{}
+	}
+}
+
+// checkSkewGrace logs what, received for the voting round for epoch, if it
+// arrived after the deadline of its phase, but was accepted within the
+// clock skew tolerance.
+func (s *state) checkSkewGrace(what string, epoch uint64, deadline time.Duration) {
+	// Lock is held.
+	now, elapsed, _ := epochNow()
+	if epoch != now+1 {
+		return
+	}
+	if late, ok := s.deadlines.withinGrace(deadline, elapsed); ok {
+		s.log.Noticef("%s for epoch %v is %v late, accepted within the clock skew tolerance.", what, epoch, late)
+	}
+}
+
+func (s *state) onStall(state string, epoch uint64, deadline time.Time) {
+	// Called from the watchdog, the lock may be held by the stalled FSM.
+	s.log.Criticalf("Voting for epoch %v is stalled in state %v, overdue since %v!", epoch, state, deadline)
+	s.s.metrics.add(MetricRoundStallsTotal, 1)
+	s.s.emitEvent(&RoundStalledEvent{
+		State:    state,
+		Epoch:    epoch,
+		Deadline: deadline,
+	})
+}
+
+func (s *state) warmupRemaining() time.Duration {
+	return s.s.cfg.Debug.StartupWarmup - time.Since(s.startTime)
+}
+
+func (s *state) consense(epoch uint64) error {
 	// if we have a document, see if the other signatures make a consensus
 	// if we do not make a consensus with our document iterate over the
 	// other documents and see if the signatures make a consensus
@@ -215,18 +444,26 @@ func (s *state) consense(epoch uint64) {
 	certificates, ok := s.certificates[epoch]
 	if !ok {
 		s.log.Errorf("No certificates for epoch %d", epoch)
-		return
+		return fmt.Errorf("no certificates for epoch %d", epoch)
 	}
 
 	for pk, c := range certificates {
+		// A certificate that carries signatures by anyone but the
+		// authority is only used for the signatures it merges.
+		if sigs, err := cert.GetSignatures(c); err != nil || len(s.peerSignatures(pk, c)) != len(sigs) {
+			s.log.Debugf("Not using the certificate from %x for epoch %d, it has foreign signatures", pk, epoch)
+			continue
+		}
 		for jk, d := range certificates {
 			if pk == jk {
 				continue // skip adding own signature
 			}
-			kjk := new(eddsa.PublicKey)
-			kjk.FromBytes(jk[:])
-			if ds, err := cert.GetSignature(jk[:], d); err == nil {
-				if sc, err := cert.AddSignature(kjk, *ds, c); err == nil {
+			for _, ds := range s.peerSignatures(jk, d) {
+				v := new(eddsa.PublicKey)
+				if err := v.FromBytes(ds.Identity); err != nil {
+					continue
+				}
+				if sc, err := cert.AddSignature(v, ds, c); err == nil {
 					c = sc
 				}
 			}
@@ -234,17 +471,127 @@ func (s *state) consense(epoch uint64) {
 		if _, good, _, err := cert.VerifyThreshold(s.verifiers, s.threshold, c); err == nil {
 			if pDoc, err := s11n.VerifyAndParseDocument(c, good[0]); err == nil {
 				s.documents[epoch] = &document{doc: pDoc, raw: c}
+				s.persistDocument(epoch, c)
 				s.log.Noticef("Consensus made for epoch %d with %d/%d signatures", epoch, len(good), len(s.verifiers))
+				s.checkNodesDropped(epoch)
+				if raw, err := cert.GetCertified(c); err == nil {
+					h := sha256b64(raw)
+					s.s.metrics.addWithExemplar(MetricConsensusReachedTotal, 1, epoch, h)
+					s.s.emitEvent(&ConsensusReachedEvent{Epoch: epoch, DocumentHash: h})
+					s.checkObserved(epoch, raw)
+				}
 				for _, g := range good {
 					id := base64.StdEncoding.EncodeToString(g.Identity())
 					s.log.Noticef("Consensus signed by %s", id)
 				}
-				return
+				return nil
 			}
 		}
 	}
 	s.log.Errorf("No consensus found for epoch %d", epoch)
-	return
+	return fmt.Errorf("no threshold of signatures on a document for epoch %d, got %d certificates", epoch, len(certificates))
+}
+
+// peerSignatures returns the signatures from the certificate c of the
+// authority with the identity key pk that are merged into the consensus: its
+// own, and during an identity key rotation the one made with the
+// NextIdentityPublicKey it is configured with.
+func (s *state) peerSignatures(pk [eddsa.PublicKeySize]byte, c []byte) []cert.Signature {
+	sigs, err := cert.GetSignatures(c)
+	if err != nil {
+		return nil
+	}
+	next, hasNext := s.authorityNextKeys[pk]
+	var ret []cert.Signature
+	for _, sig := range sigs {
+		switch {
+		case bytes.Equal(sig.Identity, pk[:]):
+			ret = append(ret, sig)
+		case hasNext && bytes.Equal(sig.Identity, next[:]):
+			ret = append(ret, sig)
+		}
+	}
+	return ret
+}
+
+func (s *state) isVerifier(id []byte) bool {
+	for _, v := range s.verifiers {
+		if bytes.Equal(v.Identity(), id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *state) checkNodesAtRisk(epoch uint64) {
+	// Lock is held (called from the FSM).
+	prev, ok := s.documents[epoch-1]
+	if !ok {
+		return
+	}
+	present := make(map[[eddsa.PublicKeySize]byte]bool)
+	for pk := range s.descriptors[epoch] {
+		present[pk] = true
+	}
+
+	atRisk := absentNodes(documentNodes(prev.doc), present)
+	for _, pk := range atRisk {
+		if s.atRisk[pk] == epoch {
+			continue // Already reported.
+		}
+		s.atRisk[pk] = epoch
+		id := new(eddsa.PublicKey)
+		id.FromBytes(pk[:])
+		s.log.Warningf("Node %v: No descriptor for epoch %v, will be dropped from the consensus.", id, epoch)
+		s.s.emitEvent(&NodeAtRiskEvent{Epoch: epoch, IdentityKey: id})
+	}
+	s.s.metrics.set(MetricNodesAtRisk, float64(len(atRisk)))
+}
+
+func (s *state) checkNodesDropped(epoch uint64) {
+	// Lock is held (called from the FSM).
+	prev, ok := s.documents[epoch-1]
+	if !ok {
+		return
+	}
+	cur := s.documents[epoch]
+
+	dropped := absentNodes(documentNodes(prev.doc), documentNodes(cur.doc))
+	for _, pk := range dropped {
+		id := new(eddsa.PublicKey)
+		id.FromBytes(pk[:])
+		s.log.Warningf("Node %v: Dropped from the consensus for epoch %v.", id, epoch)
+		s.s.emitEvent(&NodeDroppedEvent{Epoch: epoch, IdentityKey: id})
+	}
+	s.s.metrics.add(MetricNodesDroppedTotal, float64(len(dropped)))
+}
+
+// documentNodes returns the set of the identity keys of all the nodes
+// listed in a document.
+func documentNodes(doc *pki.Document) map[[eddsa.PublicKeySize]byte]bool {
+	nodes := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, l := range doc.Topology {
+		for _, desc := range l {
+			nodes[desc.IdentityKey.ByteArray()] = true
+		}
+	}
+	for _, desc := range doc.Providers {
+		nodes[desc.IdentityKey.ByteArray()] = true
+	}
+	return nodes
+}
+
+// absentNodes returns the sorted identity keys of the nodes that are in
+// prev but not in cur.
+func absentNodes(prev, cur map[[eddsa.PublicKeySize]byte]bool) [][eddsa.PublicKeySize]byte {
+	var absent [][eddsa.PublicKeySize]byte
+	for pk := range prev {
+		if !cur[pk] {
+			absent = append(absent, pk)
+		}
+	}
+	sort.Slice(absent, func(i, j int) bool { return bytes.Compare(absent[i][:], absent[j][:]) < 0 })
+	return absent
 }
 
 func (s *state) identityPubKey() [eddsa.PublicKeySize]byte {
@@ -260,13 +607,78 @@ func (s *state) voted(epoch uint64) bool {
 	return false
 }
 
+func (s *state) ownVote(epoch uint64) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	v, ok := s.votes[epoch][s.identityPubKey()]
+	if !ok {
+		return nil, ErrNoVote
+	}
+	raw := make([]byte, len(v.raw))
+	copy(raw, v.raw)
+	return raw, nil
+}
+
+// signedVotes returns a copy of every signed vote for the epoch, keyed by
+// the identity key of the authority that cast it, including this one.
+func (s *state) signedVotes(epoch uint64) (map[[eddsa.PublicKeySize]byte][]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if len(s.votes[epoch]) == 0 {
+		return nil, ErrNoVote
+	}
+	votes := make(map[[eddsa.PublicKeySize]byte][]byte, len(s.votes[epoch]))
+	for pk, v := range s.votes[epoch] {
+		raw := make([]byte, len(v.raw))
+		copy(raw, v.raw)
+		votes[pk] = raw
+	}
+	return votes, nil
+}
+
+// signedDescriptors returns a copy of every persisted descriptor for the
+// epoch, sorted by identity key.
+func (s *state) signedDescriptors(epoch uint64) ([][]byte, error) {
+	now, _, _ := epochNow()
+	if epoch < now-uint64(s.s.cfg.Parameters.DocumentRetentionEpochs) {
+		return nil, ErrDescriptorsNotRetained
+	}
+
+	descs := [][]byte{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		eBkt := tx.Bucket([]byte(descriptorsBucket)).Bucket(epochToBytes(epoch))
+		if eBkt == nil {
+			return nil
+		}
+		return eBkt.ForEach(func(pk, blob []byte) error {
+			rawDesc, err := s.storage.open(blob)
+			if err != nil {
+				return err
+			}
+			raw := make([]byte, len(rawDesc))
+			copy(raw, rawDesc)
+			descs = append(descs, raw)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return descs, nil
+}
+
 func (s *state) getDocument(descriptors []*descriptor, params *config.Parameters, srv []byte) *s11n.Document {
-	// Carve out the descriptors between providers and nodes.
+	// Carve out the descriptors between providers and nodes, and set aside
+	// the nodes that are pinned to a layer.
 	var providers [][]byte
-	var nodes []*descriptor
+	var nodes, pinned []*descriptor
 	for _, v := range descriptors {
 		if v.desc.Layer == pki.LayerProvider {
 			providers = append(providers, v.raw)
+		} else if _, ok := s.mixLayers[v.desc.IdentityKey.ByteArray()]; ok {
+			pinned = append(pinned, v)
 		} else {
 			nodes = append(nodes, v)
 		}
@@ -274,6 +686,12 @@ func (s *state) getDocument(descriptors []*descriptor, params *config.Parameters
 
 	// Assign nodes to layers.
 	var topology [][][]byte
+	if b := s.s.cfg.TopologyBuilder; b != nil {
+		var err error
+		if topology, err = buildTopology(b, nodes, params.Layers, params); err != nil {
+			s.log.Errorf("TopologyBuilder failed, falling back to the default topology: %v", err)
+		}
+	}
 	// XXX: should a bootstrapping authority fetch prior consensus' Topology from another authority?
 
 	// TODO: We could re-use a prior topology for a configurable number of epochs
@@ -281,14 +699,25 @@ func (s *state) getDocument(descriptors []*descriptor, params *config.Parameters
 	// We prefer to not randomize the topology if there is an existing topology to avoid
 	// partitioning the client anonymity set when messages from an earlier epoch are
 	// differentiable as such because of topology violations in the present epoch.
-	if d, ok := s.documents[s.votingEpoch-1]; ok {
-		topology = s.generateTopology(nodes, d.doc, srv)
-	} else {
-		// XXX: ask another authority for a consensus
-		// (this might be better placed at bootstrap)
-		// Or, this authority will vote with a random
-		// topology and never reach consenus with the other authorities
-		topology = s.generateRandomTopology(nodes, srv)
+	if topology == nil {
+		if d, ok := s.documents[s.votingEpoch-1]; ok {
+			topology = s.generateTopology(nodes, d.doc, srv, params.Layers)
+		} else {
+			// XXX: ask another authority for a consensus
+			// (this might be better placed at bootstrap)
+			// Or, this authority will vote with a random
+			// topology and never reach consenus with the other authorities
+			topology = s.generateRandomTopology(nodes, srv, params.Layers)
+		}
+	}
+	sortNodesByPublicKey(pinned)
+	for _, v := range pinned {
+		layer := s.mixLayers[v.desc.IdentityKey.ByteArray()]
+		if layer >= len(topology) {
+			s.log.Errorf("Node %v: Pinned to layer %v, out of %v Layers", v.desc.IdentityKey, layer, len(topology))
+			continue
+		}
+		topology[layer] = append(topology[layer], v.raw)
 	}
 
 	// Build the Document.
@@ -308,10 +737,28 @@ func (s *state) getDocument(descriptors []*descriptor, params *config.Parameters
 		Topology:          topology,
 		Providers:         providers,
 		SharedRandomValue: srv,
+
+		SphinxGeometryVersion: uint64(params.SphinxGeometryVersion),
+		SphinxGeometry:        sphinxGeometry(params),
+	}
+	if params.ChainDocuments {
+		doc.PriorDocumentHash = s.priorDocumentHash(s.votingEpoch)
 	}
 	return doc
 }
 
+// priorDocumentHash returns the DocumentHash of the consensus for the epoch
+// before epoch, or nil if there is none to chain to.
+func (s *state) priorDocumentHash(epoch uint64) []byte {
+	if d, ok := s.documents[epoch-1]; ok {
+		if h, err := s11n.DocumentHash(d.raw); err == nil {
+			return h
+		}
+		s.log.Errorf("Failed to hash the consensus for epoch %v", epoch-1)
+	}
+	return nil
+}
+
 // SharedRandom is a container for commit-and-reveal protocol messages
 type SharedRandom struct {
 	epoch  uint64
@@ -375,19 +822,23 @@ func (s *SharedRandom) Reveal() []byte {
 func (s *state) reveal(epoch uint64) {
 	if reveal, ok := s.reveals[epoch][s.identityPubKey()]; ok {
 		// Reveals are only valid until the end of voting round
-		_, _, till := epochtime.Now()
+		_, _, till := epochNow()
 		revealExpiration := time.Now().Add(till).Unix()
 		signed, err := cert.Sign(s.s.identityKey, reveal, revealExpiration)
 		if err != nil {
 			s.s.fatalErrCh <- err
 		}
-		go s.sendRevealToAuthorities(signed, epoch)
+		go s.sendRevealToAuthorities(signed, epoch, phaseDeadline(s.deadlines.authorityReveal))
 	}
 }
 
 func (s *state) vote(epoch uint64) {
 	descriptors := []*descriptor{}
 	for _, desc := range s.descriptors[epoch] {
+		if isBlacklisted(s.s.cfg.Blacklist, desc.desc.IdentityKey, epoch) {
+			s.log.Noticef("Node %v: Excluded from the vote for epoch %v, blacklisted", desc.desc.IdentityKey, epoch)
+			continue
+		}
 		descriptors = append(descriptors, desc)
 	}
 	srv := new(SharedRandom)
@@ -402,7 +853,6 @@ func (s *state) vote(epoch uint64) {
 	}
 	if _, ok := s.reveals[epoch][s.identityPubKey()]; !ok {
 		s.reveals[epoch][s.identityPubKey()] = srv.Reveal()
-		// XXX persist reveals to database?
 	} else {
 		s.log.Errorf("failure: reveal already present, this should never happen.")
 		err := errors.New("failure: reveal already present, this should never happen")
@@ -412,8 +862,10 @@ func (s *state) vote(epoch uint64) {
 
 	// vote topology is irrelevent.
 	var zeros [32]byte
-	vote := s.getDocument(descriptors, s.s.cfg.Parameters, zeros[:])
+	vote := s.getDocument(descriptors, s.s.cfg.ParametersAt(epoch), zeros[:])
 	vote.SharedRandomCommit = commit
+	vote.Blacklist = blacklistVote(s.s.cfg.Blacklist, epoch)
+	vote.Authorities = authoritiesVote(s.s.cfg, s.s.IdentityKey(), s.s.linkKey.PublicKey())
 	signedVote := s.sign(vote)
 	if signedVote == nil {
 		err := errors.New("failure: signing vote failed")
@@ -427,14 +879,28 @@ func (s *state) vote(epoch uint64) {
 	}
 	if _, ok := s.votes[epoch][s.identityPubKey()]; !ok {
 		s.votes[epoch][s.identityPubKey()] = signedVote
-		// XXX persist votes to database?
 	} else {
 		s.log.Errorf("failure: vote already present, this should never happen.")
 		err := errors.New("failure: vote already present, this should never happen")
 		s.s.fatalErrCh <- err
 		return
 	}
-	s.sendVoteToAuthorities(signedVote.raw, epoch)
+
+	// Persist the vote and reveal before either leaves this node, so that a
+	// restart can not result in casting a conflicting vote.
+	pk := s.identityPubKey()
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.putRoundBlob(tx, revealsBucket, epoch, pk, srv.Reveal()); err != nil {
+			return err
+		}
+		return s.putRoundBlob(tx, votesBucket, epoch, pk, signedVote.raw)
+	}); err != nil {
+		// Persistence failures are FATAL.
+		s.s.fatalErrCh <- err
+		return
+	}
+	s.sendVoteToAuthorities(signedVote.raw, epoch, sentVote, phaseDeadline(s.deadlines.authorityVote))
+	s.s.emitEvent(&VoteCastEvent{Epoch: epoch})
 }
 
 func (s *state) sign(doc *s11n.Document) *document {
@@ -461,10 +927,14 @@ func (s *state) sign(doc *s11n.Document) *document {
 	}
 }
 
+func (s *state) isEmptyNetwork() bool {
+	return len(s.authorizedMixes) == 0 && len(s.authorizedProviders) == 0
+}
+
 func (s *state) hasEnoughDescriptors(m map[[eddsa.PublicKeySize]byte]*descriptor) bool {
 	// A Document will be generated iff there are at least:
 	//
-	//  * Debug.Layers * Debug.MinNodesPerLayer nodes.
+	//  * Parameters.Layers * Debug.MinNodesPerLayer nodes.
 	//  * One provider.
 	//
 	// Otherwise, it's pointless to generate a unusable document.
@@ -476,25 +946,90 @@ func (s *state) hasEnoughDescriptors(m map[[eddsa.PublicKeySize]byte]*descriptor
 	}
 	nrNodes := len(m) - nrProviders
 
-	minNodes := s.s.cfg.Debug.Layers * s.s.cfg.Debug.MinNodesPerLayer
+	minNodes := s.s.cfg.Parameters.Layers * s.s.cfg.Debug.MinNodesPerLayer
 	return nrProviders > 0 && nrNodes >= minNodes
 }
 
-func (s *state) sendRevealToPeer(peer *config.AuthorityPeer, reveal []byte, epoch uint64) error {
-	var conn net.Conn
-	var err error
-	for i, a := range peer.Addresses {
-		conn, err = net.Dial("tcp", a)
-		if err == nil {
-			break
+// descriptorShortfall describes the descriptors in m against the ones
+// required by hasEnoughDescriptors.
+func (s *state) descriptorShortfall(m map[[eddsa.PublicKeySize]byte]*descriptor) string {
+	nrProviders := 0
+	for _, v := range m {
+		if v.desc.Layer == pki.LayerProvider {
+			nrProviders++
 		}
-		if i == len(peer.Addresses)-1 {
-			return err
+	}
+	layers, perLayer := s.s.cfg.Parameters.Layers, s.s.cfg.Debug.MinNodesPerLayer
+	return fmt.Sprintf("got %v mixes, need %v (%v per layer for %v layers), got %v providers, need 1",
+		len(m)-nrProviders, layers*perLayer, perLayer, layers, nrProviders)
+}
+
+// missingDescriptors returns a line for each of the whitelisted nodes that
+// has not uploaded a descriptor for the epoch, with its identity key, and
+// whether it is a mix or a provider, followed by the provider's name.  The
+// lines are sorted.
+func (s *state) missingDescriptors(epoch uint64) []string {
+	// Lock is held.
+	var missing []string
+	add := func(id [eddsa.PublicKeySize]byte, what string) {
+		if _, ok := s.descriptors[epoch][id]; ok {
+			return
+		}
+		pk := new(eddsa.PublicKey)
+		if err := pk.FromBytes(id[:]); err != nil {
+			return
+		}
+		missing = append(missing, fmt.Sprintf("%v %v", pk, what))
+	}
+	for id := range s.authorizedMixes {
+		add(id, "mix")
+	}
+	for id, name := range s.authorizedProviders {
+		add(id, "provider "+name)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// missingServices returns the sorted list of required services that are not
+// offered by any of the Providers in m.
+func missingServices(required []string, m map[[eddsa.PublicKeySize]byte]*descriptor) []string {
+	var missing []string
+	for _, svc := range required {
+		found := false
+		for _, v := range m {
+			if v.desc.Layer != pki.LayerProvider {
+				continue
+			}
+			if _, ok := v.desc.Kaetzchen[svc]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, svc)
 		}
 	}
-	defer conn.Close()
+	sort.Strings(missing)
+	return missing
+}
+
+func (s *state) sendRevealToPeer(peer *config.AuthorityPeer, reveal []byte, epoch uint64) error {
+	conn, err := s.s.dialPeer(peer)
+	if err != nil {
+		return err
+	}
+	s.s.connOpened()
+	defer func() {
+		conn.Close()
+		s.s.connClosed()
+	}()
 	s.s.Add(1)
 	defer s.s.Done()
+
+	// Bound the whole exchange, so that an unresponsive peer can't pin
+	// this goroutine past the round.
+	conn.SetDeadline(time.Now().Add(peerDeadline))
 	cfg := &wire.SessionConfig{
 		Authenticator:     s,
 		AdditionalData:    s.s.identityKey.PublicKey().Bytes(),
@@ -531,35 +1066,36 @@ func (s *state) sendRevealToPeer(peer *config.AuthorityPeer, reveal []byte, epoc
 	case commands.RevealOk:
 		return nil
 	case commands.RevealTooLate:
-		return errors.New("reveal was too late")
+		return &peerRejectedError{"reveal was too late"}
 	case commands.RevealTooEarly:
-		return errors.New("reveal was too early")
+		return &peerRejectedError{"reveal was too early"}
 	case commands.RevealAlreadyReceived:
-		return errors.New("reveal already received by authority")
+		return &peerRejectedError{"reveal already received by authority"}
 	case commands.RevealNotAuthorized:
-		return errors.New("reveal rejected by authority: Not Authorized")
+		return &peerRejectedError{"reveal rejected by authority: Not Authorized"}
 	default:
-		return fmt.Errorf("reveal rejected by authority: unknown error code received")
+		return &peerRejectedError{"reveal rejected by authority: unknown error code received"}
 	}
 	return nil
 
 }
 func (s *state) sendVoteToPeer(peer *config.AuthorityPeer, vote []byte, epoch uint64) error {
 	// get a connector here
-	var conn net.Conn
-	var err error
-	for i, a := range peer.Addresses {
-		conn, err = net.Dial("tcp", a)
-		if err == nil {
-			break
-		}
-		if i == len(peer.Addresses)-1 {
-			return err
-		}
+	conn, err := s.s.dialPeer(peer)
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
+	s.s.connOpened()
+	defer func() {
+		conn.Close()
+		s.s.connClosed()
+	}()
 	s.s.Add(1)
 	defer s.s.Done()
+
+	// Bound the whole exchange, so that an unresponsive peer can't pin
+	// this goroutine past the round.
+	conn.SetDeadline(time.Now().Add(peerDeadline))
 	cfg := &wire.SessionConfig{
 		Authenticator:     s,
 		AdditionalData:    s.s.identityKey.PublicKey().Bytes(),
@@ -595,12 +1131,18 @@ func (s *state) sendVoteToPeer(peer *config.AuthorityPeer, vote []byte, epoch ui
 	switch r.ErrorCode {
 	case commands.VoteOk:
 		return nil
+	case commands.VoteAlreadyReceived:
+		// The peer has it, as when the acknowledgement of an earlier
+		// attempt was lost.
+		return nil
 	case commands.VoteTooLate:
-		return errors.New("vote was too late")
+		return &peerRejectedError{"vote was too late"}
 	case commands.VoteTooEarly:
-		return errors.New("vote was too early")
+		return &peerRejectedError{"vote was too early"}
+	case commands.VoteMalformed:
+		return &peerRejectedError{"vote was malformed"}
 	default:
-		return fmt.Errorf("vote rejected by authority: unknown error code received")
+		return &peerRejectedError{"vote rejected by authority: unknown error code received"}
 	}
 	return nil
 }
@@ -611,33 +1153,198 @@ func (s *state) sendVoteToPeer(peer *config.AuthorityPeer, vote []byte, epoch ui
 func (s *state) IsPeerValid(creds *wire.PeerCredentials) bool {
 	var ad [eddsa.PublicKeySize]byte
 	copy(ad[:], creds.AdditionalData)
+	s.RLock()
 	_, ok := s.authorizedAuthorities[ad]
+	s.RUnlock()
 	if ok {
-		return true
+		return s.checkPeerLinkKey(ad, creds.PublicKey) || !s.s.cfg.Debug.StrictPeerKeys
 	}
 	return false
 }
 
 // sendRevealToAuthorities sends a Shared Random Reveal command to
-// all Directory Authorities
-func (s *state) sendRevealToAuthorities(reveal []byte, epoch uint64) {
+// all Directory Authorities, retrying until the deadline.
+func (s *state) sendRevealToAuthorities(reveal []byte, epoch uint64, deadline time.Time) {
 	s.log.Noticef("Sending Shared Random Reveal for epoch %v, to all Directory Authorities.", epoch)
 
 	for _, peer := range s.s.cfg.Authorities {
-		go s.sendRevealToPeer(peer, reveal, epoch)
+		go func(peer *config.AuthorityPeer) {
+			if err := s.retryPeer(peer, deadline, func() error {
+				return s.sendRevealToPeer(peer, reveal, epoch)
+			}); err != nil {
+				s.log.Warningf("Failed to send Reveal for epoch %v to %v: %v", epoch, peer.IdentityPublicKey, err)
+			}
+		}(peer)
 	}
-
 }
 
-// sendVoteToAuthorities sends s.descriptors[epoch] to
-// all Directory Authorities
-func (s *state) sendVoteToAuthorities(vote []byte, epoch uint64) {
+// sendVoteToAuthorities sends the vote or signature, per what, to all
+// Directory Authorities, retrying each until it acknowledges receipt or the
+// deadline, and then logs which of them did.
+func (s *state) sendVoteToAuthorities(vote []byte, epoch uint64, what string, deadline time.Time) {
 	// Lock is held (called from the onWakeup hook).
 
-	s.log.Noticef("Sending Document for epoch %v, to all Directory Authorities.", s.votingEpoch)
+	s.log.Noticef("Sending %v for epoch %v, to all Directory Authorities.", what, epoch)
 
+	var wg sync.WaitGroup
 	for _, peer := range s.s.cfg.Authorities {
-		go s.sendVoteToPeer(peer, vote, epoch)
+		wg.Add(1)
+		go func(peer *config.AuthorityPeer) {
+			defer wg.Done()
+			if err := s.retryPeer(peer, deadline, func() error {
+				return s.sendVoteToPeer(peer, vote, epoch)
+			}); err != nil {
+				s.log.Warningf("Failed to send %v for epoch %v to %v: %v", what, epoch, peer.IdentityPublicKey, err)
+				return
+			}
+			s.recordAck(epoch, peer.IdentityPublicKey.ByteArray(), what)
+		}(peer)
+	}
+	go func() {
+		wg.Wait()
+		s.logAcks(epoch, what)
+	}()
+}
+
+// peerRejectedError is the error returned when a peer authority rejects a
+// command, which is never retried.
+type peerRejectedError struct {
+	msg string
+}
+
+func (e *peerRejectedError) Error() string {
+	return e.msg
+}
+
+// phaseDeadline returns the time at which the phase of the current epoch
+// that ends at d elapsed ends.
+func phaseDeadline(d time.Duration) time.Time {
+	_, elapsed, _ := epochNow()
+	return time.Now().Add(d - elapsed)
+}
+
+// retryPeer calls fn until it succeeds or is rejected by the peer, retrying
+// with exponential backoff and jitter, for up to Debug.PeerDialMaxRetries
+// times as long as the retry would be before the deadline.
+func (s *state) retryPeer(peer *config.AuthorityPeer, deadline time.Time, fn func() error) error {
+	base := time.Duration(s.s.cfg.Debug.PeerDialBaseDelay) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*peerRejectedError); ok || attempt >= s.s.cfg.Debug.PeerDialMaxRetries {
+			return err
+		}
+		delay := peerRetryDelay(base, attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		s.log.Debugf("Peer %v: %v, retrying in %v", peer.IdentityPublicKey, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-s.HaltCh():
+			return err
+		}
+	}
+}
+
+// peerRetryDelay returns the delay before the retry following attempt,
+// which is between half and all of base doubled for each prior attempt,
+// capped at peerDeadline.
+func peerRetryDelay(base time.Duration, attempt int) time.Duration {
+	d := peerDeadline
+	if attempt < 16 && base<<uint(attempt) < d {
+		d = base << uint(attempt)
+	}
+	if d < 2 {
+		return d
+	}
+	return d/2 + time.Duration(rand.NewMath().Int63n(int64(d/2)))
+}
+
+// voteParameters returns the parameters carried in a vote.  A vote only
+// carries ChainDocuments if there is a prior document to chain to.
+func voteParameters(vote *s11n.Document) *config.Parameters {
+	params := &config.Parameters{
+		SendRatePerMinute: vote.SendRatePerMinute,
+		Mu:                vote.Mu,
+		MuMaxDelay:        vote.MuMaxDelay,
+		LambdaP:           vote.LambdaP,
+		LambdaPMaxDelay:   vote.LambdaPMaxDelay,
+		LambdaL:           vote.LambdaL,
+		LambdaLMaxDelay:   vote.LambdaLMaxDelay,
+		LambdaD:           vote.LambdaD,
+		LambdaDMaxDelay:   vote.LambdaDMaxDelay,
+		LambdaM:           vote.LambdaM,
+		LambdaMMaxDelay:   vote.LambdaMMaxDelay,
+		ChainDocuments:    vote.PriorDocumentHash != nil,
+		Layers:            len(vote.Topology),
+
+		SphinxGeometryVersion: int(vote.SphinxGeometryVersion),
+	}
+	if g := vote.SphinxGeometry; g != nil {
+		params.SphinxHops = int(g.Hops)
+		params.SphinxPerHopRoutingInfoLength = int(g.PerHopRoutingInfoLength)
+		params.SphinxPayloadLength = int(g.PayloadLength)
+	}
+	return params
+}
+
+// votedParameters returns the subset of the parameters that is carried in
+// votes, see voteParameters.
+func votedParameters(p *config.Parameters) *config.Parameters {
+	params := &config.Parameters{
+		SendRatePerMinute: p.SendRatePerMinute,
+		Mu:                p.Mu,
+		MuMaxDelay:        p.MuMaxDelay,
+		LambdaP:           p.LambdaP,
+		LambdaPMaxDelay:   p.LambdaPMaxDelay,
+		LambdaL:           p.LambdaL,
+		LambdaLMaxDelay:   p.LambdaLMaxDelay,
+		LambdaD:           p.LambdaD,
+		LambdaDMaxDelay:   p.LambdaDMaxDelay,
+		LambdaM:           p.LambdaM,
+		LambdaMMaxDelay:   p.LambdaMMaxDelay,
+		ChainDocuments:    p.ChainDocuments,
+		Layers:            p.Layers,
+
+		SphinxGeometryVersion: p.SphinxGeometryVersion,
+	}
+	if sphinxGeometry(p) != nil {
+		params.SphinxHops = p.SphinxHops
+		params.SphinxPerHopRoutingInfoLength = p.SphinxPerHopRoutingInfoLength
+		params.SphinxPayloadLength = p.SphinxPayloadLength
+	}
+	return params
+}
+
+// sphinxGeometry returns the Sphinx packet geometry to publish, or nil if
+// it is not configured.
+func sphinxGeometry(p *config.Parameters) *s11n.SphinxGeometry {
+	if p.SphinxPayloadLength == 0 {
+		return nil
+	}
+	return &s11n.SphinxGeometry{
+		Hops:                    uint64(p.SphinxHops),
+		PerHopRoutingInfoLength: uint64(p.SphinxPerHopRoutingInfoLength),
+		PayloadLength:           uint64(p.SphinxPayloadLength),
+	}
+}
+
+// checkVoteParameters warns if the parameters of a peer's vote differ from
+// the ones this authority votes for.
+func (s *state) checkVoteParameters(vote *commands.Vote) {
+	v, err := s11n.FromPayload(vote.PublicKey, vote.Payload)
+	if err != nil {
+		return
+	}
+	p := votedParameters(s.s.cfg.ParametersAt(v.Epoch))
+	p.ChainDocuments = p.ChainDocuments && s.priorDocumentHash(v.Epoch) != nil
+	ours := p.Hash()
+	theirs := voteParameters(v).Hash()
+	if !bytes.Equal(ours, theirs) {
+		s.log.Warningf("Vote from Authority %v has parameters hash %x, which differs from ours %x", vote.PublicKey, theirs, ours)
 	}
 }
 
@@ -654,12 +1361,17 @@ func (s *state) tallyVotes(epoch uint64) ([]*descriptor, *config.Parameters, err
 	nodes := make([]*descriptor, 0)
 	mixTally := make(map[string][]*s11n.Document)
 	mixParams := make(map[string][]*s11n.Document)
+	nrRevealed := 0
 	for pk, voteDoc := range s.votes[epoch] {
 		srv := new(SharedRandom)
 		// Parse the payload bytes into the s11n.Document
 		// so that we can access the mix descriptors + sigs
 		// The votes have already been validated.
 
+		if s.isExcluded(epoch, pk) {
+			s.log.Errorf("Skipping vote from Authority %x who equivocated", pk)
+			continue
+		}
 		if _, ok := s.reveals[epoch][pk]; !ok {
 			s.log.Errorf("Skipping vote from Authority %s who failed to reveal", pk)
 			continue
@@ -685,20 +1397,9 @@ func (s *state) tallyVotes(epoch uint64) ([]*descriptor, *config.Parameters, err
 			s.log.Errorf("Skipping vote from Authority that failed to decode?! %v", err)
 			continue
 		}
+		nrRevealed++
 		// serialize the vote parameters and tally these as well.
-		params := &config.Parameters{
-			SendRatePerMinute: vote.SendRatePerMinute,
-			Mu:                vote.Mu,
-			MuMaxDelay:        vote.MuMaxDelay,
-			LambdaP:           vote.LambdaP,
-			LambdaPMaxDelay:   vote.LambdaPMaxDelay,
-			LambdaL:           vote.LambdaL,
-			LambdaLMaxDelay:   vote.LambdaLMaxDelay,
-			LambdaD:           vote.LambdaD,
-			LambdaDMaxDelay:   vote.LambdaDMaxDelay,
-			LambdaM:           vote.LambdaM,
-			LambdaMMaxDelay:   vote.LambdaMMaxDelay,
-		}
+		params := voteParameters(vote)
 		b := bytes.Buffer{}
 		e := gob.NewEncoder(&b)
 		err = e.Encode(params)
@@ -731,6 +1432,10 @@ func (s *state) tallyVotes(epoch uint64) ([]*descriptor, *config.Parameters, err
 			}
 		}
 	}
+	if nrRevealed < s.threshold {
+		return nil, nil, fmt.Errorf("not enough revealed votes for epoch %v, got %v, need %v", epoch, nrRevealed, s.threshold)
+	}
+
 	// include mixes that have a threshold of votes
 	for rawDesc, votes := range mixTally {
 		if len(votes) >= s.threshold {
@@ -764,15 +1469,62 @@ func (s *state) tallyVotes(epoch uint64) ([]*descriptor, *config.Parameters, err
 	return nil, nil, errors.New("consensus failure")
 }
 
+// dissentersFor returns the number of votes for a set of parameters that
+// leaves too few authorities to reach the threshold on any other set.
+func dissentersFor(nrVerifiers, threshold int) int {
+	return nrVerifiers - threshold + 1
+}
+
 func (s *state) GetConsensus(epoch uint64) (*document, error) {
-	s.Lock()
-	defer s.Unlock()
+	s.RLock()
+	defer s.RUnlock()
 	if d := s.documents[epoch]; d != nil {
 		return d, nil
 	}
+	if s.failed[epoch] && s.s.cfg.Parameters.ServeLastGoodOnFailure {
+		if d := s.lastGoodDocument(epoch); d != nil {
+			s.log.Debugf("Serving the last good document for epoch %v, as the round failed.", epoch)
+			return d, nil
+		}
+	}
+	now, _, _ := epochNow()
+	if s.failed[epoch] || epoch < now-uint64(s.s.cfg.Parameters.DocumentRetentionEpochs) {
+		return nil, errGone
+	}
 	return nil, errNotYet
 }
 
+// lastGoodDocument returns the most recent retained document for an epoch
+// before epoch, or nil if there is none.
+func (s *state) lastGoodDocument(epoch uint64) *document {
+	// Lock is held.
+	var last *document
+	var lastEpoch uint64
+	for e, d := range s.documents {
+		if e < epoch && (last == nil || e > lastEpoch) {
+			last, lastEpoch = d, e
+		}
+	}
+	return last
+}
+
+func (s *state) canonicalBytes(epoch uint64) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	d, ok := s.documents[epoch]
+	if !ok {
+		return nil, ErrNoDocument
+	}
+	certified, err := cert.GetCertified(d.raw)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, len(certified))
+	copy(raw, certified)
+	return raw, nil
+}
+
 func (s *state) isTabulated(epoch uint64) bool {
 	if _, ok := s.documents[epoch]; ok {
 		return true
@@ -806,10 +1558,14 @@ func (s *state) computeSharedRandom(epoch uint64) ([]byte, error) {
 		if sr.Verify(srr) {
 			reveals = append(reveals, Reveal{pk, srr})
 		} else {
-			// XXX: failed to verify , log err?
+			// The authority misbehaved, exclude its contribution.
+			s.log.Errorf("Authority %x revealed a value that does not match its commitment for epoch %v, excluding it from the shared random", pk, epoch)
 			continue
 		}
 	}
+	if min := s.s.cfg.Debug.MinRevealsForBeacon; len(reveals) < min {
+		return nil, fmt.Errorf("authority: Only %d valid reveals of the %d required, cannot calculate a shared random for Epoch %d", len(reveals), min, epoch)
+	}
 
 	sort.Slice(reveals, func(i, j int) bool {
 		return string(reveals[i].Digest) > string(reveals[j].Digest)
@@ -827,10 +1583,154 @@ func (s *state) computeSharedRandom(epoch uint64) ([]byte, error) {
 	} else {
 		srv.Write(zeros)
 	}
-	return srv.Sum(nil), nil
+	return srv.Sum(nil), nil
+}
+
+// blacklistVote returns the configured blacklist entries that the authority
+// votes to publish for epoch.
+func blacklistVote(cfgEntries []*config.BlacklistEntry, epoch uint64) []*s11n.BlacklistEntry {
+	var entries []*s11n.BlacklistEntry
+	for _, v := range cfgEntries {
+		e := &s11n.BlacklistEntry{
+			IdentityKey: v.IdentityKey.Bytes(),
+			Until:       v.Until,
+		}
+		if !e.IsExpired(epoch) {
+			entries = append(entries, e)
+		}
+	}
+	s11n.SortBlacklist(entries)
+	return entries
+}
+
+// isBlacklisted returns true iff the node with the identity key pk is on
+// one of the configured blacklist entries that has not expired by epoch.
+func isBlacklisted(cfgEntries []*config.BlacklistEntry, pk *eddsa.PublicKey, epoch uint64) bool {
+	for _, v := range cfgEntries {
+		if v.IdentityKey.Equal(pk) && (v.Until == 0 || epoch < v.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+// tallyBlacklist returns the blacklist entries that at least threshold of
+// the votes agree on, identity key and Until both.
+func tallyBlacklist(votes []*s11n.Document, threshold int, epoch uint64) []*s11n.BlacklistEntry {
+	type entryKey struct {
+		pk    [eddsa.PublicKeySize]byte
+		until uint64
+	}
+	tally := make(map[entryKey]int)
+	for _, vote := range votes {
+		// Each vote counts at most once per identity, so that with a
+		// majority threshold only one Until can be agreed on.
+		seen := make(map[[eddsa.PublicKeySize]byte]bool)
+		for _, e := range vote.Blacklist {
+			if len(e.IdentityKey) != eddsa.PublicKeySize || e.IsExpired(epoch) {
+				continue
+			}
+			k := entryKey{until: e.Until}
+			copy(k.pk[:], e.IdentityKey)
+			if !seen[k.pk] {
+				seen[k.pk] = true
+				tally[k]++
+			}
+		}
+	}
+
+	var entries []*s11n.BlacklistEntry
+	for k, n := range tally {
+		if n >= threshold {
+			pk := k.pk
+			entries = append(entries, &s11n.BlacklistEntry{IdentityKey: pk[:], Until: k.until})
+		}
+	}
+	s11n.SortBlacklist(entries)
+	return entries
+}
+
+// authoritiesVote returns the authority set that the authority votes to
+// publish, itself followed by its voting peers.  Peers without a link key or
+// addresses can not be reached by clients, and are left out.
+func authoritiesVote(cfg *config.Config, identityKey *eddsa.PublicKey, linkKey *ecdh.PublicKey) []*s11n.AuthorityEntry {
+	entries := []*s11n.AuthorityEntry{{
+		IdentityKey: identityKey.Bytes(),
+		LinkKey:     linkKey.Bytes(),
+		Addresses:   cfg.Authority.Addresses,
+	}}
+	for _, v := range cfg.VotingAuthorities() {
+		if v.LinkPublicKey == nil || len(v.Addresses) == 0 {
+			continue
+		}
+		entries = append(entries, &s11n.AuthorityEntry{
+			IdentityKey: v.IdentityPublicKey.Bytes(),
+			LinkKey:     v.LinkPublicKey.Bytes(),
+			Addresses:   v.Addresses,
+		})
+	}
+	s11n.SortAuthorities(entries)
+	return entries
+}
+
+// tallyAuthorities returns the authority entries that at least threshold
+// of the votes agree on, link key and addresses included.
+func tallyAuthorities(votes []*s11n.Document, threshold int) []*s11n.AuthorityEntry {
+	tally := make(map[string]int)
+	agreed := make(map[string]*s11n.AuthorityEntry)
+	for _, vote := range votes {
+		// Each vote counts at most once per identity, so that with a
+		// majority threshold only one entry can be agreed on.
+		seen := make(map[string]bool)
+		for _, e := range vote.Authorities {
+			if len(e.IdentityKey) != eddsa.PublicKeySize || len(e.LinkKey) != ecdh.PublicKeySize || len(e.Addresses) == 0 {
+				continue
+			}
+			if seen[string(e.IdentityKey)] {
+				continue
+			}
+			seen[string(e.IdentityKey)] = true
+			k := string(e.IdentityKey) + string(e.LinkKey) + strings.Join(e.Addresses, "\x00")
+			tally[k]++
+			agreed[k] = e
+		}
+	}
+
+	var entries []*s11n.AuthorityEntry
+	for k, n := range tally {
+		if n >= threshold {
+			entries = append(entries, agreed[k])
+		}
+	}
+	s11n.SortAuthorities(entries)
+	return entries
+}
+
+// parsedVotes returns the deserialized votes for epoch.
+func (s *state) parsedVotes(epoch uint64) []*s11n.Document {
+	// Lock is held (called from the onWakeup hook).
+	var votes []*s11n.Document
+	for pk, v := range s.votes[epoch] {
+		ed := new(eddsa.PublicKey)
+		ed.FromBytes(pk[:])
+		vote, err := s11n.FromPayload(ed, v.raw)
+		if err != nil {
+			s.log.Errorf("Skipping vote from Authority that failed to decode?! %v", err)
+			continue
+		}
+		votes = append(votes, vote)
+	}
+	return votes
 }
 
 func (s *state) tabulate(epoch uint64) {
+	if signed, ok := s.certificates[epoch][s.identityPubKey()]; ok {
+		// Restored from persistence, don't sign a second document.
+		s.log.Noticef("Already signed a Consensus Document for epoch %v, resending it.", epoch)
+		s.sendVoteToAuthorities(signed, epoch, sentSignature, phaseDeadline(s.deadlines.publishConsensus))
+		return
+	}
+
 	s.log.Noticef("Generating Consensus Document for epoch %v.", epoch)
 	// generate the shared random value or fail
 	srv, err := s.computeSharedRandom(epoch)
@@ -847,6 +1747,16 @@ func (s *state) tabulate(epoch uint64) {
 	}
 	s.log.Debug("Mixes tallied, now making a document")
 	doc := s.getDocument(mixes, params, srv)
+	votes := s.parsedVotes(epoch)
+	doc.Blacklist = tallyBlacklist(votes, s.threshold, epoch)
+	doc.Authorities = tallyAuthorities(votes, s.threshold)
+	if err = checkLayerSizes(doc.Topology, s.s.cfg.Debug.MinNodesPerLayer); err != nil {
+		if s.s.cfg.Parameters.RequireMinNodes {
+			s.log.Errorf("Not signing the consensus for epoch %v: %v", epoch, err)
+			return
+		}
+		s.log.Warningf("Signing a consensus for epoch %v regardless: %v", epoch, err)
+	}
 
 	// Serialize and sign the Document.
 	signed, err := s11n.SignDocument(s.s.identityKey, doc)
@@ -854,20 +1764,126 @@ func (s *state) tabulate(epoch uint64) {
 		s.log.Debugf("SignDocument failed with err: %v", err)
 		return
 	}
+	if s.s.nextIdentityKey != nil && s.s.cfg.Authority.DualSigning(epoch) {
+		if epoch >= s.s.cfg.Authority.RotationEpoch {
+			s.log.Warningf("Epoch %v is past the identity key RotationEpoch, restart to complete the rotation.", epoch)
+		}
+		if signed, err = cert.SignMulti(s.s.nextIdentityKey, signed); err != nil {
+			s.log.Errorf("Failed to sign document with the next identity key: %v", err)
+			return
+		}
+	}
 	// Save our certificate
+	if err = s.persist(certificatesBucket, epoch, s.identityPubKey(), signed); err != nil {
+		// Persistence failures are FATAL.
+		s.s.fatalErrCh <- err
+		return
+	}
 	if _, ok := s.certificates[epoch]; !ok {
 		s.certificates[epoch] = make(map[[eddsa.PublicKeySize]byte][]byte)
 	}
 	s.certificates[epoch][s.identityPubKey()] = signed
+	s.s.metrics.add(MetricConsensusGeneratedTotal, 1)
 	if raw, err := cert.GetCertified(signed); err == nil {
 		s.log.Debugf("Document for epoch %v saved: %s", epoch, raw)
 		s.log.Debugf("sha256(certified): %s", sha256b64(raw))
+		if s.s.cfg.Debug.LogConsensusInputs {
+			s.logConsensusInputs(epoch, mixes, srv, raw)
+		}
 	}
 	// send our vote to the other authorities!
-	s.sendVoteToAuthorities([]byte(signed), epoch)
+	s.sendVoteToAuthorities([]byte(signed), epoch, sentSignature, phaseDeadline(s.deadlines.publishConsensus))
+}
+
+// observe computes the consensus for epoch from the votes of the other
+// authorities the way tabulate does, and logs it instead of signing it.
+func (s *state) observe(epoch uint64) {
+	// Lock is held (called from the FSM).
+	if _, ok := s.observed[epoch]; ok {
+		return
+	}
+	srv, err := s.computeSharedRandom(epoch)
+	if err != nil {
+		s.log.Warningf("Observer: No shared random for epoch %v: %v", epoch, err)
+		return
+	}
+	mixes, params, err := s.tallyVotes(epoch)
+	if err != nil {
+		s.log.Warningf("Observer: No consensus expected for epoch %v: %v", epoch, err)
+		return
+	}
+	doc := s.getDocument(mixes, params, srv)
+	votes := s.parsedVotes(epoch)
+	doc.Blacklist = tallyBlacklist(votes, s.threshold, epoch)
+	doc.Authorities = tallyAuthorities(votes, s.threshold)
+
+	// The document is signed to get the certified payload the authorities
+	// sign, the signature itself never leaves this node.
+	signed, err := s11n.SignDocument(s.s.identityKey, doc)
+	if err != nil {
+		s.log.Errorf("Observer: Failed to serialize the document for epoch %v: %v", epoch, err)
+		return
+	}
+	raw, err := cert.GetCertified(signed)
+	if err != nil {
+		s.log.Errorf("Observer: Failed to serialize the document for epoch %v: %v", epoch, err)
+		return
+	}
+	s.observed[epoch] = sha256b64(raw)
+	s.log.Noticef("Observer: Expecting consensus for epoch %v with %d nodes, sha256(certified): %s", epoch, len(mixes), s.observed[epoch])
+	if s.s.cfg.Debug.LogConsensusInputs {
+		s.logConsensusInputs(epoch, mixes, srv, raw)
+	}
+}
+
+// checkObserved compares the certified payload of the consensus for epoch
+// with the one this observer computed, if any.
+func (s *state) checkObserved(epoch uint64, certified []byte) {
+	// Lock is held.
+	expected, ok := s.observed[epoch]
+	if !ok {
+		return
+	}
+	if h := sha256b64(certified); h != expected {
+		s.log.Warningf("Observer: Consensus for epoch %v has sha256(certified) %s, expected %s", epoch, h, expected)
+		return
+	}
+	s.log.Noticef("Observer: Consensus for epoch %v matches the expected document", epoch)
+}
+
+// checkLayerSizes returns an error iff any of the layers of the topology
+// have fewer than min nodes.
+func checkLayerSizes(topology [][][]byte, min int) error {
+	for layer, nodes := range topology {
+		if len(nodes) < min {
+			return fmt.Errorf("layer %d has %d nodes, need at least %d", layer, len(nodes), min)
+		}
+	}
+	return nil
 }
 
-func (s *state) generateTopology(nodeList []*descriptor, doc *pki.Document, srv []byte) [][][]byte {
+func (s *state) logConsensusInputs(epoch uint64, descs []*descriptor, srv, certified []byte) {
+	hashes := make([]string, 0, len(descs))
+	for _, v := range descs {
+		hashes = append(hashes, sha256b64(v.raw))
+	}
+	sort.Strings(hashes)
+
+	s.log.Debugf("Consensus inputs for epoch %v: threshold: %d/%d", epoch, s.threshold, len(s.verifiers))
+	s.log.Debugf("Consensus inputs for epoch %v: shared random value: %s", epoch, base64.StdEncoding.EncodeToString(srv))
+	for _, h := range hashes {
+		s.log.Debugf("Consensus inputs for epoch %v: descriptor: %s", epoch, h)
+	}
+	s.log.Debugf("Consensus inputs for epoch %v: document: %s", epoch, sha256b64(certified))
+}
+
+// generateTopology assigns the nodes to layers, preserving the layers of
+// the previous consensus doc where possible.  The topology is a function of
+// only the set of nodes, the previous topology and srv, the shared random
+// value of the consensus being generated, which is published in it as the
+// SharedRandomValue.  This is what allows the authorities to converge on
+// the same topology, and anyone to reproduce it.
+func (s *state) generateTopology(nodeList []*descriptor, doc *pki.Document, srv []byte, layers int) [][][]byte {
 	s.log.Debugf("Generating mix topology.")
 
 	nodeMap := make(map[[constants.NodeIDLength]byte]*descriptor)
@@ -891,11 +1907,16 @@ func (s *state) generateTopology(nodeList []*descriptor, doc *pki.Document, srv
 		s.log.Errorf("DeterministicRandReader() failed to initialize: %v", err)
 		s.s.fatalErrCh <- err
 	}
-	targetNodesPerLayer := len(nodeList) / s.s.cfg.Debug.Layers
-	topology := make([][][]byte, s.s.cfg.Debug.Layers)
+	targetNodesPerLayer := len(nodeList) / layers
+	topology := make([][][]byte, layers)
 
-	// Assign nodes that still exist up to the target size.
+	// Assign nodes that still exist up to the target size.  The number of
+	// layers may have changed since the previous document, in which case
+	// only the layers that still exist are carried over.
 	for layer, nodes := range doc.Topology {
+		if layer >= layers {
+			break
+		}
 		nodeIndexes := rng.Perm(len(nodes))
 
 		for _, idx := range nodeIndexes {
@@ -914,17 +1935,19 @@ func (s *state) generateTopology(nodeList []*descriptor, doc *pki.Document, srv
 		}
 	}
 
-	// Flatten the map containing the nodes pending assignment.
+	// Flatten the map containing the nodes pending assignment, in a
+	// deterministic order, as the map iteration order is random.
 	toAssign := make([]*descriptor, 0, len(nodeMap))
 	for _, n := range nodeMap {
 		toAssign = append(toAssign, n)
 	}
+	sortNodesByPublicKey(toAssign)
 	assignIndexes := rng.Perm(len(toAssign))
 
 	// Fill out any layers that are under the target size, by
 	// randomly assigning from the pending list.
 	idx := 0
-	for layer := range doc.Topology {
+	for layer := range topology {
 		for len(topology[layer]) < targetNodesPerLayer {
 			n := toAssign[assignIndexes[idx]]
 			topology[layer] = append(topology[layer], n.raw)
@@ -943,7 +1966,49 @@ func (s *state) generateTopology(nodeList []*descriptor, doc *pki.Document, srv
 	return topology
 }
 
-func (s *state) generateRandomTopology(nodes []*descriptor, srv []byte) [][][]byte {
+// buildTopology assigns the nodes to layers with a custom TopologyBuilder,
+// and ensures that every node is assigned to exactly one of the layers.
+func buildTopology(b config.TopologyBuilder, nodes []*descriptor, layers int, params *config.Parameters) ([][][]byte, error) {
+	sorted := make([]*descriptor, len(nodes))
+	copy(sorted, nodes)
+	sortNodesByPublicKey(sorted)
+
+	descs := make([]*pki.MixDescriptor, 0, len(sorted))
+	pending := make(map[[eddsa.PublicKeySize]byte]*descriptor)
+	for _, v := range sorted {
+		descs = append(descs, v.desc)
+		pending[v.desc.IdentityKey.ByteArray()] = v
+	}
+
+	t, err := b.Build(descs, layers, params)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || len(t.Layers) != layers {
+		return nil, fmt.Errorf("topology does not have %d layers", layers)
+	}
+	topology := make([][][]byte, layers)
+	for layer, l := range t.Layers {
+		for _, desc := range l {
+			id := desc.IdentityKey.ByteArray()
+			n, ok := pending[id]
+			if !ok {
+				return nil, fmt.Errorf("node %v is unknown or assigned more than once", desc.IdentityKey)
+			}
+			topology[layer] = append(topology[layer], n.raw)
+			delete(pending, id)
+		}
+	}
+	if len(pending) != 0 {
+		return nil, fmt.Errorf("%d nodes not assigned to a layer", len(pending))
+	}
+	return topology, nil
+}
+
+// generateRandomTopology randomly assigns the nodes to layers, for lack of
+// a previous consensus.  As with generateTopology, the topology is a
+// function of only the set of nodes and srv.
+func (s *state) generateRandomTopology(nodeList []*descriptor, srv []byte, layers int) [][][]byte {
 	s.log.Debugf("Generating random mix topology.")
 
 	// If there is no node history in the form of a previous consensus,
@@ -961,8 +2026,13 @@ func (s *state) generateRandomTopology(nodes []*descriptor, srv []byte) [][][]by
 		s.s.fatalErrCh <- err
 	}
 
+	// Shuffle the nodes in a deterministic order, regardless of the order
+	// they are passed in.
+	nodes := make([]*descriptor, len(nodeList))
+	copy(nodes, nodeList)
+	sortNodesByPublicKey(nodes)
 	nodeIndexes := rng.Perm(len(nodes))
-	topology := make([][][]byte, s.s.cfg.Debug.Layers)
+	topology := make([][][]byte, layers)
 	for idx, layer := 0, 0; idx < len(nodes); idx++ {
 		n := nodes[nodeIndexes[idx]]
 		topology[layer] = append(topology[layer], n.raw)
@@ -976,13 +2046,13 @@ func (s *state) generateRandomTopology(nodes []*descriptor, srv []byte) [][][]by
 func (s *state) pruneDocuments() {
 	// Lock is held (called from the onWakeup hook).
 
-	// Looking a bit into the past is probably ok, if more past documents
-	// need to be accessible, then methods that query the DB could always
-	// be added.
-	const preserveForPastEpochs = 3
-
-	now, _, _ := epochtime.Now()
-	cmpEpoch := now - preserveForPastEpochs
+	// Only prune once per epoch.
+	now, _, _ := epochNow()
+	if now == s.prunedEpoch {
+		return
+	}
+	s.prunedEpoch = now
+	cmpEpoch := now - uint64(s.s.cfg.Parameters.DocumentRetentionEpochs)
 
 	for e := range s.documents {
 		if e < cmpEpoch {
@@ -1004,16 +2074,80 @@ func (s *state) pruneDocuments() {
 			delete(s.certificates, e)
 		}
 	}
+	for e := range s.reveals {
+		if e < cmpEpoch {
+			delete(s.reveals, e)
+		}
+	}
+	for e := range s.equivocators {
+		if e < cmpEpoch {
+			delete(s.equivocators, e)
+		}
+	}
+	for e := range s.acks {
+		if e < cmpEpoch {
+			delete(s.acks, e)
+		}
+	}
+	for e := range s.observed {
+		if e < cmpEpoch {
+			delete(s.observed, e)
+		}
+	}
+	for e := range s.flagged {
+		if e < cmpEpoch {
+			delete(s.flagged, e)
+		}
+	}
+	for e := range s.failed {
+		if e < cmpEpoch {
+			delete(s.failed, e)
+		}
+	}
+
+	// All of the buckets are keyed by epoch, with either a value or a
+	// nested bucket per epoch.
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{documentsBucket, descriptorsBucket, votesBucket, revealsBucket, certificatesBucket} {
+			bkt := tx.Bucket([]byte(name))
+			var expired, expiredBkts [][]byte
+			c := bkt.Cursor()
+			for k, v := c.First(); k != nil && epochFromBytes(k) < cmpEpoch; k, v = c.Next() {
+				if v == nil {
+					expiredBkts = append(expiredBkts, k)
+				} else {
+					expired = append(expired, k)
+				}
+			}
+			for _, k := range expired {
+				if err := bkt.Delete(k); err != nil {
+					return err
+				}
+			}
+			for _, k := range expiredBkts {
+				if err := bkt.DeleteBucket(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		s.log.Errorf("Failed to prune the persistence store: %v", err)
+	}
 }
 
 func (s *state) isDescriptorAuthorized(desc *pki.MixDescriptor) bool {
+	return isAuthorized(desc, s.authorizedMixes, s.authorizedProviders)
+}
+
+func isAuthorized(desc *pki.MixDescriptor, mixes map[[eddsa.PublicKeySize]byte]bool, providers map[[eddsa.PublicKeySize]byte]string) bool {
 	pk := desc.IdentityKey.ByteArray()
 
 	switch desc.Layer {
 	case 0:
-		return s.authorizedMixes[pk]
+		return mixes[pk]
 	case pki.LayerProvider:
-		name, ok := s.authorizedProviders[pk]
+		name, ok := providers[pk]
 		if !ok {
 			return false
 		}
@@ -1035,6 +2169,34 @@ func (s *state) dupVote(vote commands.Vote) bool {
 	return false
 }
 
+// checkVoteEpoch returns an error if the signed document doc, uploaded as
+// a Vote for epoch, was made for a different epoch.  The Epoch of the Vote
+// command is not signed, so without this a vote or signature captured in an
+// earlier round could be replayed in this one.  Votes are also bound to the
+// round by the epoch prefixing their fresh SharedRandomCommit.
+//
+// This binding is what stands in for a challenge.  The Vote command is
+// defined in core/wire/commands and has no room for a nonce, and one would
+// not add anything: a document that passes this check was signed by its
+// author for the round being voted on, so replaying it within the round is
+// indistinguishable from the author's own retry, and is answered the same
+// way, while a different document for the same round is equivocation.
+func checkVoteEpoch(doc *pki.Document, epoch uint64) error {
+	if doc.Epoch != epoch {
+		return fmt.Errorf("document is for epoch %v, not %v", doc.Epoch, epoch)
+	}
+	if !isVote(doc) {
+		return nil
+	}
+	if len(doc.SharedRandomCommit) != s11n.SharedRandomLength {
+		return fmt.Errorf("SharedRandomCommit is %v bytes", len(doc.SharedRandomCommit))
+	}
+	if e := binary.BigEndian.Uint64(doc.SharedRandomCommit[:8]); e != epoch {
+		return fmt.Errorf("SharedRandomCommit is for epoch %v, not %v", e, epoch)
+	}
+	return nil
+}
+
 func (s *state) onRevealUpload(reveal *commands.Reveal) commands.Command {
 	s.Lock()
 	defer s.Unlock()
@@ -1097,8 +2259,14 @@ func (s *state) onRevealUpload(reveal *commands.Reveal) commands.Command {
 		return &resp
 	}
 
+	if err := s.persist(revealsBucket, s.votingEpoch, reveal.PublicKey.ByteArray(), certified); err != nil {
+		// Persistence failures are FATAL.
+		s.s.fatalErrCh <- err
+	}
 	s.log.Debug("Reveal OK.")
+	s.checkSkewGrace(fmt.Sprintf("Reveal from %v", reveal.PublicKey), s.votingEpoch, s.deadlines.authorityReveal)
 	s.reveals[s.votingEpoch][reveal.PublicKey.ByteArray()] = certified
+	s.updateRoundMetrics()
 	resp.ErrorCode = commands.RevealOk
 	return &resp
 }
@@ -1108,6 +2276,7 @@ func (s *state) onVoteUpload(vote *commands.Vote) commands.Command {
 	defer s.Unlock()
 	resp := commands.VoteStatus{}
 
+	s.observeVoteEpoch(vote)
 	if vote.Epoch < s.votingEpoch {
 		s.log.Errorf("Received Vote too early: %d < %d", vote.Epoch, s.votingEpoch)
 		resp.ErrorCode = commands.VoteTooEarly
@@ -1124,6 +2293,11 @@ func (s *state) onVoteUpload(vote *commands.Vote) commands.Command {
 		resp.ErrorCode = commands.VoteNotAuthorized
 		return &resp
 	}
+	if !s.isVerifier(vote.PublicKey.Bytes()) {
+		s.log.Errorf("Rejected Vote from the observer %v.", vote.PublicKey)
+		resp.ErrorCode = commands.VoteNotAuthorized
+		return &resp
+	}
 
 	doc, err := s11n.VerifyAndParseDocument(vote.Payload, vote.PublicKey)
 	if err != nil {
@@ -1131,6 +2305,11 @@ func (s *state) onVoteUpload(vote *commands.Vote) commands.Command {
 		resp.ErrorCode = commands.VoteNotSigned
 		return &resp
 	}
+	if err := checkVoteEpoch(doc, vote.Epoch); err != nil {
+		s.log.Errorf("Rejected replayed Vote from %v: %v", vote.PublicKey, err)
+		resp.ErrorCode = commands.VoteMalformed
+		return &resp
+	}
 
 	// haven't received a vote yet for this epoch
 	if _, ok := s.votes[s.votingEpoch]; !ok {
@@ -1142,20 +2321,45 @@ func (s *state) onVoteUpload(vote *commands.Vote) commands.Command {
 	}
 	// peer has not yet voted for this epoch
 	if !s.dupVote(*vote) {
+		if err := s.persist(votesBucket, s.votingEpoch, vote.PublicKey.ByteArray(), vote.Payload); err != nil {
+			// Persistence failures are FATAL.
+			s.s.fatalErrCh <- err
+		}
 		s.votes[s.votingEpoch][vote.PublicKey.ByteArray()] = &document{
 			raw: vote.Payload,
 			doc: doc,
 		}
+		s.checkVoteParameters(vote)
+		s.updateRoundMetrics()
 		s.log.Debug("Vote OK.")
+		s.checkSkewGrace(fmt.Sprintf("Vote from %v", vote.PublicKey), s.votingEpoch, s.deadlines.authorityVote)
 		resp.ErrorCode = commands.VoteOk
 	} else {
+		pk := vote.PublicKey.ByteArray()
+		if prev := s.votes[s.votingEpoch][pk].raw; isVote(doc) && !sameCertified(prev, vote.Payload) {
+			s.onEquivocation(s.votingEpoch, pk, prev, vote.Payload)
+			resp.ErrorCode = commands.VoteAlreadyReceived
+			return &resp
+		} else if isVote(doc) {
+			// The same vote again, as when the peer lost our
+			// acknowledgement and retried.
+			s.log.Debugf("Vote from %v already received.", vote.PublicKey)
+			resp.ErrorCode = commands.VoteAlreadyReceived
+			return &resp
+		}
 		// peer has voted previously, and has not yet submitted a signature
 		if !s.dupSig(*vote) {
+			if err := s.persist(certificatesBucket, s.votingEpoch, vote.PublicKey.ByteArray(), vote.Payload); err != nil {
+				// Persistence failures are FATAL.
+				s.s.fatalErrCh <- err
+			}
 			s.certificates[s.votingEpoch][vote.PublicKey.ByteArray()] = vote.Payload
+			s.updateRoundMetrics()
 			if raw, err := cert.GetCertified(vote.Payload); err == nil {
 				s.log.Debugf("Certificate for epoch %v saved: %s", vote.Epoch, raw)
 				s.log.Debugf("sha256(certified): %s", sha256b64(raw))
 			}
+			s.checkSkewGrace(fmt.Sprintf("Signature from %v", vote.PublicKey), s.votingEpoch, s.deadlines.publishConsensus)
 			resp.ErrorCode = commands.VoteOk
 			return &resp
 		}
@@ -1168,11 +2372,25 @@ func (s *state) onVoteUpload(vote *commands.Vote) commands.Command {
 	return &resp
 }
 
+// supersedes returns true iff the raw descriptor b is to be used instead of
+// a, both being for the same node and epoch.  The descriptor signed last
+// wins, and ties are broken by the descriptor hash, so that every authority
+// makes the same choice regardless of the order the uploads arrive in.
+func supersedes(b, a []byte) bool {
+	ta, _ := s11n.GetTimestampFromDescriptor(a)
+	tb, _ := s11n.GetTimestampFromDescriptor(b)
+	if ta != tb {
+		return tb > ta
+	}
+	ha, hb := sha3.Sum256(a), sha3.Sum256(b)
+	return bytes.Compare(hb[:], ha[:]) > 0
+}
+
 func (s *state) onDescriptorUpload(rawDesc []byte, desc *pki.MixDescriptor, epoch uint64) error {
 	s.Lock()
 	defer s.Unlock()
 
-	// Note: Caller ensures that the epoch is the current epoch +- 1.
+	// Note: Caller ensures that the epoch passes checkDescriptorEpoch.
 	pk := desc.IdentityKey.ByteArray()
 
 	// Get the public key -> descriptor map for the epoch.
@@ -1184,14 +2402,23 @@ func (s *state) onDescriptorUpload(rawDesc []byte, desc *pki.MixDescriptor, epoc
 
 	// Check for redundant uploads.
 	if d, ok := m[pk]; ok {
-		// If the descriptor changes, then it will be rejected to prevent
-		// nodes from reneging on uploads.
-		if !bytes.Equal(d.raw, rawDesc) {
-			return fmt.Errorf("state: Node %v: Conflicting descriptor for epoch %v", desc.IdentityKey, epoch)
+		// Redundant uploads that don't change are harmless.
+		if bytes.Equal(d.raw, rawDesc) {
+			return nil
 		}
 
-		// Redundant uploads that don't change are harmless.
-		return nil
+		// The node uploaded another descriptor, for example after a
+		// restart.  Keep the one that every authority would keep, so that
+		// the votes do not diverge.
+		if !supersedes(rawDesc, d.raw) {
+			s.log.Noticef("Node %v: Collapsed duplicate descriptors for epoch %v, keeping the prior upload", desc.IdentityKey, epoch)
+			return nil
+		}
+		if s.voted(epoch) {
+			// The vote can't be changed anymore.
+			return fmt.Errorf("state: Node %v: Conflicting descriptor for epoch %v, already voted", desc.IdentityKey, epoch)
+		}
+		s.log.Noticef("Node %v: Collapsed duplicate descriptors for epoch %v, keeping the new upload", desc.IdentityKey, epoch)
 	}
 
 	// Ok, this is a new descriptor.
@@ -1208,7 +2435,11 @@ func (s *state) onDescriptorUpload(rawDesc []byte, desc *pki.MixDescriptor, epoc
 		if err != nil {
 			return err
 		}
-		eBkt.Put(pk[:], rawDesc)
+		blob, err := s.storage.seal(rawDesc)
+		if err != nil {
+			return err
+		}
+		eBkt.Put(pk[:], blob)
 		return nil
 	}); err != nil {
 		// Persistence failures are FATAL.
@@ -1223,23 +2454,24 @@ func (s *state) onDescriptorUpload(rawDesc []byte, desc *pki.MixDescriptor, epoc
 
 	id := base64.StdEncoding.EncodeToString(desc.IdentityKey.Bytes())
 	s.log.Debugf("Node %s: Sucessfully submitted descriptor for epoch %v.", id, epoch)
+	s.checkSkewGrace(fmt.Sprintf("Descriptor from Node %s", id), epoch, s.deadlines.mixPublish)
 	s.onUpdate()
 	return nil
 }
 
 func (s *state) documentForEpoch(epoch uint64) ([]byte, error) {
-	var generationDeadline = 7 * (epochtime.Period / 8)
-
 	s.RLock()
 	defer s.RUnlock()
 
+	generationDeadline := s.deadlines.publishConsensus
+
 	// If we have a serialized document, return it.
 	if d, ok := s.documents[epoch]; ok {
 		return d.raw, nil
 	}
 
 	// Otherwise, return an error based on the time.
-	now, _, till := epochtime.Now()
+	now, _, till := epochNow()
 	switch epoch {
 	case now:
 		// We missed the deadline to publish a descriptor for the current
@@ -1284,39 +2516,41 @@ func (s *state) restorePersistence() error {
 		if err != nil {
 			return err
 		}
+		for _, name := range []string{votesBucket, revealsBucket, certificatesBucket, peerKeysBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
 
 		if b := bkt.Get([]byte(versionKey)); b != nil {
 			// Well it looks like we loaded as opposed to created.
 			if len(b) != 1 || b[0] != 0 {
 				return fmt.Errorf("state: incompatible version: %d", uint(b[0]))
 			}
+			if err := s.initStorage(bkt, false); err != nil {
+				return err
+			}
 
-			// Figure out which epochs to restore for.
-			now, _, _ := epochtime.Now()
+			// Figure out which epochs to restore for, the documents are
+			// restored for the entire retention window.
+			now, _, _ := epochNow()
+			retained := uint64(s.s.cfg.Parameters.DocumentRetentionEpochs)
+			for epoch := now - retained; epoch < now-1; epoch++ {
+				if err := s.restoreDocument(docsBkt, epoch); err != nil {
+					return err
+				}
+			}
 			epochs := []uint64{now - 1, now, now + 1}
 
 			// Restore the documents and descriptors.
 			for _, epoch := range epochs {
 				k := epochToBytes(epoch)
-				if rawDoc := docsBkt.Get(k); rawDoc != nil {
-					_, good, _, err := cert.VerifyThreshold(s.verifiers, s.threshold, rawDoc)
-					if err != nil {
-						s.log.Errorf("Failed to verify threshold on restored document")
-						break // or continue?
-					}
-					doc, err := s11n.VerifyAndParseDocument(rawDoc, good[0])
-					if err != nil {
-						s.log.Errorf("Failed to validate persisted document: %v", err)
-					} else if doc.Epoch != epoch {
-						// The document for the wrong epoch was persisted?
-						s.log.Errorf("Persisted document has unexpected epoch: %v", doc.Epoch)
-					} else {
-						s.log.Debugf("Restored Document for epoch %v: %v.", epoch, doc)
-						d := new(document)
-						d.doc = doc
-						d.raw = rawDoc
-						s.documents[epoch] = d
-					}
+				if err := s.restoreDocument(docsBkt, epoch); err != nil {
+					return err
+				}
+
+				if err := s.restoreRound(tx, epoch); err != nil {
+					return err
 				}
 
 				eDescsBkt := descsBkt.Bucket(k)
@@ -1326,12 +2560,16 @@ func (s *state) restorePersistence() error {
 				}
 
 				c := eDescsBkt.Cursor()
-				for pk, rawDesc := c.First(); pk != nil; pk, rawDesc = c.Next() {
+				for pk, blob := c.First(); pk != nil; pk, blob = c.Next() {
+					rawDesc, err := s.storage.open(blob)
+					if err != nil {
+						return err
+					}
 					verifier, err := s11n.GetVerifierFromDescriptor([]byte(rawDesc))
 					if err != nil {
 						return err
 					}
-					desc, err := s11n.VerifyAndParseDescriptor(verifier, rawDesc, epoch)
+					desc, err := s.s.verifyAndParseDescriptor(verifier, rawDesc, epoch)
 					if err != nil {
 						s.log.Errorf("Failed to validate persisted descriptor: %v", err)
 						continue
@@ -1367,31 +2605,180 @@ func (s *state) restorePersistence() error {
 		// We created a new database, so populate the new `metadata` bucket.
 		bkt.Put([]byte(versionKey), []byte{0})
 
+		return s.initStorage(bkt, true)
+	})
+}
+
+// restoreDocument restores the persisted consensus document for the epoch,
+// if any.
+func (s *state) restoreDocument(docsBkt *bolt.Bucket, epoch uint64) error {
+	blob := docsBkt.Get(epochToBytes(epoch))
+	if blob == nil {
+		return nil
+	}
+	rawDoc, err := s.storage.open(blob)
+	if err != nil {
+		return err
+	}
+	_, good, _, err := cert.VerifyThreshold(s.verifiers, s.threshold, rawDoc)
+	if err != nil {
+		s.log.Errorf("Failed to verify threshold on restored document")
 		return nil
+	}
+	doc, err := s11n.VerifyAndParseDocument(rawDoc, good[0])
+	if err != nil {
+		s.log.Errorf("Failed to validate persisted document: %v", err)
+	} else if doc.Epoch != epoch {
+		// The document for the wrong epoch was persisted?
+		s.log.Errorf("Persisted document has unexpected epoch: %v", doc.Epoch)
+	} else {
+		s.log.Debugf("Restored Document for epoch %v: %v.", epoch, doc)
+		d := new(document)
+		d.doc = doc
+		d.raw = rawDoc
+		s.documents[epoch] = d
+	}
+	return nil
+}
+
+// persistDocument stores the consensus document for the epoch.
+func (s *state) persistDocument(epoch uint64, raw []byte) {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		blob, err := s.storage.seal(raw)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(documentsBucket)).Put(epochToBytes(epoch), blob)
+	}); err != nil {
+		// Persistence failures are FATAL.
+		s.s.fatalErrCh <- err
+	}
+}
+
+// putRoundBlob seals b and stores it in the named voting round bucket,
+// keyed by epoch and then by the authority's public key.
+func (s *state) putRoundBlob(tx *bolt.Tx, bucket string, epoch uint64, pk [eddsa.PublicKeySize]byte, b []byte) error {
+	eBkt, err := tx.Bucket([]byte(bucket)).CreateBucketIfNotExists(epochToBytes(epoch))
+	if err != nil {
+		return err
+	}
+	blob, err := s.storage.seal(b)
+	if err != nil {
+		return err
+	}
+	return eBkt.Put(pk[:], blob)
+}
+
+// persist stores b in the named voting round bucket.
+func (s *state) persist(bucket string, epoch uint64, pk [eddsa.PublicKeySize]byte, b []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.putRoundBlob(tx, bucket, epoch, pk, b)
 	})
 }
 
+// restoreRound restores the votes, reveals and certificates persisted for
+// the epoch's voting round.
+func (s *state) restoreRound(tx *bolt.Tx, epoch uint64) error {
+	k := epochToBytes(epoch)
+	restore := func(bucket string, fn func(pk *eddsa.PublicKey, b []byte) error) error {
+		eBkt := tx.Bucket([]byte(bucket)).Bucket(k)
+		if eBkt == nil {
+			return nil
+		}
+		c := eBkt.Cursor()
+		for rawPk, blob := c.First(); rawPk != nil; rawPk, blob = c.Next() {
+			b, err := s.storage.open(blob)
+			if err != nil {
+				return err
+			}
+			pk := new(eddsa.PublicKey)
+			if err := pk.FromBytes(rawPk); err != nil {
+				s.log.Errorf("Discarding persisted %v: %v", bucket, err)
+				continue
+			}
+			if pk.ByteArray() != s.identityPubKey() && !s.authorizedAuthorities[pk.ByteArray()] {
+				s.log.Warningf("Discarding persisted %v from unauthorized peer: %v", bucket, pk)
+				continue
+			}
+			if err := fn(pk, b); err != nil {
+				s.log.Errorf("Discarding persisted %v: %v", bucket, err)
+			}
+		}
+		return nil
+	}
+
+	if err := restore(votesBucket, func(pk *eddsa.PublicKey, b []byte) error {
+		doc, err := s11n.VerifyAndParseDocument(b, pk)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.votes[epoch]; !ok {
+			s.votes[epoch] = make(map[[eddsa.PublicKeySize]byte]*document)
+		}
+		s.votes[epoch][pk.ByteArray()] = &document{raw: b, doc: doc}
+		return nil
+	}); err != nil {
+		return err
+	}
+	restoreBlobs := func(m map[uint64]map[[eddsa.PublicKeySize]byte][]byte) func(*eddsa.PublicKey, []byte) error {
+		return func(pk *eddsa.PublicKey, b []byte) error {
+			if _, ok := m[epoch]; !ok {
+				m[epoch] = make(map[[eddsa.PublicKeySize]byte][]byte)
+			}
+			m[epoch][pk.ByteArray()] = b
+			return nil
+		}
+	}
+	if err := restore(revealsBucket, restoreBlobs(s.reveals)); err != nil {
+		return err
+	}
+	if err := restore(certificatesBucket, restoreBlobs(s.certificates)); err != nil {
+		return err
+	}
+	if s.voted(epoch) {
+		s.log.Noticef("Restored our vote for epoch %v.", epoch)
+	}
+	return nil
+}
+
 func newState(s *Server) (*state, error) {
 	const dbFile = "persistence.db"
 
 	st := new(state)
 	st.s = s
 	st.log = s.logBackend.GetLogger("state")
+	if s.cfg.Debug == nil {
+		s.cfg.Debug = new(config.Debug)
+	}
+	if s.cfg.Parameters == nil {
+		s.cfg.Parameters = new(config.Parameters)
+	}
 
 	// set voting schedule at runtime
+	st.deadlines = newPhaseDeadlines(s.cfg.Parameters)
+	st.deadlines.skewTolerance = time.Duration(s.cfg.Debug.EpochClockSkewTolerance) * time.Second
 
 	st.log.Debugf("State initialized with epoch Period: %s", epochtime.Period)
-	st.log.Debugf("State initialized with mixPublishDeadline: %s", mixPublishDeadline)
-	st.log.Debugf("State initialized with authorityVoteDeadline: %s", authorityVoteDeadline)
-	st.log.Debugf("State initialized with authorityRevealDeadline: %s", authorityRevealDeadline)
-	st.log.Debugf("State initialized with publishConsensusDeadline: %s", publishConsensusDeadline)
-	st.verifiers = make([]cert.Verifier, len(s.cfg.Authorities)+1)
-	for i, auth := range s.cfg.Authorities {
-		st.verifiers[i] = cert.Verifier(auth.IdentityPublicKey)
-	}
-	st.verifiers[len(s.cfg.Authorities)] = cert.Verifier(s.IdentityKey())
-	st.threshold = len(st.verifiers)/2 + 1
-	st.dissenters = len(s.cfg.Authorities)/2 - 1
+	st.log.Debugf("State initialized with mixPublishDeadline: %s", st.deadlines.mixPublish)
+	st.log.Debugf("State initialized with authorityVoteDeadline: %s", st.deadlines.authorityVote)
+	st.log.Debugf("State initialized with authorityRevealDeadline: %s", st.deadlines.authorityReveal)
+	st.log.Debugf("State initialized with publishConsensusDeadline: %s", st.deadlines.publishConsensus)
+	st.log.Debugf("State initialized with clock skew tolerance: %s", st.deadlines.skewTolerance)
+	st.verifiers = make([]cert.Verifier, 0, len(s.cfg.Authorities)+1)
+	for _, auth := range s.cfg.VotingAuthorities() {
+		st.verifiers = append(st.verifiers, cert.Verifier(auth.IdentityPublicKey))
+	}
+	if s.cfg.Debug.ObserverMode {
+		// Observers never sign, so their signature never counts.
+		st.log.Noticef("Running as an observer, not voting.")
+	} else {
+		st.verifiers = append(st.verifiers, cert.Verifier(s.IdentityKey()))
+	}
+	st.threshold = s.cfg.Parameters.Threshold
+	if st.threshold == 0 {
+		st.threshold = len(st.verifiers)/2 + 1
+	}
+	st.dissenters = dissentersFor(len(st.verifiers), st.threshold)
 
 	// Initialize the authorized peer tables.
 	st.authorizedMixes = make(map[[eddsa.PublicKeySize]byte]bool)
@@ -1404,6 +2791,7 @@ func newState(s *Server) (*state, error) {
 		pk := v.IdentityKey.ByteArray()
 		st.authorizedProviders[pk] = v.Identifier
 	}
+	st.mixLayers = pinnedLayers(st.s.cfg.Mixes)
 	st.authorizedAuthorities = make(map[[eddsa.PublicKeySize]byte]bool)
 	for _, v := range st.s.cfg.Authorities {
 		pk := v.IdentityPublicKey.ByteArray()
@@ -1414,12 +2802,26 @@ func newState(s *Server) (*state, error) {
 		pk := v.IdentityPublicKey.ByteArray()
 		st.authorityLinkKeys[pk] = v.LinkPublicKey
 	}
+	st.authorityNextKeys = make(map[[eddsa.PublicKeySize]byte][eddsa.PublicKeySize]byte)
+	if k := st.s.cfg.Authority.NextIdentityKey; k != nil {
+		st.authorityNextKeys[s.IdentityKey().ByteArray()] = k.ByteArray()
+	}
+	for _, v := range st.s.cfg.Authorities {
+		if v.NextIdentityPublicKey != nil {
+			st.authorityNextKeys[v.IdentityPublicKey.ByteArray()] = v.NextIdentityPublicKey.ByteArray()
+		}
+	}
 
 	st.documents = make(map[uint64]*document)
 	st.descriptors = make(map[uint64]map[[eddsa.PublicKeySize]byte]*descriptor)
 	st.votes = make(map[uint64]map[[eddsa.PublicKeySize]byte]*document)
 	st.certificates = make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte)
 	st.reveals = make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte)
+	st.atRisk = make(map[[eddsa.PublicKeySize]byte]uint64)
+	st.observed = make(map[uint64]string)
+	st.failed = make(map[uint64]bool)
+	st.flagged = make(map[uint64][]string)
+	st.epochClaims = make(map[[eddsa.PublicKeySize]byte]epochClaim)
 
 	// Initialize the persistence store and restore state.
 	dbPath := filepath.Join(s.cfg.Authority.DataDir, dbFile)
@@ -1433,7 +2835,14 @@ func newState(s *Server) (*state, error) {
 	}
 
 	// Set the initial state to bootstrap
+	if s.cfg.Debug.StartupWarmup > 0 {
+		st.log.Noticef("Not voting during the %v startup warmup.", s.cfg.Debug.StartupWarmup)
+	}
+	st.startTime = time.Now()
 	st.state = stateBootstrap
+	if margin := s.cfg.Debug.StallWatchdogMargin; margin > 0 {
+		st.watchdog = newStallWatchdog(time.Duration(margin)*time.Second, st.onStall)
+	}
 	st.Go(st.worker)
 	return st, nil
 }
@@ -1445,7 +2854,17 @@ func (s *state) backgroundFetchConsensus(epoch uint64) {
 	_, ok := s.documents[epoch]
 	if !ok {
 		go func() {
-			cfg := &client.Config{s.s.logBackend, s.s.cfg.Authorities, nil}
+			logBackend, err := s.s.clientLogBackend()
+			if err != nil {
+				return
+			}
+			cfg := &client.Config{
+				LogBackend:  logBackend,
+				Authorities: s.s.cfg.VotingAuthorities(),
+				DialContextFn: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return s.s.transport.DialContext(ctx, addr)
+				},
+			}
 			c, err := client.New(cfg)
 			if err != nil {
 				return
@@ -1454,6 +2873,7 @@ func (s *state) backgroundFetchConsensus(epoch uint64) {
 			defer cancel()
 			doc, rawDoc, err := c.Get(ctx, epoch)
 			if err != nil {
+				s.log.Debugf("Failed to fetch the consensus for epoch %v: %v", epoch, err)
 				return
 			}
 			s.Lock()
@@ -1464,6 +2884,10 @@ func (s *state) backgroundFetchConsensus(epoch uint64) {
 			// multiple times during bootstrapping
 			if _, ok := s.documents[epoch]; !ok {
 				s.documents[epoch] = &document{doc, rawDoc}
+				s.persistDocument(epoch, rawDoc)
+				if raw, err := cert.GetCertified(rawDoc); err == nil {
+					s.checkObserved(epoch, raw)
+				}
 			}
 		}()
 	}
@@ -1479,6 +2903,17 @@ func epochFromBytes(b []byte) uint64 {
 	return binary.BigEndian.Uint64(b[0:8])
 }
 
+// pinnedLayers returns the layers that mixes are pinned to, by identity key.
+func pinnedLayers(mixes []*config.Node) map[[eddsa.PublicKeySize]byte]int {
+	m := make(map[[eddsa.PublicKeySize]byte]int)
+	for _, v := range mixes {
+		if v.Layer != nil {
+			m[v.IdentityKey.ByteArray()] = *v.Layer
+		}
+	}
+	return m
+}
+
 func sortNodesByPublicKey(nodes []*descriptor) {
 	dTos := func(d *descriptor) string {
 		pk := d.desc.IdentityKey.ByteArray()
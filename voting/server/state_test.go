@@ -18,14 +18,26 @@ package server
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	bolt "github.com/coreos/bbolt"
 	"github.com/katzenpost/authority/internal/s11n"
 	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
+	"github.com/katzenpost/core/crypto/ecdh"
 	"github.com/katzenpost/core/crypto/eddsa"
 	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
 	"github.com/katzenpost/core/pki"
+	"github.com/katzenpost/core/wire/commands"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/sha3"
 )
@@ -182,3 +194,1484 @@ func TestVoteThreshold(t *testing.T) {
 	//	}
 	//}
 }
+
+func TestMissingServices(t *testing.T) {
+	assert := assert.New(t)
+
+	m := make(map[[eddsa.PublicKeySize]byte]*descriptor)
+	m[[eddsa.PublicKeySize]byte{0x01}] = &descriptor{desc: &pki.MixDescriptor{
+		Layer: 0,
+	}}
+	m[[eddsa.PublicKeySize]byte{0x02}] = &descriptor{desc: &pki.MixDescriptor{
+		Layer: pki.LayerProvider,
+		Kaetzchen: map[string]map[string]interface{}{
+			"loop": {"endpoint": "+loop"},
+		},
+	}}
+
+	assert.Empty(missingServices(nil, m))
+	assert.Empty(missingServices([]string{"loop"}, m))
+	assert.Equal([]string{"keyserver"}, missingServices([]string{"loop", "keyserver"}, m))
+
+	// Services offered by something that isn't a Provider don't count.
+	m[[eddsa.PublicKeySize]byte{0x01}].desc.Kaetzchen = map[string]map[string]interface{}{
+		"keyserver": {"endpoint": "+keyserver"},
+	}
+	assert.Equal([]string{"keyserver"}, missingServices([]string{"loop", "keyserver"}, m))
+
+	// No Providers at all means every service is missing.
+	delete(m, [eddsa.PublicKeySize]byte{0x02})
+	assert.Equal([]string{"keyserver", "loop"}, missingServices([]string{"loop", "keyserver"}, m))
+}
+
+func TestAbsentNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	a := [eddsa.PublicKeySize]byte{0x01}
+	b := [eddsa.PublicKeySize]byte{0x02}
+	c := [eddsa.PublicKeySize]byte{0x03}
+
+	prev := map[[eddsa.PublicKeySize]byte]bool{a: true, b: true, c: true}
+	assert.Empty(absentNodes(prev, prev))
+	assert.Equal([][eddsa.PublicKeySize]byte{a, c}, absentNodes(prev, map[[eddsa.PublicKeySize]byte]bool{b: true}))
+
+	// Nodes that are new in the current epoch are never absent.
+	assert.Empty(absentNodes(map[[eddsa.PublicKeySize]byte]bool{}, prev))
+}
+
+// reverseTopologyBuilder assigns the nodes to layers round-robin, in reverse
+// identity key order.
+type reverseTopologyBuilder struct {
+	skip       int
+	extraLayer bool
+}
+
+func (b *reverseTopologyBuilder) Build(descs []*pki.MixDescriptor, layers int, params *config.Parameters) (*config.Topology, error) {
+	t := &config.Topology{Layers: make([][]*pki.MixDescriptor, layers)}
+	for i := len(descs) - 1 - b.skip; i >= 0; i-- {
+		layer := (len(descs) - 1 - i) % layers
+		t.Layers[layer] = append(t.Layers[layer], descs[i])
+	}
+	if b.extraLayer {
+		t.Layers = append(t.Layers, nil)
+	}
+	return t, nil
+}
+
+func TestBuildTopology(t *testing.T) {
+	assert := assert.New(t)
+
+	var nodes []*descriptor
+	for i := 0; i < 6; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		nodes = append(nodes, &descriptor{
+			desc: &pki.MixDescriptor{IdentityKey: k.PublicKey()},
+			raw:  []byte{byte(i)},
+		})
+	}
+	sorted := make([]*descriptor, len(nodes))
+	copy(sorted, nodes)
+	sortNodesByPublicKey(sorted)
+
+	topology, err := buildTopology(&reverseTopologyBuilder{}, nodes, 3, &config.Parameters{})
+	assert.NoError(err)
+	assert.Equal([][][]byte{
+		{sorted[5].raw, sorted[2].raw},
+		{sorted[4].raw, sorted[1].raw},
+		{sorted[3].raw, sorted[0].raw},
+	}, topology)
+
+	// The builder is always given the nodes in the same order, so the
+	// topology does not depend on the order the descriptors arrived in.
+	nodes[0], nodes[5] = nodes[5], nodes[0]
+	again, err := buildTopology(&reverseTopologyBuilder{}, nodes, 3, &config.Parameters{})
+	assert.NoError(err)
+	assert.Equal(topology, again)
+
+	// Topologies that omit nodes, or have the wrong number of layers, are
+	// rejected.
+	_, err = buildTopology(&reverseTopologyBuilder{skip: 1}, nodes, 3, &config.Parameters{})
+	assert.Error(err)
+	_, err = buildTopology(&reverseTopologyBuilder{extraLayer: true}, nodes, 3, &config.Parameters{})
+	assert.Error(err)
+}
+
+func TestDocumentChain(t *testing.T) {
+	assert := assert.New(t)
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	s := &state{documents: make(map[uint64]*document)}
+
+	// Publish three consecutive chained documents.
+	const firstEpoch = 23
+	for epoch := uint64(firstEpoch); epoch < firstEpoch+3; epoch++ {
+		doc := &s11n.Document{
+			Epoch:             epoch,
+			PriorDocumentHash: s.priorDocumentHash(epoch),
+		}
+		signed, err := s11n.SignDocument(k, doc)
+		assert.NoError(err)
+		s.documents[epoch] = &document{raw: signed}
+	}
+
+	// The first chained epoch has no prior document, so it omits the hash.
+	first, err := s11n.FromPayload(k.PublicKey(), s.documents[firstEpoch].raw)
+	assert.NoError(err)
+	assert.Nil(first.PriorDocumentHash)
+
+	// Each subsequent document commits to the previous one.
+	for epoch := uint64(firstEpoch + 1); epoch < firstEpoch+3; epoch++ {
+		d, err := s11n.FromPayload(k.PublicKey(), s.documents[epoch].raw)
+		assert.NoError(err)
+		prior, err := s11n.DocumentHash(s.documents[epoch-1].raw)
+		assert.NoError(err)
+		assert.Equal(prior, d.PriorDocumentHash, "epoch %v", epoch)
+	}
+
+	// The hash does not depend on which signatures are attached.
+	other, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	payload, err := s11n.FromPayload(k.PublicKey(), s.documents[firstEpoch].raw)
+	assert.NoError(err)
+	resigned, err := s11n.SignDocument(other, payload)
+	assert.NoError(err)
+	h1, err := s11n.DocumentHash(s.documents[firstEpoch].raw)
+	assert.NoError(err)
+	h2, err := s11n.DocumentHash(resigned)
+	assert.NoError(err)
+	assert.Equal(h1, h2)
+}
+
+func TestMismatchedReveal(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &config.Config{
+		Logging: &config.Logging{
+			Level: "DEBUG",
+		},
+		Debug: &config.Debug{
+			MinRevealsForBeacon: 2,
+		},
+	}
+	srv := &Server{cfg: cfg}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:         srv,
+		log:       srv.logBackend.GetLogger("state"),
+		documents: make(map[uint64]*document),
+		votes:     make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		reveals:   make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+
+	const epoch = 23
+	s.votes[epoch] = make(map[[eddsa.PublicKeySize]byte]*document)
+	s.reveals[epoch] = make(map[[eddsa.PublicKeySize]byte][]byte)
+	for i := byte(0); i < 3; i++ {
+		sr := new(SharedRandom)
+		commit, err := sr.Commit(epoch)
+		assert.NoError(err)
+		pk := [eddsa.PublicKeySize]byte{i}
+		s.votes[epoch][pk] = &document{doc: &pki.Document{SharedRandomCommit: commit}}
+		s.reveals[epoch][pk] = sr.Reveal()
+	}
+
+	// Replace one authority's reveal with a value it did not commit to.
+	liar := [eddsa.PublicKeySize]byte{2}
+	other := new(SharedRandom)
+	_, err := other.Commit(epoch)
+	assert.NoError(err)
+	s.reveals[epoch][liar] = other.Reveal()
+
+	// The beacon is computed from the honest reveals alone.
+	withLiar, err := s.computeSharedRandom(epoch)
+	assert.NoError(err)
+	delete(s.votes[epoch], liar)
+	withoutLiar, err := s.computeSharedRandom(epoch)
+	assert.NoError(err)
+	assert.Equal(withoutLiar, withLiar)
+
+	// Too few valid reveals yields no beacon at all.
+	cfg.Debug.MinRevealsForBeacon = 3
+	_, err = s.computeSharedRandom(epoch)
+	assert.Error(err)
+}
+
+func TestTallyBlacklist(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	var keys []*eddsa.PublicKey
+	for i := 0; i < 4; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		keys = append(keys, k.PublicKey())
+	}
+	voteFor := func(entries ...*config.BlacklistEntry) *s11n.Document {
+		return &s11n.Document{Blacklist: blacklistVote(entries, epoch)}
+	}
+
+	votes := []*s11n.Document{
+		voteFor(
+			&config.BlacklistEntry{IdentityKey: keys[0]},
+			&config.BlacklistEntry{IdentityKey: keys[1], Until: epoch + 10},
+			&config.BlacklistEntry{IdentityKey: keys[2], Until: epoch + 10},
+			&config.BlacklistEntry{IdentityKey: keys[3], Until: epoch},
+		),
+		voteFor(
+			&config.BlacklistEntry{IdentityKey: keys[0]},
+			&config.BlacklistEntry{IdentityKey: keys[1], Until: epoch + 10},
+			&config.BlacklistEntry{IdentityKey: keys[2], Until: epoch + 20},
+			&config.BlacklistEntry{IdentityKey: keys[3], Until: epoch},
+		),
+		voteFor(),
+	}
+
+	// Expired entries are not voted for.
+	assert.Len(votes[0].Blacklist, 3)
+
+	// Only the entries a threshold agrees on, including Until, are listed.
+	want := blacklistVote([]*config.BlacklistEntry{
+		{IdentityKey: keys[0]},
+		{IdentityKey: keys[1], Until: epoch + 10},
+	}, epoch)
+	assert.Equal(want, tallyBlacklist(votes, 2, epoch))
+
+	// Entries age out once the epoch reaches Until.
+	assert.Len(tallyBlacklist(votes, 2, epoch+10), 1)
+	assert.Empty(tallyBlacklist(votes, 3, epoch))
+}
+
+func TestTallyAuthorities(t *testing.T) {
+	assert := assert.New(t)
+
+	var peers []*config.AuthorityPeer
+	for i := 0; i < 3; i++ {
+		idKey, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		peers = append(peers, &config.AuthorityPeer{
+			IdentityPublicKey: idKey.PublicKey(),
+			LinkPublicKey:     linkKey.PublicKey(),
+			Addresses:         []string{fmt.Sprintf("authority-%d.example.org:30001", i)},
+		})
+	}
+
+	// Each authority votes for itself, at its bind address, and its peers.
+	voteFor := func(self int, addr string) *s11n.Document {
+		cfg := &config.Config{Authority: &config.Authority{Addresses: []string{addr}}}
+		for i, v := range peers {
+			if i != self {
+				cfg.Authorities = append(cfg.Authorities, v)
+			}
+		}
+		return &s11n.Document{Authorities: authoritiesVote(cfg, peers[self].IdentityPublicKey, peers[self].LinkPublicKey)}
+	}
+	votes := []*s11n.Document{
+		voteFor(0, "0.0.0.0:30001"),
+		voteFor(1, peers[1].Addresses[0]),
+		voteFor(2, peers[2].Addresses[0]),
+	}
+	assert.Len(votes[0].Authorities, 3)
+
+	// The entries are the ones a threshold agrees on, so the peers' view
+	// of the first authority's address prevails.
+	cfg := &config.Config{Authority: &config.Authority{Addresses: peers[0].Addresses}, Authorities: peers[1:]}
+	want := authoritiesVote(cfg, peers[0].IdentityPublicKey, peers[0].LinkPublicKey)
+	assert.Equal(want, tallyAuthorities(votes, 2))
+	assert.Len(tallyAuthorities(votes, 3), 2)
+
+	// Peers that clients can not reach are not voted for.
+	peers[1].Addresses = nil
+	assert.Len(voteFor(0, "0.0.0.0:30001").Authorities, 2)
+}
+
+func TestVoteParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &config.Parameters{
+		SendRatePerMinute: 10,
+		Mu:                0.001,
+		MuMaxDelay:        100,
+		LambdaM:           0.5,
+		RequiredServices:  []string{"loop"},
+		ChainDocuments:    true,
+	}
+	vote := &s11n.Document{
+		SendRatePerMinute: p.SendRatePerMinute,
+		Mu:                p.Mu,
+		MuMaxDelay:        p.MuMaxDelay,
+		LambdaM:           p.LambdaM,
+		PriorDocumentHash: make([]byte, s11n.DocumentHashLength),
+	}
+
+	// The parameters carried in a vote hash the same as the voted subset of
+	// the configured parameters.
+	assert.Equal(votedParameters(p).Hash(), voteParameters(vote).Hash())
+	vote.Mu = 0.002
+	assert.NotEqual(votedParameters(p).Hash(), voteParameters(vote).Hash())
+}
+
+// openTestDB gives s a fresh persistence store, and returns a func that
+// removes it.
+func openTestDB(assert *assert.Assertions, s *state) func() {
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	s.db, err = bolt.Open(filepath.Join(dataDir, "persistence.db"), 0600, nil)
+	assert.NoError(err)
+	assert.NoError(s.restorePersistence())
+	return func() {
+		s.db.Close()
+		os.RemoveAll(dataDir)
+	}
+}
+
+func genSignedDescriptor(assert *assert.Assertions, epoch uint64, layer uint8) []byte {
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	desc := &pki.MixDescriptor{
+		Name:        "node.example.org",
+		IdentityKey: identityKey.PublicKey(),
+		LinkKey:     linkKey.PublicKey(),
+		MixKeys:     make(map[uint64]*ecdh.PublicKey),
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+		Layer: layer,
+	}
+	for e := epoch; e < epoch+3; e++ {
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		desc.MixKeys[e] = mixKey.PublicKey()
+	}
+	signed, err := s11n.SignDescriptor(identityKey, desc)
+	assert.NoError(err)
+	return signed
+}
+
+func TestRequireMinNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	mixes := [][]byte{genSignedDescriptor(assert, epoch, 0), genSignedDescriptor(assert, epoch, 0)}
+	provider := genSignedDescriptor(assert, epoch, pki.LayerProvider)
+
+	// Tabulate the consensus of a single authority that has voted for one
+	// mix in each of two layers, with at least two nodes each.
+	tabulate := func(requireMinNodes bool) bool {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		srv := &Server{
+			cfg: &config.Config{
+				Logging:    &config.Logging{Level: "DEBUG"},
+				Parameters: &config.Parameters{Layers: 2, RequireMinNodes: requireMinNodes},
+				Debug:      &config.Debug{MinNodesPerLayer: 2},
+			},
+			identityKey: k,
+			fatalErrCh:  make(chan error, 1),
+			metrics:     newMetrics(false),
+		}
+		assert.NoError(srv.initLogging())
+		s := &state{
+			s:            srv,
+			log:          srv.logBackend.GetLogger("state"),
+			votingEpoch:  epoch,
+			threshold:    1,
+			documents:    make(map[uint64]*document),
+			votes:        make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+			reveals:      make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+			certificates: make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		}
+		defer openTestDB(assert, s)()
+
+		sr := new(SharedRandom)
+		commit, err := sr.Commit(epoch)
+		assert.NoError(err)
+		vote := s.sign(&s11n.Document{
+			Epoch:              epoch,
+			Topology:           [][][]byte{{mixes[0]}, {mixes[1]}},
+			Providers:          [][]byte{provider},
+			SharedRandomCommit: commit,
+		})
+		assert.NotNil(vote)
+		pk := k.PublicKey().ByteArray()
+		s.votes[epoch] = map[[eddsa.PublicKeySize]byte]*document{pk: vote}
+		s.reveals[epoch] = map[[eddsa.PublicKeySize]byte][]byte{pk: sr.Reveal()}
+
+		s.tabulate(epoch)
+		_, ok := s.certificates[epoch][pk]
+		return ok
+	}
+
+	assert.False(tabulate(true), "document signed despite a thin layer")
+	assert.True(tabulate(false), "document not signed")
+}
+
+func TestLayersMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	mixes := [][]byte{genSignedDescriptor(assert, epoch, 0), genSignedDescriptor(assert, epoch, 0)}
+	provider := genSignedDescriptor(assert, epoch, pki.LayerProvider)
+	keys := make([]*eddsa.PrivateKey, 0, 2)
+	for i := 0; i < cap(keys); i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		keys = append(keys, k)
+	}
+
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{Layers: 2},
+			Debug:      &config.Debug{MinNodesPerLayer: 1},
+		},
+		identityKey: keys[0],
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:           srv,
+		log:         srv.logBackend.GetLogger("state"),
+		votingEpoch: epoch,
+		threshold:   2,
+		votes:       make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		reveals:     make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+
+	// Each authority votes for the same nodes, in the topology for the
+	// number of layers it is configured with.
+	tally := func(topologies ...[][][]byte) (*config.Parameters, error) {
+		s.votes[epoch] = make(map[[eddsa.PublicKeySize]byte]*document)
+		s.reveals[epoch] = make(map[[eddsa.PublicKeySize]byte][]byte)
+		for i, topology := range topologies {
+			sr := new(SharedRandom)
+			commit, err := sr.Commit(epoch)
+			assert.NoError(err)
+			signed, err := s11n.SignDocument(keys[i], &s11n.Document{
+				Epoch:              epoch,
+				Topology:           topology,
+				Providers:          [][]byte{provider},
+				SharedRandomCommit: commit,
+			})
+			assert.NoError(err)
+			doc, err := s11n.VerifyAndParseDocument([]byte(signed), keys[i].PublicKey())
+			assert.NoError(err)
+			pk := keys[i].PublicKey().ByteArray()
+			s.votes[epoch][pk] = &document{doc: doc, raw: []byte(signed)}
+			s.reveals[epoch][pk] = sr.Reveal()
+		}
+		_, params, err := s.tallyVotes(epoch)
+		return params, err
+	}
+	twoLayers := [][][]byte{{mixes[0]}, {mixes[1]}}
+	oneLayer := [][][]byte{{mixes[0], mixes[1]}}
+
+	params, err := tally(twoLayers, twoLayers)
+	assert.NoError(err)
+	assert.Equal(2, params.Layers)
+
+	// Authorities that disagree on the number of layers do not reach a
+	// consensus.
+	_, err = tally(twoLayers, oneLayer)
+	assert.Error(err)
+	assert.NotEqual(votedParameters(srv.cfg.Parameters).Hash(), voteParameters(&s11n.Document{Topology: oneLayer}).Hash())
+}
+
+func TestThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		epoch         = 23
+		nrAuthorities = 5
+	)
+	keys := make([]*eddsa.PrivateKey, 0, nrAuthorities)
+	verifiers := make([]cert.Verifier, 0, nrAuthorities)
+	for i := 0; i < nrAuthorities; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		keys = append(keys, k)
+		verifiers = append(verifiers, k.PublicKey())
+	}
+
+	cfg := &config.Config{
+		Logging:    &config.Logging{Level: "DEBUG"},
+		Parameters: &config.Parameters{Layers: 1, Threshold: 4},
+		Debug:      &config.Debug{MinNodesPerLayer: 1},
+	}
+	srv := &Server{
+		cfg:         cfg,
+		identityKey: keys[0],
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:            srv,
+		log:          srv.logBackend.GetLogger("state"),
+		votingEpoch:  epoch,
+		verifiers:    verifiers,
+		threshold:    cfg.Parameters.Threshold,
+		documents:    make(map[uint64]*document),
+		certificates: make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+	defer openTestDB(assert, s)()
+
+	// Every authority signs the same document.
+	signed, err := s11n.SignDocument(keys[0], &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+	s.certificates[epoch] = map[[eddsa.PublicKeySize]byte][]byte{
+		keys[0].PublicKey().ByteArray(): signed,
+	}
+	addSignature := func(k *eddsa.PrivateKey) {
+		c, err := cert.SignMulti(k, signed)
+		assert.NoError(err)
+		s.certificates[epoch][k.PublicKey().ByteArray()] = c
+	}
+
+	// A majority of 3 out of 5 is not enough.
+	addSignature(keys[1])
+	addSignature(keys[2])
+	s.consense(epoch)
+	_, ok := s.documents[epoch]
+	assert.False(ok, "consensus with 3 of 5 signatures")
+
+	addSignature(keys[3])
+	s.consense(epoch)
+	_, ok = s.documents[epoch]
+	assert.True(ok, "no consensus with 4 of 5 signatures")
+
+	// A set of parameters only partitions the vote once it leaves too few
+	// authorities to reach the threshold on another.
+	s.dissenters = dissentersFor(len(verifiers), s.threshold)
+	assert.Equal(2, s.dissenters)
+	s.votes = make(map[uint64]map[[eddsa.PublicKeySize]byte]*document)
+	s.reveals = make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte)
+	mixes := [][]byte{genSignedDescriptor(assert, epoch, 0), genSignedDescriptor(assert, epoch, 0)}
+	provider := genSignedDescriptor(assert, epoch, pki.LayerProvider)
+	tally := func(topologies ...[][][]byte) (*config.Parameters, error) {
+		s.votes[epoch] = make(map[[eddsa.PublicKeySize]byte]*document)
+		s.reveals[epoch] = make(map[[eddsa.PublicKeySize]byte][]byte)
+		for i, topology := range topologies {
+			sr := new(SharedRandom)
+			commit, err := sr.Commit(epoch)
+			assert.NoError(err)
+			signed, err := s11n.SignDocument(keys[i], &s11n.Document{
+				Epoch:              epoch,
+				Topology:           topology,
+				Providers:          [][]byte{provider},
+				SharedRandomCommit: commit,
+			})
+			assert.NoError(err)
+			doc, err := s11n.VerifyAndParseDocument([]byte(signed), keys[i].PublicKey())
+			assert.NoError(err)
+			pk := keys[i].PublicKey().ByteArray()
+			s.votes[epoch][pk] = &document{doc: doc, raw: []byte(signed)}
+			s.reveals[epoch][pk] = sr.Reveal()
+		}
+		_, params, err := s.tallyVotes(epoch)
+		return params, err
+	}
+	oneLayer := [][][]byte{{mixes[0], mixes[1]}}
+	twoLayers := [][][]byte{{mixes[0]}, {mixes[1]}}
+
+	// The tally iterates over a map, so repeat it to cover either order.
+	for i := 0; i < 10; i++ {
+		params, err := tally(oneLayer, oneLayer, oneLayer, oneLayer, twoLayers)
+		assert.NoError(err, "a single dissenter partitioned 4 of 5")
+		if err == nil {
+			assert.Equal(1, params.Layers)
+		}
+	}
+	_, err = tally(oneLayer, oneLayer, oneLayer, twoLayers, twoLayers)
+	assert.Error(err)
+}
+
+func TestConsenseNextKeySignatures(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	keys := make([]*eddsa.PrivateKey, 0, 3)
+	verifiers := make([]cert.Verifier, 0, 3)
+	for i := 0; i < 3; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		keys = append(keys, k)
+		verifiers = append(verifiers, k.PublicKey())
+	}
+	next, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{Layers: 1},
+			Debug:      &config.Debug{MinNodesPerLayer: 1},
+		},
+		identityKey: keys[0],
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+	stranger, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	s := &state{
+		s:            srv,
+		log:          srv.logBackend.GetLogger("state"),
+		votingEpoch:  epoch,
+		verifiers:    verifiers,
+		threshold:    2,
+		documents:    make(map[uint64]*document),
+		certificates: make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		authorityNextKeys: map[[eddsa.PublicKeySize]byte][eddsa.PublicKeySize]byte{
+			keys[1].PublicKey().ByteArray(): next.PublicKey().ByteArray(),
+		},
+	}
+	defer openTestDB(assert, s)()
+
+	signed, err := s11n.SignDocument(keys[0], &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+
+	// The peer is rotating its identity key, and signs with both keys.
+	// Its certificate also carries a signature by a key that is neither.
+	peer, err := cert.SignMulti(keys[1], signed)
+	assert.NoError(err)
+	peer, err = cert.SignMulti(stranger, peer)
+	assert.NoError(err)
+	peer, err = cert.SignMulti(next, peer)
+	assert.NoError(err)
+	s.certificates[epoch] = map[[eddsa.PublicKeySize]byte][]byte{
+		keys[0].PublicKey().ByteArray(): signed,
+		keys[1].PublicKey().ByteArray(): peer,
+	}
+
+	s.consense(epoch)
+	d, ok := s.documents[epoch]
+	assert.True(ok, "no consensus")
+
+	// Clients that only know the peer's next key can verify the consensus.
+	_, _, _, err = cert.VerifyThreshold([]cert.Verifier{keys[0].PublicKey(), next.PublicKey(), keys[2].PublicKey()}, 2, d.raw)
+	assert.NoError(err)
+
+	// The signature by the unrelated key is dropped.
+	_, err = cert.GetSignature(stranger.PublicKey().Bytes(), d.raw)
+	assert.Error(err)
+	sigs, err := cert.GetSignatures(d.raw)
+	assert.NoError(err)
+	assert.Len(sigs, 3)
+}
+
+func TestPersistRound(t *testing.T) {
+	assert := assert.New(t)
+
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	defer os.RemoveAll(dataDir)
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	stranger, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	srv := &Server{
+		cfg: &config.Config{
+			Authority:  &config.Authority{DataDir: dataDir},
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{StartupWarmup: time.Hour},
+		},
+		identityKey: k,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+
+	now, _, _ := epochtime.Now()
+	epoch := now + 1
+	pk := k.PublicKey().ByteArray()
+	vote, err := s11n.SignDocument(k, &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+	reveal := []byte("our reveal")
+
+	// Vote, then stop mid-round.
+	st, err := newState(srv)
+	assert.NoError(err)
+	st.Lock()
+	assert.False(st.voted(epoch))
+	assert.NoError(st.db.Update(func(tx *bolt.Tx) error {
+		if err := st.putRoundBlob(tx, revealsBucket, epoch, pk, reveal); err != nil {
+			return err
+		}
+		return st.putRoundBlob(tx, votesBucket, epoch, pk, []byte(vote))
+	}))
+	assert.NoError(st.persist(certificatesBucket, epoch, pk, []byte(vote)))
+	assert.NoError(st.persist(votesBucket, epoch, stranger.PublicKey().ByteArray(), []byte(vote)))
+	assert.NoError(st.persist(votesBucket, now-10, pk, []byte(vote)))
+	st.Unlock()
+	st.Halt()
+
+	// After a restart, the round is restored and we won't vote again.
+	st, err = newState(srv)
+	assert.NoError(err)
+	defer st.Halt()
+	st.Lock()
+	defer st.Unlock()
+	assert.True(st.voted(epoch))
+	assert.Equal([]byte(vote), st.votes[epoch][pk].raw)
+	assert.Equal(reveal, st.reveals[epoch][pk])
+	assert.Equal([]byte(vote), st.certificates[epoch][pk])
+	_, ok := st.votes[epoch][stranger.PublicKey().ByteArray()]
+	assert.False(ok, "restored a vote from an unauthorized peer")
+	_, ok = st.votes[now-10]
+	assert.False(ok, "restored a vote for an old epoch")
+
+	// Old rounds are pruned from the database.
+	st.pruneDocuments()
+	assert.NoError(st.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(votesBucket))
+		assert.Nil(bkt.Bucket(epochToBytes(now - 10)))
+		assert.NotNil(bkt.Bucket(epochToBytes(epoch)))
+		return nil
+	}))
+}
+
+func TestDocumentRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	defer os.RemoveAll(dataDir)
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	srv := &Server{
+		cfg: &config.Config{
+			Authority:  &config.Authority{DataDir: dataDir},
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{DocumentRetentionEpochs: 3},
+			Debug:      &config.Debug{StartupWarmup: time.Hour},
+		},
+		identityKey: k,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+
+	now, _, _ := epochtime.Now()
+	epochs := []uint64{now - 5, now - 3, now - 2}
+	st, err := newState(srv)
+	assert.NoError(err)
+	st.Lock()
+	for _, epoch := range epochs {
+		signed, err := s11n.SignDocument(k, &s11n.Document{
+			Epoch:             epoch,
+			Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+			Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+			SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+		})
+		assert.NoError(err)
+		st.persistDocument(epoch, signed)
+	}
+	st.Unlock()
+	st.Halt()
+
+	// Only the documents within the retention window are restored.
+	st, err = newState(srv)
+	assert.NoError(err)
+	defer st.Halt()
+	st.Lock()
+	_, ok := st.documents[now-5]
+	assert.False(ok, "restored a document outside of the window")
+	_, ok = st.documents[now-3]
+	assert.True(ok, "did not restore a document within the window")
+	_, ok = st.documents[now-2]
+	assert.True(ok, "did not restore a document within the window")
+
+	// And older documents are deleted from disk.
+	st.prunedEpoch = 0
+	st.pruneDocuments()
+	assert.NoError(st.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(documentsBucket))
+		assert.Nil(bkt.Get(epochToBytes(now - 5)))
+		assert.NotNil(bkt.Get(epochToBytes(now - 3)))
+		return nil
+	}))
+	st.Unlock()
+
+	// Requests for pruned epochs are gone for good.
+	_, err = st.documentForEpoch(now - 5)
+	assert.Equal(errGone, err)
+	raw, err := st.documentForEpoch(now - 2)
+	assert.NoError(err)
+	assert.NotNil(raw)
+}
+
+func TestRetryPeer(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	newTestState := func(k *eddsa.PrivateKey) *state {
+		srv := &Server{
+			cfg: &config.Config{
+				Logging:    &config.Logging{Level: "DEBUG"},
+				Parameters: &config.Parameters{},
+				Debug: &config.Debug{
+					PeerDialMaxRetries: 5,
+					PeerDialBaseDelay:  1,
+				},
+			},
+			identityKey: k,
+			fatalErrCh:  make(chan error, 1),
+			metrics:     newMetrics(false),
+		}
+		assert.NoError(srv.initLogging())
+		return &state{
+			s:                     srv,
+			log:                   srv.logBackend.GetLogger("state"),
+			votingEpoch:           epoch,
+			authorizedAuthorities: make(map[[eddsa.PublicKeySize]byte]bool),
+			votes:                 make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+			certificates:          make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		}
+	}
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	s := newTestState(k)
+	p := newTestState(peerKey)
+	p.authorizedAuthorities[k.PublicKey().ByteArray()] = true
+	defer openTestDB(assert, p)()
+	peer := &config.AuthorityPeer{IdentityPublicKey: peerKey.PublicKey()}
+
+	vote, err := s11n.SignDocument(k, &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+
+	// The peer is unreachable for the first few attempts.
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	attempts := 0
+	send := func() error {
+		attempts++
+		if attempts <= 3 {
+			return unreachable
+		}
+		resp := p.onVoteUpload(&commands.Vote{
+			Epoch:     epoch,
+			PublicKey: k.PublicKey(),
+			Payload:   []byte(vote),
+		})
+		if r := resp.(*commands.VoteStatus); r.ErrorCode != commands.VoteOk {
+			return &peerRejectedError{"vote rejected"}
+		}
+		return nil
+	}
+	assert.NoError(s.retryPeer(peer, time.Now().Add(time.Minute), send))
+	assert.Equal(4, attempts)
+	_, ok := p.votes[epoch][k.PublicKey().ByteArray()]
+	assert.True(ok, "vote not collected after the peer recovered")
+
+	// Rejections are not retried.
+	attempts = 0
+	err = s.retryPeer(peer, time.Now().Add(time.Minute), func() error {
+		attempts++
+		return &peerRejectedError{"vote was too late"}
+	})
+	assert.Error(err)
+	assert.Equal(1, attempts)
+
+	// Nor are failures once the retries are exhausted, or past the deadline.
+	attempts = 0
+	assert.Equal(unreachable, s.retryPeer(peer, time.Now().Add(time.Minute), func() error {
+		attempts++
+		return unreachable
+	}))
+	assert.Equal(6, attempts)
+	attempts = 0
+	assert.Equal(unreachable, s.retryPeer(peer, time.Now(), func() error {
+		attempts++
+		return unreachable
+	}))
+	assert.Equal(1, attempts)
+
+	// The delay backs off exponentially, with jitter, up to a limit.
+	for attempt := 0; attempt < 32; attempt++ {
+		max := peerDeadline
+		if attempt < 16 && time.Second<<uint(attempt) < max {
+			max = time.Second << uint(attempt)
+		}
+		d := peerRetryDelay(time.Second, attempt)
+		assert.True(d >= max/2 && d <= max, "attempt %d: delay %v", attempt, d)
+	}
+}
+
+func TestPhaseDeadlines(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &config.Parameters{
+		DescriptorPhase: 300,
+		VotePhase:       240,
+		RevealPhase:     180,
+		SignaturePhase:  120,
+	}
+	d := newPhaseDeadlines(p)
+	assert.Equal(300*time.Second, d.mixPublish)
+	assert.Equal(540*time.Second, d.authorityVote)
+	assert.Equal(720*time.Second, d.authorityReveal)
+	assert.Equal(840*time.Second, d.publishConsensus)
+}
+
+func TestClockSkewTolerance(t *testing.T) {
+	assert := assert.New(t)
+
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	defer os.RemoveAll(dataDir)
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	srv := &Server{
+		cfg: &config.Config{
+			Authority:  &config.Authority{DataDir: dataDir},
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{EpochClockSkewTolerance: 30},
+		},
+		identityKey: k,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+
+	// The vote phase nominally ended a second ago.
+	const now = 1000
+	elapsed := epochtime.Period / 2
+	defer pinEpochClock(now, elapsed)()
+	epoch := uint64(now + 1)
+	s := &state{
+		s:   srv,
+		log: srv.logBackend.GetLogger("state"),
+		deadlines: phaseDeadlines{
+			mixPublish:       elapsed - 2*time.Second,
+			authorityVote:    elapsed - time.Second,
+			authorityReveal:  elapsed + time.Minute,
+			publishConsensus: elapsed + 2*time.Minute,
+			skewTolerance:    30 * time.Second,
+		},
+		votingEpoch:           epoch,
+		authorizedAuthorities: map[[eddsa.PublicKeySize]byte]bool{peerKey.PublicKey().ByteArray(): true},
+		votes:                 make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		reveals:               make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		certificates:          make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+	defer openTestDB(assert, s)()
+
+	late, ok := s.deadlines.withinGrace(s.deadlines.authorityVote, elapsed)
+	assert.True(ok)
+	assert.Equal(time.Second, late)
+
+	// The late vote is accepted.
+	vote, err := s11n.SignDocument(peerKey, &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+	resp := s.onVoteUpload(&commands.Vote{
+		Epoch:     epoch,
+		PublicKey: peerKey.PublicKey(),
+		Payload:   []byte(vote),
+	})
+	assert.Equal(commands.VoteOk, resp.(*commands.VoteStatus).ErrorCode)
+	_, ok = s.votes[epoch][peerKey.PublicKey().ByteArray()]
+	assert.True(ok, "late vote not recorded")
+
+	// Resuming the round just after the nominal vote deadline, the state
+	// machine keeps accepting votes until the tolerance has passed, instead
+	// of moving on to the reveals right away.
+	s.votes[epoch][s.identityPubKey()] = &document{}
+	s.state = stateBootstrap
+	wakeup := s.fsm()
+	assert.Equal(stateAcceptVote, s.state)
+	assert.Equal(epoch, s.votingEpoch)
+	select {
+	case <-wakeup:
+		t.Error("vote phase closed within the clock skew tolerance")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The state machine closes each phase only after the tolerance, and
+	// anything later than that is not within the grace period.
+	assert.Equal(29*time.Second, s.deadlines.until(s.deadlines.mixPublish, elapsed-time.Second))
+	_, ok = s.deadlines.withinGrace(s.deadlines.authorityVote, elapsed+30*time.Second)
+	assert.False(ok)
+	_, ok = s.deadlines.withinGrace(s.deadlines.authorityReveal, elapsed)
+	assert.False(ok)
+
+	// Without a tolerance, there is no grace period.
+	s.deadlines.skewTolerance = 0
+	_, ok = s.deadlines.withinGrace(s.deadlines.authorityVote, elapsed)
+	assert.False(ok)
+	assert.Equal(-time.Second, s.deadlines.until(s.deadlines.mixPublish, elapsed-time.Second))
+}
+
+func TestVoteReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{},
+		},
+		identityKey: k,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:                     srv,
+		log:                   srv.logBackend.GetLogger("state"),
+		votingEpoch:           epoch,
+		authorizedAuthorities: map[[eddsa.PublicKeySize]byte]bool{peerKey.PublicKey().ByteArray(): true},
+		votes:                 make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		reveals:               make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		certificates:          make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+	defer openTestDB(assert, s)()
+
+	genVote := func(docEpoch, commitEpoch uint64) []byte {
+		sr := new(SharedRandom)
+		commit, err := sr.Commit(commitEpoch)
+		assert.NoError(err)
+		vote, err := s11n.SignDocument(peerKey, &s11n.Document{
+			Epoch:              docEpoch,
+			Topology:           [][][]byte{{genSignedDescriptor(assert, docEpoch, 0)}},
+			Providers:          [][]byte{genSignedDescriptor(assert, docEpoch, pki.LayerProvider)},
+			SharedRandomCommit: commit,
+			SharedRandomValue:  make([]byte, s11n.SharedRandomValueLength),
+		})
+		assert.NoError(err)
+		return []byte(vote)
+	}
+	upload := func(payload []byte) uint8 {
+		resp := s.onVoteUpload(&commands.Vote{
+			Epoch:     epoch,
+			PublicKey: peerKey.PublicKey(),
+			Payload:   payload,
+		})
+		return resp.(*commands.VoteStatus).ErrorCode
+	}
+	pk := peerKey.PublicKey().ByteArray()
+
+	// A vote captured in the previous round is rejected, even though it
+	// is validly signed by an authorized peer.
+	assert.Equal(commands.VoteMalformed, upload(genVote(epoch-1, epoch-1)))
+	assert.Equal(commands.VoteMalformed, upload(genVote(epoch, epoch-1)))
+	_, ok := s.votes[epoch][pk]
+	assert.False(ok, "replayed vote recorded")
+
+	// A vote for this round is not.
+	assert.Equal(commands.VoteOk, upload(genVote(epoch, epoch)))
+	_, ok = s.votes[epoch][pk]
+	assert.True(ok, "vote not recorded")
+}
+
+func TestEquivocation(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	defer os.RemoveAll(dataDir)
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	peerKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	srv := &Server{
+		cfg: &config.Config{
+			Authority:  &config.Authority{DataDir: dataDir},
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{},
+			Debug:      &config.Debug{ExcludeEquivocators: true},
+		},
+		identityKey: k,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:                     srv,
+		log:                   srv.logBackend.GetLogger("state"),
+		votingEpoch:           epoch,
+		authorizedAuthorities: map[[eddsa.PublicKeySize]byte]bool{peerKey.PublicKey().ByteArray(): true},
+		votes:                 make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		reveals:               make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+		certificates:          make(map[uint64]map[[eddsa.PublicKeySize]byte][]byte),
+	}
+	defer openTestDB(assert, s)()
+
+	commit := make([]byte, s11n.SharedRandomLength)
+	binary.BigEndian.PutUint64(commit, epoch)
+	genVote := func(sendRate uint64) []byte {
+		vote, err := s11n.SignDocument(peerKey, &s11n.Document{
+			Epoch:              epoch,
+			SendRatePerMinute:  sendRate,
+			Topology:           [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+			Providers:          [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+			SharedRandomCommit: commit,
+			SharedRandomValue:  make([]byte, s11n.SharedRandomValueLength),
+		})
+		assert.NoError(err)
+		return []byte(vote)
+	}
+	upload := func(payload []byte) uint8 {
+		resp := s.onVoteUpload(&commands.Vote{
+			Epoch:     epoch,
+			PublicKey: peerKey.PublicKey(),
+			Payload:   payload,
+		})
+		return resp.(*commands.VoteStatus).ErrorCode
+	}
+	pk := peerKey.PublicKey().ByteArray()
+	first, second := genVote(100), genVote(200)
+
+	// The same vote twice is merely a duplicate.
+	assert.Equal(commands.VoteOk, upload(first))
+	assert.Equal(commands.VoteAlreadyReceived, upload(first))
+	assert.False(s.isExcluded(epoch, pk))
+
+	// A conflicting vote is equivocation.
+	assert.Equal(commands.VoteAlreadyReceived, upload(second))
+	assert.True(s.isExcluded(epoch, pk))
+	assert.Equal(first, s.votes[epoch][pk].raw)
+	_, ok := s.certificates[epoch][pk]
+	assert.False(ok, "conflicting vote taken as a signature")
+
+	// Both votes are saved as evidence.
+	evidence, err := filepath.Glob(filepath.Join(dataDir, "equivocation-23-*.vote"))
+	assert.NoError(err)
+	assert.Len(evidence, 2)
+	for _, f := range evidence {
+		b, err := ioutil.ReadFile(f)
+		assert.NoError(err)
+		assert.True(bytes.Equal(b, first) || bytes.Equal(b, second))
+	}
+
+	// Unless configured to, equivocators are not excluded from the tally.
+	srv.cfg.Debug.ExcludeEquivocators = false
+	assert.False(s.isExcluded(epoch, pk))
+}
+
+func TestTopologyLayersChange(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{Layers: 3},
+			Debug:      &config.Debug{},
+		},
+		fatalErrCh: make(chan error, 1),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:   srv,
+		log: srv.logBackend.GetLogger("state"),
+	}
+
+	nodes := make([]*descriptor, 0, 6)
+	for i := 0; i < cap(nodes); i++ {
+		raw := genSignedDescriptor(assert, epoch, 0)
+		verifier, err := s11n.GetVerifierFromDescriptor(raw)
+		assert.NoError(err)
+		desc, err := s11n.VerifyAndParseDescriptor(verifier, raw, epoch)
+		assert.NoError(err)
+		nodes = append(nodes, &descriptor{desc: desc, raw: raw})
+	}
+	seed := make([]byte, 32)
+	_, err := rand.Reader.Read(seed)
+	assert.NoError(err)
+
+	// prevDocument returns a previous consensus with all of the nodes in
+	// the given number of layers.
+	prevDocument := func(layers int) *pki.Document {
+		doc := &pki.Document{Topology: make([][]*pki.MixDescriptor, layers)}
+		for i, v := range nodes {
+			doc.Topology[i%layers] = append(doc.Topology[i%layers], v.desc)
+		}
+		return doc
+	}
+	check := func(topology [][][]byte, layers int) {
+		assert.Len(topology, layers)
+		nrNodes := 0
+		for _, l := range topology {
+			assert.Len(l, len(nodes)/layers)
+			nrNodes += len(l)
+		}
+		assert.Equal(len(nodes), nrNodes)
+	}
+
+	// The number of layers shrinks, and then grows, between epochs.
+	check(s.generateTopology(nodes, prevDocument(3), seed, 2), 2)
+	check(s.generateTopology(nodes, prevDocument(2), seed, 3), 3)
+	assert.Len(srv.fatalErrCh, 0)
+}
+
+func TestTopologyDeterminism(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	srv := &Server{
+		cfg: &config.Config{
+			Logging:    &config.Logging{Level: "DEBUG"},
+			Parameters: &config.Parameters{Layers: 3},
+			Debug:      &config.Debug{},
+		},
+		fatalErrCh: make(chan error, 1),
+	}
+	assert.NoError(srv.initLogging())
+	s := &state{
+		s:   srv,
+		log: srv.logBackend.GetLogger("state"),
+	}
+
+	nodes := make([]*descriptor, 0, 10)
+	for i := 0; i < cap(nodes); i++ {
+		raw := genSignedDescriptor(assert, epoch, 0)
+		verifier, err := s11n.GetVerifierFromDescriptor(raw)
+		assert.NoError(err)
+		desc, err := s11n.VerifyAndParseDescriptor(verifier, raw, epoch)
+		assert.NoError(err)
+		nodes = append(nodes, &descriptor{desc: desc, raw: raw})
+	}
+	reversed := make([]*descriptor, 0, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		reversed = append(reversed, nodes[i])
+	}
+
+	// The previous consensus has some of the nodes, and some that are gone.
+	prev := &pki.Document{Topology: make([][]*pki.MixDescriptor, 3)}
+	for i, v := range nodes[:4] {
+		prev.Topology[i%3] = append(prev.Topology[i%3], v.desc)
+	}
+	gone := genSignedDescriptor(assert, epoch, 0)
+	verifier, err := s11n.GetVerifierFromDescriptor(gone)
+	assert.NoError(err)
+	goneDesc, err := s11n.VerifyAndParseDescriptor(verifier, gone, epoch)
+	assert.NoError(err)
+	prev.Topology[0] = append(prev.Topology[0], goneDesc)
+
+	seed := make([]byte, 32)
+	_, err = rand.Reader.Read(seed)
+	assert.NoError(err)
+
+	// Running the assignment with the same inputs, in any order, must
+	// produce byte-identical topologies, as the authorities would
+	// otherwise fail to converge.
+	serialize := func(topology [][][]byte) []byte {
+		var b bytes.Buffer
+		for _, l := range topology {
+			b.WriteByte(byte(len(l)))
+			for _, raw := range l {
+				b.Write(raw)
+			}
+		}
+		return b.Bytes()
+	}
+	random := serialize(s.generateRandomTopology(nodes, seed, 3))
+	stable := serialize(s.generateTopology(nodes, prev, seed, 3))
+	for i := 0; i < 10; i++ {
+		assert.Equal(random, serialize(s.generateRandomTopology(nodes, seed, 3)))
+		assert.Equal(random, serialize(s.generateRandomTopology(reversed, seed, 3)))
+		assert.Equal(stable, serialize(s.generateTopology(nodes, prev, seed, 3)))
+		assert.Equal(stable, serialize(s.generateTopology(reversed, prev, seed, 3)))
+	}
+
+	// The seed does matter.
+	otherSeed := make([]byte, 32)
+	assert.NotEqual(random, serialize(s.generateRandomTopology(nodes, otherSeed, 3)))
+	assert.Len(srv.fatalErrCh, 0)
+}
+
+func TestDescriptorDeduplication(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	mixKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+
+	// The node restarts, and uploads a second descriptor with a different
+	// address.
+	sign := func(addr string) ([]byte, *pki.MixDescriptor) {
+		desc := &pki.MixDescriptor{
+			Name:        "node.example.org",
+			IdentityKey: identityKey.PublicKey(),
+			LinkKey:     linkKey.PublicKey(),
+			MixKeys:     map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+			Addresses: map[pki.Transport][]string{
+				pki.TransportTCPv4: []string{addr},
+			},
+		}
+		signed, err := s11n.SignDescriptor(identityKey, desc)
+		assert.NoError(err)
+		return signed, desc
+	}
+	rawA, descA := sign("192.0.2.1:4242")
+	rawB, descB := sign("192.0.2.2:4242")
+	assert.NotEqual(supersedes(rawA, rawB), supersedes(rawB, rawA))
+
+	newState := func() *state {
+		srv := &Server{
+			cfg: &config.Config{
+				Logging: &config.Logging{Level: "DEBUG"},
+			},
+			fatalErrCh: make(chan error, 1),
+		}
+		assert.NoError(srv.initLogging())
+		return &state{
+			s:           srv,
+			log:         srv.logBackend.GetLogger("state"),
+			updateCh:    make(chan interface{}, 1),
+			documents:   make(map[uint64]*document),
+			descriptors: make(map[uint64]map[[eddsa.PublicKeySize]byte]*descriptor),
+			votes:       make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+		}
+	}
+
+	// Authorities receiving the uploads in either order keep the same one.
+	first := newState()
+	defer openTestDB(assert, first)()
+	assert.NoError(first.onDescriptorUpload(rawA, descA, epoch))
+	assert.NoError(first.onDescriptorUpload(rawB, descB, epoch))
+	second := newState()
+	defer openTestDB(assert, second)()
+	assert.NoError(second.onDescriptorUpload(rawB, descB, epoch))
+	assert.NoError(second.onDescriptorUpload(rawA, descA, epoch))
+
+	pk := identityKey.PublicKey().ByteArray()
+	kept := first.descriptors[epoch][pk].raw
+	assert.Equal(kept, second.descriptors[epoch][pk].raw)
+	if supersedes(rawA, rawB) {
+		assert.Equal(rawA, kept)
+	} else {
+		assert.Equal(rawB, kept)
+	}
+}
+
+func TestObserverMode(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	dataDir, err := ioutil.TempDir("", "authority")
+	assert.NoError(err)
+	defer os.RemoveAll(dataDir)
+	observer, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	peers := make([]*eddsa.PrivateKey, 0, 3)
+	cfg := &config.Config{
+		Authority:  &config.Authority{DataDir: dataDir},
+		Logging:    &config.Logging{Level: "DEBUG"},
+		Parameters: &config.Parameters{},
+		Debug:      &config.Debug{StartupWarmup: time.Hour, ObserverMode: true},
+	}
+	for i := 0; i < 3; i++ {
+		k, err := eddsa.NewKeypair(rand.Reader)
+		assert.NoError(err)
+		peers = append(peers, k)
+		cfg.Authorities = append(cfg.Authorities, &config.AuthorityPeer{IdentityPublicKey: k.PublicKey()})
+	}
+	srv := &Server{
+		cfg:         cfg,
+		identityKey: observer,
+		fatalErrCh:  make(chan error, 1),
+		metrics:     newMetrics(false),
+	}
+	assert.NoError(srv.initLogging())
+
+	// The observer is not one of the verifiers, so the threshold is a
+	// majority of the voting authorities alone.
+	s, err := newState(srv)
+	assert.NoError(err)
+	defer s.Halt()
+	s.Lock()
+	defer s.Unlock()
+	assert.Len(s.verifiers, 3)
+	assert.False(s.isVerifier(observer.PublicKey().Bytes()))
+	assert.Equal(2, s.threshold)
+
+	signed, err := s11n.SignDocument(peers[0], &s11n.Document{
+		Epoch:             epoch,
+		Topology:          [][][]byte{{genSignedDescriptor(assert, epoch, 0)}},
+		Providers:         [][]byte{genSignedDescriptor(assert, epoch, pki.LayerProvider)},
+		SharedRandomValue: make([]byte, s11n.SharedRandomValueLength),
+	})
+	assert.NoError(err)
+	raw, err := cert.GetCertified(signed)
+	assert.NoError(err)
+	s.observed[epoch] = sha256b64(raw)
+
+	// A signature by the observer does not count towards the threshold.
+	withObserver, err := cert.SignMulti(observer, signed)
+	assert.NoError(err)
+	s.certificates[epoch] = map[[eddsa.PublicKeySize]byte][]byte{
+		peers[0].PublicKey().ByteArray(): withObserver,
+	}
+	s.consense(epoch)
+	_, ok := s.documents[epoch]
+	assert.False(ok, "consensus with 1 of 3 signatures and the observer's")
+
+	c, err := cert.SignMulti(peers[1], signed)
+	assert.NoError(err)
+	s.certificates[epoch][peers[1].PublicKey().ByteArray()] = c
+	s.consense(epoch)
+	_, ok = s.documents[epoch]
+	assert.True(ok, "no consensus with 2 of 3 signatures")
+}
+
+func TestVoteSphinxGeometry(t *testing.T) {
+	assert := assert.New(t)
+
+	// The geometry is carried in votes iff it is configured, and the
+	// parameters agree either way.
+	p := &config.Parameters{SphinxHops: 5, SphinxPerHopRoutingInfoLength: 65, SphinxPayloadLength: 51200}
+	vote := &s11n.Document{SphinxGeometry: sphinxGeometry(p)}
+	assert.Equal(&s11n.SphinxGeometry{Hops: 5, PerHopRoutingInfoLength: 65, PayloadLength: 51200}, vote.SphinxGeometry)
+	assert.Equal(votedParameters(p).Hash(), voteParameters(vote).Hash())
+
+	p = &config.Parameters{SphinxHops: 5}
+	vote = &s11n.Document{SphinxGeometry: sphinxGeometry(p)}
+	assert.Nil(vote.SphinxGeometry)
+	assert.Equal(votedParameters(p).Hash(), voteParameters(vote).Hash())
+}
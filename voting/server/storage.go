@@ -0,0 +1,191 @@
+// storage.go - Katzenpost voting authority persisted state encoding.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/rand"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	storageFlagCompressed = 1 << 0
+	storageFlagEncrypted  = 1 << 1
+
+	storageKey         = "storage"
+	storageSaltLength  = 16
+	storageKeyContext  = "katzenpost-authority-storage-v0"
+	storageArgonTime   = 1
+	storageArgonMemory = 64 * 1024
+	storageArgonLanes  = 4
+)
+
+var errStorageKey = errors.New("state: Storage.EncryptionKeyFile does not match the persisted state")
+
+// blobCodec transparently compresses and encrypts the blobs stored in the
+// persistence store.
+type blobCodec struct {
+	flags byte
+	aead  cipher.AEAD
+}
+
+func (c *blobCodec) seal(b []byte) ([]byte, error) {
+	if c.flags&storageFlagCompressed != 0 {
+		buf := new(bytes.Buffer)
+		w, err := flate.NewWriter(buf, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(b); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	}
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		b = c.aead.Seal(nonce, nonce, b, nil)
+	}
+	return b, nil
+}
+
+func (c *blobCodec) open(b []byte) ([]byte, error) {
+	if c.aead != nil {
+		nonceSize := c.aead.NonceSize()
+		if len(b) < nonceSize {
+			return nil, errors.New("state: truncated persisted blob")
+		}
+		var err error
+		if b, err = c.aead.Open(nil, b[:nonceSize], b[nonceSize:], nil); err != nil {
+			return nil, fmt.Errorf("state: failed to decrypt persisted blob: %v", err)
+		}
+	}
+	if c.flags&storageFlagCompressed != 0 {
+		r := flate.NewReader(bytes.NewReader(b))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return b, nil
+}
+
+func newBlobCodec(flags byte, passphrase, salt []byte) (*blobCodec, error) {
+	c := &blobCodec{flags: flags}
+	if flags&storageFlagEncrypted != 0 {
+		key := argon2.IDKey(passphrase, salt, storageArgonTime, storageArgonMemory, storageArgonLanes, 32)
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func storageFlags(cfg *config.Storage) byte {
+	var flags byte
+	if cfg == nil {
+		return flags
+	}
+	if cfg.Compress {
+		flags |= storageFlagCompressed
+	}
+	if cfg.EncryptionKeyFile != "" {
+		flags |= storageFlagEncrypted
+	}
+	return flags
+}
+
+func loadStoragePassphrase(cfg *config.Storage) ([]byte, error) {
+	if cfg == nil || cfg.EncryptionKeyFile == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(cfg.EncryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("state: failed to read Storage.EncryptionKeyFile: %v", err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("state: Storage.EncryptionKeyFile '%v' is empty", cfg.EncryptionKeyFile)
+	}
+	return b, nil
+}
+
+// initStorage initializes the blob codec from the configuration, and either
+// records the settings in the metadata bucket of a newly created store, or
+// ensures that they match those of an existing store.
+func (s *state) initStorage(metadata *bolt.Bucket, isNew bool) error {
+	flags := storageFlags(s.s.cfg.Storage)
+	passphrase, err := loadStoragePassphrase(s.s.cfg.Storage)
+	if err != nil {
+		return err
+	}
+
+	if isNew {
+		salt := make([]byte, storageSaltLength)
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+		if s.storage, err = newBlobCodec(flags, passphrase, salt); err != nil {
+			return err
+		}
+		check, err := s.storage.seal([]byte(storageKeyContext))
+		if err != nil {
+			return err
+		}
+		rec := append([]byte{flags}, salt...)
+		return metadata.Put([]byte(storageKey), append(rec, check...))
+	}
+
+	// Stores created before the settings were recorded are plaintext.
+	rec := metadata.Get([]byte(storageKey))
+	if rec == nil {
+		rec = make([]byte, 1+storageSaltLength)
+	}
+	if len(rec) < 1+storageSaltLength {
+		return errors.New("state: corrupted storage settings")
+	}
+	if rec[0] != flags {
+		return fmt.Errorf("state: Storage settings (%#x) differ from those of the persisted state (%#x)", flags, rec[0])
+	}
+	if s.storage, err = newBlobCodec(flags, passphrase, rec[1:1+storageSaltLength]); err != nil {
+		return err
+	}
+	if flags&storageFlagEncrypted != 0 {
+		check, err := s.storage.open(rec[1+storageSaltLength:])
+		if err != nil || !bytes.Equal(check, []byte(storageKeyContext)) {
+			return errStorageKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// storage_test.go - Voting authority persisted state encoding tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobCodec(t *testing.T) {
+	require := require.New(t)
+
+	salt := make([]byte, storageSaltLength)
+	blob := bytes.Repeat([]byte("katzenpost descriptor "), 100)
+
+	for _, flags := range []byte{0, storageFlagCompressed, storageFlagEncrypted, storageFlagCompressed | storageFlagEncrypted} {
+		c, err := newBlobCodec(flags, []byte("passphrase"), salt)
+		require.NoError(err, "newBlobCodec(%#x)", flags)
+		sealed, err := c.seal(blob)
+		require.NoError(err, "seal(%#x)", flags)
+		opened, err := c.open(sealed)
+		require.NoError(err, "open(%#x)", flags)
+		require.Equal(blob, opened, "round trip (%#x)", flags)
+
+		if flags&storageFlagCompressed != 0 {
+			require.True(len(sealed) < len(blob), "compressed (%#x)", flags)
+		}
+		if flags&storageFlagEncrypted != 0 {
+			require.False(bytes.Contains(sealed, []byte("katzenpost")), "encrypted (%#x)", flags)
+
+			wrong, err := newBlobCodec(flags, []byte("wrong passphrase"), salt)
+			require.NoError(err)
+			_, err = wrong.open(sealed)
+			require.Error(err, "open with the wrong key (%#x)", flags)
+		}
+	}
+}
+
+func TestStorageKey(t *testing.T) {
+	require := require.New(t)
+
+	dataDir, err := ioutil.TempDir("", "authority")
+	require.NoError(err)
+	defer os.RemoveAll(dataDir)
+	keyFile := filepath.Join(dataDir, "storage.key")
+	require.NoError(ioutil.WriteFile(keyFile, []byte("correct horse battery staple\n"), 0600))
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	openState := func(storage *config.Storage) error {
+		srv := &Server{
+			cfg: &config.Config{
+				Authority: &config.Authority{DataDir: dataDir},
+				Logging:   &config.Logging{Level: "DEBUG"},
+				Storage:   storage,
+				Debug:     &config.Debug{},
+			},
+			identityKey: k,
+		}
+		require.NoError(srv.initLogging())
+		st, err := newState(srv)
+		if err == nil {
+			st.Halt()
+		}
+		return err
+	}
+
+	// Create, then reopen the encrypted state.
+	storage := &config.Storage{Compress: true, EncryptionKeyFile: keyFile}
+	require.NoError(openState(storage))
+	require.NoError(openState(storage))
+
+	// Startup fails with the wrong key.
+	require.NoError(ioutil.WriteFile(keyFile, []byte("Tr0ub4dor&3"), 0600))
+	require.Equal(errStorageKey, openState(storage))
+
+	// Or a missing key.
+	require.NoError(os.Remove(keyFile))
+	require.Error(openState(storage))
+
+	// Or if encryption is disabled.
+	require.Error(openState(&config.Storage{Compress: true}))
+}
@@ -0,0 +1,48 @@
+// testhooks.go - Katzenpost voting authority test hooks.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/pki"
+)
+
+// injectDescriptor adds the descriptor d for epoch as if the node had
+// uploaded it, bypassing the whitelist and the checks of the wire protocol.
+// As only the node can sign its descriptor, a copy of d is signed with a
+// freshly generated identity key; d itself is left untouched.  It backs
+// InjectDescriptor, and is not called by the server itself.
+func (s *Server) injectDescriptor(epoch uint64, d *pki.MixDescriptor) error {
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	if err != nil {
+		return err
+	}
+	signed := *d
+	signed.IdentityKey = identityKey.PublicKey()
+	raw, err := s11n.SignDescriptor(identityKey, &signed)
+	if err != nil {
+		return err
+	}
+	desc, err := s11n.VerifyAndParseDescriptor(identityKey.PublicKey(), raw, epoch)
+	if err != nil {
+		return err
+	}
+	s.log.Warningf("Injecting descriptor for Node %v for epoch %v.", desc.IdentityKey, epoch)
+	return s.state.onDescriptorUpload(raw, desc, epoch)
+}
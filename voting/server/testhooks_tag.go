@@ -0,0 +1,34 @@
+//go:build testhooks
+// +build testhooks
+
+// testhooks_tag.go - Katzenpost voting authority exported test hooks.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import "github.com/katzenpost/core/pki"
+
+// InjectDescriptor adds the descriptor d for epoch as if the node had
+// uploaded it, bypassing the whitelist and the checks of the wire protocol,
+// so that tests can seed descriptors without running any nodes.  As only
+// the node can sign its descriptor, a copy of d is signed with a freshly
+// generated identity key; d itself is left untouched.
+//
+// InjectDescriptor only exists when built with the `testhooks` build tag,
+// so that it can not be called from a production build.
+func (s *Server) InjectDescriptor(epoch uint64, d *pki.MixDescriptor) error {
+	return s.injectDescriptor(epoch, d)
+}
@@ -0,0 +1,81 @@
+// testhooks_test.go - Voting authority test hooks tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectDescriptor(t *testing.T) {
+	assert := assert.New(t)
+
+	const epoch = 23
+	srv := &Server{
+		cfg: &config.Config{
+			Logging: &config.Logging{Level: "DEBUG"},
+		},
+		fatalErrCh: make(chan error, 1),
+	}
+	assert.NoError(srv.initLogging())
+	srv.log = srv.logBackend.GetLogger("authority")
+	srv.state = &state{
+		s:           srv,
+		log:         srv.logBackend.GetLogger("state"),
+		updateCh:    make(chan interface{}, 1),
+		documents:   make(map[uint64]*document),
+		descriptors: make(map[uint64]map[[eddsa.PublicKeySize]byte]*descriptor),
+		votes:       make(map[uint64]map[[eddsa.PublicKeySize]byte]*document),
+	}
+	defer openTestDB(assert, srv.state)()
+
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	mixKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	d := &pki.MixDescriptor{
+		Name:    "node.example.org",
+		LinkKey: linkKey.PublicKey(),
+		MixKeys: map[uint64]*ecdh.PublicKey{epoch: mixKey.PublicKey()},
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+	}
+	assert.NoError(srv.injectDescriptor(epoch, d))
+
+	// The caller's descriptor is left untouched, and a copy is signed with
+	// the identity key it was given.
+	assert.Nil(d.IdentityKey)
+	assert.Len(srv.state.descriptors[epoch], 1)
+	for id, injected := range srv.state.descriptors[epoch] {
+		identityKey := new(eddsa.PublicKey)
+		assert.NoError(identityKey.FromBytes(id[:]))
+		desc, err := s11n.VerifyAndParseDescriptor(identityKey, injected.raw, epoch)
+		assert.NoError(err)
+		assert.Equal(d.Name, desc.Name)
+	}
+
+	// Malformed descriptors are rejected.
+	assert.Error(srv.injectDescriptor(epoch, &pki.MixDescriptor{Name: "node.example.org"}))
+}
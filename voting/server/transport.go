@@ -0,0 +1,243 @@
+// transport.go - Katzenpost voting authority network transports.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/katzenpost/authority/voting/server/config"
+)
+
+// Transport is the network that the authority accepts connections from
+// nodes, clients and peer authorities on, and dials the peer authorities
+// over.  The metrics and health check servers always use TCP.
+type Transport interface {
+	// Listen returns a listener for connections to the address addr.
+	Listen(addr string) (net.Listener, error)
+
+	// DialContext connects to the address addr.
+	DialContext(ctx context.Context, addr string) (net.Conn, error)
+}
+
+type tcpTransport struct {
+	backlog   int
+	keepAlive time.Duration
+}
+
+func (t *tcpTransport) Listen(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil || t.backlog <= 0 {
+		return l, err
+	}
+	if err = setListenBacklog(l.(*net.TCPListener), t.backlog); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("server: failed to set listen backlog: %v", err)
+	}
+	return l, nil
+}
+
+func (t *tcpTransport) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	d := net.Dialer{KeepAlive: t.keepAlive}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// dialPeer connects to the first reachable address of the peer authority,
+// trying each in order.  The connection is subject to Debug.PeerIdleTimeout.
+func (s *Server) dialPeer(peer *config.AuthorityPeer) (net.Conn, error) {
+	err := fmt.Errorf("server: peer %v has no addresses", peer.IdentityPublicKey)
+	for _, a := range peer.Addresses {
+		ctx, cancel := context.WithTimeout(context.Background(), peerDeadline)
+		var conn net.Conn
+		conn, err = s.transport.DialContext(ctx, a)
+		cancel()
+		if err == nil {
+			if idle := time.Duration(s.cfg.Debug.PeerIdleTimeout) * time.Second; idle > 0 {
+				conn = &idleConn{Conn: conn, idle: idle}
+			}
+			return conn, nil
+		}
+		s.log.Debugf("Peer %v: Failed to dial '%v': %v", peer.IdentityPublicKey, a, err)
+	}
+	return nil, err
+}
+
+// idleConn is a net.Conn that fails any Read or Write that makes no
+// progress for the idle timeout, however far away the deadline set with
+// SetDeadline, SetReadDeadline or SetWriteDeadline is, so that half-open
+// connections are detected early.
+type idleConn struct {
+	net.Conn
+
+	sync.Mutex
+	idle          time.Duration
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// nextDeadline returns the deadline for the next Read or Write, given the
+// caller's deadline for it.
+func (c *idleConn) nextDeadline(deadline time.Time) time.Time {
+	t := time.Now().Add(c.idle)
+	if !deadline.IsZero() && deadline.Before(t) {
+		return deadline
+	}
+	return t
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.Lock()
+	t := c.nextDeadline(c.readDeadline)
+	c.Unlock()
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.Lock()
+	t := c.nextDeadline(c.writeDeadline)
+	c.Unlock()
+	if err := c.Conn.SetWriteDeadline(t); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *idleConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(c.nextDeadline(t))
+}
+
+func (c *idleConn) SetWriteDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(c.nextDeadline(t))
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+// MemoryTransport is a Transport that connects the listeners and dialers
+// that share it with in-memory pipes, for testing several authorities
+// within a single process without binding to any ports.  The addresses are
+// arbitrary strings.
+type MemoryTransport struct {
+	sync.Mutex
+
+	listeners map[string]*memoryListener
+}
+
+// Listen returns a listener for connections to the address addr.
+func (t *MemoryTransport) Listen(addr string) (net.Listener, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.listeners[addr]; ok {
+		return nil, fmt.Errorf("memory transport: address '%v' already in use", addr)
+	}
+	if t.listeners == nil {
+		t.listeners = make(map[string]*memoryListener)
+	}
+	l := &memoryListener{
+		t:       t,
+		addr:    memoryAddr(addr),
+		connCh:  make(chan net.Conn),
+		closeCh: make(chan interface{}),
+	}
+	t.listeners[addr] = l
+	return l, nil
+}
+
+// DialContext connects to the address addr, which must have a listener
+// created by Listen.
+func (t *MemoryTransport) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	t.Lock()
+	l, ok := t.listeners[addr]
+	t.Unlock()
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: memoryNetwork, Addr: memoryAddr(addr), Err: errors.New("connection refused")}
+	}
+
+	clientConn, serverConn := net.Pipe()
+	select {
+	case l.connCh <- serverConn:
+		return clientConn, nil
+	case <-l.closeCh:
+		return nil, &net.OpError{Op: "dial", Net: memoryNetwork, Addr: l.addr, Err: errors.New("connection refused")}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+const memoryNetwork = "memory"
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return memoryNetwork
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+type memoryListener struct {
+	t         *MemoryTransport
+	addr      memoryAddr
+	connCh    chan net.Conn
+	closeCh   chan interface{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.closeCh:
+		return nil, &net.OpError{Op: "accept", Net: memoryNetwork, Addr: l.addr, Err: errListenerClosed}
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closeCh)
+
+		l.t.Lock()
+		defer l.t.Unlock()
+		delete(l.t.listeners, string(l.addr))
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,364 @@
+// transport_test.go - Katzenpost voting authority network transport tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/voting/client"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/log"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	require := require.New(t)
+
+	tr := new(MemoryTransport)
+	ctx := context.Background()
+	l, err := tr.Listen("a")
+	require.NoError(err)
+	_, err = tr.Listen("a")
+	require.Error(err, "address reuse")
+	_, err = tr.DialContext(ctx, "b")
+	require.Error(err, "dial without a listener")
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 4)
+		if _, err := conn.Read(b); err == nil {
+			conn.Write(b)
+		}
+	}()
+	conn, err := tr.DialContext(ctx, "a")
+	require.NoError(err)
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(err)
+	b := make([]byte, 4)
+	_, err = conn.Read(b)
+	require.NoError(err)
+	require.Equal("ping", string(b))
+	conn.Close()
+
+	// Closed listeners fail permanently, and free the address.
+	require.NoError(l.Close())
+	_, err = l.Accept()
+	require.Error(err)
+	e, ok := err.(net.Error)
+	require.True(ok)
+	require.False(e.Temporary())
+	_, err = tr.DialContext(ctx, "a")
+	require.Error(err)
+	l, err = tr.Listen("a")
+	require.NoError(err)
+	l.Close()
+}
+
+func TestServerMemoryTransport(t *testing.T) {
+	require := require.New(t)
+
+	tr := new(MemoryTransport)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.Addresses = []string{"authority-0"}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+
+	s, err := NewWithTransport(cfg, tr)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// A client reaches the authority over the same transport.
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	c, err := client.New(&client.Config{
+		LogBackend: logBackend,
+		Authorities: []*config.AuthorityPeer{{
+			IdentityPublicKey: s.IdentityKey(),
+			LinkPublicKey:     s.linkKey.PublicKey(),
+			Addresses:         cfg.Authority.Addresses,
+		}},
+		DialContextFn: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tr.DialContext(ctx, addr)
+		},
+	})
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	epoch, _, _ := epochtime.Now()
+	_, _, err = c.Get(ctx, epoch)
+	require.Equal(pki.ErrNoDocument, err)
+}
+
+func TestMemoryTransportRound(t *testing.T) {
+	require := require.New(t)
+
+	const epoch = 1000
+	defer pinEpochClock(epoch, 0)()
+	tr := new(MemoryTransport)
+	servers, cleanup := genTestAuthorities(require, tr, 4, nil)
+	defer cleanup()
+	runTestRound(t, servers, epoch+1)
+
+	// Clients fetch and verify the consensus over the same transport.
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	var peers []*config.AuthorityPeer
+	for _, s := range servers {
+		peers = append(peers, &config.AuthorityPeer{
+			IdentityPublicKey: s.IdentityKey(),
+			LinkPublicKey:     s.linkKey.PublicKey(),
+			Addresses:         s.cfg.Authority.Addresses,
+		})
+	}
+	c, err := client.New(&client.Config{
+		LogBackend:  logBackend,
+		Authorities: peers,
+		DialContextFn: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tr.DialContext(ctx, addr)
+		},
+	})
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	doc, _, err := c.Get(ctx, epoch+1)
+	require.NoError(err)
+	require.Equal(uint64(epoch+1), doc.Epoch)
+}
+
+func TestMaxConcurrentConnections(t *testing.T) {
+	require := require.New(t)
+
+	const max = 2
+
+	tr := new(MemoryTransport)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.Addresses = []string{"authority-0"}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	cfg.Debug.MaxConcurrentConnections = max
+
+	s, err := NewWithTransport(cfg, tr)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Hold the connection slots open, by never completing the handshake.
+	ctx := context.Background()
+	var held []net.Conn
+	for i := 0; i < max; i++ {
+		conn, err := tr.DialContext(ctx, "authority-0")
+		require.NoError(err)
+		defer conn.Close()
+		held = append(held, conn)
+	}
+
+	// Connections past the limit are closed right away.
+	conn, err := tr.DialContext(ctx, "authority-0")
+	require.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.Equal(io.EOF, err)
+	conn.Close()
+
+	// While the connections in progress are left alone.
+	for _, conn := range held {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = conn.Read(make([]byte, 1))
+		require.NotEqual(io.EOF, err)
+	}
+
+	// Closing one frees up a slot for a client.
+	held[0].Close()
+	for i := 0; atomic.LoadInt32(&s.nrConns) >= max; i++ {
+		if i > 500 {
+			t.Fatalf("connection slot was not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	logBackend, err := log.New("", "DEBUG", false)
+	require.NoError(err)
+	c, err := client.New(&client.Config{
+		LogBackend: logBackend,
+		Authorities: []*config.AuthorityPeer{{
+			IdentityPublicKey: s.IdentityKey(),
+			LinkPublicKey:     s.linkKey.PublicKey(),
+			Addresses:         cfg.Authority.Addresses,
+		}},
+		DialContextFn: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tr.DialContext(ctx, addr)
+		},
+	})
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	epoch, _, _ := epochtime.Now()
+	_, _, err = c.Get(ctx, epoch)
+	require.Equal(pki.ErrNoDocument, err)
+}
+
+func TestListenBacklog(t *testing.T) {
+	require := require.New(t)
+
+	tr := &tcpTransport{backlog: 16}
+	l, err := tr.Listen("127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(err)
+	conn.Close()
+}
+
+func TestDialPeer(t *testing.T) {
+	require := require.New(t)
+
+	tr := new(MemoryTransport)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.Addresses = []string{"[::1]:30001"}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+
+	s, err := NewWithTransport(cfg, tr)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Unreachable addresses are skipped, in order.
+	peer := &config.AuthorityPeer{
+		IdentityPublicKey: s.IdentityKey(),
+		Addresses:         []string{"authority.example.org:443", "[::1]:30001"},
+	}
+	conn, err := s.dialPeer(peer)
+	require.NoError(err)
+	conn.Close()
+
+	peer.Addresses = peer.Addresses[:1]
+	_, err = s.dialPeer(peer)
+	require.Error(err)
+}
+
+// stallingTransport is a MemoryTransport, the first dial through which
+// returns a half-open connection that never delivers any data.
+type stallingTransport struct {
+	MemoryTransport
+
+	nrDials int32
+}
+
+func (t *stallingTransport) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	if atomic.AddInt32(&t.nrDials, 1) == 1 {
+		conn, _ := net.Pipe()
+		return conn, nil
+	}
+	return t.MemoryTransport.DialContext(ctx, addr)
+}
+
+func TestPeerIdleTimeout(t *testing.T) {
+	require := require.New(t)
+
+	tr := new(stallingTransport)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Authority.Addresses = []string{"authority-0"}
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	cfg.Debug.PeerIdleTimeout = 1
+	cfg.Debug.PeerDialBaseDelay = 10
+
+	s, err := NewWithTransport(cfg, tr)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// The authority is its own peer, so that the exchange completes once
+	// the stalled connection is abandoned.
+	peer := &config.AuthorityPeer{
+		IdentityPublicKey: s.IdentityKey(),
+		LinkPublicKey:     s.linkKey.PublicKey(),
+		Addresses:         cfg.Authority.Addresses,
+	}
+	st := s.state
+	st.Lock()
+	st.authorizedAuthorities[st.identityPubKey()] = true
+	st.authorityLinkKeys[st.identityPubKey()] = peer.LinkPublicKey
+	st.Unlock()
+
+	epoch, _, _ := epochtime.Now()
+	start := time.Now()
+	err = st.retryPeer(peer, start.Add(peerDeadline), func() error {
+		return st.sendRevealToPeer(peer, make([]byte, 40), epoch+1)
+	})
+
+	// The reveal reached the authority, which answers it as it sees fit,
+	// on the second connection, long before the exchange deadline.
+	if err != nil {
+		_, ok := err.(*peerRejectedError)
+		require.True(ok, "%v", err)
+	}
+	require.Equal(int32(2), atomic.LoadInt32(&tr.nrDials))
+	require.True(time.Since(start) < peerDeadline/2)
+}
+
+func TestIdleConnDeadlines(t *testing.T) {
+	require := require.New(t)
+
+	a, b := net.Pipe()
+	defer b.Close()
+	c := &idleConn{Conn: a, idle: time.Hour}
+	defer c.Close()
+
+	// A read deadline set on its own still bounds the read, and is not
+	// pushed back to the idle timeout by the Read.
+	require.NoError(c.SetReadDeadline(time.Now().Add(50 * time.Millisecond)))
+	start := time.Now()
+	_, err := c.Read(make([]byte, 1))
+	require.Error(err)
+	nerr, ok := err.(net.Error)
+	require.True(ok, "%v", err)
+	require.True(nerr.Timeout())
+	require.True(time.Since(start) < time.Minute)
+
+	// Likewise a write deadline set on its own bounds the write.
+	require.NoError(c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)))
+	start = time.Now()
+	_, err = c.Write([]byte{0})
+	require.Error(err)
+	nerr, ok = err.(net.Error)
+	require.True(ok, "%v", err)
+	require.True(nerr.Timeout())
+	require.True(time.Since(start) < time.Minute)
+
+	// The idle timeout still applies without a caller deadline.
+	c.idle = 50 * time.Millisecond
+	require.NoError(c.SetDeadline(time.Time{}))
+	_, err = c.Read(make([]byte, 1))
+	nerr, ok = err.(net.Error)
+	require.True(ok, "%v", err)
+	require.True(nerr.Timeout())
+}
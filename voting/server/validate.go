@@ -0,0 +1,142 @@
+// validate.go - Katzenpost voting authority configuration validation.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+)
+
+// ValidateConfigFile loads the configuration file f exactly as the authority
+// does at startup, and additionally checks the peer authorities against
+// this authority's own keys and addresses, so that mistakes can be caught
+// before deployment.  Nothing is started, and the DataDir is not modified:
+// the keys are only checked if they already exist.  It returns nil iff the
+// configuration is usable.
+func ValidateConfigFile(f string) error {
+	cfg, err := config.LoadFile(f, false)
+	if err != nil {
+		return err
+	}
+	return validateConfig(cfg)
+}
+
+func validateConfig(cfg *config.Config) error {
+	dataDir := cfg.Authority.DataDir
+	if _, err := os.Stat(dataDir); err == nil && !cfg.Debug.AllowUnsafePermissions {
+		if err = checkDataDirPermissions(dataDir); err != nil {
+			return err
+		}
+	}
+	identityKey, err := existingIdentityKey(cfg)
+	if err != nil {
+		return err
+	}
+	linkKey, err := existingLinkKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	ownAddrs := make(map[string]bool)
+	for _, v := range cfg.Authority.Addresses {
+		ownAddrs[v] = true
+	}
+	seen := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, peer := range cfg.Authorities {
+		if err := peer.Validate(); err != nil {
+			return err
+		}
+		pk := peer.IdentityPublicKey.ByteArray()
+		if seen[pk] {
+			return fmt.Errorf("server: Authorities: IdentityPublicKey %v is present more than once", peer.IdentityPublicKey)
+		}
+		seen[pk] = true
+		if identityKey != nil && pk == identityKey.ByteArray() {
+			return fmt.Errorf("server: Authorities: IdentityPublicKey %v is this authority's own identity key", peer.IdentityPublicKey)
+		}
+		if next := cfg.Authority.NextIdentityKey; next != nil && pk == next.ByteArray() {
+			return fmt.Errorf("server: Authorities: IdentityPublicKey %v is this authority's NextIdentityKey", peer.IdentityPublicKey)
+		}
+		if linkKey != nil && peer.LinkPublicKey != nil && linkKey.Equal(peer.LinkPublicKey) {
+			return fmt.Errorf("server: Authorities: peer %v has this authority's own link key", peer.IdentityPublicKey)
+		}
+		for _, v := range peer.Addresses {
+			if ownAddrs[v] {
+				return fmt.Errorf("server: Authorities: peer %v Address '%v' is one of this authority's own", peer.IdentityPublicKey, v)
+			}
+		}
+	}
+	return nil
+}
+
+// existingIdentityKey returns the identity public key that the authority
+// would use, or nil if it would be generated at startup.
+func existingIdentityKey(cfg *config.Config) (*eddsa.PublicKey, error) {
+	if cfg.Debug.IdentityKey != nil {
+		return cfg.Debug.IdentityKey.PublicKey(), nil
+	}
+	k, err := externalIdentityKey(cfg.Debug)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		privFile := filepath.Join(cfg.Authority.DataDir, identityPrivateKeyFile)
+		if _, err := os.Lstat(privFile); err != nil {
+			return nil, nil
+		}
+		if k, err = eddsa.Load(privFile, filepath.Join(cfg.Authority.DataDir, identityPublicKeyFile), rand.Reader); err != nil {
+			return nil, err
+		}
+	}
+	defer k.Reset()
+
+	// Copy the public key, as resetting the key pair clobbers it.
+	pk := new(eddsa.PublicKey)
+	if err = pk.FromBytes(k.PublicKey().Bytes()); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// existingLinkKey returns the link public key that the authority would use,
+// or nil if it would be generated at startup.
+func existingLinkKey(cfg *config.Config) (*ecdh.PublicKey, error) {
+	if cfg.Debug.LinkKey != nil {
+		return cfg.Debug.LinkKey.PublicKey(), nil
+	}
+	privFile := filepath.Join(cfg.Authority.DataDir, linkPrivateKeyFile)
+	if _, err := os.Lstat(privFile); err != nil {
+		return nil, nil
+	}
+	k, err := ecdh.Load(privFile, filepath.Join(cfg.Authority.DataDir, linkPublicKeyFile), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Reset()
+
+	pk := new(ecdh.PublicKey)
+	if err = pk.FromBytes(k.PublicKey().Bytes()); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
@@ -0,0 +1,107 @@
+// validate_test.go - Katzenpost voting authority configuration validation tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	require := require.New(t)
+
+	dataDir, err := ioutil.TempDir("", "authority")
+	require.NoError(err)
+	defer os.RemoveAll(dataDir)
+	ownKey, err := GenerateKeys(&config.Config{Authority: &config.Authority{DataDir: dataDir}})
+	require.NoError(err)
+
+	const base = `
+[Authority]
+  Addresses = [ "127.0.0.1:29483" ]
+  DataDir = "%s"
+
+[[Mixes]]
+  IdentityKey = "BEEF95721381C0756D28954524BB1D090F54C8DD9295F84B1D8A93F1E3C17AD8"
+`
+	const peer = `
+[[Authorities]]
+  IdentityPublicKey = "%s"
+  LinkPublicKey = "%s"
+  Addresses = [ "%s" ]
+`
+	genPeer := func(addr string) string {
+		idKey, err := eddsa.NewKeypair(rand.Reader)
+		require.NoError(err)
+		linkKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		return fmt.Sprintf(peer, idKey.PublicKey(), linkKey.PublicKey(), addr)
+	}
+	cfgFile := filepath.Join(dataDir, "authority.toml")
+	validate := func(peers ...string) error {
+		b := fmt.Sprintf(base, dataDir)
+		for _, v := range peers {
+			b += v
+		}
+		require.NoError(ioutil.WriteFile(cfgFile, []byte(b), 0600))
+		return ValidateConfigFile(cfgFile)
+	}
+
+	// A well formed configuration, with or without peers, is valid.
+	require.NoError(validate())
+	require.NoError(validate(genPeer("127.0.0.1:29484"), genPeer("authority.example.org:29483")))
+
+	// As validation has no side effects, keys that do not exist yet are
+	// not generated.
+	_, err = os.Stat(filepath.Join(dataDir, linkPrivateKeyFile))
+	require.True(os.IsNotExist(err))
+
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	dup := genPeer("127.0.0.1:29484")
+	for _, v := range [][]string{
+		// The authority itself.
+		{fmt.Sprintf(peer, ownKey, linkKey.PublicKey(), "127.0.0.1:29484")},
+		// A peer at one of the authority's own addresses.
+		{genPeer("127.0.0.1:29483")},
+		// The same peer twice.
+		{dup, dup},
+		// A peer with an invalid address.
+		{genPeer("127.0.0.1")},
+	} {
+		require.Error(validate(v...), "%v", v)
+	}
+
+	// Configurations that fail to load are invalid.
+	require.NoError(ioutil.WriteFile(cfgFile, []byte(fmt.Sprintf(base, dataDir)+"\n[Bogus]\n  Key = 1\n"), 0600))
+	require.Error(ValidateConfigFile(cfgFile))
+	require.Error(ValidateConfigFile(filepath.Join(dataDir, "missing.toml")))
+
+	// So are DataDirs that the authority would refuse to start with.
+	require.NoError(validate())
+	require.NoError(os.Chmod(dataDir, 0755))
+	require.Error(validate())
+}
@@ -0,0 +1,93 @@
+// watchdog.go - Katzenpost voting authority stalled round watchdog.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/katzenpost/core/worker"
+)
+
+// stallWatchdog observes the progress of the voting state machine, and
+// reports when it fails to run within margin of the time it was scheduled
+// to.  It only ever reads the progress reported to it, and never takes the
+// state lock, so that it keeps working if the state machine deadlocks.
+type stallWatchdog struct {
+	sync.Mutex
+	worker.Worker
+
+	margin  time.Duration
+	onStall func(state string, epoch uint64, deadline time.Time)
+
+	state    string
+	epoch    uint64
+	deadline time.Time
+	alerted  bool
+}
+
+// progress records that the state machine is in state, voting for epoch,
+// and will next run at deadline.
+func (w *stallWatchdog) progress(state string, epoch uint64, deadline time.Time) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.state = state
+	w.epoch = epoch
+	w.deadline = deadline
+	w.alerted = false
+}
+
+func (w *stallWatchdog) check(now time.Time) {
+	w.Lock()
+	if w.alerted || w.deadline.IsZero() || now.Before(w.deadline.Add(w.margin)) {
+		w.Unlock()
+		return
+	}
+	w.alerted = true // Only alert once per stall.
+	state, epoch, deadline := w.state, w.epoch, w.deadline
+	w.Unlock()
+
+	w.onStall(state, epoch, deadline)
+}
+
+func (w *stallWatchdog) worker() {
+	interval := w.margin / 2
+	if interval > time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.HaltCh():
+			return
+		case now := <-t.C:
+			w.check(now)
+		}
+	}
+}
+
+func newStallWatchdog(margin time.Duration, onStall func(string, uint64, time.Time)) *stallWatchdog {
+	w := &stallWatchdog{
+		margin:  margin,
+		onStall: onStall,
+	}
+	w.Go(w.worker)
+	return w
+}
@@ -0,0 +1,58 @@
+// watchdog_test.go - Voting authority stalled round watchdog tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallWatchdog(t *testing.T) {
+	require := require.New(t)
+
+	type stall struct {
+		state string
+		epoch uint64
+	}
+	stallCh := make(chan stall, 10)
+	w := newStallWatchdog(50*time.Millisecond, func(state string, epoch uint64, deadline time.Time) {
+		stallCh <- stall{state, epoch}
+	})
+	defer w.Halt()
+
+	// A state machine that keeps making progress never triggers an alert.
+	for i := 0; i < 10; i++ {
+		w.progress(stateAcceptVote, 23, time.Now().Add(20*time.Millisecond))
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.Len(stallCh, 0)
+
+	// Stall a phase, by not reporting progress past the deadline.
+	w.progress(stateAcceptReveal, 23, time.Now())
+	select {
+	case s := <-stallCh:
+		require.Equal(stall{stateAcceptReveal, 23}, s)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stall was not detected")
+	}
+
+	// The stall is only reported once.
+	time.Sleep(200 * time.Millisecond)
+	require.Len(stallCh, 0)
+}
@@ -0,0 +1,244 @@
+// whitelist.go - Katzenpost voting authority whitelist management.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/pki"
+)
+
+// WhitelistImpact is the effect that a proposed whitelist would have, if it
+// was applied, on the nodes that have uploaded descriptors.
+type WhitelistImpact struct {
+	// Epoch is the epoch of the descriptors the proposed whitelist was
+	// evaluated against.
+	Epoch uint64
+
+	// Added is the list of nodes that the proposed whitelist authorizes,
+	// that the current one does not.  As only authorized nodes may upload
+	// descriptors, none of these have uploaded one yet.
+	Added []*config.Node
+
+	// Removed is the list of accepted descriptors that the proposed
+	// whitelist would exclude.
+	Removed []*pki.MixDescriptor
+
+	// Retained is the list of accepted descriptors that the proposed
+	// whitelist would still authorize.
+	Retained []*pki.MixDescriptor
+
+	// Warnings is the list of minimum requirements for forming a
+	// consensus that would be violated by the proposed whitelist.
+	Warnings []string
+}
+
+// SimulateWhitelist returns the impact of replacing the whitelist with the
+// proposed mixes and providers, evaluated against the most recent epoch's
+// accepted descriptors.  Nothing is applied.
+func (s *Server) SimulateWhitelist(mixes, providers []*config.Node) *WhitelistImpact {
+	return s.state.simulateWhitelist(mixes, providers)
+}
+
+func (s *state) simulateWhitelist(mixes, providers []*config.Node) *WhitelistImpact {
+	s.RLock()
+	defer s.RUnlock()
+
+	proposedMixes := make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, v := range mixes {
+		proposedMixes[v.IdentityKey.ByteArray()] = true
+	}
+	proposedProviders := make(map[[eddsa.PublicKeySize]byte]string)
+	for _, v := range providers {
+		proposedProviders[v.IdentityKey.ByteArray()] = v.Identifier
+	}
+
+	impact := new(WhitelistImpact)
+	for _, v := range mixes {
+		if !s.authorizedMixes[v.IdentityKey.ByteArray()] {
+			impact.Added = append(impact.Added, v)
+		}
+	}
+	for _, v := range providers {
+		if name, ok := s.authorizedProviders[v.IdentityKey.ByteArray()]; !ok || name != v.Identifier {
+			impact.Added = append(impact.Added, v)
+		}
+	}
+
+	for e := range s.descriptors {
+		if e > impact.Epoch {
+			impact.Epoch = e
+		}
+	}
+	descs := make([]*descriptor, 0, len(s.descriptors[impact.Epoch]))
+	for _, v := range s.descriptors[impact.Epoch] {
+		descs = append(descs, v)
+	}
+	sortNodesByPublicKey(descs)
+
+	nrProviders, nrMixes := 0, 0
+	for _, v := range descs {
+		if !isAuthorized(v.desc, proposedMixes, proposedProviders) {
+			impact.Removed = append(impact.Removed, v.desc)
+			continue
+		}
+		impact.Retained = append(impact.Retained, v.desc)
+		if v.desc.Layer == pki.LayerProvider {
+			nrProviders++
+		} else {
+			nrMixes++
+		}
+	}
+
+	// These mirror the checks done at startup, and before voting.
+	minNodes := s.s.cfg.Parameters.Layers * s.s.cfg.Debug.MinNodesPerLayer
+	if len(providers) < 1 {
+		impact.Warnings = append(impact.Warnings, "no Providers are whitelisted")
+	}
+	if len(mixes) < minNodes {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("insufficient Mixes whitelisted, got %v, need %v", len(mixes), minNodes))
+	}
+	if nrProviders < 1 {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("no accepted Provider descriptors for epoch %v would remain", impact.Epoch))
+	}
+	if nrMixes < minNodes {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("insufficient accepted Mix descriptors for epoch %v would remain, got %v, need %v", impact.Epoch, nrMixes, minNodes))
+	}
+	return impact
+}
+
+// ReloadWhitelist replaces the mix and provider whitelist with the one in
+// cfg, typically a freshly loaded copy of the configuration file, without
+// interrupting the authority.  The new whitelist is used from the next voting
+// round on, and accepted descriptors that it no longer authorizes are
+// discarded for every epoch that has not been voted on yet.
+//
+// Only the whitelist is reloaded.  If the authority peers in cfg differ from
+// the running configuration, ErrPeersChanged is returned and nothing is
+// applied, as the peers can only be changed with a restart.
+func (s *Server) ReloadWhitelist(cfg *config.Config) (*WhitelistImpact, error) {
+	if err := diffPeers(s.cfg.Authorities, cfg.Authorities); err != nil {
+		s.log.Errorf("Refusing to reload the whitelist, restart to change the authority peers: %v", err)
+		return nil, ErrPeersChanged
+	}
+	if err := validateWhitelist(cfg.Mixes, cfg.Providers, s.cfg.Parameters.Layers, s.cfg.Debug); err != nil {
+		s.log.Errorf("Refusing to reload the whitelist: %v", err)
+		return nil, err
+	}
+
+	impact := s.state.reloadWhitelist(cfg.Mixes, cfg.Providers)
+	for _, v := range impact.Added {
+		s.log.Noticef("Whitelist reload: authorized node: %v", v.IdentityKey)
+	}
+	for _, v := range impact.Removed {
+		s.log.Noticef("Whitelist reload: deauthorized node: %v", v.IdentityKey)
+	}
+	for _, w := range impact.Warnings {
+		s.log.Warningf("Whitelist reload: %v", w)
+	}
+	s.log.Noticef("Whitelist reloaded: %v Mixes, %v Providers.", len(cfg.Mixes), len(cfg.Providers))
+	return impact, nil
+}
+
+func (s *state) reloadWhitelist(mixes, providers []*config.Node) *WhitelistImpact {
+	impact := s.simulateWhitelist(mixes, providers)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.authorizedMixes = make(map[[eddsa.PublicKeySize]byte]bool)
+	for _, v := range mixes {
+		s.authorizedMixes[v.IdentityKey.ByteArray()] = true
+	}
+	s.authorizedProviders = make(map[[eddsa.PublicKeySize]byte]string)
+	for _, v := range providers {
+		s.authorizedProviders[v.IdentityKey.ByteArray()] = v.Identifier
+	}
+	s.mixLayers = pinnedLayers(mixes)
+
+	// Descriptors that are already part of a vote stay, the rest must be
+	// authorized by the new whitelist.
+	for epoch, descs := range s.descriptors {
+		if s.voted(epoch) {
+			continue
+		}
+		for pk, v := range descs {
+			if !s.isDescriptorAuthorized(v.desc) {
+				s.log.Debugf("Discarding descriptor for epoch %v: %v", epoch, v.desc.IdentityKey)
+				delete(descs, pk)
+			}
+		}
+	}
+	return impact
+}
+
+// diffPeers returns a descriptive error if the authority peers in proposed
+// differ from current in any identity key, link key or address.
+func diffPeers(current, proposed []*config.AuthorityPeer) error {
+	if len(current) != len(proposed) {
+		return fmt.Errorf("got %v peers, running with %v", len(proposed), len(current))
+	}
+	peers := make(map[[eddsa.PublicKeySize]byte]*config.AuthorityPeer)
+	for _, v := range current {
+		peers[v.IdentityPublicKey.ByteArray()] = v
+	}
+	for _, v := range proposed {
+		peer, ok := peers[v.IdentityPublicKey.ByteArray()]
+		if !ok {
+			return fmt.Errorf("unknown peer %v", v.IdentityPublicKey)
+		}
+		if !peer.LinkPublicKey.Equal(v.LinkPublicKey) {
+			return fmt.Errorf("peer %v link key changed", v.IdentityPublicKey)
+		}
+		if !sameAddresses(peer.Addresses, v.Addresses) {
+			return fmt.Errorf("peer %v addresses changed", v.IdentityPublicKey)
+		}
+		if !sameKey(peer.NextIdentityPublicKey, v.NextIdentityPublicKey) {
+			return fmt.Errorf("peer %v next identity key changed", v.IdentityPublicKey)
+		}
+		if peer.Observer != v.Observer {
+			return fmt.Errorf("peer %v observer flag changed", v.IdentityPublicKey)
+		}
+	}
+	return nil
+}
+
+func sameKey(a, b *eddsa.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b)
+}
+
+func sameAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
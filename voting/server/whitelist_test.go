@@ -0,0 +1,143 @@
+// whitelist_test.go - Voting authority whitelist simulation tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateWhitelist(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Accept descriptors from the whitelisted mix and provider.
+	epoch, _, _ := epochtime.Now()
+	mix, provider := cfg.Mixes[0], cfg.Providers[0]
+	mixDesc := &pki.MixDescriptor{IdentityKey: mix.IdentityKey, Layer: 0}
+	providerDesc := &pki.MixDescriptor{IdentityKey: provider.IdentityKey, Name: provider.Identifier, Layer: pki.LayerProvider}
+	s.state.Lock()
+	s.state.descriptors[epoch] = map[[eddsa.PublicKeySize]byte]*descriptor{
+		mix.IdentityKey.ByteArray():      {desc: mixDesc},
+		provider.IdentityKey.ByteArray(): {desc: providerDesc},
+	}
+	s.state.Unlock()
+
+	// The current whitelist has no impact.
+	impact := s.SimulateWhitelist(cfg.Mixes, cfg.Providers)
+	require.Equal(epoch, impact.Epoch)
+	require.Empty(impact.Added)
+	require.Empty(impact.Removed)
+	require.Len(impact.Retained, 2)
+	require.Empty(impact.Warnings)
+
+	// Replacing the mix removes its descriptor, and leaves too few mixes to
+	// form a consensus.
+	newMix := genTestNode(require, "")
+	impact = s.SimulateWhitelist([]*config.Node{newMix}, cfg.Providers)
+	require.Equal([]*config.Node{newMix}, impact.Added)
+	require.Equal([]*pki.MixDescriptor{mixDesc}, impact.Removed)
+	require.Equal([]*pki.MixDescriptor{providerDesc}, impact.Retained)
+	require.Len(impact.Warnings, 1)
+
+	// Renaming the provider also excludes its descriptor.
+	renamed := &config.Node{Identifier: "renamed.example.org", IdentityKey: provider.IdentityKey}
+	impact = s.SimulateWhitelist(cfg.Mixes, []*config.Node{renamed})
+	require.Equal([]*config.Node{renamed}, impact.Added)
+	require.Equal([]*pki.MixDescriptor{providerDesc}, impact.Removed)
+	require.Len(impact.Warnings, 1)
+
+	// Nothing was applied.
+	require.True(s.state.isDescriptorAuthorized(mixDesc))
+	require.True(s.state.isDescriptorAuthorized(providerDesc))
+}
+
+func TestReloadWhitelist(t *testing.T) {
+	require := require.New(t)
+
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour
+
+	s, err := New(cfg)
+	require.NoError(err, "New()")
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Accept descriptors for an epoch that has not been voted on yet.
+	epoch, _, _ := epochtime.Now()
+	epoch++
+	mix, provider := cfg.Mixes[0], cfg.Providers[0]
+	mixDesc := &pki.MixDescriptor{IdentityKey: mix.IdentityKey, Layer: 0}
+	providerDesc := &pki.MixDescriptor{IdentityKey: provider.IdentityKey, Name: provider.Identifier, Layer: pki.LayerProvider}
+	s.state.Lock()
+	s.state.descriptors[epoch] = map[[eddsa.PublicKeySize]byte]*descriptor{
+		mix.IdentityKey.ByteArray():      {desc: mixDesc},
+		provider.IdentityKey.ByteArray(): {desc: providerDesc},
+	}
+	s.state.Unlock()
+
+	// Changing the authority peers requires a restart.
+	newCfg := *cfg
+	newMix := genTestNode(require, "")
+	newCfg.Mixes = []*config.Node{newMix}
+	newCfg.Authorities = []*config.AuthorityPeer{{
+		IdentityPublicKey: newMix.IdentityKey,
+		LinkPublicKey:     newMix.IdentityKey.ToECDH(),
+		Addresses:         []string{"127.0.0.1:1234"},
+	}}
+	_, err = s.ReloadWhitelist(&newCfg)
+	require.Equal(ErrPeersChanged, err)
+	require.True(s.state.isDescriptorAuthorized(mixDesc))
+
+	// So does an insufficient whitelist.
+	newCfg.Authorities = nil
+	newCfg.Mixes = nil
+	_, err = s.ReloadWhitelist(&newCfg)
+	require.Error(err)
+	require.True(s.state.isDescriptorAuthorized(mixDesc))
+
+	// Replacing the mix applies, and discards its descriptor.
+	newCfg.Mixes = []*config.Node{newMix}
+	impact, err := s.ReloadWhitelist(&newCfg)
+	require.NoError(err)
+	require.Equal([]*config.Node{newMix}, impact.Added)
+	require.Equal([]*pki.MixDescriptor{mixDesc}, impact.Removed)
+	require.False(s.state.isDescriptorAuthorized(mixDesc))
+	require.True(s.state.isDescriptorAuthorized(providerDesc))
+	require.True(s.state.isDescriptorAuthorized(&pki.MixDescriptor{IdentityKey: newMix.IdentityKey}))
+
+	s.state.RLock()
+	defer s.state.RUnlock()
+	require.Len(s.state.descriptors[epoch], 1)
+	require.Contains(s.state.descriptors[epoch], provider.IdentityKey.ByteArray())
+}
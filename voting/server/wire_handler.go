@@ -17,17 +17,82 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/cert"
 	"github.com/katzenpost/core/crypto/eddsa"
 	"github.com/katzenpost/core/crypto/rand"
-	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
 	"github.com/katzenpost/core/wire"
 	"github.com/katzenpost/core/wire/commands"
 )
 
+// maxCommandOverhead is the number of bytes that a command takes on the
+// wire, in addition to its payload, with plenty of room to spare.
+const maxCommandOverhead = 4096
+
+var errReadLimit = errors.New("authority: peer exceeded the read limit")
+
+// limitedConn is a net.Conn whose reads fail once the limit set with
+// setLimit is exhausted, so that a peer can not make the authority read
+// more than the largest command it accepts from the peer.
+type limitedConn struct {
+	net.Conn
+	limited   bool
+	remaining int
+}
+
+// setLimit limits the bytes read from now on to n, or lifts the limit if n
+// is not positive.
+func (c *limitedConn) setLimit(n int) {
+	c.limited = n > 0
+	c.remaining = n
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	if !c.limited {
+		return c.Conn.Read(b)
+	}
+	if c.remaining <= 0 {
+		return 0, errReadLimit
+	}
+	if len(b) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.Conn.Read(b)
+	c.remaining -= n
+	return n, err
+}
+
+// readLimit returns the number of bytes that the peer authenticated by auth
+// may send after the handshake, or 0 for no limit.  Each connection carries
+// a single command, so this bounds the encrypted wire frames of the command
+// by the Debug.MaxDescriptorSize or Debug.MaxDocumentSize of its payload,
+// before anything is decrypted or deserialized.
+func (s *Server) readLimit(auth *wireAuthenticator) int {
+	var max int
+	switch {
+	case auth.isAuthority:
+		max = s.cfg.Debug.MaxDocumentSize
+	case auth.isMix:
+		max = s.cfg.Debug.MaxDescriptorSize
+	default:
+		// Clients only ever send GetConsensus, which has no payload.
+		return maxCommandOverhead
+	}
+	if max <= 0 {
+		return 0
+	}
+	return max + maxCommandOverhead
+}
+
 func (s *Server) onConn(conn net.Conn) {
 	const (
 		initialDeadline  = 30 * time.Second
@@ -37,8 +102,10 @@ func (s *Server) onConn(conn net.Conn) {
 	rAddr := conn.RemoteAddr()
 	s.log.Debugf("Accepted new connection: %v", rAddr)
 
+	// The listener counted the connection as opened.
 	defer func() {
 		conn.Close()
+		s.connClosed()
 		s.Done()
 	}()
 
@@ -58,11 +125,13 @@ func (s *Server) onConn(conn net.Conn) {
 	defer wireConn.Close()
 
 	// Handshake.
+	lconn := &limitedConn{Conn: conn}
 	conn.SetDeadline(time.Now().Add(initialDeadline))
-	if err = wireConn.Initialize(conn); err != nil {
+	if err = wireConn.Initialize(lconn); err != nil {
 		s.log.Debugf("Peer %v: Failed session handshake: %v", rAddr, err)
 		return
 	}
+	lconn.setLimit(s.readLimit(auth))
 
 	// Receive a command.
 	cmd, err := wireConn.RecvCommand()
@@ -79,7 +148,7 @@ func (s *Server) onConn(conn net.Conn) {
 	} else if auth.isMix {
 		resp = s.onMix(rAddr, cmd, auth.peerIdentityKey)
 	} else if auth.isAuthority {
-		resp = s.onAuthority(rAddr, cmd)
+		resp = s.onAuthority(rAddr, cmd, auth.peerIdentityKey)
 	} else {
 		panic("wtf") // should only happen if there is a bug in wireAuthenticator
 	}
@@ -121,19 +190,19 @@ func (s *Server) onMix(rAddr net.Addr, cmd commands.Command, peerIdentityKey *ed
 	return resp
 }
 
-func (s *Server) onAuthority(rAddr net.Addr, cmd commands.Command) commands.Command {
+func (s *Server) onAuthority(rAddr net.Addr, cmd commands.Command, peerIdentityKey *eddsa.PublicKey) commands.Command {
 	s.log.Debug("onAuthority")
 	var resp commands.Command
 	switch c := cmd.(type) {
 	case *commands.GetConsensus:
 		resp = s.onGetConsensus(rAddr, c)
 	case *commands.Vote:
-		resp = s.onVote(c)
+		resp = s.onVote(c, peerIdentityKey)
 	case *commands.VoteStatus:
 		s.log.Error("VoteStatus command is not allowed on Authority wire service listener.")
 		return nil
 	case *commands.Reveal:
-		resp = s.onReveal(c)
+		resp = s.onReveal(c, peerIdentityKey)
 	case *commands.RevealStatus:
 		s.log.Error("RevealStatus command is not allowed on Authority wire service listener.")
 		return nil
@@ -144,11 +213,24 @@ func (s *Server) onAuthority(rAddr net.Addr, cmd commands.Command) commands.Comm
 	return resp
 }
 
-func (s *Server) onVote(cmd *commands.Vote) commands.Command {
+func (s *Server) onVote(cmd *commands.Vote, peerIdentityKey *eddsa.PublicKey) commands.Command {
+	// Peers only relay their own votes and signatures.
+	if !cmd.PublicKey.Equal(peerIdentityKey) {
+		s.log.Errorf("Vote from Authority %v sent by %v", cmd.PublicKey, peerIdentityKey)
+		return &commands.VoteStatus{ErrorCode: commands.VoteNotAuthorized}
+	}
+	if max := s.cfg.Debug.MaxDocumentSize; max > 0 && len(cmd.Payload) > max {
+		s.log.Errorf("Vote from Authority %v is %v bytes, exceeding MaxDocumentSize", cmd.PublicKey, len(cmd.Payload))
+		return &commands.VoteStatus{ErrorCode: commands.VoteMalformed}
+	}
 	return s.state.onVoteUpload(cmd)
 }
 
-func (s *Server) onReveal(cmd *commands.Reveal) commands.Command {
+func (s *Server) onReveal(cmd *commands.Reveal, peerIdentityKey *eddsa.PublicKey) commands.Command {
+	if !cmd.PublicKey.Equal(peerIdentityKey) {
+		s.log.Errorf("Reveal from Authority %v sent by %v", cmd.PublicKey, peerIdentityKey)
+		return &commands.RevealStatus{ErrorCode: commands.RevealNotAuthorized}
+	}
 	return s.state.onRevealUpload(cmd)
 }
 
@@ -166,26 +248,120 @@ func (s *Server) onGetConsensus(rAddr net.Addr, cmd *commands.GetConsensus) comm
 	} else {
 		s.log.Debugf("Peer: %v: Serving document for epoch %v.", rAddr, cmd.Epoch)
 		resp.ErrorCode = commands.ConsensusOk
-		resp.Payload = doc.raw
+		resp.Payload = doc.raw // Shared, read-only.
 	}
 	return resp
 }
 
+// DescriptorEpochError is the error returned when a node uploads a
+// descriptor for an epoch that the authority is not accepting descriptors
+// for.
+type DescriptorEpochError struct {
+	// Epoch is the epoch the descriptor was uploaded for.
+	Epoch uint64
+
+	// Now is the authority's current epoch.
+	Now uint64
+}
+
+func (e *DescriptorEpochError) Error() string {
+	return fmt.Sprintf("server: descriptor for epoch %v is not acceptable in epoch %v", e.Epoch, e.Now)
+}
+
+// checkDescriptorEpoch returns a *DescriptorEpochError unless epoch is one
+// that descriptors are accepted for, at elapsed into the current epoch now,
+// with till remaining.  Nodes will always publish the descriptor for the
+// current epoch on launch, which may be off by one period, depending on how
+// skewed the node's clock is and the current time, so the epochs now-1
+// through now+1 are accepted.  Within skew of either end of the epoch, the
+// epoch the node's clock may already or still be in is accepted as well.
+func checkDescriptorEpoch(epoch, now uint64, elapsed, till, skew time.Duration) error {
+	switch {
+	case epoch+1 >= now && epoch <= now+1:
+	case epoch == now+2 && till < skew:
+	case epoch+2 == now && elapsed < skew:
+	default:
+		return &DescriptorEpochError{Epoch: epoch, Now: now}
+	}
+	return nil
+}
+
+// uploadLimiter counts the descriptor uploads by each node identity over
+// the current epoch.
+type uploadLimiter struct {
+	sync.Mutex
+
+	epoch  uint64
+	counts map[[eddsa.PublicKeySize]byte]int
+}
+
+// allow records an upload by pubKey during epoch, and returns true iff the
+// uploads by pubKey during epoch do not exceed limit.  The counts are reset
+// when the epoch changes.
+func (l *uploadLimiter) allow(epoch uint64, pubKey *eddsa.PublicKey, limit int) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.counts == nil || l.epoch != epoch {
+		l.epoch = epoch
+		l.counts = make(map[[eddsa.PublicKeySize]byte]int)
+	}
+	pk := pubKey.ByteArray()
+	l.counts[pk]++
+	return l.counts[pk] <= limit
+}
+
 func (s *Server) onPostDescriptor(rAddr net.Addr, cmd *commands.PostDescriptor, pubKey *eddsa.PublicKey) commands.Command {
 	resp := &commands.PostDescriptorStatus{
 		ErrorCode: commands.DescriptorInvalid,
 	}
 
 	// Ensure the epoch is somewhat sane.
-	now, _, _ := epochtime.Now()
-	switch cmd.Epoch {
-	case now - 1, now, now + 1:
-		// Nodes will always publish the descriptor for the current epoch on
-		// launch, which may be off by one period, depending on how skewed
-		// the node's clock is and the current time.
-	default:
-		// The peer is publishing for an epoch that's invalid.
-		s.log.Errorf("Peer %v: Invalid descriptor epoch '%v'", rAddr, cmd.Epoch)
+	now, elapsed, till := epochNow()
+	skew := time.Duration(s.cfg.Debug.EpochClockSkewTolerance) * time.Second
+	if err := checkDescriptorEpoch(cmd.Epoch, now, elapsed, till, skew); err != nil {
+		s.log.Errorf("Peer %v: Node %v: %v", rAddr, pubKey, err)
+		return resp
+	}
+
+	// Ensure that the descriptor is not excessively large, before parsing
+	// it.
+	if max := s.cfg.Debug.MaxDescriptorSize; max > 0 && len(cmd.Payload) > max {
+		s.log.Errorf("Peer %v: Descriptor is %v bytes, exceeding MaxDescriptorSize", rAddr, len(cmd.Payload))
+		return resp
+	}
+
+	// Ensure that the peer has not exceeded its upload allowance.
+	if limit := s.cfg.Debug.DescriptorUploadRateLimit; limit > 0 {
+		if !s.descUploads.allow(now, pubKey, limit) {
+			s.log.Warningf("Peer %v: Descriptor upload rate limit exceeded for epoch %v", rAddr, now)
+			resp.ErrorCode = commands.DescriptorForbidden
+			return resp
+		}
+	}
+
+	// Ensure that the descriptor carries a sufficient proof-of-work, before
+	// doing anything expensive.
+	if nBits := s.cfg.Debug.SubmissionPoWBits; nBits > 0 {
+		nonce, err := s11n.GetProofOfWorkFromDescriptor(cmd.Payload)
+		if err != nil {
+			s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
+			return resp
+		}
+		if !s11n.VerifyProofOfWork(cmd.Epoch, pubKey, nonce, nBits) {
+			s.log.Errorf("Peer %v: Insufficient proof-of-work for epoch %v", rAddr, cmd.Epoch)
+			return resp
+		}
+	}
+
+	// Ensure that the descriptor is signed with an accepted algorithm.
+	alg, err := s11n.GetSignatureAlgorithmFromDescriptor(cmd.Payload)
+	if err != nil {
+		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
+		return resp
+	}
+	if !s.isSignatureAlgorithmAccepted(alg) {
+		s.log.Errorf("Peer %v: Descriptor signature algorithm '%v' is not accepted", rAddr, alg)
 		return resp
 	}
 
@@ -195,26 +371,69 @@ func (s *Server) onPostDescriptor(rAddr net.Addr, cmd *commands.PostDescriptor,
 		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
 		return resp
 	}
-	desc, err := s11n.VerifyAndParseDescriptor(verifier, cmd.Payload, cmd.Epoch)
+	desc, err := s.verifyAndParseDescriptor(verifier, cmd.Payload, cmd.Epoch)
 	if err != nil {
 		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
 		return resp
 	}
 
-	// Ensure that the descriptor is signed by the peer that is posting.
+	// Ensure that the descriptor is signed by the peer that is posting.  The
+	// link layer handshake proves that the peer controls pubKey (See
+	// wireAuthenticator), so a node can not upload a descriptor for any
+	// other identity, even one that it obtained correctly signed.
 	if !desc.IdentityKey.Equal(pubKey) {
 		s.log.Errorf("Peer %v: Identity key '%v' is not link key '%v'.", rAddr, desc.IdentityKey, pubKey)
 		resp.ErrorCode = commands.DescriptorForbidden
 		return resp
 	}
 
+	// Ensure that the descriptor name is acceptable.
+	if err = config.ValidateIdentifier(desc.Name, s.cfg.Debug.IdentifierPolicy); err != nil {
+		s.log.Errorf("Peer %v: Invalid descriptor name: %v", rAddr, err)
+		return resp
+	}
+
 	// Ensure that the descriptor is from an allowed peer.
-	if !s.state.isDescriptorAuthorized(desc) {
+	s.state.RLock()
+	authorized := s.state.isDescriptorAuthorized(desc)
+	s.state.RUnlock()
+	if !authorized {
 		s.log.Errorf("Peer %v: Identity key '%v' not authorized", rAddr, desc.IdentityKey)
 		resp.ErrorCode = commands.DescriptorForbidden
 		return resp
 	}
 
+	// Ensure that the node is not blacklisted, whitelisted or not.
+	if isBlacklisted(s.cfg.Blacklist, desc.IdentityKey, cmd.Epoch) {
+		s.log.Noticef("Peer %v: Identity key '%v' is blacklisted", rAddr, desc.IdentityKey)
+		resp.ErrorCode = commands.DescriptorForbidden
+		return resp
+	}
+
+	// Ensure that the descriptor does not advertise an excessive number of
+	// addresses.
+	if err = checkAddressLimit(desc, s.cfg.Debug.MaxAddressesPerNode); err != nil {
+		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
+		return resp
+	}
+	if err = checkLoadWeight(desc, s.cfg.Debug.MaxLoadWeight); err != nil {
+		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
+		return resp
+	}
+
+	// Ensure that the advertised transports are acceptable.
+	addrs, err := s.checkTransports(desc)
+	if err != nil {
+		s.log.Errorf("Peer %v: Invalid descriptor: %v", rAddr, err)
+		return resp
+	}
+
+	// Ensure that the descriptor advertises at least one usable address.
+	if err = s.verifyDescriptorAddresses(desc.IdentityKey, addrs); err != nil {
+		s.log.Errorf("Peer %v: Address verification failed: %v", rAddr, err)
+		return resp
+	}
+
 	// Hand the descriptor off to the state worker.  As long as this returns
 	// a nil, the authority "accepts" the descriptor.
 	err = s.state.onDescriptorUpload(cmd.Payload, desc, cmd.Epoch)
@@ -233,6 +452,79 @@ func (s *Server) onPostDescriptor(rAddr net.Addr, cmd *commands.PostDescriptor,
 	return resp
 }
 
+func checkAddressLimit(desc *pki.MixDescriptor, max int) error {
+	n := 0
+	for _, addrs := range desc.Addresses {
+		n += len(addrs)
+	}
+	if n > max {
+		return fmt.Errorf("%d addresses exceeds the limit of %d", n, max)
+	}
+	return nil
+}
+
+// checkLoadWeight returns an error iff the descriptor's advisory LoadWeight
+// exceeds max.
+func checkLoadWeight(desc *pki.MixDescriptor, max int) error {
+	if int(desc.LoadWeight) > max {
+		return fmt.Errorf("LoadWeight %d exceeds the limit of %d", desc.LoadWeight, max)
+	}
+	return nil
+}
+
+// checkTransports returns the descriptor's addresses, iff they are all for
+// transports that are acceptable under Debug.AllowedTransports, and well
+// formed.  As descriptors are self-signed, unacceptable transports can not
+// be stripped before the descriptor is persisted and published, so they
+// are an error.
+func (s *Server) checkTransports(desc *pki.MixDescriptor) (map[pki.Transport][]string, error) {
+	if err := s11n.ValidateAddresses(desc.Addresses); err != nil {
+		return nil, err
+	}
+	allowed := make([]pki.Transport, 0, len(s.cfg.Debug.AllowedTransports))
+	for _, v := range s.cfg.Debug.AllowedTransports {
+		allowed = append(allowed, pki.Transport(v))
+	}
+	addrs, err := s11n.ValidateTransports(desc.Addresses, allowed)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no valid transports for node %v", desc.IdentityKey)
+	}
+	return addrs, nil
+}
+
+func (s *Server) verifyDescriptorAddresses(id *eddsa.PublicKey, addrs map[pki.Transport][]string) error {
+	verifyFn := s.cfg.AddressVerifier
+	if verifyFn == nil {
+		return nil
+	}
+
+	// Check the transports in a stable order, so that the logs are
+	// comparable between authorities.
+	transports := make([]string, 0, len(addrs))
+	for t := range addrs {
+		transports = append(transports, string(t))
+	}
+	sort.Strings(transports)
+
+	nrOk := 0
+	for _, t := range transports {
+		for _, addr := range addrs[pki.Transport(t)] {
+			if err := verifyFn(addr, t); err != nil {
+				s.log.Warningf("Node %v: Ignoring unverified address ['%v']'%v': %v", id, t, addr, err)
+				continue
+			}
+			nrOk++
+		}
+	}
+	if nrOk == 0 {
+		return fmt.Errorf("no verifiable addresses for node %v", id)
+	}
+	return nil
+}
+
 type wireAuthenticator struct {
 	s               *Server
 	peerIdentityKey *eddsa.PublicKey
@@ -259,9 +551,12 @@ func (a *wireAuthenticator) IsPeerValid(creds *wire.PeerCredentials) bool {
 	}
 
 	pk := a.peerIdentityKey.ByteArray()
+	a.s.state.RLock()
 	_, isMix := a.s.state.authorizedMixes[pk]
 	_, isProvider := a.s.state.authorizedProviders[pk]
 	_, isAuthority := a.s.state.authorizedAuthorities[pk]
+	linkKey, hasLinkKey := a.s.state.authorityLinkKeys[pk]
+	a.s.state.RUnlock()
 
 	if isMix || isProvider {
 		linkPk := a.peerIdentityKey.ToECDH()
@@ -272,12 +567,11 @@ func (a *wireAuthenticator) IsPeerValid(creds *wire.PeerCredentials) bool {
 		a.isMix = true // Providers and mixes are both mixes. :)
 		return true
 	} else if isAuthority {
-		linkKey, ok := a.s.state.authorityLinkKeys[pk]
-		if !ok {
+		if !hasLinkKey {
 			a.s.log.Warning("Rejecting authority authentication, no link key entry.")
 			return false
 		}
-		if !linkKey.Equal(creds.PublicKey) {
+		if !a.s.state.checkPeerLinkKey(pk, creds.PublicKey) || !linkKey.Equal(creds.PublicKey) {
 			a.s.log.Warning("Rejecting authority authentication, public key mismatch.")
 			return false
 		}
@@ -290,3 +584,23 @@ func (a *wireAuthenticator) IsPeerValid(creds *wire.PeerCredentials) bool {
 
 	return false // Not reached.
 }
+
+// verifyAndParseDescriptor verifies and deserializes a descriptor uploaded by
+// a node, in the parsing mode selected by Debug.LenientDescriptorParsing.
+func (s *Server) verifyAndParseDescriptor(verifier cert.Verifier, b []byte, epoch uint64) (*pki.MixDescriptor, error) {
+	if s.cfg.Debug.LenientDescriptorParsing {
+		return s11n.VerifyAndParseDescriptor(verifier, b, epoch)
+	}
+	return s11n.VerifyAndParseDescriptorStrict(verifier, b, epoch)
+}
+
+// isSignatureAlgorithmAccepted returns true iff descriptors signed with the
+// given algorithm are accepted under Debug.DescriptorSignatureAlgorithms.
+func (s *Server) isSignatureAlgorithmAccepted(alg string) bool {
+	for _, v := range s.cfg.Debug.DescriptorSignatureAlgorithms {
+		if v == alg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,410 @@
+// wire_handler_test.go - Voting authority connection handler tests.
+// Copyright (C) 2026  The Katzenpost Authors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/katzenpost/authority/internal/s11n"
+	"github.com/katzenpost/authority/voting/server/config"
+	"github.com/katzenpost/core/crypto/ecdh"
+	"github.com/katzenpost/core/crypto/eddsa"
+	"github.com/katzenpost/core/crypto/rand"
+	"github.com/katzenpost/core/epochtime"
+	"github.com/katzenpost/core/pki"
+	"github.com/katzenpost/core/wire"
+	"github.com/katzenpost/core/wire/commands"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAddressLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	desc := &pki.MixDescriptor{
+		Addresses: make(map[pki.Transport][]string),
+	}
+	for i := 0; i < 20; i++ {
+		desc.Addresses[pki.TransportTCPv4] = append(desc.Addresses[pki.TransportTCPv4], fmt.Sprintf("192.0.2.%d:1234", i))
+		desc.Addresses[pki.TransportTCPv6] = append(desc.Addresses[pki.TransportTCPv6], fmt.Sprintf("[2001:db8::%d]:1234", i))
+	}
+
+	// The limit applies to the total across all transports.
+	assert.NoError(checkAddressLimit(desc, 40))
+	assert.Error(checkAddressLimit(desc, 39))
+	assert.Error(checkAddressLimit(desc, 20))
+
+	// Over-limit descriptors are rejected every time, rather than being
+	// accepted in part depending on map iteration order.
+	for i := 0; i < 10; i++ {
+		assert.Error(checkAddressLimit(desc, 30))
+	}
+}
+
+func TestCheckLoadWeight(t *testing.T) {
+	assert := assert.New(t)
+
+	desc := &pki.MixDescriptor{}
+	assert.NoError(checkLoadWeight(desc, 100))
+	desc.LoadWeight = 100
+	assert.NoError(checkLoadWeight(desc, 100))
+	desc.LoadWeight = 101
+	assert.Error(checkLoadWeight(desc, 100))
+}
+
+func TestDescriptorUploadRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	const now = 1000
+	defer pinEpochClock(now, epochtime.Period/2)()
+
+	srv := &Server{
+		cfg: &config.Config{
+			Logging: &config.Logging{Level: "DEBUG"},
+			Debug:   &config.Debug{DescriptorUploadRateLimit: 3},
+		},
+	}
+	assert.NoError(srv.initLogging())
+
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	other, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+
+	// The payload is junk, so uploads within the limit are rejected as
+	// invalid, and uploads beyond it as forbidden, before being parsed.
+	post := func(pk *eddsa.PublicKey) uint8 {
+		cmd := &commands.PostDescriptor{Epoch: now, Payload: []byte("junk")}
+		resp := srv.onPostDescriptor(nil, cmd, pk).(*commands.PostDescriptorStatus)
+		return resp.ErrorCode
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(commands.DescriptorInvalid, post(k.PublicKey()))
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(commands.DescriptorForbidden, post(k.PublicKey()))
+	}
+
+	// Other identities have their own allowance.
+	assert.Equal(commands.DescriptorInvalid, post(other.PublicKey()))
+
+	// The counts are reset at the epoch boundary.
+	assert.False(srv.descUploads.allow(now, k.PublicKey(), 3))
+	assert.True(srv.descUploads.allow(now+1, k.PublicKey(), 3))
+}
+
+func TestCheckTransports(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &config.Config{
+		Logging: &config.Logging{
+			Level: "DEBUG",
+		},
+		Debug: &config.Debug{
+			AllowedTransports: []string{"tcp4", "tcp6", "torv2"},
+		},
+	}
+	s := &Server{cfg: cfg}
+	assert.NoError(s.initLogging())
+
+	desc := &pki.MixDescriptor{
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4:    []string{"192.0.2.1:4242"},
+			s11n.TransportTorV3:   []string{"vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion:443"},
+			pki.Transport("quic"): []string{"192.0.2.1:4242"},
+		},
+	}
+
+	// The invalid transports can not be stripped from the signed
+	// descriptor, so it is rejected, however lenient the configuration.
+	_, err := s.checkTransports(desc)
+	assert.Error(err)
+
+	// Without them, the descriptor is accepted.
+	delete(desc.Addresses, s11n.TransportTorV3)
+	delete(desc.Addresses, pki.Transport("quic"))
+	addrs, err := s.checkTransports(desc)
+	assert.NoError(err)
+	assert.Equal(map[pki.Transport][]string{
+		pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+	}, addrs)
+
+	// A malformed address is rejected.
+	desc.Addresses[s11n.TransportTorV2] = []string{"not-an-onion.example.com:4242"}
+	_, err = s.checkTransports(desc)
+	assert.Error(err)
+	delete(desc.Addresses, s11n.TransportTorV2)
+
+	// A descriptor without any transport is rejected.
+	delete(desc.Addresses, pki.TransportTCPv4)
+	_, err = s.checkTransports(desc)
+	assert.Error(err)
+}
+
+func TestPayloadSizeLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	const now = 1000
+	defer pinEpochClock(now, epochtime.Period/2)()
+
+	raw := genSignedDescriptor(assert, now, 0)
+	srv := &Server{
+		cfg: &config.Config{
+			Logging: &config.Logging{Level: "DEBUG"},
+			Debug: &config.Debug{
+				MaxDescriptorSize: len(raw),
+				MaxDocumentSize:   1024,
+			},
+		},
+	}
+	assert.NoError(srv.initLogging())
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+
+	// A descriptor within the limit is parsed, and found to be signed by
+	// another identity.
+	post := func(payload []byte) uint8 {
+		cmd := &commands.PostDescriptor{Epoch: now, Payload: payload}
+		resp := srv.onPostDescriptor(nil, cmd, k.PublicKey()).(*commands.PostDescriptorStatus)
+		return resp.ErrorCode
+	}
+	assert.Equal(commands.DescriptorForbidden, post(raw))
+
+	// Beyond the limit, it is rejected outright.
+	srv.cfg.Debug.MaxDescriptorSize = len(raw) - 1
+	assert.Equal(commands.DescriptorInvalid, post(raw))
+
+	// Oversized votes are rejected without reaching the state, which
+	// would otherwise verify and parse them.
+	cmd := &commands.Vote{
+		Epoch:     now,
+		PublicKey: k.PublicKey(),
+		Payload:   make([]byte, srv.cfg.Debug.MaxDocumentSize+1),
+	}
+	resp := srv.onVote(cmd, k.PublicKey()).(*commands.VoteStatus)
+	assert.Equal(commands.VoteMalformed, resp.ErrorCode)
+
+	// The connection is not read beyond the limit of what the peer may
+	// send, however much more it does.
+	assert.Equal(1024+maxCommandOverhead, srv.readLimit(&wireAuthenticator{isAuthority: true}))
+	assert.Equal(maxCommandOverhead, srv.readLimit(&wireAuthenticator{isClient: true}))
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		client.Write(make([]byte, 1024*1024))
+	}()
+	lconn := &limitedConn{Conn: server}
+	lconn.setLimit(srv.readLimit(&wireAuthenticator{isAuthority: true}))
+	n, err := io.Copy(ioutil.Discard, lconn)
+	assert.Equal(errReadLimit, err)
+	assert.Equal(int64(1024+maxCommandOverhead), n)
+}
+
+type algorithmSigner struct {
+	*eddsa.PrivateKey
+	algorithm string
+}
+
+func (s *algorithmSigner) KeyType() string {
+	return s.algorithm
+}
+
+func TestDescriptorSignatureAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	const now = 1000
+	defer pinEpochClock(now, epochtime.Period/2)()
+
+	srv := &Server{
+		cfg: &config.Config{
+			Logging: &config.Logging{Level: "DEBUG"},
+			Debug: &config.Debug{
+				DescriptorSignatureAlgorithms: []string{s11n.SignatureAlgorithmEd25519},
+			},
+		},
+	}
+	assert.NoError(srv.initLogging())
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	post := func(payload []byte) uint8 {
+		cmd := &commands.PostDescriptor{Epoch: now, Payload: payload}
+		resp := srv.onPostDescriptor(nil, cmd, k.PublicKey()).(*commands.PostDescriptorStatus)
+		return resp.ErrorCode
+	}
+
+	// An Ed25519 descriptor is verified, and found to be signed by another
+	// identity.
+	assert.Equal(commands.DescriptorForbidden, post(genSignedDescriptor(assert, now, 0)))
+
+	// A descriptor signed with an unknown algorithm is rejected.
+	identityKey, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	mixKey, err := ecdh.NewKeypair(rand.Reader)
+	assert.NoError(err)
+	desc := &pki.MixDescriptor{
+		Name:        "node.example.org",
+		IdentityKey: identityKey.PublicKey(),
+		LinkKey:     linkKey.PublicKey(),
+		MixKeys:     map[uint64]*ecdh.PublicKey{now: mixKey.PublicKey()},
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+	}
+	signed, err := s11n.SignDescriptor(&algorithmSigner{identityKey, "unknown-algorithm"}, desc)
+	assert.NoError(err)
+	assert.Equal(commands.DescriptorInvalid, post(signed))
+
+	// Ed25519 descriptors are rejected once the algorithm is no longer
+	// accepted, at the end of a migration.
+	srv.cfg.Debug.DescriptorSignatureAlgorithms = []string{"newer-algorithm"}
+	assert.Equal(commands.DescriptorInvalid, post(genSignedDescriptor(assert, now, 0)))
+}
+
+func TestCheckDescriptorEpoch(t *testing.T) {
+	assert := assert.New(t)
+
+	const now = 1000
+	mid := epochtime.Period / 2
+	skew := 30 * time.Second
+	for _, epoch := range []uint64{now - 1, now, now + 1} {
+		assert.NoError(checkDescriptorEpoch(epoch, now, mid, mid, skew), "%v", epoch)
+	}
+	for _, epoch := range []uint64{0, now - 2, now + 2, now + 23} {
+		err := checkDescriptorEpoch(epoch, now, mid, mid, skew)
+		assert.Equal(&DescriptorEpochError{Epoch: epoch, Now: now}, err, "%v", epoch)
+	}
+
+	// Near the epoch boundaries, skewed clocks may be an epoch ahead or
+	// behind.
+	assert.NoError(checkDescriptorEpoch(now+2, now, epochtime.Period-skew/2, skew/2, skew))
+	assert.Error(checkDescriptorEpoch(now+2, now, epochtime.Period-skew/2, skew/2, 0))
+	assert.NoError(checkDescriptorEpoch(now-2, now, skew/2, epochtime.Period-skew/2, skew))
+	assert.Error(checkDescriptorEpoch(now+3, now, epochtime.Period-skew/2, skew/2, skew))
+}
+
+func TestDescriptorEpoch(t *testing.T) {
+	assert := assert.New(t)
+
+	const now = 1000
+	defer pinEpochClock(now, epochtime.Period/2)()
+
+	srv := &Server{
+		cfg: &config.Config{
+			Logging: &config.Logging{Level: "DEBUG"},
+			Debug:   &config.Debug{},
+		},
+	}
+	assert.NoError(srv.initLogging())
+	k, err := eddsa.NewKeypair(rand.Reader)
+	assert.NoError(err)
+
+	// A descriptor for an acceptable epoch gets as far as being found to
+	// be signed by another identity.
+	post := func(epoch uint64) uint8 {
+		cmd := &commands.PostDescriptor{Epoch: epoch, Payload: genSignedDescriptor(assert, epoch, 0)}
+		resp := srv.onPostDescriptor(nil, cmd, k.PublicKey()).(*commands.PostDescriptorStatus)
+		return resp.ErrorCode
+	}
+	assert.Equal(commands.DescriptorForbidden, post(now+1))
+
+	// One for a future or a stale epoch is rejected before being parsed.
+	assert.Equal(commands.DescriptorInvalid, post(now+2))
+	assert.Equal(commands.DescriptorInvalid, post(now-2))
+}
+
+type acceptingAuthenticator struct{}
+
+func (a *acceptingAuthenticator) IsPeerValid(creds *wire.PeerCredentials) bool {
+	return true
+}
+
+func TestDescriptorUploadIdentity(t *testing.T) {
+	require := require.New(t)
+
+	const now = 1000
+	defer pinEpochClock(now, epochtime.Period/2)()
+
+	nodeKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	otherKey, err := eddsa.NewKeypair(rand.Reader)
+	require.NoError(err)
+	cfg := genTestConfig(require)
+	defer os.RemoveAll(cfg.Authority.DataDir)
+	cfg.Debug.StartupWarmup = time.Hour // Keep the worker from driving the FSM.
+	cfg.Mixes = []*config.Node{
+		{IdentityKey: nodeKey.PublicKey()},
+		{IdentityKey: otherKey.PublicKey()},
+	}
+	s, err := New(cfg)
+	require.NoError(err)
+	defer s.Wait()
+	defer s.Shutdown()
+
+	// Upload the descriptor over a link authenticated with identityKey.
+	post := func(identityKey *eddsa.PrivateKey, payload []byte) uint8 {
+		conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+		require.NoError(err)
+		defer conn.Close()
+		linkKey := identityKey.ToECDH()
+		session, err := wire.NewSession(&wire.SessionConfig{
+			Authenticator:     &acceptingAuthenticator{},
+			AdditionalData:    identityKey.PublicKey().Bytes(),
+			AuthenticationKey: linkKey,
+			RandomReader:      rand.Reader,
+		}, true)
+		require.NoError(err)
+		defer session.Close()
+		require.NoError(session.Initialize(conn))
+		require.NoError(session.SendCommand(&commands.PostDescriptor{Epoch: now, Payload: payload}))
+		resp, err := session.RecvCommand()
+		require.NoError(err)
+		require.IsType(&commands.PostDescriptorStatus{}, resp)
+		return resp.(*commands.PostDescriptorStatus).ErrorCode
+	}
+
+	// The other node's descriptor, correctly signed by it.
+	linkKey, err := ecdh.NewKeypair(rand.Reader)
+	require.NoError(err)
+	desc := &pki.MixDescriptor{
+		Name:        "node.example.org",
+		IdentityKey: otherKey.PublicKey(),
+		LinkKey:     linkKey.PublicKey(),
+		MixKeys:     make(map[uint64]*ecdh.PublicKey),
+		Addresses: map[pki.Transport][]string{
+			pki.TransportTCPv4: []string{"192.0.2.1:4242"},
+		},
+	}
+	for e := uint64(now); e < now+3; e++ {
+		mixKey, err := ecdh.NewKeypair(rand.Reader)
+		require.NoError(err)
+		desc.MixKeys[e] = mixKey.PublicKey()
+	}
+	signed, err := s11n.SignDescriptor(otherKey, desc)
+	require.NoError(err)
+
+	// Another node can not upload it, while the node itself can.
+	require.Equal(commands.DescriptorForbidden, post(nodeKey, signed))
+	require.Equal(commands.DescriptorOk, post(otherKey, signed))
+}